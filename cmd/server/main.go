@@ -8,9 +8,10 @@ import (
 	"syscall"
 	"time"
 
-	"google.golang.org/grpc"
+	"go.opentelemetry.io/otel"
 
 	"github.com/bentalebwael/faceit-users-service/internal/api"
+	"github.com/bentalebwael/faceit-users-service/internal/api/commands"
 	grpcapi "github.com/bentalebwael/faceit-users-service/internal/api/grpc"
 	"github.com/bentalebwael/faceit-users-service/internal/api/grpc/interceptors"
 	restapi "github.com/bentalebwael/faceit-users-service/internal/api/rest"
@@ -22,9 +23,11 @@ import (
 	"github.com/bentalebwael/faceit-users-service/internal/platform/postgres"
 	"github.com/bentalebwael/faceit-users-service/internal/platform/ratelimiter"
 	"github.com/bentalebwael/faceit-users-service/internal/platform/redis"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
 	"github.com/bentalebwael/faceit-users-service/internal/platform/tracer"
 	"github.com/bentalebwael/faceit-users-service/internal/repository/cache"
 	"github.com/bentalebwael/faceit-users-service/internal/repository/database"
+	"github.com/bentalebwael/faceit-users-service/migrations"
 )
 
 func main() {
@@ -37,6 +40,15 @@ func main() {
 	// Initialize logger
 	log := logger.NewLogger(cfg)
 
+	// Run the migrate subcommand instead of the server when asked to
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, log, os.Args[2:]); err != nil {
+			log.Error("migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize tracer
 	tp, err := tracer.NewTracerProvider(cfg)
 	if err != nil {
@@ -61,6 +73,22 @@ func main() {
 	defer postgres.Close(db)
 	log.Info("Database connection established")
 
+	// Apply pending schema migrations when enabled. Replicas starting together
+	// take turns on an advisory lock, so each migration runs once.
+	migrator, err := postgres.NewMigrator(db, migrations.FS)
+	if err != nil {
+		log.Error("failed to load schema migrations", "error", err)
+		os.Exit(1)
+	}
+	if cfg.DB.AutoMigrate {
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Error("failed to apply schema migrations", "error", err)
+			os.Exit(1)
+		}
+		log.Info("Schema migrations applied", "count", applied)
+	}
+
 	// Initialize Redis client
 	redisClient, err := redis.NewClient(cfg)
 	if err != nil {
@@ -80,22 +108,65 @@ func main() {
 	defer kafkaPlatform.Close(kafkaWriter) // Use alias
 	log.Info("Kafka producer initialized")
 
+	// Initialize the writer handing password reset tokens to the mailer
+	resetWriter, err := kafkaPlatform.NewResetWriter(cfg, log)
+	if err != nil {
+		log.Error("failed to create kafka password reset writer", "error", err)
+		os.Exit(1)
+	}
+	defer kafkaPlatform.Close(resetWriter)
+
+	// Initialize the encoder of the events published to Kafka
+	eventEncoder, err := events.NewEncoder(&cfg.Kafka)
+	if err != nil {
+		log.Error("failed to initialize event encoder", "error", err)
+		os.Exit(1)
+	}
+	log.Info("Event encoder initialized", "encoding", cfg.Kafka.EventEncoding, "schema_version", cfg.Kafka.EventSchemaVersion)
+
+	// Initialize access token manager
+	tokens, err := token.NewManager(cfg)
+	if err != nil {
+		log.Error("failed to initialize token manager", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize rate limiter
-	limiter := ratelimiter.NewLimiter(cfg)
-	log.Info("Rate limiter initialized")
+	limiter := ratelimiter.NewLimiter(cfg, ratelimiter.WithRedis(redisClient), ratelimiter.WithTokens(tokens))
+	log.Info("Rate limiter initialized", "backend", cfg.Rate.Backend)
 
-	// Initialize repositories and event publisher
-	userRepo := database.NewUserRepository(db)
+	// Initialize repositories and event publisher. Events are written to the
+	// outbox in the same transaction as the user and relayed to Kafka later.
+	transactor := database.NewTransactor(db, &cfg.DB)
+	userRepo := database.NewUserRepository(db, transactor)
 	cachedRepo := cache.NewCacheDecorator(userRepo, redisClient, &cfg.Redis)
-	eventPublisher := events.NewUserEventPublisher(kafkaWriter)
+	resetRepo := database.NewPasswordResetRepository(db)
+	nicknameRepo := database.NewNicknameHistoryRepository(db)
+	outboxRepo := database.NewOutboxRepository(db)
+	eventPublisher := events.NewOutboxPublisher(outboxRepo)
 	log.Info("Repositories and publisher initialized")
 
+	// Initialize the broadcaster of user changes to watching clients
+	watcher := events.NewBroadcaster(&cfg.Watch)
+
 	// Initialize user service
-	userService := user.NewService(cachedRepo, eventPublisher, log)
+	userService := user.NewService(cachedRepo, eventPublisher, log,
+		user.WithNotifier(watcher),
+		user.WithPasswordResets(resetRepo, cfg.Auth.PasswordResetTTL),
+		user.WithResetSender(events.NewResetTokenSender(resetWriter)),
+		user.WithDeletionRetention(cfg.Deletion.RestoreGracePeriod, cfg.Deletion.PurgeRetention),
+		user.WithCursorSigningKey([]byte(cfg.Pagination.CursorSecret)),
+		user.WithMaxListLimit(cfg.Pagination.MaxLimit),
+		user.WithNicknameHistory(nicknameRepo, cfg.Nickname.ChangeCooldown, cfg.Nickname.HistoryRetention),
+		user.WithBatchLimits(cfg.Batch.MaxSize, cfg.Batch.HashWorkers),
+	)
 	log.Info("User service initialized")
 
+	// Initialize access policy consulted by the API layers
+	policy := user.NewPolicy(cachedRepo)
+
 	// Initialize health checker and run initial check
-	healthChecker := api.NewHealthChecker(db, redisClient, kafkaWriter, log)
+	healthChecker := api.NewHealthChecker(db, redisClient, kafkaWriter, log, api.WithSchemaCheck(migrator))
 	if status := healthChecker.Check(context.Background()); status.Status == api.Unhealthy {
 		log.Error("initial health check failed", "status", status, "error", err)
 		os.Exit(1)
@@ -103,14 +174,20 @@ func main() {
 	log.Info("Initial health check passed")
 
 	// Initialize REST server
-	httpServer := restapi.NewServer(cfg.API.Port, userService, healthChecker, limiter, log)
+	httpServer := restapi.NewServer(cfg.API.Port, userService, policy, healthChecker, limiter, tokens, watcher, cfg.Watch.HeartbeatInterval, log)
 	log.Info("REST server initialized")
 
 	// Initialize gRPC server with interceptors
-	grpcOpts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(interceptors.UnaryLoggingInterceptor(log)),
-	}
-	grpcServer := grpcapi.NewServer(cfg.GRPC.Port, userService, log, grpcOpts...)
+	chain := interceptors.NewChain(
+		interceptors.WithRequestID(),
+		interceptors.WithRecovery(log),
+		interceptors.WithTracing(otel.GetTracerProvider(), otel.GetTextMapPropagator()),
+		interceptors.WithLogging(log),
+		interceptors.WithDeadlines(cfg.GRPC.RequestTimeout, cfg.GRPC.StreamTimeout),
+		interceptors.WithRateLimit(limiter, log),
+		interceptors.WithAuth(tokens, log),
+	)
+	grpcServer := grpcapi.NewServer(cfg.GRPC.Port, userService, policy, tokens, watcher, log, chain.ServerOptions()...)
 	log.Info("gRPC server initialized")
 
 	// Create error channel for server errors
@@ -131,6 +208,57 @@ func main() {
 		}
 	}()
 
+	// Start purging users deleted longer than the retention ago
+	purgeCtx, stopPurger := context.WithCancel(context.Background())
+	purgerDone := make(chan struct{})
+	purger := user.NewPurger(userService, cfg.Deletion.PurgeInterval, cfg.Deletion.PurgeBatchSize, log)
+	go func() {
+		defer close(purgerDone)
+		purger.Run(purgeCtx)
+	}()
+
+	// Start relaying outbox events to Kafka
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	relay := events.NewRelay(outboxRepo, transactor, events.NewUserEventPublisher(kafkaWriter, events.WithEncoder(eventEncoder)), &cfg.Outbox, log)
+	go func() {
+		defer close(relayDone)
+		relay.Run(relayCtx)
+	}()
+
+	// Start consuming commands from other services, and retrying those that
+	// failed, when enabled
+	commandsCtx, stopCommands := context.WithCancel(context.Background())
+	var commandsDone []chan struct{}
+	if cfg.Commands.Enabled {
+		if err := kafkaPlatform.CreateCommandTopics(cfg, log); err != nil {
+			log.Error("failed to create command topics", "error", err)
+			os.Exit(1)
+		}
+		registry := kafkaPlatform.NewRegistry()
+		commands.NewHandlers(userService, log).Register(registry)
+		commandWriter := kafkaPlatform.NewCommandWriter(cfg)
+		defer kafkaPlatform.Close(commandWriter)
+
+		for _, topic := range []string{cfg.Commands.Topic, cfg.Commands.RetryTopic} {
+			reader := kafkaPlatform.NewCommandReader(cfg, topic)
+			consumer := kafkaPlatform.NewConsumer(reader, commandWriter, registry, &cfg.Commands, log)
+			done := make(chan struct{})
+			commandsDone = append(commandsDone, done)
+			go func() {
+				defer close(done)
+				defer reader.Close()
+				if err := consumer.Run(commandsCtx); err != nil {
+					select {
+					case errChan <- fmt.Errorf("command consumer error: %w", err):
+					default: // Another error is already shutting the service down
+					}
+				}
+			}()
+		}
+		log.Info("Command consumers started", "topic", cfg.Commands.Topic, "retry_topic", cfg.Commands.RetryTopic)
+	}
+
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -150,6 +278,7 @@ func main() {
 
 	// Graceful shutdown
 	log.Info("Shutting down servers...")
+	watcher.Close() // Ends the streams of watching clients, which would hold up the servers
 	if err := httpServer.Stop(ctx); err != nil {
 		log.Error("failed to stop HTTP server", "error", err)
 	} else {
@@ -158,5 +287,23 @@ func main() {
 
 	grpcServer.Stop()
 	log.Info("gRPC server stopped")
+
+	// Commands in hand are finished and committed before the consumers stop
+	stopCommands()
+	for _, done := range commandsDone {
+		<-done
+	}
+	if cfg.Commands.Enabled {
+		log.Info("Command consumers stopped")
+	}
+
+	stopPurger()
+	<-purgerDone
+	log.Info("Purger stopped")
+
+	// Stopped last so events of in-flight requests still get relayed
+	stopRelay()
+	<-relayDone
+	log.Info("Outbox relay stopped")
 	log.Info("Shutdown complete")
 }
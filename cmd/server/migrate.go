@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/postgres"
+	"github.com/bentalebwael/faceit-users-service/migrations"
+)
+
+const migrateUsage = "usage: server migrate up|down [steps]|status|force <version>"
+
+// runMigrate implements the migrate subcommand, which manages the database
+// schema with the migrations embedded in the binary
+func runMigrate(cfg *config.Config, log *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := postgres.NewConnection(cfg)
+	if err != nil {
+		return err
+	}
+	defer postgres.Close(db)
+
+	migrator, err := postgres.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info("Schema migrations applied", "count", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q, %s", args[1], migrateUsage)
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		log.Info("Schema migrations reverted", "count", reverted)
+	case "force":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q, %s", args[1], migrateUsage)
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			return err
+		}
+		log.Info("Schema version forced", "version", version)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info("Schema status", "version", status.Version, "dirty", status.Dirty, "latest", status.Latest, "pending", status.Pending)
+	default:
+		return fmt.Errorf("unknown migrate command %q, %s", args[0], migrateUsage)
+	}
+	return nil
+}
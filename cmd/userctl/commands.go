@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/api"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// action carries out a parsed command against the service and returns what
+// to print
+type action func(ctx context.Context, service *user.Service) (any, error)
+
+// command parses the arguments of a command into its action. Parsing happens
+// before connecting, so mistakes are reported without touching any store.
+type command func(args []string, stdin io.Reader, stderr io.Writer) (action, error)
+
+var commands = map[string]command{
+	"create":         parseCreate,
+	"get":            parseGet,
+	"update":         parseUpdate,
+	"delete":         parseDelete,
+	"list":           parseList,
+	"search":         parseSearch,
+	"reset-password": parseResetPassword,
+	"republish":      parseRepublish,
+}
+
+// status reports the outcome of a command that has no user to show
+type status struct {
+	ID     uuid.UUID `json:"id"`
+	Status string    `json:"status"`
+}
+
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: userctl %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseUserArg parses flags followed by exactly one <user> argument
+func parseUserArg(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", fmt.Errorf("%s takes exactly one user ID or nickname", fs.Name())
+	}
+	return fs.Arg(0), nil
+}
+
+// resolveUser finds a user by ID or, when ref is not a UUID, by nickname,
+// which also matches nicknames the user recently gave up
+func resolveUser(ctx context.Context, service *user.Service, ref string) (*user.User, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return service.GetUser(ctx, id)
+	}
+	return service.GetUserByNickname(ctx, ref)
+}
+
+// passwordFlags registers -password and -password-stdin; the latter keeps the
+// password out of shell history and process listings
+func passwordFlags(fs *flag.FlagSet) func(stdin io.Reader) (string, error) {
+	password := fs.String("password", "", "new password")
+	fromStdin := fs.Bool("password-stdin", false, "read the password from the first line of stdin")
+	return func(stdin io.Reader) (string, error) {
+		if !*fromStdin {
+			return *password, nil
+		}
+		if *password != "" {
+			return "", errors.New("-password and -password-stdin are mutually exclusive")
+		}
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+}
+
+func parseCreate(args []string, stdin io.Reader, stderr io.Writer) (action, error) {
+	fs := newFlagSet("create", "", stderr)
+	u := &user.User{}
+	fs.StringVar(&u.FirstName, "first-name", "", "first name")
+	fs.StringVar(&u.LastName, "last-name", "", "last name")
+	fs.StringVar(&u.Nickname, "nickname", "", "nickname (required)")
+	fs.StringVar(&u.Email, "email", "", "email address (required)")
+	fs.StringVar(&u.Country, "country", "", "ISO 3166-1 alpha-2 country code (required)")
+	role := fs.String("role", string(user.RolePlayer), "role: player, moderator or admin")
+	readPassword := passwordFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return nil, errors.New("create takes no arguments")
+	}
+
+	var err error
+	if u.Password, err = readPassword(stdin); err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, required := range []struct{ name, value string }{
+		{"nickname", u.Nickname},
+		{"email", u.Email},
+		{"country", u.Country},
+		{"password", u.Password},
+	} {
+		if required.value == "" {
+			errs = append(errs, user.NewValidationError(required.name, "is required"))
+		}
+	}
+	if err := user.JoinValidationErrors(errs...); err != nil {
+		return nil, err
+	}
+	u.Role = user.Role(*role)
+
+	return func(ctx context.Context, service *user.Service) (any, error) {
+		return service.CreateUser(ctx, u)
+	}, nil
+}
+
+func parseGet(args []string, stdin io.Reader, stderr io.Writer) (action, error) {
+	ref, err := parseUserArg(newFlagSet("get", "<user>", stderr), args)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, service *user.Service) (any, error) {
+		return resolveUser(ctx, service, ref)
+	}, nil
+}
+
+func parseUpdate(args []string, stdin io.Reader, stderr io.Writer) (action, error) {
+	fs := newFlagSet("update", "<user>", stderr)
+	changes := &user.User{}
+	fs.StringVar(&changes.FirstName, "first-name", "", "new first name, empty to clear it")
+	fs.StringVar(&changes.LastName, "last-name", "", "new last name, empty to clear it")
+	fs.StringVar(&changes.Nickname, "nickname", "", "new nickname")
+	fs.StringVar(&changes.Email, "email", "", "new email address")
+	fs.StringVar(&changes.Country, "country", "", "new ISO 3166-1 alpha-2 country code")
+	fs.Int64Var(&changes.Version, "version", 0, "fail unless the user is still at this version")
+	role := fs.String("role", "", "new role: player, moderator or admin")
+	ref, err := parseUserArg(fs, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the flags given are changed, so an empty value can clear a name
+	var fields []user.Field
+	setRole := false
+	fs.Visit(func(f *flag.Flag) {
+		switch field := user.Field(strings.ReplaceAll(f.Name, "-", "_")); {
+		case field.IsUpdatable():
+			fields = append(fields, field)
+		case f.Name == "role":
+			setRole = true
+		}
+	})
+	if len(fields) == 0 && !setRole {
+		fs.Usage()
+		return nil, errors.New("update needs at least one field or -role to change")
+	}
+
+	return func(ctx context.Context, service *user.Service) (any, error) {
+		u, err := resolveUser(ctx, service, ref)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) > 0 {
+			if u, err = service.UpdateUser(ctx, u.ID, changes, fields); err != nil {
+				return nil, err
+			}
+		}
+		if setRole {
+			if u, err = service.AssignRole(ctx, u.ID, user.Role(*role)); err != nil {
+				return nil, err
+			}
+		}
+		return u, nil
+	}, nil
+}
+
+func parseDelete(args []string, stdin io.Reader, stderr io.Writer) (action, error) {
+	ref, err := parseUserArg(newFlagSet("delete", "<user>", stderr), args)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, service *user.Service) (any, error) {
+		u, err := resolveUser(ctx, service, ref)
+		if err != nil {
+			return nil, err
+		}
+		if err := service.DeleteUser(ctx, u.ID); err != nil {
+			return nil, err
+		}
+		return &status{ID: u.ID, Status: "deleted"}, nil
+	}, nil
+}
+
+func parseList(args []string, stdin io.Reader, stderr io.Writer) (action, error) {
+	fs := newFlagSet("list", "[field=value | field[operator]=value | page=N | limit=N | cursor=C | order_by=F | order_desc=B | include_total=B ...]", stderr)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	for _, term := range fs.Args() {
+		key, value, ok := strings.Cut(term, "=")
+		if !ok {
+			fs.Usage()
+			return nil, fmt.Errorf("query term %q is not of the form key=value", term)
+		}
+		query.Add(key, value)
+	}
+	params, err := api.ParseListQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, service *user.Service) (any, error) {
+		return service.ListUsers(ctx, params)
+	}, nil
+}
+
+func parseSearch(args []string, stdin io.Reader, stderr io.Writer) (action, error) {
+	fs := newFlagSet("search", "<query>", stderr)
+	limit := fs.Int("limit", 0, "maximum number of results (default 10)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, errors.New("search needs a query")
+	}
+	query := strings.Join(fs.Args(), " ")
+
+	return func(ctx context.Context, service *user.Service) (any, error) {
+		return service.SearchUsers(ctx, query, *limit)
+	}, nil
+}
+
+func parseResetPassword(args []string, stdin io.Reader, stderr io.Writer) (action, error) {
+	fs := newFlagSet("reset-password", "<user>", stderr)
+	readPassword := passwordFlags(fs)
+	ref, err := parseUserArg(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	password, err := readPassword(stdin)
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return nil, user.NewValidationError("password", "is required")
+	}
+
+	return func(ctx context.Context, service *user.Service) (any, error) {
+		u, err := resolveUser(ctx, service, ref)
+		if err != nil {
+			return nil, err
+		}
+		if err := service.ResetPassword(ctx, u.ID, password); err != nil {
+			return nil, err
+		}
+		return &status{ID: u.ID, Status: "password_reset"}, nil
+	}, nil
+}
+
+func parseRepublish(args []string, stdin io.Reader, stderr io.Writer) (action, error) {
+	ref, err := parseUserArg(newFlagSet("republish", "<user>", stderr), args)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, service *user.Service) (any, error) {
+		u, err := resolveUser(ctx, service, ref)
+		if err != nil {
+			return nil, err
+		}
+		return service.RepublishUser(ctx, u.ID)
+	}, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func TestRun_Usage(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "no command", args: nil, wantErr: "no command given"},
+		{name: "unknown command", args: []string{"frobnicate"}, wantErr: `unknown command "frobnicate"`},
+		{name: "unknown output format", args: []string{"-output", "xml", "get", "johndoe"}, wantErr: `unknown output format "xml"`},
+		{name: "missing user", args: []string{"get"}, wantErr: "get takes exactly one user ID or nickname"},
+		{name: "nothing to update", args: []string{"update", "johndoe"}, wantErr: "update needs at least one field or -role to change"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every case fails before the configuration is loaded
+			err := run(context.Background(), tt.args, strings.NewReader(""), io.Discard, io.Discard)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestParseCreate(t *testing.T) {
+	t.Run("reports every missing field", func(t *testing.T) {
+		_, err := parseCreate([]string{"-nickname", "johndoe"}, strings.NewReader(""), io.Discard)
+
+		var errs user.ValidationErrors
+		require.ErrorAs(t, err, &errs)
+		fields := make([]string, len(errs))
+		for i, e := range errs {
+			fields[i] = e.Field
+		}
+		assert.Equal(t, []string{"email", "country", "password"}, fields)
+	})
+
+	t.Run("reads the password from stdin", func(t *testing.T) {
+		args := []string{"-nickname", "johndoe", "-email", "john@example.com", "-country", "US", "-password-stdin"}
+		act, err := parseCreate(args, strings.NewReader("secret123\n"), io.Discard)
+		require.NoError(t, err)
+		assert.NotNil(t, act)
+	})
+
+	t.Run("password given twice", func(t *testing.T) {
+		args := []string{"-nickname", "johndoe", "-email", "john@example.com", "-country", "US", "-password", "a", "-password-stdin"}
+		_, err := parseCreate(args, strings.NewReader("b\n"), io.Discard)
+		assert.ErrorContains(t, err, "mutually exclusive")
+	})
+}
+
+func TestParseResetPassword(t *testing.T) {
+	_, err := parseResetPassword([]string{"-password-stdin", "johndoe"}, strings.NewReader(""), io.Discard)
+	assert.ErrorIs(t, err, user.ErrValidation)
+
+	act, err := parseResetPassword([]string{"-password", "newsecret", "johndoe"}, strings.NewReader(""), io.Discard)
+	require.NoError(t, err)
+	assert.NotNil(t, act)
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "defaults", args: nil},
+		{name: "filters and paging", args: []string{"country=DE", "nickname[prefix]=jo", "limit=50", "include_total=true"}},
+		{name: "term without value", args: []string{"country"}, wantErr: `query term "country" is not of the form key=value`},
+		{name: "invalid term", args: []string{"limit=many"}, wantErr: "limit - must be a positive integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			act, err := parseList(tt.args, strings.NewReader(""), io.Discard)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, act)
+		})
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	_, err := parseSearch(nil, strings.NewReader(""), io.Discard)
+	assert.ErrorContains(t, err, "search needs a query")
+
+	act, err := parseSearch([]string{"-limit", "5", "john", "doe"}, strings.NewReader(""), io.Discard)
+	require.NoError(t, err)
+	assert.NotNil(t, act)
+}
@@ -0,0 +1,206 @@
+// Command userctl manages users from the command line. It runs the same user
+// service as the server against the configured Postgres and Redis, so every
+// change is validated, versioned and announced through the outbox exactly as
+// if it had been made through the API.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	"github.com/bentalebwael/faceit-users-service/internal/events"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/postgres"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/redis"
+	"github.com/bentalebwael/faceit-users-service/internal/repository/cache"
+	"github.com/bentalebwael/faceit-users-service/internal/repository/database"
+)
+
+const usage = `usage: userctl [flags] <command> [arguments]
+
+Commands:
+  create            create a user
+  get <user>        show a user
+  update <user>     change the given fields or the role of a user
+  delete <user>     soft delete a user
+  list [query]      list users, query terms as in GET /users (country=DE limit=50)
+  search <query>    search users by nickname, name or email
+  reset-password <user>
+                    set a new password without the current one
+  republish <user>  publish an updated event with the current state of a user
+
+A <user> is a user ID or a nickname. Run userctl <command> -help for the
+flags of a command.
+
+Flags:
+`
+
+// errDryRun rolls back the unit of work of a dry run
+var errDryRun = errors.New("dry run")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "userctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// options are the flags shared by every command
+type options struct {
+	output  string
+	dryRun  bool
+	noCache bool
+}
+
+// run parses args, runs the command they name and prints its result to stdout
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("userctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	var opts options
+	fs.StringVar(&opts.output, "output", "table", "output format: table, json or csv")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "run the command, then roll back its changes and events instead of committing them")
+	fs.BoolVar(&opts.noCache, "no-cache", false, "read Postgres directly, bypassing the Redis cache; writes still evict the users they change")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	out, err := newPrinter(opts.output, stdout)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no command given")
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown command %q, run userctl -help for the list of commands", fs.Arg(0))
+	}
+	act, err := cmd(fs.Args()[1:], stdin, stderr)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	e, err := newEnv(cfg, opts)
+	if err != nil {
+		return err
+	}
+	defer e.close()
+
+	result, err := e.exec(ctx, act)
+	if err != nil {
+		return err
+	}
+	if opts.dryRun {
+		fmt.Fprintln(stderr, "dry run: all changes were rolled back")
+	}
+	return out.print(result)
+}
+
+// env holds the service and the connections it runs on
+type env struct {
+	service    *user.Service
+	transactor *database.Transactor
+	dryRun     bool
+	close      func()
+}
+
+// newEnv connects to Postgres and Redis and wires the user service like the
+// server does. Without the cache, reads go straight to Postgres but writes
+// still evict the cache entries of the users they change, so the server never
+// serves the old state. A dry run bypasses the cache entirely, as it commits
+// no writes and cache writes could not be rolled back.
+func newEnv(cfg *config.Config, opts options) (*env, error) {
+	// Warnings only, on stderr, so they never mix with the printed result
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	db, err := postgres.NewConnection(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	closers := []func(){func() { postgres.Close(db) }}
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+
+	transactor := database.NewTransactor(db, &cfg.DB)
+	var repo user.Repository = database.NewUserRepository(db, transactor)
+	if !opts.dryRun {
+		redisClient, err := redis.NewClient(cfg)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to connect to redis: %w", err)
+		}
+		closers = append(closers, func() { redis.Close(redisClient) })
+		var cacheOpts []cache.Option
+		if opts.noCache {
+			cacheOpts = append(cacheOpts, cache.WithoutCachedReads())
+		}
+		repo = cache.NewCacheDecorator(repo, redisClient, &cfg.Redis, cacheOpts...)
+	}
+
+	service := user.NewService(repo, events.NewOutboxPublisher(database.NewOutboxRepository(db)), log,
+		user.WithPasswordResets(database.NewPasswordResetRepository(db), cfg.Auth.PasswordResetTTL),
+		user.WithDeletionRetention(cfg.Deletion.RestoreGracePeriod, cfg.Deletion.PurgeRetention),
+		user.WithCursorSigningKey([]byte(cfg.Pagination.CursorSecret)),
+		user.WithMaxListLimit(cfg.Pagination.MaxLimit),
+		user.WithNicknameHistory(database.NewNicknameHistoryRepository(db), cfg.Nickname.ChangeCooldown, cfg.Nickname.HistoryRetention),
+		user.WithBatchLimits(cfg.Batch.MaxSize, cfg.Batch.HashWorkers),
+	)
+
+	return &env{
+		service:    service,
+		transactor: transactor,
+		dryRun:     opts.dryRun,
+		close:      closeAll,
+	}, nil
+}
+
+// exec runs act. A dry run runs it in a transaction that is rolled back once
+// act is done; the units of work of the service join that transaction, so
+// neither their changes nor their outbox events are ever committed.
+func (e *env) exec(ctx context.Context, act action) (any, error) {
+	if !e.dryRun {
+		return act(ctx, e.service)
+	}
+
+	var result any
+	err := e.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if result, err = act(ctx, e.service); err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return result, nil
+}
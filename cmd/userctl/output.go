@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bentalebwael/faceit-users-service/internal/api"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// Output formats of the -output flag
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// listOutput is the JSON form of a page of users, shaped like the REST response
+type listOutput struct {
+	Users      []user.User `json:"users"`
+	HasMore    bool        `json:"has_more"`
+	TotalCount *int64      `json:"total_count,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// printer writes command results to w in one of the output formats
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	switch format {
+	case formatTable, formatJSON, formatCSV:
+		return &printer{format: format, w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, use table, json or csv", format)
+	}
+}
+
+func (p *printer) print(result any) error {
+	switch result := result.(type) {
+	case *user.User:
+		return p.write(result, api.UserColumns, [][]string{api.UserRecord(result)}, "")
+	case *user.ListResult:
+		rows := make([][]string, len(result.Users))
+		for i := range result.Users {
+			rows[i] = api.UserRecord(&result.Users[i])
+		}
+		var footer string
+		if result.TotalCount != nil {
+			footer = fmt.Sprintf("total: %d\n", *result.TotalCount)
+		}
+		if result.NextCursor != "" {
+			footer += fmt.Sprintf("next page: cursor=%s\n", result.NextCursor)
+		}
+		users := result.Users
+		if users == nil {
+			users = []user.User{}
+		}
+		page := listOutput{Users: users, HasMore: result.HasMore, TotalCount: result.TotalCount, NextCursor: result.NextCursor}
+		return p.write(page, api.UserColumns, rows, footer)
+	case []user.SearchResult:
+		rows := make([][]string, len(result))
+		for i := range result {
+			rows[i] = append(api.UserRecord(&result[i].User), strconv.FormatFloat(result[i].Score, 'f', 3, 64))
+		}
+		if result == nil {
+			result = []user.SearchResult{}
+		}
+		return p.write(result, append(api.UserColumns[:len(api.UserColumns):len(api.UserColumns)], "score"), rows, "")
+	case *status:
+		return p.write(result, []string{"id", "status"}, [][]string{{result.ID.String(), result.Status}}, "")
+	default:
+		return fmt.Errorf("cannot print result of type %T", result)
+	}
+}
+
+// write prints v as JSON, or header and rows as a table or CSV. The footer
+// only accompanies tables, whose readers are people rather than scripts.
+func (p *printer) write(v any, header []string, rows [][]string, footer string) error {
+	switch p.format {
+	case formatJSON:
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case formatCSV:
+		w := csv.NewWriter(p.w)
+		w.Write(header)
+		w.WriteAll(rows)
+		return w.Error()
+	default:
+		w := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		_, err := io.WriteString(p.w, footer)
+		return err
+	}
+}
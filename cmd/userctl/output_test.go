@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func testUser() user.User {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return user.User{
+		ID:        uuid.MustParse("7b1a5a4e-5f0e-4d6b-9c53-3c1f2b8a9d10"),
+		FirstName: "John",
+		LastName:  "Doe",
+		Nickname:  "johndoe",
+		Password:  "hash",
+		Email:     "john@example.com",
+		Country:   "US",
+		Role:      user.RolePlayer,
+		CreatedAt: created,
+		UpdatedAt: created,
+		Version:   2,
+	}
+}
+
+func TestPrinter_Table(t *testing.T) {
+	u := testUser()
+	total := int64(3)
+	var buf bytes.Buffer
+	p, err := newPrinter(formatTable, &buf)
+	require.NoError(t, err)
+
+	require.NoError(t, p.print(&user.ListResult{Users: []user.User{u}, HasMore: true, TotalCount: &total, NextCursor: "abc"}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[0], "ID"))
+	assert.Contains(t, lines[0], "FIRST_NAME")
+	assert.Contains(t, lines[1], "johndoe")
+	assert.Contains(t, lines[1], "2024-05-01T12:00:00Z")
+	assert.Equal(t, "total: 3", lines[2])
+	assert.Equal(t, "next page: cursor=abc", lines[3])
+}
+
+func TestPrinter_JSON(t *testing.T) {
+	u := testUser()
+	var buf bytes.Buffer
+	p, err := newPrinter(formatJSON, &buf)
+	require.NoError(t, err)
+
+	require.NoError(t, p.print(&user.ListResult{}))
+	assert.JSONEq(t, `{"users": [], "has_more": false}`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, p.print(&u))
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "johndoe", got["nickname"])
+	assert.NotContains(t, got, "password", "the password hash must never be printed")
+}
+
+func TestPrinter_CSV(t *testing.T) {
+	u := testUser()
+	var buf bytes.Buffer
+	p, err := newPrinter(formatCSV, &buf)
+	require.NoError(t, err)
+
+	require.NoError(t, p.print([]user.SearchResult{{User: u, Score: 0.5}}))
+	assert.Equal(t,
+		"id,nickname,email,first_name,last_name,country,role,version,created_at,updated_at,score\n"+
+			"7b1a5a4e-5f0e-4d6b-9c53-3c1f2b8a9d10,johndoe,john@example.com,John,Doe,US,player,2,2024-05-01T12:00:00Z,2024-05-01T12:00:00Z,0.500\n",
+		buf.String())
+
+	buf.Reset()
+	require.NoError(t, p.print(&status{ID: u.ID, Status: "deleted"}))
+	assert.Equal(t, "id,status\n7b1a5a4e-5f0e-4d6b-9c53-3c1f2b8a9d10,deleted\n", buf.String())
+}
+
+func TestPrinter_UnknownResult(t *testing.T) {
+	p, err := newPrinter(formatTable, &bytes.Buffer{})
+	require.NoError(t, err)
+	assert.Error(t, p.print(42))
+}
@@ -0,0 +1,146 @@
+// Package commands handles the commands other services send over Kafka by
+// dispatching them to the user service
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	kafkaPlatform "github.com/bentalebwael/faceit-users-service/internal/platform/kafka"
+)
+
+// Command types, sent in the command-type header
+const (
+	EraseUser      = "user.erase"
+	BanUser        = "user.ban"
+	CorrectCountry = "user.correct_country"
+)
+
+// EraseUserCommand asks for a user to be erased. The user is removed with
+// their personal data at once and cannot be restored.
+type EraseUserCommand struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// BanUserCommand asks for a user to be banned, so they can no longer log in
+type BanUserCommand struct {
+	UserID uuid.UUID `json:"user_id"`
+	Reason string    `json:"reason"`
+}
+
+// CorrectCountryCommand asks for every user in a country to be moved to
+// another, such as when a country code was retired
+type CorrectCountryCommand struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Service is the part of the user service the commands are dispatched to,
+// implemented by *user.Service
+type Service interface {
+	EraseUser(ctx context.Context, id uuid.UUID) error
+	BanUser(ctx context.Context, id uuid.UUID, reason string) (*user.User, error)
+	CorrectCountry(ctx context.Context, from, to string) (int, error)
+}
+
+// Handlers handles commands with the user service
+type Handlers struct {
+	service Service
+	logger  *slog.Logger
+}
+
+// NewHandlers creates the command handlers
+func NewHandlers(service Service, logger *slog.Logger) *Handlers {
+	return &Handlers{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// Register registers the handler of every command type with registry
+func (h *Handlers) Register(registry *kafkaPlatform.Registry) {
+	registry.Register(EraseUser, h.EraseUser)
+	registry.Register(BanUser, h.BanUser)
+	registry.Register(CorrectCountry, h.CorrectCountry)
+}
+
+// EraseUser handles EraseUserCommand. Erasing a user that is already gone
+// succeeds, so redelivered commands are harmless.
+func (h *Handlers) EraseUser(ctx context.Context, msg kafka.Message) error {
+	var cmd EraseUserCommand
+	if err := decode(msg, &cmd); err != nil {
+		return err
+	}
+	if cmd.UserID == uuid.Nil {
+		return kafkaPlatform.Permanent(errors.New("user_id is required"))
+	}
+
+	err := h.service.EraseUser(ctx, cmd.UserID)
+	if err != nil && !errors.Is(err, user.ErrNotFound) {
+		return fmt.Errorf("failed to erase user %s: %w", cmd.UserID, err)
+	}
+	h.logger.Info("user erased", "user_id", cmd.UserID)
+	return nil
+}
+
+// BanUser handles BanUserCommand. Banning a user already banned is a no-op,
+// so redelivered commands are harmless. Unknown and deleted users cannot be
+// banned, which no retry changes.
+func (h *Handlers) BanUser(ctx context.Context, msg kafka.Message) error {
+	var cmd BanUserCommand
+	if err := decode(msg, &cmd); err != nil {
+		return err
+	}
+	if cmd.UserID == uuid.Nil {
+		return kafkaPlatform.Permanent(errors.New("user_id is required"))
+	}
+
+	_, err := h.service.BanUser(ctx, cmd.UserID, cmd.Reason)
+	switch {
+	case errors.Is(err, user.ErrNotFound), errors.Is(err, user.ErrValidation):
+		return kafkaPlatform.Permanent(fmt.Errorf("failed to ban user %s: %w", cmd.UserID, err))
+	case err != nil:
+		return fmt.Errorf("failed to ban user %s: %w", cmd.UserID, err)
+	}
+	h.logger.Info("user banned", "user_id", cmd.UserID)
+	return nil
+}
+
+// CorrectCountry handles CorrectCountryCommand. Users are moved a page at a
+// time and those already moved are no longer in the old country, so a retried
+// or redelivered command resumes with the rest.
+func (h *Handlers) CorrectCountry(ctx context.Context, msg kafka.Message) error {
+	var cmd CorrectCountryCommand
+	if err := decode(msg, &cmd); err != nil {
+		return err
+	}
+	if cmd.From == "" || cmd.To == "" {
+		return kafkaPlatform.Permanent(errors.New("from and to are required"))
+	}
+
+	count, err := h.service.CorrectCountry(ctx, cmd.From, cmd.To)
+	switch {
+	case errors.Is(err, user.ErrValidation):
+		return kafkaPlatform.Permanent(fmt.Errorf("failed to move users from %s to %s: %w", cmd.From, cmd.To, err))
+	case err != nil:
+		return fmt.Errorf("failed to move users from %s to %s after %d: %w", cmd.From, cmd.To, count, err)
+	}
+	h.logger.Info("country corrected", "from", cmd.From, "to", cmd.To, "count", count)
+	return nil
+}
+
+// decode decodes the JSON value of msg into cmd. A malformed command is
+// permanent, as no retry can fix it.
+func decode(msg kafka.Message, cmd any) error {
+	if err := json.Unmarshal(msg.Value, cmd); err != nil {
+		return kafkaPlatform.Permanent(fmt.Errorf("malformed command: %w", err))
+	}
+	return nil
+}
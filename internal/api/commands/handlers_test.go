@@ -0,0 +1,227 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	kafkaPlatform "github.com/bentalebwael/faceit-users-service/internal/platform/kafka"
+)
+
+// fakeService keeps users in memory and answers like the user service, so
+// redelivered commands meet the state the first delivery left
+type fakeService struct {
+	users map[uuid.UUID]*user.User
+	err   error // Returned by every call when set
+}
+
+func newFakeService(users ...*user.User) *fakeService {
+	s := &fakeService{users: make(map[uuid.UUID]*user.User)}
+	for _, u := range users {
+		s.users[u.ID] = u
+	}
+	return s
+}
+
+func (s *fakeService) EraseUser(_ context.Context, id uuid.UUID) error {
+	if s.err != nil {
+		return s.err
+	}
+	if _, exists := s.users[id]; !exists {
+		return user.ErrNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+func (s *fakeService) BanUser(_ context.Context, id uuid.UUID, reason string) (*user.User, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if reason == "" {
+		return nil, user.NewValidationError("reason", "is required")
+	}
+	u, exists := s.users[id]
+	if !exists {
+		return nil, user.ErrNotFound
+	}
+	if u.BannedAt == nil {
+		now := time.Now().UTC()
+		u.BannedAt = &now
+		u.BanReason = reason
+	}
+	return u, nil
+}
+
+func (s *fakeService) CorrectCountry(_ context.Context, from, to string) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if len(to) != 2 {
+		return 0, user.NewValidationError("country", "must be a 2-letter ISO code")
+	}
+	count := 0
+	for _, u := range s.users {
+		if u.Country == from {
+			u.Country = to
+			count++
+		}
+	}
+	return count, nil
+}
+
+func newTestHandlers(service Service) *Handlers {
+	return NewHandlers(service, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func command(value string) kafka.Message {
+	return kafka.Message{Value: []byte(value)}
+}
+
+func TestHandlers_EraseUser(t *testing.T) {
+	u := &user.User{ID: uuid.New(), Nickname: "johndoe"}
+	msg := command(`{"user_id": "` + u.ID.String() + `"}`)
+
+	t.Run("erases the user", func(t *testing.T) {
+		service := newFakeService(u)
+		h := newTestHandlers(service)
+
+		require.NoError(t, h.EraseUser(context.Background(), msg))
+		assert.NotContains(t, service.users, u.ID)
+
+		// A redelivered command finds the user gone and succeeds
+		assert.NoError(t, h.EraseUser(context.Background(), msg))
+	})
+
+	t.Run("transient failure is retried", func(t *testing.T) {
+		service := newFakeService(u)
+		service.err = errors.New("database unavailable")
+		h := newTestHandlers(service)
+
+		err := h.EraseUser(context.Background(), msg)
+		require.Error(t, err)
+		assert.False(t, kafkaPlatform.IsPermanent(err))
+	})
+
+	for name, value := range map[string]string{
+		"malformed":       `{"user_id": `,
+		"invalid user_id": `{"user_id": "not-a-uuid"}`,
+		"missing user_id": `{}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := newTestHandlers(newFakeService(u)).EraseUser(context.Background(), command(value))
+			require.Error(t, err)
+			assert.True(t, kafkaPlatform.IsPermanent(err))
+		})
+	}
+}
+
+func TestHandlers_BanUser(t *testing.T) {
+	t.Run("bans the user", func(t *testing.T) {
+		u := &user.User{ID: uuid.New(), Nickname: "johndoe"}
+		service := newFakeService(u)
+		h := newTestHandlers(service)
+
+		require.NoError(t, h.BanUser(context.Background(), command(`{"user_id": "`+u.ID.String()+`", "reason": "cheating"}`)))
+		require.NotNil(t, u.BannedAt)
+		bannedAt := *u.BannedAt
+
+		// A redelivered command leaves the ban as it was
+		require.NoError(t, h.BanUser(context.Background(), command(`{"user_id": "`+u.ID.String()+`", "reason": "cheating"}`)))
+		assert.Equal(t, bannedAt, *u.BannedAt)
+		assert.Equal(t, "cheating", u.BanReason)
+	})
+
+	t.Run("validation error is permanent", func(t *testing.T) {
+		u := &user.User{ID: uuid.New()}
+		err := newTestHandlers(newFakeService(u)).BanUser(context.Background(), command(`{"user_id": "`+u.ID.String()+`"}`))
+		require.Error(t, err)
+		assert.True(t, kafkaPlatform.IsPermanent(err))
+		assert.ErrorIs(t, err, user.ErrValidation)
+	})
+
+	t.Run("unknown user is permanent", func(t *testing.T) {
+		err := newTestHandlers(newFakeService()).BanUser(context.Background(), command(`{"user_id": "`+uuid.NewString()+`", "reason": "cheating"}`))
+		require.Error(t, err)
+		assert.True(t, kafkaPlatform.IsPermanent(err))
+	})
+
+	t.Run("transient failure is retried", func(t *testing.T) {
+		service := newFakeService()
+		service.err = errors.New("database unavailable")
+
+		err := newTestHandlers(service).BanUser(context.Background(), command(`{"user_id": "`+uuid.NewString()+`", "reason": "cheating"}`))
+		require.Error(t, err)
+		assert.False(t, kafkaPlatform.IsPermanent(err))
+	})
+
+	for name, value := range map[string]string{
+		"malformed":       `not json`,
+		"missing user_id": `{"reason": "cheating"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := newTestHandlers(newFakeService()).BanUser(context.Background(), command(value))
+			require.Error(t, err)
+			assert.True(t, kafkaPlatform.IsPermanent(err))
+		})
+	}
+}
+
+func TestHandlers_CorrectCountry(t *testing.T) {
+	t.Run("moves every user of the country", func(t *testing.T) {
+		moved := []*user.User{{ID: uuid.New(), Country: "YU"}, {ID: uuid.New(), Country: "YU"}}
+		stayed := &user.User{ID: uuid.New(), Country: "DE"}
+		service := newFakeService(moved[0], moved[1], stayed)
+		h := newTestHandlers(service)
+		msg := command(`{"from": "YU", "to": "RS"}`)
+
+		require.NoError(t, h.CorrectCountry(context.Background(), msg))
+		for _, u := range moved {
+			assert.Equal(t, "RS", u.Country)
+		}
+		assert.Equal(t, "DE", stayed.Country)
+
+		// A redelivered command finds nobody left to move
+		require.NoError(t, h.CorrectCountry(context.Background(), msg))
+		assert.Equal(t, "DE", stayed.Country)
+	})
+
+	t.Run("validation error is permanent", func(t *testing.T) {
+		service := newFakeService(&user.User{ID: uuid.New(), Country: "YU"})
+
+		err := newTestHandlers(service).CorrectCountry(context.Background(), command(`{"from": "YU", "to": "Serbia"}`))
+		require.Error(t, err)
+		assert.True(t, kafkaPlatform.IsPermanent(err))
+		assert.ErrorIs(t, err, user.ErrValidation)
+	})
+
+	t.Run("transient failure is retried", func(t *testing.T) {
+		service := newFakeService()
+		service.err = errors.New("database unavailable")
+
+		err := newTestHandlers(service).CorrectCountry(context.Background(), command(`{"from": "YU", "to": "RS"}`))
+		require.Error(t, err)
+		assert.False(t, kafkaPlatform.IsPermanent(err))
+	})
+
+	for name, value := range map[string]string{
+		"malformed":    `{"from": "YU", "to": 7}`,
+		"missing from": `{"to": "RS"}`,
+		"missing to":   `{"from": "YU"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := newTestHandlers(newFakeService()).CorrectCountry(context.Background(), command(value))
+			require.Error(t, err)
+			assert.True(t, kafkaPlatform.IsPermanent(err))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// Formats users can be exported in
+const (
+	ExportNDJSON = "ndjson"
+	ExportCSV    = "csv"
+)
+
+// UserColumns are the columns of a user in CSV output, in the order of UserRecord
+var UserColumns = []string{"id", "nickname", "email", "first_name", "last_name", "country", "role", "version", "created_at", "updated_at"}
+
+// UserRecord is the CSV record of u
+func UserRecord(u *user.User) []string {
+	return []string{
+		u.ID.String(),
+		u.Nickname,
+		u.Email,
+		u.FirstName,
+		u.LastName,
+		u.Country,
+		string(u.Role),
+		strconv.FormatInt(u.Version, 10),
+		u.CreatedAt.Format(time.RFC3339),
+		u.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// ExportWriter writes a stream of users as newline delimited JSON or as CSV
+// with a header row
+type ExportWriter struct {
+	format string
+	json   *json.Encoder
+	csv    *csv.Writer
+}
+
+// NewExportWriter creates a writer of users to w in format, which defaults to
+// NDJSON when empty
+func NewExportWriter(w io.Writer, format string) (*ExportWriter, error) {
+	switch format {
+	case "", ExportNDJSON:
+		return &ExportWriter{format: ExportNDJSON, json: json.NewEncoder(w)}, nil
+	case ExportCSV:
+		return &ExportWriter{format: ExportCSV, csv: csv.NewWriter(w)}, nil
+	default:
+		return nil, user.NewValidationError("format", "must be one of ndjson, csv")
+	}
+}
+
+// ContentType is the media type of the written stream
+func (e *ExportWriter) ContentType() string {
+	if e.format == ExportCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// WriteHeader writes what precedes the first user, the header row of CSV
+func (e *ExportWriter) WriteHeader() error {
+	if e.csv != nil {
+		return e.csv.Write(UserColumns)
+	}
+	return nil
+}
+
+// Write writes one user. CSV records are buffered until Flush.
+func (e *ExportWriter) Write(u *user.User) error {
+	if e.csv != nil {
+		return e.csv.Write(UserRecord(u))
+	}
+	return e.json.Encode(u)
+}
+
+// Flush writes any buffered records
+func (e *ExportWriter) Flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func exportedUsers() []user.User {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []user.User{
+		{ID: uuid.MustParse("7b1a5a4e-5f0e-4d6b-9c53-3c1f2b8a9d10"), Nickname: "johndoe", Email: "john@example.com", FirstName: "John", LastName: "Doe, Jr.", Country: "US", Role: user.RolePlayer, Password: "hash", Version: 1, CreatedAt: created, UpdatedAt: created},
+		{ID: uuid.MustParse("0c9e4f7a-1d2b-4e3f-8a5b-6c7d8e9f0a1b"), Nickname: "janedoe", Email: "jane@example.com", Country: "FR", Role: user.RoleAdmin, Version: 3, CreatedAt: created, UpdatedAt: created},
+	}
+}
+
+func TestExportWriter_NDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewExportWriter(&buf, "")
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-ndjson", w.ContentType())
+
+	require.NoError(t, w.WriteHeader())
+	users := exportedUsers()
+	for i := range users {
+		require.NoError(t, w.Write(&users[i]))
+	}
+	require.NoError(t, w.Flush())
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &got))
+	assert.Equal(t, "janedoe", got["nickname"])
+	assert.NotContains(t, lines[0], "hash", "password hashes must never be exported")
+}
+
+func TestExportWriter_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewExportWriter(&buf, ExportCSV)
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv; charset=utf-8", w.ContentType())
+
+	require.NoError(t, w.WriteHeader())
+	users := exportedUsers()
+	require.NoError(t, w.Write(&users[0]))
+	require.NoError(t, w.Flush())
+
+	assert.Equal(t,
+		"id,nickname,email,first_name,last_name,country,role,version,created_at,updated_at\n"+
+			`7b1a5a4e-5f0e-4d6b-9c53-3c1f2b8a9d10,johndoe,john@example.com,John,"Doe, Jr.",US,player,1,2024-05-01T12:00:00Z,2024-05-01T12:00:00Z`+"\n",
+		buf.String())
+}
+
+func TestNewExportWriter_UnknownFormat(t *testing.T) {
+	_, err := NewExportWriter(&bytes.Buffer{}, "xml")
+	assert.ErrorIs(t, err, user.ErrValidation)
+	assert.Equal(t, map[string]string{"format": "must be one of ndjson, csv"}, user.ValidationDetails(err))
+}
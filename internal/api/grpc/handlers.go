@@ -4,15 +4,22 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"sort"
+	"strings"
+	"unicode"
 
 	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/bentalebwael/faceit-users-service/internal/api"
 	userpb "github.com/bentalebwael/faceit-users-service/internal/api/grpc/gen/user"
 	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	"github.com/bentalebwael/faceit-users-service/internal/events"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
 	"github.com/bentalebwael/faceit-users-service/internal/platform/tracer"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -21,14 +28,20 @@ import (
 type UserServer struct {
 	userpb.UnimplementedUserServiceServer
 	service *user.Service
+	policy  *user.Policy
+	tokens  *token.Manager
+	watcher *events.Broadcaster
 	logger  *slog.Logger
 	tracer  trace.Tracer
 }
 
 // NewUserServer creates a new UserServer
-func NewUserServer(service *user.Service, logger *slog.Logger) *UserServer {
+func NewUserServer(service *user.Service, policy *user.Policy, tokens *token.Manager, watcher *events.Broadcaster, logger *slog.Logger) *UserServer {
 	return &UserServer{
 		service: service,
+		policy:  policy,
+		tokens:  tokens,
+		watcher: watcher,
 		logger:  logger,
 		tracer:  tracer.GetTracer(),
 	}
@@ -74,6 +87,11 @@ func (s *UserServer) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*
 		return nil, status.Errorf(codes.InvalidArgument, "Invalid user ID format: %v", err)
 	}
 
+	if err := s.authorize(ctx, user.ActionRead, userID); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "GetUser")
+	}
+
 	foundUser, err := s.service.GetUser(ctx, userID)
 	if err != nil {
 		tracer.AddError(span, err)
@@ -82,6 +100,27 @@ func (s *UserServer) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*
 	return toProtoUser(foundUser), nil
 }
 
+// GetUserByNickname handles the GetUserByNickname gRPC request
+func (s *UserServer) GetUserByNickname(ctx context.Context, req *userpb.GetUserByNicknameRequest) (*userpb.User, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.GetUserByNickname")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.nickname", req.Nickname))
+
+	// Authorized before the lookup, so nobody else learns which nicknames exist
+	if err := s.authorize(ctx, user.ActionRead, uuid.Nil); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "GetUserByNickname")
+	}
+
+	foundUser, err := s.service.GetUserByNickname(ctx, req.Nickname)
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "GetUserByNickname")
+	}
+	return toProtoUser(foundUser), nil
+}
+
 // UpdateUser handles the UpdateUser gRPC request
 func (s *UserServer) UpdateUser(ctx context.Context, req *userpb.UpdateUserRequest) (*userpb.User, error) {
 	ctx, span := s.tracer.Start(ctx, "grpc.UpdateUser")
@@ -99,15 +138,21 @@ func (s *UserServer) UpdateUser(ctx context.Context, req *userpb.UpdateUserReque
 		return nil, status.Errorf(codes.InvalidArgument, "Invalid user ID format: %v", err)
 	}
 
+	if err := s.authorize(ctx, user.ActionUpdate, userID); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "UpdateUser")
+	}
+
 	updateUserReq := &user.User{
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 		Nickname:  req.Nickname,
 		Email:     req.Email,
 		Country:   req.Country,
+		Version:   req.ExpectedVersion,
 	}
 
-	updatedUser, err := s.service.UpdateUser(ctx, userID, updateUserReq)
+	updatedUser, err := s.service.UpdateUser(ctx, userID, updateUserReq, updateFields(req))
 	if err != nil {
 		tracer.AddError(span, err)
 		return nil, s.handleServiceError(ctx, err, "UpdateUser")
@@ -128,6 +173,11 @@ func (s *UserServer) DeleteUser(ctx context.Context, req *userpb.DeleteUserReque
 		return nil, status.Errorf(codes.InvalidArgument, "Invalid user ID format: %v", err)
 	}
 
+	if err := s.authorize(ctx, user.ActionDelete, userID); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "DeleteUser")
+	}
+
 	err = s.service.DeleteUser(ctx, userID)
 	if err != nil {
 		tracer.AddError(span, err)
@@ -136,6 +186,32 @@ func (s *UserServer) DeleteUser(ctx context.Context, req *userpb.DeleteUserReque
 	return &emptypb.Empty{}, nil
 }
 
+// RestoreUser handles the RestoreUser gRPC request
+func (s *UserServer) RestoreUser(ctx context.Context, req *userpb.RestoreUserRequest) (*userpb.User, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.RestoreUser")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", req.Id))
+	userID, err := uuid.Parse(req.Id)
+	if err != nil {
+		s.logger.Warn("invalid user ID format in gRPC request", "id", req.Id, "error", err)
+		tracer.AddError(span, err)
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid user ID format: %v", err)
+	}
+
+	if err := s.authorize(ctx, user.ActionRestore, userID); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "RestoreUser")
+	}
+
+	restoredUser, err := s.service.RestoreUser(ctx, userID)
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "RestoreUser")
+	}
+	return toProtoUser(restoredUser), nil
+}
+
 // ListUsers handles the ListUsers gRPC request
 func (s *UserServer) ListUsers(ctx context.Context, req *userpb.ListUsersRequest) (*userpb.ListUsersResponse, error) {
 	ctx, span := s.tracer.Start(ctx, "grpc.ListUsers")
@@ -146,54 +222,385 @@ func (s *UserServer) ListUsers(ctx context.Context, req *userpb.ListUsersRequest
 		attribute.Int64("limit", int64(req.Limit)),
 		attribute.Bool("order_desc", req.OrderDesc),
 		attribute.String("order_by", req.OrderBy),
+		attribute.Bool("cursor", req.Cursor != ""),
 	)
-	page := 1
-	if req.Page > 0 {
-		page = int(req.Page)
-	}
-
-	limit := 10
-	if req.Limit > 0 {
-		limit = int(req.Limit)
+	if err := s.authorize(ctx, user.ActionList, uuid.Nil); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "ListUsers")
 	}
 
-	// Prepare domain ListParams
-	params := user.ListParams{
-		Limit:     limit,
-		Offset:    (page - 1) * limit,
-		OrderBy:   req.OrderBy,
-		OrderDesc: req.OrderDesc,
-		Filters:   make([]user.Filter, 0),
+	params, pageErr := api.ListPage(int(req.Page), int(req.Limit), req.Cursor)
+	params.OrderBy = req.OrderBy
+	params.OrderDesc = req.OrderDesc
+	if req.IncludeTotal != nil {
+		params.IncludeTotal = *req.IncludeTotal
 	}
 
 	// Convert proto filters to domain filters
 	for _, filter := range req.Filters {
-		if filter.Value != "" {
-			params.Filters = append(params.Filters, user.Filter{
-				Field: filter.Field,
-				Value: filter.Value,
-			})
-		}
+		params.Filters = append(params.Filters, user.Filter{
+			Field:    filter.Field,
+			Operator: user.FilterOperator(filter.Operator),
+			Value:    filter.Value,
+			Values:   filter.Values,
+		})
+	}
+
+	if pageErr != nil {
+		// Report the fields the service would reject alongside the malformed ones
+		err := user.JoinValidationErrors(pageErr, s.service.ValidateListParams(params))
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "ListUsers")
 	}
 
-	users, hasMore, totalCount, err := s.service.ListUsers(ctx, params)
+	result, err := s.service.ListUsers(ctx, params)
 	if err != nil {
 		tracer.AddError(span, err)
 		return nil, s.handleServiceError(ctx, err, "ListUsers")
 	}
 
-	protoUsers := make([]*userpb.User, len(users))
-	for i, u := range users {
+	protoUsers := make([]*userpb.User, len(result.Users))
+	for i, u := range result.Users {
 		protoUsers[i] = toProtoUser(&u)
 	}
 
 	return &userpb.ListUsersResponse{
 		Users:      protoUsers,
-		HasMore:    hasMore,
-		TotalCount: totalCount,
+		HasMore:    result.HasMore,
+		TotalCount: result.TotalCount,
+		NextCursor: result.NextCursor,
+	}, nil
+}
+
+// SearchUsers handles the SearchUsers gRPC request
+func (s *UserServer) SearchUsers(ctx context.Context, req *userpb.SearchUsersRequest) (*userpb.SearchUsersResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.SearchUsers")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int64("limit", int64(req.Limit)))
+	if err := s.authorize(ctx, user.ActionList, uuid.Nil); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "SearchUsers")
+	}
+
+	results, err := s.service.SearchUsers(ctx, req.Query, int(req.Limit))
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "SearchUsers")
+	}
+
+	protoResults := make([]*userpb.SearchResult, len(results))
+	for i, r := range results {
+		protoResults[i] = &userpb.SearchResult{
+			User:  toProtoUser(&r.User),
+			Score: r.Score,
+		}
+	}
+
+	return &userpb.SearchUsersResponse{Results: protoResults}, nil
+}
+
+// Authenticate handles the Authenticate gRPC request
+func (s *UserServer) Authenticate(ctx context.Context, req *userpb.AuthenticateRequest) (*userpb.AuthenticateResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.Authenticate")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.identifier", req.Identifier))
+
+	authenticatedUser, err := s.service.Authenticate(ctx, req.Identifier, req.Password)
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "Authenticate")
+	}
+
+	accessToken, expiresAt, err := s.tokens.Issue(authenticatedUser.ID.String(), []string{string(authenticatedUser.Role)})
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "Authenticate")
+	}
+
+	return &userpb.AuthenticateResponse{
+		User:        toProtoUser(authenticatedUser),
+		AccessToken: accessToken,
+		ExpiresAt:   timestamppb.New(expiresAt),
 	}, nil
 }
 
+// ChangePassword handles the ChangePassword gRPC request
+func (s *UserServer) ChangePassword(ctx context.Context, req *userpb.ChangePasswordRequest) (*emptypb.Empty, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.ChangePassword")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", req.Id))
+	userID, err := uuid.Parse(req.Id)
+	if err != nil {
+		s.logger.Warn("invalid user ID format in gRPC request", "id", req.Id, "error", err)
+		tracer.AddError(span, err)
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid user ID format: %v", err)
+	}
+
+	if err := s.authorize(ctx, user.ActionChangePassword, userID); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "ChangePassword")
+	}
+
+	if err := s.service.ChangePassword(ctx, userID, req.OldPassword, req.NewPassword); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "ChangePassword")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// RequestPasswordReset handles the RequestPasswordReset gRPC request
+func (s *UserServer) RequestPasswordReset(ctx context.Context, req *userpb.RequestPasswordResetRequest) (*userpb.RequestPasswordResetResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.RequestPasswordReset")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.email", req.Email))
+
+	// The token is sent to the user out of band, so the response does not tell
+	// whether the email belongs to a user
+	if err := s.service.RequestPasswordReset(ctx, req.Email); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "RequestPasswordReset")
+	}
+	return &userpb.RequestPasswordResetResponse{}, nil
+}
+
+// ConfirmPasswordReset handles the ConfirmPasswordReset gRPC request
+func (s *UserServer) ConfirmPasswordReset(ctx context.Context, req *userpb.ConfirmPasswordResetRequest) (*emptypb.Empty, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.ConfirmPasswordReset")
+	defer span.End()
+
+	if err := s.service.ConfirmPasswordReset(ctx, req.Token, req.NewPassword); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "ConfirmPasswordReset")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// AssignRole handles the AssignRole gRPC request
+func (s *UserServer) AssignRole(ctx context.Context, req *userpb.AssignRoleRequest) (*userpb.User, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.AssignRole")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", req.Id),
+		attribute.String("user.role", req.Role),
+	)
+	userID, err := uuid.Parse(req.Id)
+	if err != nil {
+		s.logger.Warn("invalid user ID format in gRPC request", "id", req.Id, "error", err)
+		tracer.AddError(span, err)
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid user ID format: %v", err)
+	}
+
+	if err := s.authorize(ctx, user.ActionAssignRole, userID); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "AssignRole")
+	}
+
+	role, err := user.ParseRole(req.Role)
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "AssignRole")
+	}
+
+	updatedUser, err := s.service.AssignRole(ctx, userID, role)
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "AssignRole")
+	}
+	return toProtoUser(updatedUser), nil
+}
+
+// BatchCreateUsers handles the BatchCreateUsers gRPC request
+func (s *UserServer) BatchCreateUsers(ctx context.Context, req *userpb.BatchCreateUsersRequest) (*userpb.BatchCreateUsersResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.BatchCreateUsers")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("batch.size", len(req.Users)),
+		attribute.Bool("batch.all_or_nothing", req.AllOrNothing),
+	)
+	if err := s.authorize(ctx, user.ActionBatchCreate, uuid.Nil); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "BatchCreateUsers")
+	}
+
+	users := make([]*user.User, len(req.Users))
+	for i, u := range req.Users {
+		users[i] = &user.User{
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Nickname:  u.Nickname,
+			Password:  u.Password,
+			Email:     u.Email,
+			Country:   u.Country,
+		}
+	}
+
+	results, err := s.service.BatchCreateUsers(ctx, users, req.AllOrNothing)
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "BatchCreateUsers")
+	}
+
+	resp := &userpb.BatchCreateUsersResponse{Results: make([]*userpb.BatchCreateUserResult, len(results))}
+	for i, result := range results {
+		if result.Err != nil {
+			resp.Results[i] = &userpb.BatchCreateUserResult{Error: toProtoError(result.Err)}
+			resp.Failed++
+			continue
+		}
+		resp.Results[i] = &userpb.BatchCreateUserResult{User: toProtoUser(result.User)}
+		resp.Created++
+	}
+	return resp, nil
+}
+
+// BatchGetUsers handles the BatchGetUsers gRPC request
+func (s *UserServer) BatchGetUsers(ctx context.Context, req *userpb.BatchGetUsersRequest) (*userpb.BatchGetUsersResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "grpc.BatchGetUsers")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch.size", len(req.Ids)))
+	if err := s.authorize(ctx, user.ActionRead, uuid.Nil); err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "BatchGetUsers")
+	}
+
+	ids, err := api.ParseIDs(req.Ids)
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "BatchGetUsers")
+	}
+
+	users, err := s.service.GetUsers(ctx, ids)
+	if err != nil {
+		tracer.AddError(span, err)
+		return nil, s.handleServiceError(ctx, err, "BatchGetUsers")
+	}
+
+	resp := &userpb.BatchGetUsersResponse{Users: make([]*userpb.User, 0, len(users))}
+	for i, u := range users {
+		if u == nil {
+			resp.MissingIds = append(resp.MissingIds, req.Ids[i])
+			continue
+		}
+		resp.Users = append(resp.Users, toProtoUser(u))
+	}
+	return resp, nil
+}
+
+// ExportUsers handles the ExportUsers gRPC request, sending the matching
+// users one message at a time
+func (s *UserServer) ExportUsers(req *userpb.ExportUsersRequest, stream userpb.UserService_ExportUsersServer) error {
+	ctx, span := s.tracer.Start(stream.Context(), "grpc.ExportUsers")
+	defer span.End()
+
+	if err := s.authorize(ctx, user.ActionExport, uuid.Nil); err != nil {
+		tracer.AddError(span, err)
+		return s.handleServiceError(ctx, err, "ExportUsers")
+	}
+
+	filters := make([]user.Filter, len(req.Filters))
+	for i, filter := range req.Filters {
+		filters[i] = user.Filter{
+			Field:    filter.Field,
+			Operator: user.FilterOperator(filter.Operator),
+			Value:    filter.Value,
+			Values:   filter.Values,
+		}
+	}
+
+	sent := 0
+	err := s.service.ExportUsers(ctx, filters, func(u *user.User) error {
+		if err := stream.Send(toProtoUser(u)); err != nil {
+			return err
+		}
+		sent++
+		return nil
+	})
+	span.SetAttributes(attribute.Int("export.sent", sent))
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			// The stream failed, usually because the client went away
+			tracer.AddError(span, err)
+			return err
+		}
+		tracer.AddError(span, err)
+		return s.handleServiceError(ctx, err, "ExportUsers")
+	}
+	return nil
+}
+
+// WatchUsers handles the WatchUsers gRPC request, streaming changes of users
+// until the client goes away. Clients falling too far behind are dropped with
+// ResourceExhausted and may resume with the token of the last change they got.
+func (s *UserServer) WatchUsers(req *userpb.WatchUsersRequest, stream userpb.UserService_WatchUsersServer) error {
+	ctx, span := s.tracer.Start(stream.Context(), "grpc.WatchUsers")
+	defer span.End()
+
+	if err := s.authorize(ctx, user.ActionList, uuid.Nil); err != nil {
+		tracer.AddError(span, err)
+		return s.handleServiceError(ctx, err, "WatchUsers")
+	}
+
+	ids, err := api.ParseIDs(req.UserIds)
+	if err != nil {
+		tracer.AddError(span, err)
+		return s.handleServiceError(ctx, err, "WatchUsers")
+	}
+
+	sub, err := s.watcher.Subscribe(req.ResumeToken, api.EventFilter(req.Country, ids))
+	if err != nil {
+		tracer.AddError(span, err)
+		return watchStatus(err).Err()
+	}
+	defer sub.Close()
+
+	sent := 0
+	defer func() { span.SetAttributes(attribute.Int("watch.sent", sent)) }()
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case n, ok := <-sub.Notifications():
+			if !ok {
+				err := sub.Err()
+				tracer.AddError(span, err)
+				s.logger.Warn("user watcher dropped", "reason", err, "sent", sent)
+				return watchStatus(err).Err()
+			}
+			if err := stream.Send(toProtoUserChange(n)); err != nil {
+				tracer.AddError(span, err)
+				return err
+			}
+			sent++
+		}
+	}
+}
+
+// watchStatus maps the errors of a subscription to the watched changes
+func watchStatus(err error) *status.Status {
+	switch {
+	case errors.Is(err, events.ErrResumeExpired):
+		return status.New(codes.OutOfRange, "The resume token is unknown or expired, watch again without it")
+	case errors.Is(err, events.ErrSlowConsumer):
+		return status.New(codes.ResourceExhausted, "The watcher fell too far behind, resume with the last resume token")
+	case errors.Is(err, events.ErrBroadcasterClosed):
+		return status.New(codes.Unavailable, "The server is shutting down, resume with the last resume token")
+	default:
+		return status.New(codes.Internal, "An internal server error occurred")
+	}
+}
+
+// authorize consults the access policy for the authenticated caller
+func (s *UserServer) authorize(ctx context.Context, action user.Action, targetID uuid.UUID) error {
+	return s.policy.Authorize(ctx, api.PrincipalFromContext(ctx), action, targetID)
+}
+
 // handleServiceError maps domain errors to gRPC status codes
 func (s *UserServer) handleServiceError(ctx context.Context, err error, methodName string) error {
 	s.logger.Error("gRPC service error", "method", methodName, "error", err)
@@ -203,21 +610,129 @@ func (s *UserServer) handleServiceError(ctx context.Context, err error, methodNa
 		tracer.AddError(span, err)
 	}
 
+	return errorStatus(err).Err()
+}
+
+// errorStatus maps a domain error to the gRPC status reporting it
+func errorStatus(err error) *status.Status {
 	switch {
 	case errors.Is(err, user.ErrNotFound):
-		return status.Error(codes.NotFound, err.Error())
+		return status.New(codes.NotFound, err.Error())
 	case errors.Is(err, user.ErrEmailTaken), errors.Is(err, user.ErrNicknameTaken):
-		return status.Error(codes.AlreadyExists, err.Error())
+		return status.New(codes.AlreadyExists, err.Error())
+	case errors.Is(err, user.ErrAlreadyExists):
+		return status.New(codes.AlreadyExists, user.ErrAlreadyExists.Error())
+	case errors.Is(err, user.ErrConflict), errors.Is(err, user.ErrBatchAborted):
+		return status.New(codes.Aborted, err.Error())
+	case errors.Is(err, user.ErrSerialization):
+		return status.New(codes.Aborted, "The request conflicted with a concurrent one, retry it")
+	case errors.Is(err, user.ErrTimeout):
+		return status.New(codes.Unavailable, "The request timed out, retry it later")
+	case errors.Is(err, user.ErrNicknameCooldown):
+		return status.New(codes.FailedPrecondition, err.Error())
 	case errors.Is(err, user.ErrValidation):
-		return status.Error(codes.InvalidArgument, err.Error())
+		return validationStatus(err)
+	case errors.Is(err, user.ErrInvalidResetToken):
+		return status.New(codes.InvalidArgument, err.Error())
+	case errors.Is(err, user.ErrInvalidCredentials):
+		return status.New(codes.Unauthenticated, err.Error())
+	case errors.Is(err, user.ErrForbidden), errors.Is(err, user.ErrBanned):
+		return status.New(codes.PermissionDenied, err.Error())
 	default:
-		return status.Error(codes.Internal, "An internal server error occurred")
+		return status.New(codes.Internal, "An internal server error occurred")
+	}
+}
+
+// validationStatus returns an InvalidArgument status carrying a BadRequest
+// detail with a violation for each invalid field
+func validationStatus(err error) *status.Status {
+	st := status.New(codes.InvalidArgument, err.Error())
+
+	details := user.ValidationDetails(err)
+	fields := make([]string, 0, len(details))
+	for field := range details {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	badRequest := &errdetails.BadRequest{}
+	for _, field := range fields {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: details[field],
+		})
+	}
+	if withDetails, detailErr := st.WithDetails(badRequest); detailErr == nil {
+		st = withDetails
+	}
+	return st
+}
+
+// toProtoError converts a domain error to the Error message of per-item
+// results, named after the gRPC status code the error maps to
+func toProtoError(err error) *userpb.Error {
+	st := errorStatus(err)
+	return &userpb.Error{
+		Code:    codeName(st.Code()),
+		Message: st.Message(),
+		Details: user.ValidationDetails(err),
+	}
+}
+
+// codeName is the snake case name of c, e.g. already_exists
+func codeName(c codes.Code) string {
+	var b strings.Builder
+	for i, r := range c.String() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// updateFields returns the fields in the update mask, or else the non-empty fields, of req
+func updateFields(req *userpb.UpdateUserRequest) []user.Field {
+	if paths := req.GetUpdateMask().GetPaths(); len(paths) > 0 {
+		fields := make([]user.Field, len(paths))
+		for i, path := range paths {
+			fields[i] = user.Field(path)
+		}
+		return fields
+	}
+
+	values := map[user.Field]string{
+		user.FieldFirstName: req.FirstName,
+		user.FieldLastName:  req.LastName,
+		user.FieldNickname:  req.Nickname,
+		user.FieldEmail:     req.Email,
+		user.FieldCountry:   req.Country,
+	}
+	var fields []user.Field
+	for _, field := range user.UpdatableFields {
+		if values[field] != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func toProtoUserChange(n events.Notification) *userpb.UserChange {
+	return &userpb.UserChange{
+		EventId:     n.Event.ID,
+		Type:        string(n.Event.Type),
+		User:        toProtoUser(n.Event.User),
+		ChangedAt:   timestamppb.New(n.Event.Timestamp),
+		ResumeToken: n.Token,
 	}
 }
 
 // toProtoUser converts a domain user to a gRPC user message
 func toProtoUser(u *user.User) *userpb.User {
-	return &userpb.User{
+	pb := &userpb.User{
 		Id:        u.ID.String(),
 		FirstName: u.FirstName,
 		LastName:  u.LastName,
@@ -226,5 +741,12 @@ func toProtoUser(u *user.User) *userpb.User {
 		Country:   u.Country,
 		CreatedAt: timestamppb.New(u.CreatedAt),
 		UpdatedAt: timestamppb.New(u.UpdatedAt),
+		Role:      string(u.Role),
+		Version:   u.Version,
+		BanReason: u.BanReason,
+	}
+	if u.BannedAt != nil {
+		pb.BannedAt = timestamppb.New(*u.BannedAt)
 	}
+	return pb
 }
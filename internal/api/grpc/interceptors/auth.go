@@ -0,0 +1,78 @@
+package interceptors
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
+)
+
+// publicMethods can be called without an access token
+var publicMethods = map[string]bool{
+	"/user.UserService/CreateUser":           true,
+	"/user.UserService/Authenticate":         true,
+	"/user.UserService/RequestPasswordReset": true,
+	"/user.UserService/ConfirmPasswordReset": true,
+}
+
+// UnaryAuthInterceptor returns a new unary server interceptor that requires a
+// valid bearer token in the "authorization" metadata and stores its claims in
+// the request context
+func UnaryAuthInterceptor(tokens *token.Manager, logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, info.FullMethod, tokens, logger)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor returns a new stream server interceptor that requires
+// a valid bearer token like UnaryAuthInterceptor, storing its claims in the
+// context of the stream
+func StreamAuthInterceptor(tokens *token.Manager, logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), info.FullMethod, tokens, logger)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate verifies the bearer token of a call to method unless the
+// method is public, returning ctx with the token's claims
+func authenticate(ctx context.Context, method string, tokens *token.Manager, logger *slog.Logger) (context.Context, error) {
+	if publicMethods[method] {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	scheme, raw, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || raw == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	claims, err := tokens.Verify(raw)
+	if err != nil {
+		logger.Warn("invalid access token",
+			"method", method,
+			"error", err,
+		)
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+
+	return token.NewContext(ctx, claims), nil
+}
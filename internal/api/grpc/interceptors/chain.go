@@ -0,0 +1,138 @@
+package interceptors
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	"github.com/bentalebwael/faceit-users-service/internal/platform/ratelimiter"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
+)
+
+// stage is the position of an interceptor in a Chain
+type stage int
+
+// The stages of a Chain from the outermost to the innermost. Request IDs come
+// first so that everything after can log them, and recovery right after so
+// that it catches panics in the rest of the chain too.
+const (
+	stageRequestID stage = iota
+	stageRecovery
+	stageTracing
+	stageLogging
+	stageDeadline
+	stageRateLimit
+	stageAuth
+	numStages
+)
+
+// Chain is the set of unary and streaming interceptors a gRPC server runs
+// every call through. Only the interceptors selected by its options are
+// installed, always in the same order whatever the order of the options.
+type Chain struct {
+	unary  [numStages]grpc.UnaryServerInterceptor
+	stream [numStages]grpc.StreamServerInterceptor
+}
+
+// ChainOption adds an interceptor to a Chain
+type ChainOption func(*Chain)
+
+// NewChain creates a chain of the interceptors selected by opts
+func NewChain(opts ...ChainOption) *Chain {
+	c := &Chain{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithRequestID gives every call a request ID, see RequestIDFromContext
+func WithRequestID() ChainOption {
+	return func(c *Chain) {
+		c.unary[stageRequestID] = UnaryRequestIDInterceptor()
+		c.stream[stageRequestID] = StreamRequestIDInterceptor()
+	}
+}
+
+// WithRecovery turns panics in handlers into Internal errors
+func WithRecovery(logger *slog.Logger) ChainOption {
+	return func(c *Chain) {
+		c.unary[stageRecovery] = UnaryRecoveryInterceptor(logger)
+		c.stream[stageRecovery] = StreamRecoveryInterceptor(logger)
+	}
+}
+
+// WithTracing traces every call with a server span of tracerProvider,
+// continuing the trace context propagator extracts from the call's metadata
+func WithTracing(tracerProvider trace.TracerProvider, propagator propagation.TextMapPropagator) ChainOption {
+	return func(c *Chain) {
+		c.unary[stageTracing] = UnaryTracingInterceptor(tracerProvider, propagator)
+		c.stream[stageTracing] = StreamTracingInterceptor(tracerProvider, propagator)
+	}
+}
+
+// WithLogging logs the start and end of every call
+func WithLogging(logger *slog.Logger) ChainOption {
+	return func(c *Chain) {
+		c.unary[stageLogging] = UnaryLoggingInterceptor(logger)
+		c.stream[stageLogging] = StreamLoggingInterceptor(logger)
+	}
+}
+
+// WithDeadlines limits how long unary and streaming calls may run; a zero
+// timeout leaves the calls of that kind unlimited
+func WithDeadlines(unaryTimeout, streamTimeout time.Duration) ChainOption {
+	return func(c *Chain) {
+		c.unary[stageDeadline] = UnaryDeadlineInterceptor(unaryTimeout)
+		c.stream[stageDeadline] = StreamDeadlineInterceptor(streamTimeout)
+	}
+}
+
+// WithRateLimit rejects calls over the quota of their caller
+func WithRateLimit(limiter *ratelimiter.RateLimiter, logger *slog.Logger) ChainOption {
+	return func(c *Chain) {
+		c.unary[stageRateLimit] = UnaryRateLimitInterceptor(limiter, logger)
+		c.stream[stageRateLimit] = StreamRateLimitInterceptor(limiter, logger)
+	}
+}
+
+// WithAuth requires a valid bearer token for every non-public method
+func WithAuth(tokens *token.Manager, logger *slog.Logger) ChainOption {
+	return func(c *Chain) {
+		c.unary[stageAuth] = UnaryAuthInterceptor(tokens, logger)
+		c.stream[stageAuth] = StreamAuthInterceptor(tokens, logger)
+	}
+}
+
+// ServerOptions returns the options installing the chain on a gRPC server
+func (c *Chain) ServerOptions() []grpc.ServerOption {
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	for i := range numStages {
+		if c.unary[i] != nil {
+			unary = append(unary, c.unary[i])
+		}
+		if c.stream[i] != nil {
+			stream = append(stream, c.stream[i])
+		}
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
+
+// contextStream is a server stream whose context was replaced by an
+// interceptor, e.g. to carry the caller's claims
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,148 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/ratelimiter"
+)
+
+// serve runs the health service behind chain and returns a client of it
+func serve(t *testing.T, chain *Chain) healthpb.HealthClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(chain.ServerOptions()...)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestChain_RequestIDAndTracing(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	client := serve(t, NewChain(
+		WithTracing(tracerProvider, propagation.TraceContext{}),
+		WithRequestID(),
+	))
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		RequestIDKey, "req-1",
+		"traceparent", "00-"+traceID+"-00f067aa0ba902b7-01",
+	)
+
+	var header metadata.MD
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"req-1"}, header.Get(RequestIDKey))
+
+	stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	header, err = stream.Header()
+	require.NoError(t, err)
+	require.Len(t, header.Get(RequestIDKey), 1)
+	assert.NotEmpty(t, header.Get(RequestIDKey)[0], "a request ID is generated when the caller sends none")
+
+	ended := spans.Ended()
+	require.Len(t, ended, 1, "the span of the stream ends with the stream")
+	span := ended[0]
+	assert.Equal(t, "grpc.health.v1.Health/Check", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+}
+
+func TestChain_RateLimit(t *testing.T) {
+	limiter := ratelimiter.NewLimiter(&config.Config{Rate: config.RateConfig{RequestsPerSecond: 1, Burst: 1}})
+	client := serve(t, NewChain(WithRateLimit(limiter, slog.New(slog.NewTextHandler(io.Discard, nil)))))
+
+	var trailer metadata.MD
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0"}, trailer.Get("ratelimit-remaining"))
+	assert.Empty(t, trailer.Get("retry-after"))
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"1"}, trailer.Get("retry-after"))
+}
+
+func TestRecoveryInterceptors(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	_, err := UnaryRecoveryInterceptor(logger)(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Unary"},
+		func(context.Context, interface{}) (interface{}, error) { panic("boom") })
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, logs.String(), `"panic":"boom"`)
+	assert.Contains(t, logs.String(), "runtime/debug.Stack")
+
+	err = StreamRecoveryInterceptor(logger)(nil, &contextStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"},
+		func(interface{}, grpc.ServerStream) error { panic("boom") })
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, logs.String(), `"method":"/test/Stream"`)
+}
+
+func TestDeadlineInterceptors(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Unary"}
+	deadline := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		d, ok := ctx.Deadline()
+		if !ok {
+			return time.Duration(0), nil
+		}
+		return time.Until(d), nil
+	}
+
+	got, err := UnaryDeadlineInterceptor(time.Minute)(context.Background(), nil, info, deadline)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, got, float64(time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err = UnaryDeadlineInterceptor(time.Minute)(ctx, nil, info, deadline)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, got, time.Second, "an earlier deadline of the caller is kept")
+
+	got, err = UnaryDeadlineInterceptor(0)(context.Background(), nil, info, deadline)
+	require.NoError(t, err)
+	assert.Zero(t, got, "a zero timeout sets no deadline")
+
+	err = StreamDeadlineInterceptor(time.Minute)(nil, &contextStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"},
+		func(_ interface{}, ss grpc.ServerStream) error {
+			_, ok := ss.Context().Deadline()
+			assert.True(t, ok)
+			return nil
+		})
+	assert.NoError(t, err)
+}
@@ -15,31 +15,62 @@ func UnaryLoggingInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		start := time.Now()
 		method := info.FullMethod
+		requestID := RequestIDFromContext(ctx)
 
 		logger.Info("gRPC request started",
 			"method", method,
+			"request_id", requestID,
 			"request", fmt.Sprintf("%+v", req),
 		)
 
 		resp, err := handler(ctx, req)
 		duration := time.Since(start)
 
-		// Determine status code
-		code := codes.OK
-		if err != nil {
-			if s, ok := status.FromError(err); ok {
-				code = s.Code()
-			} else {
-				code = codes.Internal
-			}
-		}
-
 		logger.Info("gRPC request completed",
 			"method", method,
+			"request_id", requestID,
 			"duration", duration,
-			"status", code.String(),
+			"status", statusCode(err).String(),
 		)
 
 		return resp, err
 	}
 }
+
+// StreamLoggingInterceptor is UnaryLoggingInterceptor for streaming calls
+func StreamLoggingInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		method := info.FullMethod
+		requestID := RequestIDFromContext(ss.Context())
+
+		logger.Info("gRPC stream started",
+			"method", method,
+			"request_id", requestID,
+		)
+
+		err := handler(srv, ss)
+		duration := time.Since(start)
+
+		logger.Info("gRPC stream completed",
+			"method", method,
+			"request_id", requestID,
+			"duration", duration,
+			"status", statusCode(err).String(),
+		)
+
+		return err
+	}
+}
+
+// statusCode returns the status code of err, treating errors that carry none
+// as internal ones
+func statusCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	return codes.Internal
+}
@@ -6,21 +6,62 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	"github.com/bentalebwael/faceit-users-service/internal/platform/ratelimiter"
 )
 
-// UnaryRateLimitInterceptor returns a new unary server interceptor for rate limiting
+// UnaryRateLimitInterceptor returns a new unary server interceptor for rate
+// limiting. Calls are limited per client and per method, and the state of the
+// client's quota is reported in the ratelimit-* trailers.
 func UnaryRateLimitInterceptor(limiter *ratelimiter.RateLimiter, logger *slog.Logger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		if !limiter.Allow() {
-			logger.Warn("rate limit exceeded",
-				"method", info.FullMethod,
-			)
+		result := checkRate(ctx, info.FullMethod, limiter, logger)
+		if err := grpc.SetTrailer(ctx, metadata.New(result.Fields())); err != nil {
+			logger.Warn("failed to set rate limit trailers", "method", info.FullMethod, "error", err)
+		}
+		if !result.Allowed {
 			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
 		}
 
 		return handler(ctx, req)
 	}
 }
+
+// StreamRateLimitInterceptor is UnaryRateLimitInterceptor for streaming
+// calls, which count as a single request however many messages they carry
+func StreamRateLimitInterceptor(limiter *ratelimiter.RateLimiter, logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		result := checkRate(ss.Context(), info.FullMethod, limiter, logger)
+		ss.SetTrailer(metadata.New(result.Fields()))
+		if !result.Allowed {
+			return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// checkRate counts a call to method against the quota of its caller
+func checkRate(ctx context.Context, method string, limiter *ratelimiter.RateLimiter, logger *slog.Logger) ratelimiter.Result {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var authorization, remoteAddr string
+	if values := md.Get("authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+	client := limiter.Client(authorization, remoteAddr, md.Get("x-forwarded-for"))
+
+	result, err := limiter.Allow(ctx, method, client)
+	if err != nil {
+		logger.Error("rate limit check failed, allowing call", "method", method, "error", err)
+	}
+	if !result.Allowed {
+		logger.Warn("rate limit exceeded", "method", method, "client", client)
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package interceptors
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDKey is the metadata key carrying the request ID of a call, both in
+// the request and in the response headers
+const RequestIDKey = "x-request-id"
+
+// maxRequestIDLength bounds request IDs taken from callers, which end up in logs
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// UnaryRequestIDInterceptor returns a new unary server interceptor that gives
+// every call a request ID: the one in the x-request-id metadata of the call,
+// or a new one. The ID is returned in the x-request-id response header.
+func UnaryRequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := requestID(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, id))
+		return handler(context.WithValue(ctx, requestIDKey{}, id), req)
+	}
+}
+
+// StreamRequestIDInterceptor is UnaryRequestIDInterceptor for streaming calls
+func StreamRequestIDInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		id := requestID(ctx)
+		_ = ss.SetHeader(metadata.Pairs(RequestIDKey, id))
+		return handler(srv, &contextStream{ServerStream: ss, ctx: context.WithValue(ctx, requestIDKey{}, id)})
+	}
+}
+
+// RequestIDFromContext returns the request ID of the call ctx belongs to, or
+// "" outside the request ID interceptors
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestID returns the request ID the caller sent, or a new one if it sent
+// none or an unreasonably long one
+func requestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(RequestIDKey); len(values) > 0 && values[0] != "" && len(values[0]) <= maxRequestIDLength {
+		return values[0]
+	}
+	return uuid.NewString()
+}
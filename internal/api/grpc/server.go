@@ -10,6 +10,8 @@ import (
 
 	pb "github.com/bentalebwael/faceit-users-service/internal/api/grpc/gen/user"
 	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	"github.com/bentalebwael/faceit-users-service/internal/events"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
 )
 
 type Server struct {
@@ -19,7 +21,7 @@ type Server struct {
 	service *user.Service
 }
 
-func NewServer(port int, service *user.Service, logger *slog.Logger, opts ...grpc.ServerOption) *Server {
+func NewServer(port int, service *user.Service, policy *user.Policy, tokens *token.Manager, watcher *events.Broadcaster, logger *slog.Logger, opts ...grpc.ServerOption) *Server {
 	grpcServer := grpc.NewServer(opts...)
 
 	server := &Server{
@@ -29,7 +31,7 @@ func NewServer(port int, service *user.Service, logger *slog.Logger, opts ...grp
 		service: service,
 	}
 
-	pb.RegisterUserServiceServer(grpcServer, NewUserServer(service, logger))
+	pb.RegisterUserServiceServer(grpcServer, NewUserServer(service, policy, tokens, watcher, logger))
 
 	// Register reflection service for development tools
 	reflection.Register(grpcServer)
@@ -8,6 +8,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/redis/go-redis/v9"
 	"github.com/segmentio/kafka-go"
+
+	"github.com/bentalebwael/faceit-users-service/internal/platform/postgres"
 )
 
 const (
@@ -21,10 +23,23 @@ type HealthStatus struct {
 }
 
 type Details struct {
-	Database  string    `json:"database"`
-	Redis     string    `json:"redis"`
-	Kafka     string    `json:"kafka"`
-	Timestamp time.Time `json:"timestamp"`
+	Database  string         `json:"database"`
+	Redis     string         `json:"redis"`
+	Kafka     string         `json:"kafka"`
+	Schema    *SchemaDetails `json:"schema,omitempty"` // Set when the schema is checked
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// SchemaDetails reports the database schema version against the migrations
+// known to the binary; the schema is unhealthy when dirty or behind
+type SchemaDetails struct {
+	Status string `json:"status"`
+	*postgres.MigrationStatus
+}
+
+// SchemaChecker reports the migration status of the database schema
+type SchemaChecker interface {
+	Status(ctx context.Context) (*postgres.MigrationStatus, error)
 }
 
 // HealthChecker performs health checks on dependencies
@@ -32,16 +47,31 @@ type HealthChecker struct {
 	db     *sqlx.DB
 	redis  *redis.Client
 	kafka  *kafka.Writer
+	schema SchemaChecker
 	logger *slog.Logger
 }
 
-func NewHealthChecker(db *sqlx.DB, redis *redis.Client, kafka *kafka.Writer, logger *slog.Logger) *HealthChecker {
-	return &HealthChecker{
+// HealthOption configures optional checks of the HealthChecker
+type HealthOption func(*HealthChecker)
+
+// WithSchemaCheck also checks that the database schema is clean and up to date
+func WithSchemaCheck(schema SchemaChecker) HealthOption {
+	return func(h *HealthChecker) {
+		h.schema = schema
+	}
+}
+
+func NewHealthChecker(db *sqlx.DB, redis *redis.Client, kafka *kafka.Writer, logger *slog.Logger, opts ...HealthOption) *HealthChecker {
+	h := &HealthChecker{
 		db:     db,
 		redis:  redis,
 		kafka:  kafka,
 		logger: logger,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Check performs health checks on all dependencies
@@ -90,9 +120,14 @@ func (h *HealthChecker) Check(ctx context.Context) *HealthStatus {
 		}
 	}
 
+	if h.schema != nil {
+		status.Details.Schema = h.checkSchema(ctx)
+	}
+
 	if status.Details.Database == Healthy &&
 		status.Details.Redis == Healthy &&
-		status.Details.Kafka == Healthy {
+		status.Details.Kafka == Healthy &&
+		(status.Details.Schema == nil || status.Details.Schema.Status == Healthy) {
 		status.Status = Healthy
 	} else {
 		status.Status = Unhealthy
@@ -100,3 +135,19 @@ func (h *HealthChecker) Check(ctx context.Context) *HealthStatus {
 
 	return status
 }
+
+func (h *HealthChecker) checkSchema(ctx context.Context) *SchemaDetails {
+	migrationStatus, err := h.schema.Status(ctx)
+	if err != nil {
+		h.logger.Error("schema health check failed", "error", err)
+		return &SchemaDetails{Status: Unhealthy}
+	}
+
+	details := &SchemaDetails{Status: Healthy, MigrationStatus: migrationStatus}
+	if migrationStatus.Dirty || migrationStatus.Behind() {
+		h.logger.Error("database schema is not up to date",
+			"version", migrationStatus.Version, "dirty", migrationStatus.Dirty, "pending", migrationStatus.Pending)
+		details.Status = Unhealthy
+	}
+	return details
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/platform/postgres"
 )
 
 // mockNetAddr implements net.Addr for testing Kafka writer address.
@@ -146,3 +148,67 @@ func TestHealthChecker_Check_MultipleUnhealthy(t *testing.T) {
 	assert.NoError(t, dbMock.ExpectationsWereMet())
 	assert.NoError(t, redisMock.ExpectationsWereMet())
 }
+
+// mockSchemaChecker returns a fixed migration status
+type mockSchemaChecker struct {
+	status *postgres.MigrationStatus
+	err    error
+}
+
+func (m *mockSchemaChecker) Status(ctx context.Context) (*postgres.MigrationStatus, error) {
+	return m.status, m.err
+}
+
+func TestHealthChecker_Check_Schema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema *mockSchemaChecker
+		want   string
+	}{
+		{
+			name:   "up to date",
+			schema: &mockSchemaChecker{status: &postgres.MigrationStatus{Version: 8, Latest: 8}},
+			want:   Healthy,
+		},
+		{
+			name:   "behind",
+			schema: &mockSchemaChecker{status: &postgres.MigrationStatus{Version: 7, Latest: 8, Pending: 1}},
+			want:   Unhealthy,
+		},
+		{
+			name:   "dirty",
+			schema: &mockSchemaChecker{status: &postgres.MigrationStatus{Version: 8, Dirty: true, Latest: 8}},
+			want:   Unhealthy,
+		},
+		{
+			name:   "status error",
+			schema: &mockSchemaChecker{err: errors.New("db connection failed")},
+			want:   Unhealthy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlxDB, dbMock, redisClient, redisMock, kafkaWriter, _ := setupMocks(t)
+			hc := NewHealthChecker(sqlxDB, redisClient, kafkaWriter, discardLogger(), WithSchemaCheck(tt.schema))
+
+			dbMock.ExpectPing().WillReturnError(nil)
+			redisMock.ExpectPing().SetVal("PONG")
+
+			status := hc.Check(context.Background())
+
+			require.NotNil(t, status.Details.Schema)
+			assert.Equal(t, tt.want, status.Details.Schema.Status)
+			assert.Equal(t, tt.schema.status, status.Details.Schema.MigrationStatus)
+			assert.Equal(t, Unhealthy, status.Status) // Kafka check will fail
+		})
+	}
+
+	t.Run("not checked without a schema checker", func(t *testing.T) {
+		_, dbMock, _, redisMock, _, hc := setupMocks(t)
+		dbMock.ExpectPing().WillReturnError(nil)
+		redisMock.ExpectPing().SetVal("PONG")
+
+		assert.Nil(t, hc.Check(context.Background()).Details.Schema)
+	})
+}
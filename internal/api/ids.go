@@ -0,0 +1,25 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// ParseIDs parses the user IDs of a batch request, reporting every malformed
+// one as user.ValidationErrors on the field ids[index]
+func ParseIDs(raw []string) ([]uuid.UUID, error) {
+	var errs []error
+	ids := make([]uuid.UUID, len(raw))
+	for i, s := range raw {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			errs = append(errs, user.NewValidationError(fmt.Sprintf("ids[%d]", i), "must be a UUID"))
+			continue
+		}
+		ids[i] = id
+	}
+	return ids, user.JoinValidationErrors(errs...)
+}
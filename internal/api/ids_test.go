@@ -0,0 +1,22 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func TestParseIDs(t *testing.T) {
+	id := uuid.New()
+
+	ids, err := ParseIDs([]string{id.String(), id.String()})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{id, id}, ids)
+
+	_, err = ParseIDs([]string{"nope", id.String(), ""})
+	assert.Equal(t, map[string]string{"ids[0]": "must be a UUID", "ids[2]": "must be a UUID"}, user.ValidationDetails(err))
+}
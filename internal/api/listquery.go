@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// DefaultListLimit is the page size of list requests that do not set one
+const DefaultListLimit = 10
+
+// ListPage builds the pagination part of list params from a 1-based page, a
+// page size and the cursor of a previous page. Zero page and limit select the
+// defaults; the limit is checked against the maximum by the service.
+func ListPage(page, limit int, cursor string) (user.ListParams, error) {
+	var errs []error
+	if page < 0 {
+		errs = append(errs, user.NewValidationError("page", "must be a positive integer"))
+		page = 0
+	}
+	if page > 1 && cursor != "" {
+		errs = append(errs, user.NewValidationError("page", "cannot be combined with cursor"))
+	}
+	if page == 0 {
+		page = 1
+	}
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+
+	params := user.ListParams{
+		Limit:     limit,
+		Offset:    (page - 1) * limit,
+		OrderBy:   "created_at",
+		OrderDesc: true,
+		Filters:   make([]user.Filter, 0),
+		Cursor:    cursor,
+		// Offset clients have always received the total, cursor clients opt in
+		IncludeTotal: cursor == "",
+	}
+	if params.Offset < 0 {
+		params.Offset = 0 // A negative limit is reported by the service
+	}
+	return params, user.JoinValidationErrors(errs...)
+}
+
+// ParseListQuery parses the query string of a list request. page, limit,
+// cursor, order_by, order_desc and include_total control pagination and
+// sorting; every other parameter is a filter written as field=value or
+// field[operator]=value, with comma separated values for the in operator.
+//
+// Malformed parameters are reported together as user.ValidationErrors naming
+// each of them, while the returned params fall back to defaults for them so
+// the rest can still be validated by the service.
+func ParseListQuery(query url.Values) (user.ListParams, error) {
+	var errs []error
+	single := func(key string) string {
+		values := query[key]
+		if len(values) > 1 {
+			errs = append(errs, user.NewValidationError(key, "must be given only once"))
+		}
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	}
+	integer := func(key string) int {
+		raw := single(key)
+		if raw == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			errs = append(errs, user.NewValidationError(key, "must be a positive integer"))
+			return 0
+		}
+		return n
+	}
+	boolean := func(key string) (bool, bool) {
+		raw := single(key)
+		if raw == "" {
+			return false, false
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs = append(errs, user.NewValidationError(key, "must be true or false"))
+			return false, false
+		}
+		return b, true
+	}
+
+	params, err := ListPage(integer("page"), integer("limit"), single("cursor"))
+	errs = append(errs, err)
+
+	if orderBy := single("order_by"); orderBy != "" {
+		params.OrderBy = orderBy
+	}
+	if orderDesc, ok := boolean("order_desc"); ok {
+		params.OrderDesc = orderDesc
+	}
+	if includeTotal, ok := boolean("include_total"); ok {
+		params.IncludeTotal = includeTotal
+	}
+
+	filters := make(url.Values, len(query))
+	for key, values := range query {
+		if _, ok := listControlParams[key]; !ok {
+			filters[key] = values
+		}
+	}
+	params.Filters, err = ParseFilters(filters)
+	errs = append(errs, err)
+
+	return params, user.JoinValidationErrors(errs...)
+}
+
+// ParseFilters parses every parameter of query as a filter written as
+// field=value or field[operator]=value, reporting the malformed ones together
+// as user.ValidationErrors
+func ParseFilters(query url.Values) ([]user.Filter, error) {
+	// Sorted so the same query always yields the same SQL
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	filters := make([]user.Filter, 0, len(keys))
+	for _, key := range keys {
+		filter, err := parseFilter(key, query[key])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		filters = append(filters, filter)
+	}
+	return filters, user.JoinValidationErrors(errs...)
+}
+
+// listControlParams are the list query parameters that are not filters
+var listControlParams = map[string]struct{}{
+	"page":          {},
+	"limit":         {},
+	"cursor":        {},
+	"order_by":      {},
+	"order_desc":    {},
+	"include_total": {},
+}
+
+// parseFilter turns the query parameter key=values into a filter, reading the
+// operator from a key of the form field[operator]
+func parseFilter(key string, values []string) (user.Filter, error) {
+	if len(values) > 1 {
+		return user.Filter{}, user.NewValidationError(key, "must be given only once")
+	}
+	if len(values) == 0 || values[0] == "" {
+		return user.Filter{}, user.NewValidationError(key, "must not be empty")
+	}
+
+	filter := user.Filter{Field: key, Value: values[0]}
+	if field, rest, ok := strings.Cut(key, "["); ok {
+		operator, ok := strings.CutSuffix(rest, "]")
+		if !ok || field == "" || operator == "" {
+			return user.Filter{}, user.NewValidationError(key, "must be written as field or field[operator]")
+		}
+		filter.Field = field
+		filter.Operator = user.FilterOperator(operator)
+	}
+	if filter.Operator == user.OpIn {
+		filter.Values = strings.Split(filter.Value, ",")
+	}
+	return filter, nil
+}
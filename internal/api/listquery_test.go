@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func TestParseListQuery(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		params, err := ParseListQuery(url.Values{})
+		require.NoError(t, err)
+		assert.Equal(t, DefaultListLimit, params.Limit)
+		assert.Equal(t, 0, params.Offset)
+		assert.Equal(t, "created_at", params.OrderBy)
+		assert.True(t, params.OrderDesc)
+		assert.True(t, params.IncludeTotal)
+		assert.Empty(t, params.Filters)
+	})
+
+	t.Run("pagination and sorting are not filters", func(t *testing.T) {
+		query, _ := url.ParseQuery("page=3&limit=20&order_by=nickname&order_desc=false&include_total=false&country[in]=DE,FR&nickname=jo")
+		params, err := ParseListQuery(query)
+		require.NoError(t, err)
+		assert.Equal(t, 20, params.Limit)
+		assert.Equal(t, 40, params.Offset)
+		assert.Equal(t, "nickname", params.OrderBy)
+		assert.False(t, params.OrderDesc)
+		assert.False(t, params.IncludeTotal)
+		assert.Equal(t, []user.Filter{
+			{Field: "country", Operator: user.OpIn, Value: "DE,FR", Values: []string{"DE", "FR"}},
+			{Field: "nickname", Value: "jo"},
+		}, params.Filters)
+	})
+
+	t.Run("cursor skips the total by default", func(t *testing.T) {
+		params, err := ParseListQuery(url.Values{"cursor": {"abc.def"}})
+		require.NoError(t, err)
+		assert.Equal(t, "abc.def", params.Cursor)
+		assert.False(t, params.IncludeTotal)
+	})
+
+	t.Run("reports every malformed parameter", func(t *testing.T) {
+		query, _ := url.ParseQuery("page=0&limit=ten&order_desc=maybe&include_total=1&country[in=DE&email=&nickname=a&nickname=b")
+		params, err := ParseListQuery(query)
+		require.Error(t, err)
+		assert.True(t, user.IsValidationError(err))
+		assert.Equal(t, map[string]string{
+			"page":       "must be a positive integer",
+			"limit":      "must be a positive integer",
+			"order_desc": "must be true or false",
+			"country[in": "must be written as field or field[operator]",
+			"email":      "must not be empty",
+			"nickname":   "must be given only once",
+		}, user.ValidationDetails(err))
+
+		// Malformed values fall back to defaults so the rest can be validated
+		assert.Equal(t, DefaultListLimit, params.Limit)
+		assert.True(t, params.OrderDesc)
+		assert.True(t, params.IncludeTotal)
+	})
+
+	t.Run("page cannot be combined with cursor", func(t *testing.T) {
+		_, err := ParseListQuery(url.Values{"page": {"2"}, "cursor": {"abc.def"}})
+		assert.Equal(t, map[string]string{"page": "cannot be combined with cursor"}, user.ValidationDetails(err))
+	})
+}
+
+func TestListPage(t *testing.T) {
+	params, err := ListPage(0, 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultListLimit, params.Limit)
+	assert.Equal(t, 0, params.Offset)
+
+	params, err = ListPage(2, 25, "")
+	require.NoError(t, err)
+	assert.Equal(t, 25, params.Offset)
+
+	_, err = ListPage(-1, 10, "")
+	assert.Equal(t, map[string]string{"page": "must be a positive integer"}, user.ValidationDetails(err))
+
+	// The service rejects the negative limit, the offset must not add to it
+	params, err = ListPage(3, -5, "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, params.Offset)
+}
+
+func TestParseFilters(t *testing.T) {
+	query, _ := url.ParseQuery("role=admin&country[in]=DE,FR&nickname[bogus=jo")
+	filters, err := ParseFilters(query)
+	assert.Equal(t, map[string]string{"nickname[bogus": "must be written as field or field[operator]"}, user.ValidationDetails(err))
+	assert.Equal(t, []user.Filter{
+		{Field: "country", Operator: user.OpIn, Value: "DE,FR", Values: []string{"DE", "FR"}},
+		{Field: "role", Value: "admin"},
+	}, filters)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// ParseMergePatch parses an RFC 7396 JSON merge patch of a user into the
+// changes and the fields it sets, sorted by name. A member with a string value
+// sets the field and a null member clears it; members that are not updatable
+// fields are passed through for the service to reject.
+//
+// A patch that is not a JSON object is reported as a plain error, while
+// members of the wrong type are reported together as user.ValidationErrors.
+func ParseMergePatch(body []byte) (*user.User, []user.Field, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return nil, nil, user.ErrInvalidInput
+	}
+
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changes := &user.User{}
+	fields := make([]user.Field, 0, len(names))
+	var errs []error
+	for _, name := range names {
+		field := user.Field(name)
+		fields = append(fields, field)
+		if !field.IsUpdatable() {
+			continue
+		}
+
+		var value string
+		if raw := members[name]; !bytes.Equal(raw, []byte("null")) {
+			if err := json.Unmarshal(raw, &value); err != nil {
+				errs = append(errs, user.NewValidationError(name, "must be a string or null"))
+				continue
+			}
+		}
+		setField(changes, field, value)
+	}
+
+	return changes, fields, user.JoinValidationErrors(errs...)
+}
+
+// setField sets the updatable field of u to value
+func setField(u *user.User, field user.Field, value string) {
+	switch field {
+	case user.FieldFirstName:
+		u.FirstName = value
+	case user.FieldLastName:
+		u.LastName = value
+	case user.FieldNickname:
+		u.Nickname = value
+	case user.FieldEmail:
+		u.Email = value
+	case user.FieldCountry:
+		u.Country = value
+	}
+}
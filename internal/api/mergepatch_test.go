@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func TestParseMergePatch(t *testing.T) {
+	t.Run("set and clear", func(t *testing.T) {
+		changes, fields, err := ParseMergePatch([]byte(`{"nickname": "jd", "last_name": null}`))
+		require.NoError(t, err)
+		assert.Equal(t, []user.Field{user.FieldLastName, user.FieldNickname}, fields)
+		assert.Equal(t, "jd", changes.Nickname)
+		assert.Equal(t, "", changes.LastName)
+	})
+
+	t.Run("empty patch", func(t *testing.T) {
+		_, fields, err := ParseMergePatch([]byte(`{}`))
+		require.NoError(t, err)
+		assert.Empty(t, fields)
+	})
+
+	t.Run("unknown members are passed through", func(t *testing.T) {
+		_, fields, err := ParseMergePatch([]byte(`{"role": "admin"}`))
+		require.NoError(t, err)
+		assert.Equal(t, []user.Field{"role"}, fields)
+	})
+
+	t.Run("reports every member of the wrong type", func(t *testing.T) {
+		_, _, err := ParseMergePatch([]byte(`{"nickname": 1, "country": {"code": "DE"}, "email": "a@b.c"}`))
+		assert.Equal(t, map[string]string{
+			"nickname": "must be a string or null",
+			"country":  "must be a string or null",
+		}, user.ValidationDetails(err))
+	})
+
+	for _, body := range []string{`[]`, `"x"`, `null`, `{`} {
+		t.Run("not an object "+body, func(t *testing.T) {
+			_, _, err := ParseMergePatch([]byte(body))
+			assert.ErrorIs(t, err, user.ErrInvalidInput)
+		})
+	}
+}
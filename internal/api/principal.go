@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
+)
+
+// PrincipalFromContext builds the domain principal from the access token
+// claims stored in ctx by the REST middleware or gRPC interceptor. It returns
+// nil for unauthenticated requests or tokens without a valid subject.
+func PrincipalFromContext(ctx context.Context) *user.Principal {
+	claims, ok := token.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil
+	}
+
+	principal := &user.Principal{UserID: userID, Role: user.RolePlayer}
+	for _, r := range claims.Roles {
+		if role := user.Role(r); role.IsValid() {
+			principal.Role = role
+			break
+		}
+	}
+	return principal
+}
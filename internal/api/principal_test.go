@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
+)
+
+func TestPrincipalFromContext(t *testing.T) {
+	userID := uuid.New()
+	withClaims := func(subject string, roles ...string) context.Context {
+		claims := &token.Claims{Roles: roles}
+		claims.Subject = subject
+		return token.NewContext(context.Background(), claims)
+	}
+
+	assert.Nil(t, PrincipalFromContext(context.Background()))
+	assert.Nil(t, PrincipalFromContext(withClaims("not-a-uuid", "admin")))
+
+	principal := PrincipalFromContext(withClaims(userID.String(), "admin"))
+	require.NotNil(t, principal)
+	assert.Equal(t, userID, principal.UserID)
+	assert.Equal(t, user.RoleAdmin, principal.Role)
+
+	principal = PrincipalFromContext(withClaims(userID.String(), "unknown"))
+	require.NotNil(t, principal)
+	assert.Equal(t, user.RolePlayer, principal.Role)
+}
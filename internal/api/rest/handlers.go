@@ -5,25 +5,37 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"github.com/bentalebwael/faceit-users-service/internal/api"
 	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	"github.com/bentalebwael/faceit-users-service/internal/events"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
 )
 
 type Handler struct {
-	service       *user.Service
-	healthChecker *api.HealthChecker
-	logger        *slog.Logger
+	service           *user.Service
+	policy            *user.Policy
+	healthChecker     *api.HealthChecker
+	tokens            *token.Manager
+	watcher           *events.Broadcaster
+	heartbeatInterval time.Duration
+	logger            *slog.Logger
 }
 
-func NewHandler(service *user.Service, healthChecker *api.HealthChecker, logger *slog.Logger) *Handler {
+func NewHandler(service *user.Service, policy *user.Policy, healthChecker *api.HealthChecker, tokens *token.Manager, watcher *events.Broadcaster, heartbeatInterval time.Duration, logger *slog.Logger) *Handler {
 	return &Handler{
-		service:       service,
-		healthChecker: healthChecker,
-		logger:        logger,
+		service:           service,
+		policy:            policy,
+		healthChecker:     healthChecker,
+		tokens:            tokens,
+		watcher:           watcher,
+		heartbeatInterval: heartbeatInterval,
+		logger:            logger,
 	}
 }
 
@@ -77,18 +89,42 @@ func (h *Handler) GetUser(c *gin.Context) {
 		return
 	}
 
+	if !h.authorize(c, user.ActionRead, userID) {
+		return
+	}
+
 	user, err := h.service.GetUser(ctx, userID)
 	if err != nil {
 		h.handleServiceError(c, err)
 		return
 	}
 
+	c.Header("ETag", etag(user))
 	c.JSON(http.StatusOK, user)
 }
 
-// UpdateUser handles PUT /users/:id requests
-func (h *Handler) UpdateUser(c *gin.Context) {
+// GetUserByNickname handles GET /users/by-nickname/:nickname requests,
+// resolving recently abandoned nicknames to the user who had them. The caller
+// is authorized before the lookup, so nobody else learns which nicknames exist.
+func (h *Handler) GetUserByNickname(c *gin.Context) {
 	ctx := c.Request.Context()
+	if !h.authorize(c, user.ActionRead, uuid.Nil) {
+		return
+	}
+
+	nicknameUser, err := h.service.GetUserByNickname(ctx, c.Param("nickname"))
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(nicknameUser))
+	c.JSON(http.StatusOK, nicknameUser)
+}
+
+// UpdateUser handles PUT /users/:id requests, replacing every updatable
+// field of the user; optional fields missing from the body are cleared
+func (h *Handler) UpdateUser(c *gin.Context) {
 	idStr := c.Param("id")
 	userID, err := uuid.Parse(idStr)
 	if err != nil {
@@ -97,28 +133,90 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if !h.authorize(c, user.ActionUpdate, userID) {
+		return
+	}
+
 	var req UpdateUserRequest
-	// Use ShouldBindJSON which respects binding tags (like omitempty for validation)
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Warn("failed to bind update request", "error", err)
 		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: err.Error()})
 		return
 	}
 
-	updateUserReq := &user.User{
+	replacement := &user.User{
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 		Nickname:  req.Nickname,
 		Email:     req.Email,
 		Country:   req.Country,
 	}
+	h.updateUser(c, userID, replacement, user.UpdatableFields)
+}
+
+// PatchUser handles PATCH /users/:id requests carrying an RFC 7396 JSON merge
+// patch: members set the fields they name and null members clear them
+func (h *Handler) PatchUser(c *gin.Context) {
+	idStr := c.Param("id")
+	userID, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Warn("invalid user ID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: "Invalid user ID format"})
+		return
+	}
+
+	if !h.authorize(c, user.ActionUpdate, userID) {
+		return
+	}
+
+	if contentType := c.ContentType(); contentType != mergePatchContentType && contentType != gin.MIMEJSON {
+		c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{Code: "unsupported_media_type", Message: "Content-Type must be " + mergePatchContentType})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		h.logger.Warn("failed to read patch request", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: err.Error()})
+		return
+	}
+
+	changes, fields, err := api.ParseMergePatch(body)
+	if err != nil {
+		if errors.Is(err, user.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: "Merge patch must be a JSON object"})
+			return
+		}
+		h.handleServiceError(c, err)
+		return
+	}
+	h.updateUser(c, userID, changes, fields)
+}
 
-	updatedUser, err := h.service.UpdateUser(ctx, userID, updateUserReq)
+// updateUser applies the given fields of changes to the user, honouring an
+// If-Match header, and responds with the updated user and its ETag
+func (h *Handler) updateUser(c *gin.Context, userID uuid.UUID, changes *user.User, fields []user.Field) {
+	ifMatch := c.GetHeader("If-Match")
+	expectedVersion, ok := ifMatchVersion(ifMatch)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, ErrorResponse{Code: "precondition_failed", Message: "If-Match must be * or a single ETag of the user"})
+		return
+	}
+	changes.Version = expectedVersion
+
+	updatedUser, err := h.service.UpdateUser(c.Request.Context(), userID, changes, fields)
 	if err != nil {
+		if user.IsConflict(err) && ifMatch != "" {
+			// The client's precondition failed rather than a concurrent write racing it
+			h.logger.Warn("user update precondition failed", "id", userID, "if_match", ifMatch)
+			c.JSON(http.StatusPreconditionFailed, ErrorResponse{Code: "precondition_failed", Message: "User has been modified since it was read"})
+			return
+		}
 		h.handleServiceError(c, err)
 		return
 	}
 
+	c.Header("ETag", etag(updatedUser))
 	c.JSON(http.StatusOK, updatedUser)
 }
 
@@ -133,6 +231,10 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	if !h.authorize(c, user.ActionDelete, userID) {
+		return
+	}
+
 	err = h.service.DeleteUser(ctx, userID)
 	if err != nil {
 		h.handleServiceError(c, err)
@@ -142,73 +244,446 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// RestoreUser handles POST /users/:id/restore requests
+func (h *Handler) RestoreUser(c *gin.Context) {
+	ctx := c.Request.Context()
+	idStr := c.Param("id")
+	userID, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Warn("invalid user ID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: "Invalid user ID format"})
+		return
+	}
+
+	if !h.authorize(c, user.ActionRestore, userID) {
+		return
+	}
+
+	restoredUser, err := h.service.RestoreUser(ctx, userID)
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, restoredUser)
+}
+
 // ListUsers handles GET /users requests
 func (h *Handler) ListUsers(c *gin.Context) {
 	ctx := c.Request.Context()
+	if !h.authorize(c, user.ActionList, uuid.Nil) {
+		return
+	}
 
-	page := 1 // Default value
-	if pageStr := c.Query("page"); pageStr != "" {
-		if parsedPage, err := strconv.Atoi(pageStr); err == nil && parsedPage > 0 {
-			page = parsedPage
-		}
+	params, err := api.ParseListQuery(c.Request.URL.Query())
+	if err != nil {
+		// Report the parameters the service would reject alongside the malformed ones
+		h.handleServiceError(c, user.JoinValidationErrors(err, h.service.ValidateListParams(params)))
+		return
+	}
+
+	result, err := h.service.ListUsers(ctx, params)
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	resp := ListUsersResponse{
+		Users:      result.Users,
+		HasMore:    result.HasMore,
+		TotalCount: result.TotalCount,
+		NextCursor: result.NextCursor,
 	}
 
-	limit := 10 // Default value
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
+	c.JSON(http.StatusOK, resp)
+}
+
+// SearchUsers handles GET /users/search requests, ranking users by how closely
+// they match the q parameter
+func (h *Handler) SearchUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !h.authorize(c, user.ActionList, uuid.Nil) {
+		return
+	}
+
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			h.handleServiceError(c, user.NewValidationError("limit", "must be a positive integer"))
+			return
 		}
 	}
 
-	params := user.ListParams{
-		Limit:     limit,
-		Offset:    (page - 1) * limit,
-		OrderBy:   "created_at", // Default value
-		OrderDesc: true,         // Default value
-		Filters:   make([]user.Filter, 0),
+	results, err := h.service.SearchUsers(ctx, c.Query("q"), limit)
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
 	}
 
-	if orderBy := c.Query("order_by"); orderBy != "" {
-		params.OrderBy = orderBy
+	c.JSON(http.StatusOK, SearchUsersResponse{Results: results})
+}
+
+// BatchCreateUsers handles POST /users:batchCreate requests, reporting the
+// outcome of each user in the order they were given
+func (h *Handler) BatchCreateUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !h.authorize(c, user.ActionBatchCreate, uuid.Nil) {
+		return
+	}
+
+	var req BatchCreateUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("failed to bind batch create request", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: err.Error()})
+		return
 	}
 
-	if orderDescStr := c.Query("order_desc"); orderDescStr != "" {
-		if boolValue, err := strconv.ParseBool(orderDescStr); err == nil {
-			params.OrderDesc = boolValue
+	users := make([]*user.User, len(req.Users))
+	for i, u := range req.Users {
+		users[i] = &user.User{
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Nickname:  u.Nickname,
+			Password:  u.Password,
+			Email:     u.Email,
+			Country:   u.Country,
 		}
 	}
 
-	// Parse filters from query parameters
-	queryParams := c.Request.URL.Query()
-	for key, values := range queryParams {
-		if len(values) > 0 && values[0] != "" {
-			value := values[0]
-			params.Filters = append(params.Filters, user.Filter{
-				Field: key,
-				Value: value,
-			})
+	results, err := h.service.BatchCreateUsers(ctx, users, req.AllOrNothing)
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	resp := BatchCreateUsersResponse{Results: make([]BatchCreateResult, len(results))}
+	for i, result := range results {
+		if result.Err != nil {
+			status, errResp := errorResponse(result.Err)
+			resp.Results[i] = BatchCreateResult{Index: i, Status: status, Error: &errResp}
+			resp.Failed++
+			continue
 		}
+		resp.Results[i] = BatchCreateResult{Index: i, Status: http.StatusCreated, User: result.User}
+		resp.Created++
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// BatchGetUsers handles POST /users:batchGet requests
+func (h *Handler) BatchGetUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !h.authorize(c, user.ActionRead, uuid.Nil) {
+		return
 	}
 
-	users, hasMore, totalCount, err := h.service.ListUsers(ctx, params)
+	var req BatchGetUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("failed to bind batch get request", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: err.Error()})
+		return
+	}
+
+	ids, err := api.ParseIDs(req.IDs)
 	if err != nil {
 		h.handleServiceError(c, err)
 		return
 	}
 
-	resp := ListUsersResponse{
-		Users:      users,
-		HasMore:    hasMore,
-		TotalCount: totalCount,
+	users, err := h.service.GetUsers(ctx, ids)
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	resp := BatchGetUsersResponse{Users: make([]*user.User, 0, len(users)), MissingIDs: make([]string, 0)}
+	for i, u := range users {
+		if u == nil {
+			resp.MissingIDs = append(resp.MissingIDs, req.IDs[i])
+			continue
+		}
+		resp.Users = append(resp.Users, u)
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
+// ExportUsers handles GET /users:export requests, streaming every user
+// matching the filters of the query as NDJSON or, with format=csv, as CSV
+func (h *Handler) ExportUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !h.authorize(c, user.ActionExport, uuid.Nil) {
+		return
+	}
+
+	query := c.Request.URL.Query()
+	format := query.Get("format")
+	query.Del("format")
+
+	w, err := api.NewExportWriter(c.Writer, format)
+	filters, filterErr := api.ParseFilters(query)
+	if err := user.JoinValidationErrors(err, filterErr); err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	// The status is sent with the first user, so that errors found before
+	// it, such as an invalid filter, can still be reported as such
+	started := false
+	start := func() error {
+		started = true
+		c.Header("Content-Type", w.ContentType())
+		c.Status(http.StatusOK)
+		return w.WriteHeader()
+	}
+
+	err = h.service.ExportUsers(ctx, filters, func(u *user.User) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := w.Write(u); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		if !started {
+			h.handleServiceError(c, err)
+			return
+		}
+		// Too late to change the status, cut the stream short instead
+		h.logger.Error("user export failed", "error", err)
+		c.Abort()
+	}
+}
+
+// UserEvents handles GET /users/events requests, streaming the users created,
+// updated and deleted from now on as server-sent events, optionally only those
+// in the country of the query. Each event has the JSON shape of the Kafka
+// events and its resume token as ID, so a client reconnecting with
+// Last-Event-ID first gets the events it missed. If they are no longer
+// buffered, the stream starts with a reset event instead.
+func (h *Handler) UserEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !h.authorize(c, user.ActionList, uuid.Nil) {
+		return
+	}
+
+	match := api.EventFilter(c.Query("country"), nil)
+	sub, err := h.watcher.Subscribe(c.GetHeader("Last-Event-ID"), match)
+	resumeExpired := errors.Is(err, events.ErrResumeExpired)
+	if resumeExpired {
+		sub, err = h.watcher.Subscribe("", match)
+	}
+	if err != nil {
+		h.logger.Error("failed to subscribe to user events", "error", err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Code: "unavailable", Message: "User events are unavailable, try again later"})
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // Keeps nginx from buffering the stream
+	c.Status(http.StatusOK)
+	if resumeExpired {
+		err = writeEvent(c.Writer, "", "reset", ErrorResponse{Code: "resume_expired", Message: "Events since Last-Event-ID are no longer available, reload the users"})
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeatInterval)
+	defer heartbeat.Stop()
+	for err == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			err = writeHeartbeat(c.Writer)
+		case n, ok := <-sub.Notifications():
+			if !ok {
+				// The client reconnects and resumes after the last event it got
+				h.logger.Warn("user events subscriber dropped", "reason", sub.Err())
+				return
+			}
+			err = writeEvent(c.Writer, n.Token, string(n.Event.Type), n.Event)
+		}
+		c.Writer.Flush()
+	}
+	h.logger.Warn("user events stream failed", "error", err)
+}
+
+// Login handles POST /auth/login requests
+func (h *Handler) Login(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("failed to bind login request", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: err.Error()})
+		return
+	}
+
+	authenticatedUser, err := h.service.Authenticate(ctx, req.Identifier, req.Password)
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	accessToken, expiresAt, err := h.tokens.Issue(authenticatedUser.ID.String(), []string{string(authenticatedUser.Role)})
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresAt:   expiresAt,
+		User:        authenticatedUser,
+	})
+}
+
+// JWKS handles GET /.well-known/jwks.json requests
+func (h *Handler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.tokens.JWKS())
+}
+
+// ChangePassword handles POST /users/:id/password requests
+func (h *Handler) ChangePassword(c *gin.Context) {
+	ctx := c.Request.Context()
+	idStr := c.Param("id")
+	userID, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Warn("invalid user ID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: "Invalid user ID format"})
+		return
+	}
+
+	if !h.authorize(c, user.ActionChangePassword, userID) {
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("failed to bind change password request", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: err.Error()})
+		return
+	}
+
+	if err := h.service.ChangePassword(ctx, userID, req.OldPassword, req.NewPassword); err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RequestPasswordReset handles POST /auth/password-reset requests. The token is
+// sent to the user out of band, and the response is the same whether or not
+// the email belongs to a user.
+func (h *Handler) RequestPasswordReset(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("failed to bind password reset request", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: err.Error()})
+		return
+	}
+
+	if err := h.service.RequestPasswordReset(ctx, req.Email); err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// ConfirmPasswordReset handles POST /auth/password-reset/confirm requests
+func (h *Handler) ConfirmPasswordReset(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req ConfirmPasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("failed to bind confirm password reset request", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: err.Error()})
+		return
+	}
+
+	if err := h.service.ConfirmPasswordReset(ctx, req.Token, req.NewPassword); err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AssignRole handles PUT /users/:id/role requests
+func (h *Handler) AssignRole(c *gin.Context) {
+	ctx := c.Request.Context()
+	idStr := c.Param("id")
+	userID, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Warn("invalid user ID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: "Invalid user ID format"})
+		return
+	}
+
+	if !h.authorize(c, user.ActionAssignRole, userID) {
+		return
+	}
+
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("failed to bind assign role request", "error", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Code: "bad_request", Message: err.Error()})
+		return
+	}
+
+	role, err := user.ParseRole(req.Role)
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	updatedUser, err := h.service.AssignRole(ctx, userID, role)
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updatedUser)
+}
+
+// authorize consults the access policy for the authenticated caller and
+// writes the error response if the action is not allowed. It reports whether
+// the request may proceed.
+func (h *Handler) authorize(c *gin.Context, action user.Action, targetID uuid.UUID) bool {
+	ctx := c.Request.Context()
+	if err := h.policy.Authorize(ctx, api.PrincipalFromContext(ctx), action, targetID); err != nil {
+		h.handleServiceError(c, err)
+		return false
+	}
+	return true
+}
+
 // handleServiceError maps domain errors to HTTP status codes
 func (h *Handler) handleServiceError(c *gin.Context, err error) {
 	h.logger.Error("service error", "error", err)
+	status, resp := errorResponse(err)
+	c.JSON(status, resp)
+}
 
+// errorResponse is the HTTP status and body reporting err
+func errorResponse(err error) (int, ErrorResponse) {
 	var code string
 	var status int
 	var message string = err.Error() // Default message
@@ -217,12 +692,39 @@ func (h *Handler) handleServiceError(c *gin.Context, err error) {
 	case errors.Is(err, user.ErrNotFound):
 		code = "not_found"
 		status = http.StatusNotFound
-	case errors.Is(err, user.ErrEmailTaken), errors.Is(err, user.ErrNicknameTaken):
+	case errors.Is(err, user.ErrEmailTaken), errors.Is(err, user.ErrNicknameTaken), errors.Is(err, user.ErrConflict):
 		code = "conflict"
 		status = http.StatusConflict
-	case errors.Is(err, user.ErrValidation):
+	case errors.Is(err, user.ErrAlreadyExists):
+		code = "conflict"
+		status = http.StatusConflict
+		message = user.ErrAlreadyExists.Error() // Hide the violated constraint
+	case errors.Is(err, user.ErrSerialization):
+		code = "conflict"
+		status = http.StatusConflict
+		message = "The request conflicted with a concurrent one, retry it"
+	case errors.Is(err, user.ErrBatchAborted):
+		code = "aborted"
+		status = http.StatusConflict
+	case errors.Is(err, user.ErrTimeout):
+		code = "unavailable"
+		status = http.StatusServiceUnavailable
+		message = "The request timed out, retry it later"
+	case errors.Is(err, user.ErrNicknameCooldown):
+		code = "nickname_cooldown"
+		status = http.StatusConflict
+	case errors.Is(err, user.ErrValidation), errors.Is(err, user.ErrInvalidResetToken):
 		code = "bad_request"
 		status = http.StatusBadRequest
+	case errors.Is(err, user.ErrInvalidCredentials):
+		code = "unauthorized"
+		status = http.StatusUnauthorized
+	case errors.Is(err, user.ErrForbidden):
+		code = "forbidden"
+		status = http.StatusForbidden
+	case errors.Is(err, user.ErrBanned):
+		code = "banned"
+		status = http.StatusForbidden
 	default:
 		// Fallback for unexpected errors
 		code = "internal_error"
@@ -230,5 +732,36 @@ func (h *Handler) handleServiceError(c *gin.Context, err error) {
 		message = "An internal error occurred"
 	}
 
-	c.JSON(status, ErrorResponse{Code: code, Message: message})
+	return status, ErrorResponse{Code: code, Message: message, Details: user.ValidationDetails(err)}
+}
+
+// mergePatchContentType is the media type of RFC 7396 JSON merge patches
+const mergePatchContentType = "application/merge-patch+json"
+
+// etag is the strong entity tag of the current version of u
+func etag(u *user.User) string {
+	return `"` + strconv.FormatInt(u.Version, 10) + `"`
+}
+
+// ifMatchVersion returns the user version required by an If-Match header.
+// An absent header or * requires none and yields 0; anything other than a
+// single strong ETag issued by etag is not satisfiable.
+func ifMatchVersion(header string) (int64, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	unquoted, ok := strings.CutPrefix(header, `"`)
+	if !ok {
+		return 0, false
+	}
+	unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
 }
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
+)
+
+// Auth returns a Gin middleware that requires a valid bearer token and stores
+// its claims in the request context
+func Auth(tokens *token.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		scheme, raw, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || raw == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    "unauthorized",
+				"message": "Missing bearer token",
+			})
+			c.Abort()
+			return
+		}
+
+		claims, err := tokens.Verify(raw)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    "unauthorized",
+				"message": "Invalid or expired token",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(token.NewContext(c.Request.Context(), claims))
+		c.Next()
+	}
+}
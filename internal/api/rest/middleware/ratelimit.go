@@ -1,17 +1,33 @@
 package middleware
 
 import (
+	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/bentalebwael/faceit-users-service/internal/platform/ratelimiter"
 )
 
-// RateLimit returns a Gin middleware for request rate limiting
-func RateLimit(limiter *ratelimiter.RateLimiter) gin.HandlerFunc {
+// RateLimit returns a Gin middleware for request rate limiting. Requests are
+// limited per client and per route, and the state of the client's quota is
+// reported in the RateLimit-* headers.
+func RateLimit(limiter *ratelimiter.RateLimiter, logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !limiter.Allow() {
+		route := c.Request.Method + " " + routePath(c)
+		client := limiter.Client(c.GetHeader("Authorization"), c.Request.RemoteAddr, c.Request.Header.Values("X-Forwarded-For"))
+
+		result, err := limiter.Allow(c.Request.Context(), route, client)
+		if err != nil {
+			logger.Error("rate limit check failed, allowing request", "route", route, "error", err)
+		}
+		for name, value := range result.Fields() {
+			c.Header(name, value)
+		}
+
+		if !result.Allowed {
+			logger.Warn("rate limit exceeded", "route", route, "client", client)
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"code":    "rate_limit_exceeded",
 				"message": "Too many requests, please try again later",
@@ -23,3 +39,14 @@ func RateLimit(limiter *ratelimiter.RateLimiter) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// routePath returns the route of the request, with the custom method the
+// request names in place of the :method parameter, such as
+// /api/v1/users:batchCreate, so each custom method has a quota of its own
+func routePath(c *gin.Context) string {
+	path := c.FullPath()
+	if prefix, ok := strings.CutSuffix(path, "/:method"); ok {
+		return prefix + "/" + c.Param("method")
+	}
+	return path
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/ratelimiter"
+)
+
+func TestRateLimit_CustomMethods(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Rate: config.RateConfig{
+			RequestsPerSecond: 100,
+			Burst:             100,
+			Backend:           "memory",
+			Routes: map[string]config.RateQuota{
+				"POST /api/v1/users:batchCreate": {RequestsPerSecond: 0.01, Burst: 1},
+			},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	router := gin.New()
+	router.Use(RateLimit(ratelimiter.NewLimiter(cfg), logger))
+	router.POST("/api/v1/:method", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	post := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := post("/api/v1/users:batchCreate")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "1", first.Header().Get("RateLimit-Limit"), "the quota of users:batchCreate applies")
+
+	assert.Equal(t, http.StatusTooManyRequests, post("/api/v1/users:batchCreate").Code)
+
+	// Other custom methods on the same route keep the default quota
+	other := post("/api/v1/users:batchGet")
+	assert.Equal(t, http.StatusOK, other.Code)
+	assert.Equal(t, "100", other.Header().Get("RateLimit-Limit"))
+}
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"log/slog"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -9,32 +10,61 @@ import (
 
 	"github.com/bentalebwael/faceit-users-service/internal/api/rest/middleware"
 	"github.com/bentalebwael/faceit-users-service/internal/platform/ratelimiter"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
 )
 
 // setupRouter configures all the routes and middleware for the API
-func setupRouter(handler *Handler, limiter *ratelimiter.RateLimiter, logger *slog.Logger) *gin.Engine {
+func setupRouter(handler *Handler, limiter *ratelimiter.RateLimiter, tokens *token.Manager, logger *slog.Logger) *gin.Engine {
 	router := gin.New()
 
 	router.Use(
 		gin.Recovery(),
 		middleware.Logger(logger),
-		middleware.RateLimit(limiter),
+		middleware.RateLimit(limiter, logger),
 	)
 
+	requireAuth := middleware.Auth(tokens)
+
 	// Health check
 	router.GET("/healthz", handler.Health)
 
+	// Public keys for verifying issued tokens
+	router.GET("/.well-known/jwks.json", handler.JWKS)
+
 	// API routes
 	v1 := router.Group("/api/v1")
 	{
+		auth := v1.Group("/auth")
+		{
+			auth.POST("/login", handler.Login)
+			auth.POST("/password-reset", handler.RequestPasswordReset)
+			auth.POST("/password-reset/confirm", handler.ConfirmPasswordReset)
+		}
+
 		users := v1.Group("/users")
 		{
 			users.POST("", handler.AddUser)
-			users.GET("", handler.ListUsers)
-			users.GET("/:id", handler.GetUser)
-			users.PUT("/:id", handler.UpdateUser)
-			users.DELETE("/:id", handler.DeleteUser)
+			users.GET("", requireAuth, handler.ListUsers)
+			users.GET("/search", requireAuth, handler.SearchUsers)
+			users.GET("/events", requireAuth, handler.UserEvents)
+			users.GET("/by-nickname/:nickname", requireAuth, handler.GetUserByNickname)
+			users.GET("/:id", requireAuth, handler.GetUser)
+			users.PUT("/:id", requireAuth, handler.UpdateUser)
+			users.PATCH("/:id", requireAuth, handler.PatchUser)
+			users.DELETE("/:id", requireAuth, handler.DeleteUser)
+			users.POST("/:id/restore", requireAuth, handler.RestoreUser)
+			users.POST("/:id/password", requireAuth, handler.ChangePassword)
+			users.PUT("/:id/role", requireAuth, handler.AssignRole)
 		}
+
+		// Custom methods on the users collection, such as /users:export
+		v1.POST("/:method", requireAuth, customMethods(map[string]gin.HandlerFunc{
+			"users:batchCreate": handler.BatchCreateUsers,
+			"users:batchGet":    handler.BatchGetUsers,
+		}))
+		v1.GET("/:method", requireAuth, customMethods(map[string]gin.HandlerFunc{
+			"users:export": handler.ExportUsers,
+		}))
 	}
 
 	// Serve Swagger Documentation
@@ -44,3 +74,17 @@ func setupRouter(handler *Handler, limiter *ratelimiter.RateLimiter, logger *slo
 
 	return router
 }
+
+// customMethods dispatches requests for a path segment of the form
+// collection:method to the handler registered for it. Gin cannot route on a
+// segment containing a colon, so such segments are matched as a parameter.
+func customMethods(methods map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler, ok := methods[c.Param("method")]
+		if !ok {
+			c.JSON(http.StatusNotFound, ErrorResponse{Code: "not_found", Message: "Unknown method " + c.Param("method")})
+			return
+		}
+		handler(c)
+	}
+}
@@ -11,7 +11,9 @@ import (
 
 	"github.com/bentalebwael/faceit-users-service/internal/api"
 	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	"github.com/bentalebwael/faceit-users-service/internal/events"
 	"github.com/bentalebwael/faceit-users-service/internal/platform/ratelimiter"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
 )
 
 type Server struct {
@@ -20,12 +22,12 @@ type Server struct {
 	logger     *slog.Logger
 }
 
-func NewServer(port int, service *user.Service, healthChecker *api.HealthChecker, limiter *ratelimiter.RateLimiter, logger *slog.Logger) *Server {
+func NewServer(port int, service *user.Service, policy *user.Policy, healthChecker *api.HealthChecker, limiter *ratelimiter.RateLimiter, tokens *token.Manager, watcher *events.Broadcaster, heartbeatInterval time.Duration, logger *slog.Logger) *Server {
 	// Set Gin mode
 	gin.SetMode(gin.ReleaseMode)
 
-	handler := NewHandler(service, healthChecker, logger)
-	router := setupRouter(handler, limiter, logger)
+	handler := NewHandler(service, policy, healthChecker, tokens, watcher, heartbeatInterval, logger)
+	router := setupRouter(handler, limiter, tokens, logger)
 
 	// Configure HTTP server
 	httpServer := &http.Server{
@@ -0,0 +1,30 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// writeEvent writes a server-sent event. data is encoded as JSON, which never
+// spans lines and so fits in a single data field.
+func writeEvent(w io.Writer, id, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event data: %w", err)
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// writeHeartbeat writes a comment, which clients ignore but which keeps
+// proxies from timing out an idle stream
+func writeHeartbeat(w io.Writer) error {
+	_, err := io.WriteString(w, ": heartbeat\n\n")
+	return err
+}
@@ -1,6 +1,10 @@
 package rest
 
-import "github.com/bentalebwael/faceit-users-service/internal/domain/user"
+import (
+	"time"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
 
 // AddUserRequest represents the request to create a new user
 type AddUserRequest struct {
@@ -12,21 +16,112 @@ type AddUserRequest struct {
 	Country   string `json:"country" binding:"required,len=2"`
 }
 
-// UpdateUserRequest represents the request to update a user
-// Fields are optional to allow partial updates.
+// UpdateUserRequest represents the request to replace a user
+// Omitted optional fields are cleared; use PATCH for partial updates.
 type UpdateUserRequest struct {
-	FirstName string `json:"first_name,omitempty"`
-	LastName  string `json:"last_name,omitempty"`
-	Nickname  string `json:"nickname,omitempty"`
-	Email     string `json:"email,omitempty" binding:"omitempty,email"`   // validate if present
-	Country   string `json:"country,omitempty" binding:"omitempty,len=2"` // validate if present
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Nickname  string `json:"nickname" binding:"required"`
+	Email     string `json:"email" binding:"required,email"`
+	Country   string `json:"country" binding:"required,len=2"`
+}
+
+// LoginRequest represents the request to authenticate a user
+// Identifier may be either the user's email or nickname.
+type LoginRequest struct {
+	Identifier string `json:"identifier" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+}
+
+// AssignRoleRequest represents the request body for changing a user's role
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// LoginResponse represents the response of a successful authentication
+type LoginResponse struct {
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	User        *user.User `json:"user"`
+}
+
+// ChangePasswordRequest represents the request to change a user's password
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// PasswordResetRequest represents the request to start a password reset
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ConfirmPasswordResetRequest represents the request to complete a password reset
+type ConfirmPasswordResetRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
-// ListUsersResponse represents the paginated response for listing users using offset pagination
+// ListUsersResponse represents the paginated response for listing users using
+// offset or cursor pagination
 type ListUsersResponse struct {
 	Users      []user.User `json:"users"`
 	HasMore    bool        `json:"has_more"`
-	TotalCount int64       `json:"total_count"`
+	TotalCount *int64      `json:"total_count,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// SearchUsersResponse represents the users matching a search, most relevant first
+type SearchUsersResponse struct {
+	Results []user.SearchResult `json:"results"`
+}
+
+// BatchCreateUsersRequest represents the request to create many users at once.
+// Its users are validated one by one by the service, so a single invalid user
+// does not fail the request.
+type BatchCreateUsersRequest struct {
+	Users        []BatchUserRequest `json:"users" binding:"required"`
+	AllOrNothing bool               `json:"all_or_nothing"`
+}
+
+// BatchUserRequest represents one user of a batch create request
+type BatchUserRequest struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Nickname  string `json:"nickname"`
+	Password  string `json:"password"`
+	Email     string `json:"email"`
+	Country   string `json:"country"`
+}
+
+// BatchCreateUsersResponse represents the outcome of each user of a batch
+// create request, in the order of the request
+type BatchCreateUsersResponse struct {
+	Results []BatchCreateResult `json:"results"`
+	Created int                 `json:"created"`
+	Failed  int                 `json:"failed"`
+}
+
+// BatchCreateResult represents the outcome of one user of a batch: the
+// created user, or the error the user would have got creating it alone
+type BatchCreateResult struct {
+	Index  int            `json:"index"`
+	Status int            `json:"status"`
+	User   *user.User     `json:"user,omitempty"`
+	Error  *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchGetUsersRequest represents the request to get many users by ID
+type BatchGetUsersRequest struct {
+	IDs []string `json:"ids" binding:"required"`
+}
+
+// BatchGetUsersResponse represents the users found, in the order of the
+// request, and the IDs of the users that were not
+type BatchGetUsersResponse struct {
+	Users      []*user.User `json:"users"`
+	MissingIDs []string     `json:"missing_ids"`
 }
 
 // ErrorResponse represents an error response
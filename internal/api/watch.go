@@ -0,0 +1,28 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/events"
+)
+
+// EventFilter returns a filter of the events of users in country among ids,
+// either of which is not filtered on when empty
+func EventFilter(country string, ids []uuid.UUID) func(*events.Event) bool {
+	watched := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		watched[id] = true
+	}
+
+	return func(e *events.Event) bool {
+		if e.User == nil {
+			return false
+		}
+		if country != "" && !strings.EqualFold(e.User.Country, country) {
+			return false
+		}
+		return len(watched) == 0 || watched[e.User.ID]
+	}
+}
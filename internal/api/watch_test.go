@@ -0,0 +1,31 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+	"github.com/bentalebwael/faceit-users-service/internal/events"
+)
+
+func TestEventFilter(t *testing.T) {
+	german := &events.Event{User: &user.User{ID: uuid.New(), Country: "DE"}}
+	french := &events.Event{User: &user.User{ID: uuid.New(), Country: "FR"}}
+
+	all := EventFilter("", nil)
+	assert.True(t, all(german))
+	assert.True(t, all(french))
+	assert.False(t, all(&events.Event{}), "events without a user never match")
+
+	byCountry := EventFilter("de", nil)
+	assert.True(t, byCountry(german))
+	assert.False(t, byCountry(french))
+
+	byID := EventFilter("", []uuid.UUID{french.User.ID})
+	assert.False(t, byID(german))
+	assert.True(t, byID(french))
+
+	assert.False(t, EventFilter("DE", []uuid.UUID{french.User.ID})(french))
+}
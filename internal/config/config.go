@@ -2,6 +2,9 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +22,15 @@ type Config struct {
 	Rate  RateConfig
 	Log   LogConfig
 	Trace TraceConfig
+	Auth  AuthConfig
+
+	Deletion   DeletionConfig
+	Outbox     OutboxConfig
+	Commands   CommandsConfig
+	Pagination PaginationConfig
+	Nickname   NicknameConfig
+	Batch      BatchConfig
+	Watch      WatchConfig
 }
 
 // APIConfig contains HTTP API server configuration
@@ -28,7 +40,9 @@ type APIConfig struct {
 
 // GRPCConfig contains gRPC server configuration
 type GRPCConfig struct {
-	Port int `mapstructure:"GRPC_PORT"` // Port on which the gRPC server will listen
+	Port           int           `mapstructure:"GRPC_PORT"`            // Port on which the gRPC server will listen
+	RequestTimeout time.Duration `mapstructure:"GRPC_REQUEST_TIMEOUT"` // Longest a unary call may run, 0 for no limit
+	StreamTimeout  time.Duration `mapstructure:"GRPC_STREAM_TIMEOUT"`  // Longest a streaming call may run, 0 for no limit
 }
 
 // DBConfig contains database configuration
@@ -38,8 +52,17 @@ type DBConfig struct {
 	MaxIdleConns    int           `mapstructure:"DATABASE_MAX_IDLE_CONNS"`    // Maximum number of idle connections
 	ConnMaxLifetime time.Duration `mapstructure:"DATABASE_CONN_MAX_LIFETIME"` // Maximum lifetime of a connection
 	ConnMaxIdleTime time.Duration `mapstructure:"DATABASE_CONN_MAX_IDLETIME"` // Maximum idle time of a connection
+	AutoMigrate     bool          `mapstructure:"DATABASE_AUTO_MIGRATE"`      // Apply pending schema migrations at startup
+
+	TxIsolation      string        `mapstructure:"DATABASE_TX_ISOLATION"`        // Isolation level of transactions (read_committed, repeatable_read, serializable)
+	TxMaxRetries     int           `mapstructure:"DATABASE_TX_MAX_RETRIES"`      // Retries of a transaction failing with a serialization failure or connection reset
+	TxRetryBaseDelay time.Duration `mapstructure:"DATABASE_TX_RETRY_BASE_DELAY"` // Delay before the first transaction retry
+	TxRetryMaxDelay  time.Duration `mapstructure:"DATABASE_TX_RETRY_MAX_DELAY"`  // Upper bound of the exponential transaction retry delay
 }
 
+// TxIsolationLevels lists the accepted values of DATABASE_TX_ISOLATION
+var TxIsolationLevels = []string{"read_committed", "repeatable_read", "serializable"}
+
 // RedisConfig contains Redis connection configuration
 type RedisConfig struct {
 	Addr         string        `mapstructure:"REDIS_ADDR"`          // Redis server address
@@ -53,19 +76,41 @@ type RedisConfig struct {
 
 // KafkaConfig contains Kafka connection configuration
 type KafkaConfig struct {
-	Brokers           string        `mapstructure:"KAFKA_BROKERS"`            // Comma-separated list of Kafka brokers
-	EventTopic        string        `mapstructure:"KAFKA_USER_EVENTS_TOPIC"`  // Topic for user events
-	NumPartitions     int           `mapstructure:"KAFKA_NUM_PARTITIONS"`     // Number of partitions for topics
-	ReplicationFactor int           `mapstructure:"KAFKA_REPLICATION_FACTOR"` // Replication factor for topics
-	WriteTimeout      time.Duration `mapstructure:"KAFKA_WRITE_TIMEOUT"`      // Timeout for write operations
+	Brokers           string        `mapstructure:"KAFKA_BROKERS"`              // Comma-separated list of Kafka brokers
+	EventTopic        string        `mapstructure:"KAFKA_USER_EVENTS_TOPIC"`    // Topic for user events
+	ResetTopic        string        `mapstructure:"KAFKA_PASSWORD_RESET_TOPIC"` // Topic password reset tokens are sent to the mailer on
+	NumPartitions     int           `mapstructure:"KAFKA_NUM_PARTITIONS"`       // Number of partitions for topics
+	ReplicationFactor int           `mapstructure:"KAFKA_REPLICATION_FACTOR"`   // Replication factor for topics
+	WriteTimeout      time.Duration `mapstructure:"KAFKA_WRITE_TIMEOUT"`        // Timeout for write operations
+	BatchTimeout      time.Duration `mapstructure:"KAFKA_BATCH_TIMEOUT"`        // Maximum time to wait for a batch to fill before sending
+
+	EventEncoding      string `mapstructure:"KAFKA_EVENT_ENCODING"`       // How events are encoded (json, protobuf or cloudevents)
+	EventSchemaVersion string `mapstructure:"KAFKA_EVENT_SCHEMA_VERSION"` // Schema version events are published with
+	EventSource        string `mapstructure:"KAFKA_EVENT_SOURCE"`         // CloudEvents source of the events
 }
 
-// RateConfig contains rate limiting configuration
+// EventEncodings lists the accepted values of KAFKA_EVENT_ENCODING
+var EventEncodings = []string{"json", "protobuf", "cloudevents"}
+
+// RateConfig contains rate limiting configuration. Requests are limited per
+// client and per route or RPC method.
 type RateConfig struct {
-	RequestsPerSecond int `mapstructure:"RATE_LIMIT_RPS"`   // Number of requests allowed per second
-	Burst             int `mapstructure:"RATE_LIMIT_BURST"` // Maximum burst size for rate limiting
+	RequestsPerSecond int                  `mapstructure:"RATE_LIMIT_RPS"`             // Number of requests allowed per second
+	Burst             int                  `mapstructure:"RATE_LIMIT_BURST"`           // Maximum burst size for rate limiting
+	Backend           string               `mapstructure:"RATE_LIMIT_BACKEND"`         // Where request counts are kept (memory or redis)
+	Routes            map[string]RateQuota `mapstructure:"RATE_LIMIT_ROUTES"`          // Quotas replacing the default one for some routes
+	TrustedProxies    []netip.Prefix       `mapstructure:"RATE_LIMIT_TRUSTED_PROXIES"` // Proxies whose X-Forwarded-For header is believed
+}
+
+// RateQuota is the rate a client may call a route at
+type RateQuota struct {
+	RequestsPerSecond float64
+	Burst             int
 }
 
+// RateLimitBackends lists the accepted values of RATE_LIMIT_BACKEND
+var RateLimitBackends = []string{"memory", "redis"}
+
 // LogConfig contains logging configuration
 type LogConfig struct {
 	Level string `mapstructure:"LOG_LEVEL"` // Logging level (debug, info, warn, error)
@@ -77,6 +122,74 @@ type TraceConfig struct {
 	ServiceName      string `mapstructure:"OTEL_SERVICE_NAME"`           // Service name for tracing
 }
 
+// AuthConfig contains authentication configuration
+type AuthConfig struct {
+	PasswordResetTTL  time.Duration `mapstructure:"PASSWORD_RESET_TOKEN_TTL"` // Validity of password reset tokens
+	JWTAlgorithm      string        `mapstructure:"JWT_ALGORITHM"`            // Signing algorithm (HS256 or RS256)
+	JWTSecret         string        `mapstructure:"JWT_SECRET"`               // Shared secret for HS256
+	JWTPrivateKey     string        `mapstructure:"JWT_PRIVATE_KEY"`          // PEM encoded RSA private key for RS256
+	JWTPrivateKeyFile string        `mapstructure:"JWT_PRIVATE_KEY_FILE"`     // Path to a PEM encoded RSA private key for RS256
+	JWTKeyID          string        `mapstructure:"JWT_KEY_ID"`               // Key ID advertised in token headers and the JWKS
+	JWTIssuer         string        `mapstructure:"JWT_ISSUER"`               // Issuer claim of signed tokens
+	JWTTTL            time.Duration `mapstructure:"JWT_TTL"`                  // Validity of access tokens
+}
+
+// DeletionConfig contains soft delete and purge configuration
+type DeletionConfig struct {
+	RestoreGracePeriod time.Duration `mapstructure:"USER_RESTORE_GRACE_PERIOD"` // How long a deleted user can still be restored
+	PurgeRetention     time.Duration `mapstructure:"USER_PURGE_RETENTION"`      // How long deleted users are kept before being purged
+	PurgeInterval      time.Duration `mapstructure:"USER_PURGE_INTERVAL"`       // How often the purger runs
+	PurgeBatchSize     int           `mapstructure:"USER_PURGE_BATCH_SIZE"`     // Maximum users purged per database round trip
+}
+
+// OutboxConfig contains configuration of the relay draining the event outbox into Kafka
+type OutboxConfig struct {
+	RelayInterval  time.Duration `mapstructure:"OUTBOX_RELAY_INTERVAL"`   // How often the relay polls the outbox
+	BatchSize      int           `mapstructure:"OUTBOX_BATCH_SIZE"`       // Maximum messages relayed per batch
+	RetryBaseDelay time.Duration `mapstructure:"OUTBOX_RETRY_BASE_DELAY"` // Delay before the first retry of a failed message
+	RetryMaxDelay  time.Duration `mapstructure:"OUTBOX_RETRY_MAX_DELAY"`  // Upper bound of the exponential retry delay
+	PublishTimeout time.Duration `mapstructure:"OUTBOX_PUBLISH_TIMEOUT"`  // How long publishing a claimed batch to Kafka may take
+}
+
+// CommandsConfig contains configuration of the consumer of commands other
+// services send over Kafka
+type CommandsConfig struct {
+	Enabled         bool          `mapstructure:"KAFKA_COMMANDS_ENABLED"`          // Whether to consume commands at all
+	Topic           string        `mapstructure:"KAFKA_COMMANDS_TOPIC"`            // Topic commands are sent to
+	RetryTopic      string        `mapstructure:"KAFKA_COMMANDS_RETRY_TOPIC"`      // Topic failed commands wait on for their retry
+	DeadLetterTopic string        `mapstructure:"KAFKA_COMMANDS_DLQ_TOPIC"`        // Topic of commands that failed for good
+	GroupID         string        `mapstructure:"KAFKA_COMMANDS_GROUP_ID"`         // Consumer group shared by the replicas
+	MaxAttempts     int           `mapstructure:"KAFKA_COMMANDS_MAX_ATTEMPTS"`     // Attempts at a command before it is dead-lettered
+	RetryBaseDelay  time.Duration `mapstructure:"KAFKA_COMMANDS_RETRY_BASE_DELAY"` // Delay before the first retry of a failed command
+	RetryMaxDelay   time.Duration `mapstructure:"KAFKA_COMMANDS_RETRY_MAX_DELAY"`  // Upper bound of the exponential retry delay
+	HandlerTimeout  time.Duration `mapstructure:"KAFKA_COMMANDS_HANDLER_TIMEOUT"`  // Longest a command may take to handle
+}
+
+// PaginationConfig contains list pagination configuration
+type PaginationConfig struct {
+	CursorSecret string `mapstructure:"LIST_CURSOR_SECRET"` // Key signing list cursors, defaults to JWT_SECRET
+	MaxLimit     int    `mapstructure:"LIST_MAX_LIMIT"`     // Largest page size list requests may ask for
+}
+
+// NicknameConfig contains nickname change configuration
+type NicknameConfig struct {
+	ChangeCooldown   time.Duration `mapstructure:"NICKNAME_CHANGE_COOLDOWN"`   // Minimum time between two nickname changes of a user
+	HistoryRetention time.Duration `mapstructure:"NICKNAME_HISTORY_RETENTION"` // How long old nicknames still resolve to their user
+}
+
+// BatchConfig contains configuration of requests for many users at once
+type BatchConfig struct {
+	MaxSize     int `mapstructure:"BATCH_MAX_SIZE"`     // Largest number of users a batch create or get request may contain
+	HashWorkers int `mapstructure:"BATCH_HASH_WORKERS"` // Number of passwords of a batch hashed in parallel
+}
+
+// WatchConfig contains configuration of the live feeds of user changes
+type WatchConfig struct {
+	BufferSize        int           `mapstructure:"WATCH_BUFFER_SIZE"`        // Number of recent changes kept for watchers resuming after a disconnect
+	SubscriberBuffer  int           `mapstructure:"WATCH_SUBSCRIBER_BUFFER"`  // Number of changes a watcher may fall behind before it is dropped
+	HeartbeatInterval time.Duration `mapstructure:"WATCH_HEARTBEAT_INTERVAL"` // Time between heartbeats of idle server-sent event streams
+}
+
 // LoadConfig reads configuration from environment variables and .env file
 func LoadConfig() (*Config, error) {
 	v := viper.New()
@@ -85,6 +198,11 @@ func LoadConfig() (*Config, error) {
 	v.SetDefault("DATABASE_MAX_IDLE_CONNS", 30)
 	v.SetDefault("DATABASE_CONN_MAX_LIFETIME", "120s")
 	v.SetDefault("DATABASE_CONN_MAX_IDLETIME", "20s")
+	v.SetDefault("DATABASE_AUTO_MIGRATE", false)
+	v.SetDefault("DATABASE_TX_ISOLATION", "serializable")
+	v.SetDefault("DATABASE_TX_MAX_RETRIES", 3)
+	v.SetDefault("DATABASE_TX_RETRY_BASE_DELAY", "10ms")
+	v.SetDefault("DATABASE_TX_RETRY_MAX_DELAY", "500ms")
 
 	v.SetDefault("REDIS_DB", 0)
 	v.SetDefault("REDIS_DIAL_TIMEOUT", "5s")
@@ -93,17 +211,62 @@ func LoadConfig() (*Config, error) {
 	v.SetDefault("REDIS_CACHE_TTL", "1h")
 
 	v.SetDefault("KAFKA_USER_EVENTS_TOPIC", "user_events")
+	v.SetDefault("KAFKA_PASSWORD_RESET_TOPIC", "user_password_resets")
 	v.SetDefault("KAFKA_NUM_PARTITIONS", 1)
 	v.SetDefault("KAFKA_REPLICATION_FACTOR", 1)
 	v.SetDefault("KAFKA_WRITE_TIMEOUT", "10s")
+	v.SetDefault("KAFKA_BATCH_TIMEOUT", "10ms")
+	v.SetDefault("KAFKA_EVENT_ENCODING", "json")
+	v.SetDefault("KAFKA_EVENT_SCHEMA_VERSION", "1.1")
+	v.SetDefault("KAFKA_EVENT_SOURCE", "faceit-users-service")
 
 	v.SetDefault("RATE_LIMIT_RPS", 10)
 	v.SetDefault("RATE_LIMIT_BURST", 20)
+	v.SetDefault("RATE_LIMIT_BACKEND", "redis")
 
 	v.SetDefault("API_PORT", 8080)
 	v.SetDefault("GRPC_PORT", 50051)
+	v.SetDefault("GRPC_REQUEST_TIMEOUT", "30s")
+	v.SetDefault("GRPC_STREAM_TIMEOUT", "0s")
 	v.SetDefault("LOG_LEVEL", "info")
 	v.SetDefault("OTEL_SERVICE_NAME", "user-service")
+	v.SetDefault("PASSWORD_RESET_TOKEN_TTL", "30m")
+	v.SetDefault("JWT_ALGORITHM", "HS256")
+	v.SetDefault("JWT_KEY_ID", "default")
+	v.SetDefault("JWT_ISSUER", "user-service")
+	v.SetDefault("JWT_TTL", "1h")
+
+	v.SetDefault("USER_RESTORE_GRACE_PERIOD", "720h")
+	v.SetDefault("USER_PURGE_RETENTION", "720h")
+	v.SetDefault("USER_PURGE_INTERVAL", "1h")
+	v.SetDefault("USER_PURGE_BATCH_SIZE", 100)
+
+	v.SetDefault("OUTBOX_RELAY_INTERVAL", "1s")
+	v.SetDefault("OUTBOX_BATCH_SIZE", 100)
+	v.SetDefault("OUTBOX_RETRY_BASE_DELAY", "1s")
+	v.SetDefault("OUTBOX_RETRY_MAX_DELAY", "5m")
+	v.SetDefault("OUTBOX_PUBLISH_TIMEOUT", "30s")
+
+	v.SetDefault("KAFKA_COMMANDS_ENABLED", false)
+	v.SetDefault("KAFKA_COMMANDS_TOPIC", "user_commands")
+	v.SetDefault("KAFKA_COMMANDS_RETRY_TOPIC", "user_commands_retry")
+	v.SetDefault("KAFKA_COMMANDS_DLQ_TOPIC", "user_commands_dlq")
+	v.SetDefault("KAFKA_COMMANDS_GROUP_ID", "user-service")
+	v.SetDefault("KAFKA_COMMANDS_MAX_ATTEMPTS", 5)
+	v.SetDefault("KAFKA_COMMANDS_RETRY_BASE_DELAY", "1s")
+	v.SetDefault("KAFKA_COMMANDS_RETRY_MAX_DELAY", "5m")
+	v.SetDefault("KAFKA_COMMANDS_HANDLER_TIMEOUT", "30s")
+
+	v.SetDefault("LIST_MAX_LIMIT", 100)
+
+	v.SetDefault("NICKNAME_CHANGE_COOLDOWN", "720h")
+	v.SetDefault("NICKNAME_HISTORY_RETENTION", "2160h")
+
+	v.SetDefault("BATCH_MAX_SIZE", 1000)
+	v.SetDefault("BATCH_HASH_WORKERS", 4)
+	v.SetDefault("WATCH_BUFFER_SIZE", 1000)
+	v.SetDefault("WATCH_SUBSCRIBER_BUFFER", 64)
+	v.SetDefault("WATCH_HEARTBEAT_INTERVAL", "15s")
 
 	v.SetConfigName(".env")
 	v.SetConfigType("env")
@@ -120,12 +283,23 @@ func LoadConfig() (*Config, error) {
 
 	v.AutomaticEnv() // Automatically read matching environment variables
 
+	rateRoutes, err := parseRateQuotas(v.GetString("RATE_LIMIT_ROUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: RATE_LIMIT_ROUTES: %w", err)
+	}
+	trustedProxies, err := parsePrefixes(v.GetString("RATE_LIMIT_TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: RATE_LIMIT_TRUSTED_PROXIES: %w", err)
+	}
+
 	config := Config{
 		API: APIConfig{
 			Port: v.GetInt("API_PORT"),
 		},
 		GRPC: GRPCConfig{
-			Port: v.GetInt("GRPC_PORT"),
+			Port:           v.GetInt("GRPC_PORT"),
+			RequestTimeout: v.GetDuration("GRPC_REQUEST_TIMEOUT"),
+			StreamTimeout:  v.GetDuration("GRPC_STREAM_TIMEOUT"),
 		},
 		DB: DBConfig{
 			URL:             v.GetString("DATABASE_URL"),
@@ -133,6 +307,12 @@ func LoadConfig() (*Config, error) {
 			MaxIdleConns:    v.GetInt("DATABASE_MAX_IDLE_CONNS"),
 			ConnMaxLifetime: v.GetDuration("DATABASE_CONN_MAX_LIFETIME"),
 			ConnMaxIdleTime: v.GetDuration("DATABASE_CONN_MAX_IDLETIME"),
+			AutoMigrate:     v.GetBool("DATABASE_AUTO_MIGRATE"),
+
+			TxIsolation:      strings.ToLower(v.GetString("DATABASE_TX_ISOLATION")),
+			TxMaxRetries:     v.GetInt("DATABASE_TX_MAX_RETRIES"),
+			TxRetryBaseDelay: v.GetDuration("DATABASE_TX_RETRY_BASE_DELAY"),
+			TxRetryMaxDelay:  v.GetDuration("DATABASE_TX_RETRY_MAX_DELAY"),
 		},
 		Redis: RedisConfig{
 			Addr:         v.GetString("REDIS_ADDR"),
@@ -146,13 +326,22 @@ func LoadConfig() (*Config, error) {
 		Kafka: KafkaConfig{
 			Brokers:           v.GetString("KAFKA_BROKERS"),
 			EventTopic:        v.GetString("KAFKA_USER_EVENTS_TOPIC"),
+			ResetTopic:        v.GetString("KAFKA_PASSWORD_RESET_TOPIC"),
 			NumPartitions:     v.GetInt("KAFKA_NUM_PARTITIONS"),
 			ReplicationFactor: v.GetInt("KAFKA_REPLICATION_FACTOR"),
 			WriteTimeout:      v.GetDuration("KAFKA_WRITE_TIMEOUT"),
+			BatchTimeout:      v.GetDuration("KAFKA_BATCH_TIMEOUT"),
+
+			EventEncoding:      strings.ToLower(v.GetString("KAFKA_EVENT_ENCODING")),
+			EventSchemaVersion: v.GetString("KAFKA_EVENT_SCHEMA_VERSION"),
+			EventSource:        v.GetString("KAFKA_EVENT_SOURCE"),
 		},
 		Rate: RateConfig{
 			RequestsPerSecond: v.GetInt("RATE_LIMIT_RPS"),
 			Burst:             v.GetInt("RATE_LIMIT_BURST"),
+			Backend:           strings.ToLower(v.GetString("RATE_LIMIT_BACKEND")),
+			Routes:            rateRoutes,
+			TrustedProxies:    trustedProxies,
 		},
 		Log: LogConfig{
 			Level: v.GetString("LOG_LEVEL"),
@@ -161,6 +350,60 @@ func LoadConfig() (*Config, error) {
 			ExporterEndpoint: v.GetString("OTEL_EXPORTER_OTLP_ENDPOINT"),
 			ServiceName:      v.GetString("OTEL_SERVICE_NAME"),
 		},
+		Auth: AuthConfig{
+			PasswordResetTTL:  v.GetDuration("PASSWORD_RESET_TOKEN_TTL"),
+			JWTAlgorithm:      v.GetString("JWT_ALGORITHM"),
+			JWTSecret:         v.GetString("JWT_SECRET"),
+			JWTPrivateKey:     v.GetString("JWT_PRIVATE_KEY"),
+			JWTPrivateKeyFile: v.GetString("JWT_PRIVATE_KEY_FILE"),
+			JWTKeyID:          v.GetString("JWT_KEY_ID"),
+			JWTIssuer:         v.GetString("JWT_ISSUER"),
+			JWTTTL:            v.GetDuration("JWT_TTL"),
+		},
+		Deletion: DeletionConfig{
+			RestoreGracePeriod: v.GetDuration("USER_RESTORE_GRACE_PERIOD"),
+			PurgeRetention:     v.GetDuration("USER_PURGE_RETENTION"),
+			PurgeInterval:      v.GetDuration("USER_PURGE_INTERVAL"),
+			PurgeBatchSize:     v.GetInt("USER_PURGE_BATCH_SIZE"),
+		},
+		Outbox: OutboxConfig{
+			RelayInterval:  v.GetDuration("OUTBOX_RELAY_INTERVAL"),
+			BatchSize:      v.GetInt("OUTBOX_BATCH_SIZE"),
+			RetryBaseDelay: v.GetDuration("OUTBOX_RETRY_BASE_DELAY"),
+			RetryMaxDelay:  v.GetDuration("OUTBOX_RETRY_MAX_DELAY"),
+			PublishTimeout: v.GetDuration("OUTBOX_PUBLISH_TIMEOUT"),
+		},
+		Commands: CommandsConfig{
+			Enabled:         v.GetBool("KAFKA_COMMANDS_ENABLED"),
+			Topic:           v.GetString("KAFKA_COMMANDS_TOPIC"),
+			RetryTopic:      v.GetString("KAFKA_COMMANDS_RETRY_TOPIC"),
+			DeadLetterTopic: v.GetString("KAFKA_COMMANDS_DLQ_TOPIC"),
+			GroupID:         v.GetString("KAFKA_COMMANDS_GROUP_ID"),
+			MaxAttempts:     v.GetInt("KAFKA_COMMANDS_MAX_ATTEMPTS"),
+			RetryBaseDelay:  v.GetDuration("KAFKA_COMMANDS_RETRY_BASE_DELAY"),
+			RetryMaxDelay:   v.GetDuration("KAFKA_COMMANDS_RETRY_MAX_DELAY"),
+			HandlerTimeout:  v.GetDuration("KAFKA_COMMANDS_HANDLER_TIMEOUT"),
+		},
+		Pagination: PaginationConfig{
+			CursorSecret: v.GetString("LIST_CURSOR_SECRET"),
+			MaxLimit:     v.GetInt("LIST_MAX_LIMIT"),
+		},
+		Nickname: NicknameConfig{
+			ChangeCooldown:   v.GetDuration("NICKNAME_CHANGE_COOLDOWN"),
+			HistoryRetention: v.GetDuration("NICKNAME_HISTORY_RETENTION"),
+		},
+		Batch: BatchConfig{
+			MaxSize:     v.GetInt("BATCH_MAX_SIZE"),
+			HashWorkers: v.GetInt("BATCH_HASH_WORKERS"),
+		},
+		Watch: WatchConfig{
+			BufferSize:        v.GetInt("WATCH_BUFFER_SIZE"),
+			SubscriberBuffer:  v.GetInt("WATCH_SUBSCRIBER_BUFFER"),
+			HeartbeatInterval: v.GetDuration("WATCH_HEARTBEAT_INTERVAL"),
+		},
+	}
+	if config.Pagination.CursorSecret == "" {
+		config.Pagination.CursorSecret = config.Auth.JWTSecret
 	}
 
 	if err := validateConfig(&config); err != nil {
@@ -184,10 +427,92 @@ func validateConfig(config *Config) error {
 		missingVars = append(missingVars, "KAFKA_BROKERS")
 	}
 
+	switch strings.ToUpper(config.Auth.JWTAlgorithm) {
+	case "HS256":
+		if config.Auth.JWTSecret == "" {
+			missingVars = append(missingVars, "JWT_SECRET")
+		}
+	case "RS256":
+		if config.Auth.JWTPrivateKey == "" && config.Auth.JWTPrivateKeyFile == "" {
+			missingVars = append(missingVars, "JWT_PRIVATE_KEY or JWT_PRIVATE_KEY_FILE")
+		}
+	default:
+		return fmt.Errorf("invalid JWT algorithm: %s", config.Auth.JWTAlgorithm)
+	}
+
+	if config.Pagination.CursorSecret == "" {
+		missingVars = append(missingVars, "LIST_CURSOR_SECRET")
+	}
+
 	if len(missingVars) > 0 {
 		return fmt.Errorf("missing required configuration variables: %v", missingVars)
 	}
 
+	if config.Deletion.RestoreGracePeriod > config.Deletion.PurgeRetention {
+		return fmt.Errorf("USER_RESTORE_GRACE_PERIOD (%s) must not exceed USER_PURGE_RETENTION (%s)",
+			config.Deletion.RestoreGracePeriod, config.Deletion.PurgeRetention)
+	}
+
+	if config.DB.TxIsolation != "" && !slices.Contains(TxIsolationLevels, config.DB.TxIsolation) {
+		return fmt.Errorf("invalid DATABASE_TX_ISOLATION: %s, must be one of %v", config.DB.TxIsolation, TxIsolationLevels)
+	}
+	if config.DB.TxMaxRetries < 0 {
+		return fmt.Errorf("DATABASE_TX_MAX_RETRIES must not be negative, got %d", config.DB.TxMaxRetries)
+	}
+
+	if config.GRPC.RequestTimeout < 0 || config.GRPC.StreamTimeout < 0 {
+		return fmt.Errorf("GRPC_REQUEST_TIMEOUT (%s) and GRPC_STREAM_TIMEOUT (%s) must not be negative",
+			config.GRPC.RequestTimeout, config.GRPC.StreamTimeout)
+	}
+
+	if config.Rate.RequestsPerSecond < 1 || config.Rate.Burst < 1 {
+		return fmt.Errorf("RATE_LIMIT_RPS (%d) and RATE_LIMIT_BURST (%d) must be positive",
+			config.Rate.RequestsPerSecond, config.Rate.Burst)
+	}
+	if config.Rate.Backend != "" && !slices.Contains(RateLimitBackends, config.Rate.Backend) {
+		return fmt.Errorf("invalid RATE_LIMIT_BACKEND: %s, must be one of %v", config.Rate.Backend, RateLimitBackends)
+	}
+
+	if config.Kafka.EventEncoding != "" && !slices.Contains(EventEncodings, config.Kafka.EventEncoding) {
+		return fmt.Errorf("invalid KAFKA_EVENT_ENCODING: %s, must be one of %v", config.Kafka.EventEncoding, EventEncodings)
+	}
+
+	if config.Pagination.MaxLimit < 1 {
+		return fmt.Errorf("LIST_MAX_LIMIT must be positive, got %d", config.Pagination.MaxLimit)
+	}
+
+	if config.Nickname.ChangeCooldown < 0 || config.Nickname.HistoryRetention < 0 {
+		return fmt.Errorf("NICKNAME_CHANGE_COOLDOWN (%s) and NICKNAME_HISTORY_RETENTION (%s) must not be negative",
+			config.Nickname.ChangeCooldown, config.Nickname.HistoryRetention)
+	}
+
+	if config.Batch.MaxSize < 1 || config.Batch.HashWorkers < 1 {
+		return fmt.Errorf("BATCH_MAX_SIZE (%d) and BATCH_HASH_WORKERS (%d) must be positive",
+			config.Batch.MaxSize, config.Batch.HashWorkers)
+	}
+
+	if config.Watch.BufferSize < 1 || config.Watch.SubscriberBuffer < 1 {
+		return fmt.Errorf("WATCH_BUFFER_SIZE (%d) and WATCH_SUBSCRIBER_BUFFER (%d) must be positive",
+			config.Watch.BufferSize, config.Watch.SubscriberBuffer)
+	}
+	if config.Commands.Enabled {
+		if config.Commands.Topic == "" || config.Commands.RetryTopic == "" || config.Commands.DeadLetterTopic == "" || config.Commands.GroupID == "" {
+			return fmt.Errorf("KAFKA_COMMANDS_TOPIC, KAFKA_COMMANDS_RETRY_TOPIC, KAFKA_COMMANDS_DLQ_TOPIC and KAFKA_COMMANDS_GROUP_ID must be set when KAFKA_COMMANDS_ENABLED is true")
+		}
+		if config.Commands.MaxAttempts < 1 || config.Commands.HandlerTimeout <= 0 {
+			return fmt.Errorf("KAFKA_COMMANDS_MAX_ATTEMPTS (%d) and KAFKA_COMMANDS_HANDLER_TIMEOUT (%s) must be positive",
+				config.Commands.MaxAttempts, config.Commands.HandlerTimeout)
+		}
+		if config.Commands.RetryBaseDelay <= 0 || config.Commands.RetryMaxDelay < config.Commands.RetryBaseDelay {
+			return fmt.Errorf("KAFKA_COMMANDS_RETRY_BASE_DELAY (%s) must be positive and at most KAFKA_COMMANDS_RETRY_MAX_DELAY (%s)",
+				config.Commands.RetryBaseDelay, config.Commands.RetryMaxDelay)
+		}
+	}
+
+	if config.Watch.HeartbeatInterval <= 0 {
+		return fmt.Errorf("WATCH_HEARTBEAT_INTERVAL must be positive, got %s", config.Watch.HeartbeatInterval)
+	}
+
 	if config.Log.Level != "" {
 		level := strings.ToLower(config.Log.Level)
 		if level != "debug" && level != "info" && level != "warn" && level != "error" {
@@ -197,3 +522,52 @@ func validateConfig(config *Config) error {
 
 	return nil
 }
+
+// parseRateQuotas parses comma separated route=rps:burst quotas, such as
+// "POST /api/v1/auth/login=0.5:5,/user.UserService/Authenticate=0.5:5"
+func parseRateQuotas(raw string) (map[string]RateQuota, error) {
+	quotas := make(map[string]RateQuota)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, quota, ok := strings.Cut(entry, "=")
+		rps, burst, ok2 := strings.Cut(quota, ":")
+		if !ok || !ok2 || strings.TrimSpace(route) == "" {
+			return nil, fmt.Errorf("%q is not of the form route=rps:burst", entry)
+		}
+		q := RateQuota{}
+		var err error
+		if q.RequestsPerSecond, err = strconv.ParseFloat(rps, 64); err != nil || q.RequestsPerSecond <= 0 {
+			return nil, fmt.Errorf("requests per second of %q must be a positive number", entry)
+		}
+		if q.Burst, err = strconv.Atoi(burst); err != nil || q.Burst < 1 {
+			return nil, fmt.Errorf("burst of %q must be a positive integer", entry)
+		}
+		quotas[strings.TrimSpace(route)] = q
+	}
+	return quotas, nil
+}
+
+// parsePrefixes parses comma separated CIDR prefixes; a bare address stands
+// for itself alone
+func parsePrefixes(raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor a CIDR prefix", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
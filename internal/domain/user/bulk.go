@@ -0,0 +1,347 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxBatchSize is the largest batch BatchCreateUsers and GetUsers accept unless configured otherwise
+	DefaultMaxBatchSize = 1000
+	// DefaultHashWorkers is the number of passwords hashed in parallel unless configured otherwise
+	DefaultHashWorkers = 4
+)
+
+// exportPageSize is the number of users ExportUsers reads per query
+const exportPageSize = 500
+
+// BatchResult is the outcome of creating one user of a batch: the created
+// user, or the error that kept it from being created
+type BatchResult struct {
+	User *User
+	Err  error
+}
+
+// BatchCreateUsers creates many users at once and returns a result for each,
+// in the order given. Users that are invalid, or whose email or nickname is
+// taken or repeated earlier in the batch, are reported and skipped; the others
+// are created together in one unit of work. With allOrNothing a single failed
+// user keeps the whole batch from being created, and the others report
+// ErrBatchAborted.
+//
+// Errors that are not about a single user, such as a database failure, are
+// returned instead of the results.
+func (s *Service) BatchCreateUsers(ctx context.Context, users []*User, allOrNothing bool) ([]BatchResult, error) {
+	if len(users) == 0 || len(users) > s.maxBatchSize {
+		return nil, NewValidationError("users", fmt.Sprintf("must contain between 1 and %d users", s.maxBatchSize))
+	}
+
+	results := make([]BatchResult, len(users))
+	seenEmails := make(map[string]bool, len(users))
+	seenNicknames := make(map[string]bool, len(users))
+	pending := make([]int, 0, len(users))
+	for i, u := range users {
+		switch err := validateNewUser(u); {
+		case err != nil:
+			results[i].Err = err
+		case seenEmails[u.Email]:
+			results[i].Err = ErrEmailTaken
+		case seenNicknames[u.Nickname]:
+			results[i].Err = ErrNicknameTaken
+		default:
+			seenEmails[u.Email] = true
+			seenNicknames[u.Nickname] = true
+			pending = append(pending, i)
+		}
+	}
+	if allOrNothing && len(pending) < len(users) {
+		return abortBatch(results, pending), nil
+	}
+
+	if err := hashPasswords(ctx, users, pending, s.hashWorkers); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	for _, i := range pending {
+		u := users[i]
+		if u.Role == "" {
+			u.Role = RolePlayer
+		}
+		u.ID = uuid.New()
+		u.CreatedAt = now
+		u.UpdatedAt = now
+		u.Version = 1
+	}
+
+	// Availability is checked in the unit of work that inserts the users, as
+	// in CreateUser. Each attempt starts over from the pending users.
+	var created []int
+	var taken map[int]error
+	err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		emails := make([]string, len(pending))
+		nicknames := make([]string, len(pending))
+		for j, i := range pending {
+			emails[j] = users[i].Email
+			nicknames[j] = users[i].Nickname
+		}
+		takenEmails, takenNicknames, err := repo.Taken(ctx, emails, nicknames)
+		if err != nil {
+			return fmt.Errorf("failed to check email and nickname availability: %w", err)
+		}
+		emailTaken, nicknameTaken := toSet(takenEmails), toSet(takenNicknames)
+
+		created = make([]int, 0, len(pending))
+		taken = make(map[int]error)
+		for _, i := range pending {
+			switch {
+			case emailTaken[users[i].Email]:
+				taken[i] = ErrEmailTaken
+			case nicknameTaken[users[i].Nickname]:
+				taken[i] = ErrNicknameTaken
+			default:
+				created = append(created, i)
+			}
+		}
+		if len(created) == 0 || allOrNothing && len(taken) > 0 {
+			return nil
+		}
+
+		batch := make([]*User, len(created))
+		for j, i := range created {
+			batch[j] = users[i]
+		}
+		if err := repo.CreateBatch(ctx, batch); err != nil {
+			return fmt.Errorf("failed to save users: %w", err)
+		}
+		for _, u := range batch {
+			if err := s.publisher.PublishCreatedUser(ctx, u); err != nil {
+				return fmt.Errorf("failed to publish user created event: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, err := range taken {
+		results[i].Err = err
+	}
+	if allOrNothing && len(taken) > 0 {
+		return abortBatch(results, pending), nil
+	}
+	for _, i := range created {
+		results[i].User = users[i]
+		s.notifier.NotifyCreated(users[i])
+	}
+	return results, nil
+}
+
+// abortBatch marks the pending users that did not fail themselves as aborted
+func abortBatch(results []BatchResult, pending []int) []BatchResult {
+	for _, i := range pending {
+		if results[i].Err == nil {
+			results[i].Err = ErrBatchAborted
+		}
+	}
+	return results
+}
+
+// validateNewUser checks the fields a new user must have, reporting every
+// problem at once
+func validateNewUser(u *User) error {
+	errs := []error{validateChanges(u, UpdatableFields), validatePassword(u.Password)}
+	if u.Role != "" && !u.Role.IsValid() {
+		errs = append(errs, NewValidationError("role", "must be one of player, moderator, admin"))
+	}
+	return JoinValidationErrors(errs...)
+}
+
+// hashPasswords replaces the passwords of the users at indexes with their
+// bcrypt hashes, hashing up to workers of them at a time
+func hashPasswords(ctx context.Context, users []*User, indexes []int, workers int) error {
+	jobs := make(chan *User)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var hashErr error
+	for range min(max(workers, 1), len(indexes)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobs {
+				hashed, err := hashPassword(u.Password)
+				if err != nil {
+					mu.Lock()
+					hashErr = err
+					mu.Unlock()
+					continue
+				}
+				u.Password = hashed
+			}
+		}()
+	}
+
+feed:
+	for _, i := range indexes {
+		select {
+		case jobs <- users[i]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return hashErr
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// GetUsers returns the users with the given IDs in the same order, with nil
+// in place of unknown or deleted users. An ID may be given more than once.
+func (s *Service) GetUsers(ctx context.Context, ids []uuid.UUID) ([]*User, error) {
+	if len(ids) == 0 || len(ids) > s.maxBatchSize {
+		return nil, NewValidationError("ids", fmt.Sprintf("must contain between 1 and %d IDs", s.maxBatchSize))
+	}
+
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	found, err := s.repo.GetByIDs(ctx, unique)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	byID := make(map[uuid.UUID]*User, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+
+	users := make([]*User, len(ids))
+	for i, id := range ids {
+		users[i] = byID[id]
+	}
+	return users, nil
+}
+
+// ExportUsers calls fn with every user matching filters, oldest first, and
+// stops at the first error fn returns. Users are read a page at a time, so an
+// export of any size runs in constant memory; users changed while it runs may
+// appear in their old or new state.
+func (s *Service) ExportUsers(ctx context.Context, filters []Filter, fn func(*User) error) error {
+	params := ListParams{
+		Limit:   exportPageSize,
+		Filters: append([]Filter(nil), filters...),
+		OrderBy: "created_at",
+	}
+	if err := params.Validate(exportPageSize); err != nil {
+		return err
+	}
+
+	for {
+		users, _, err := s.repo.List(ctx, params)
+		if err != nil {
+			return fmt.Errorf("failed to list users for export: %w", err)
+		}
+		for i := range users {
+			if err := fn(&users[i]); err != nil {
+				return err
+			}
+		}
+		if len(users) < params.Limit {
+			return nil
+		}
+
+		after := cursorAfter(&users[len(users)-1], params.OrderBy, false)
+		params.After = &after
+	}
+}
+
+// CorrectCountry moves every user in country from to country to and returns
+// how many were moved. Users are moved a page of up to the batch size at a
+// time, each page with one update and its events in its own unit of work.
+// Moved users leave the old country, so after a failure a retry resumes with
+// the users not yet moved.
+func (s *Service) CorrectCountry(ctx context.Context, from, to string) (int, error) {
+	if err := validateChanges(&User{Country: to}, []Field{FieldCountry}); err != nil {
+		return 0, err
+	}
+	if from == to {
+		return 0, NewValidationError("to", "must differ from the country corrected")
+	}
+
+	params := ListParams{
+		Limit:   s.maxBatchSize,
+		Filters: []Filter{{Field: "country", Operator: OpEq, Value: from}},
+		OrderBy: "created_at",
+	}
+	if err := params.Validate(s.maxBatchSize); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		var found, moved []User
+		err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+			moved = nil
+			var err error
+			found, _, err = repo.List(ctx, params)
+			if err != nil {
+				return fmt.Errorf("failed to list users in %s: %w", from, err)
+			}
+			if len(found) == 0 {
+				return nil
+			}
+
+			ids := make([]uuid.UUID, len(found))
+			before := make(map[uuid.UUID]*User, len(found))
+			for i := range found {
+				ids[i] = found[i].ID
+				before[found[i].ID] = &found[i]
+			}
+			moved, err = repo.SetCountry(ctx, ids, to)
+			if err != nil {
+				return fmt.Errorf("failed to move users to %s: %w", to, err)
+			}
+			for i := range moved {
+				if err := s.publisher.PublishUpdatedUser(ctx, &moved[i], before[moved[i].ID]); err != nil {
+					return fmt.Errorf("failed to publish user updated event: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+
+		for i := range moved {
+			s.notifier.NotifyUpdated(&moved[i])
+		}
+		total += len(moved)
+		if len(found) < params.Limit {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newBatchUser(nickname, email string) *User {
+	return &User{FirstName: "John", LastName: "Doe", Nickname: nickname, Password: "secret123", Email: email, Country: "US"}
+}
+
+func TestService_BatchCreateUsers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("creates valid users and reports the others", func(t *testing.T) {
+		repo := newMockRepository()
+		pub := newMockPublisher()
+		service := NewService(repo, pub, logger, WithBatchLimits(10, 2))
+
+		existing := &User{ID: uuid.New(), Nickname: "taken", Email: "taken@example.com"}
+		repo.users[existing.ID] = existing
+
+		results, err := service.BatchCreateUsers(context.Background(), []*User{
+			newBatchUser("alice", "alice@example.com"),
+			newBatchUser("", "nobody@example.com"),
+			newBatchUser("bob", "alice@example.com"),
+			newBatchUser("taken", "carol@example.com"),
+			newBatchUser("dave", "dave@example.com"),
+		}, false)
+		if err != nil {
+			t.Fatalf("BatchCreateUsers() error = %v", err)
+		}
+
+		wantErrs := []error{nil, ErrValidation, ErrEmailTaken, ErrNicknameTaken, nil}
+		for i, want := range wantErrs {
+			if !errors.Is(results[i].Err, want) {
+				t.Errorf("results[%d].Err = %v, want %v", i, results[i].Err, want)
+			}
+			if (results[i].User != nil) != (want == nil) {
+				t.Errorf("results[%d].User = %v, want a user only on success", i, results[i].User)
+			}
+		}
+
+		created := results[0].User
+		if created.ID == uuid.Nil || created.Role != RolePlayer || created.Version != 1 {
+			t.Errorf("created user = %+v, want an ID, the player role and version 1", created)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(created.Password), []byte("secret123")) != nil {
+			t.Error("created user password was not hashed")
+		}
+		if len(repo.users) != 3 {
+			t.Errorf("repository holds %d users, want 3", len(repo.users))
+		}
+		if len(pub.createdUsers) != 2 {
+			t.Errorf("published %d created events, want 2", len(pub.createdUsers))
+		}
+		if repo.committed != 1 {
+			t.Errorf("committed %d units of work, want 1", repo.committed)
+		}
+	})
+
+	t.Run("all or nothing aborts the batch", func(t *testing.T) {
+		repo := newMockRepository()
+		pub := newMockPublisher()
+		service := NewService(repo, pub, logger)
+
+		existing := &User{ID: uuid.New(), Nickname: "taken", Email: "taken@example.com"}
+		repo.users[existing.ID] = existing
+
+		results, err := service.BatchCreateUsers(context.Background(), []*User{
+			newBatchUser("alice", "alice@example.com"),
+			newBatchUser("bob", "taken@example.com"),
+		}, true)
+		if err != nil {
+			t.Fatalf("BatchCreateUsers() error = %v", err)
+		}
+
+		if !errors.Is(results[0].Err, ErrBatchAborted) || results[0].User != nil {
+			t.Errorf("results[0] = %+v, want the batch aborted", results[0])
+		}
+		if !errors.Is(results[1].Err, ErrEmailTaken) {
+			t.Errorf("results[1].Err = %v, want %v", results[1].Err, ErrEmailTaken)
+		}
+		if len(repo.users) != 1 || len(pub.createdUsers) != 0 {
+			t.Errorf("created %d users and published %d events, want none", len(repo.users)-1, len(pub.createdUsers))
+		}
+	})
+
+	t.Run("rejects empty and oversized batches", func(t *testing.T) {
+		service := NewService(newMockRepository(), newMockPublisher(), logger, WithBatchLimits(1, 1))
+
+		for _, users := range [][]*User{nil, {newBatchUser("a", "a@example.com"), newBatchUser("b", "b@example.com")}} {
+			if _, err := service.BatchCreateUsers(context.Background(), users, false); !errors.Is(err, ErrValidation) {
+				t.Errorf("BatchCreateUsers(%d users) error = %v, want %v", len(users), err, ErrValidation)
+			}
+		}
+	})
+
+	t.Run("publish failure rolls the batch back", func(t *testing.T) {
+		repo := newMockRepository()
+		pub := newMockPublisher()
+		pub.err = errors.New("outbox unavailable")
+		service := NewService(repo, pub, logger)
+
+		if _, err := service.BatchCreateUsers(context.Background(), []*User{newBatchUser("alice", "alice@example.com")}, false); err == nil {
+			t.Fatal("BatchCreateUsers() error = nil, want the publish failure")
+		}
+		if repo.rolledBack != 1 {
+			t.Errorf("rolled back %d units of work, want 1", repo.rolledBack)
+		}
+	})
+}
+
+func TestHashPasswords_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	users := []*User{newBatchUser("alice", "alice@example.com"), newBatchUser("bob", "bob@example.com")}
+	if err := hashPasswords(ctx, users, []int{0, 1}, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("hashPasswords() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestService_GetUsers(t *testing.T) {
+	repo := newMockRepository()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, newMockPublisher(), logger, WithBatchLimits(4, 1))
+
+	alice := &User{ID: uuid.New(), Nickname: "alice"}
+	deletedAt := time.Now().UTC()
+	deleted := &User{ID: uuid.New(), Nickname: "gone", DeletedAt: &deletedAt}
+	repo.users[alice.ID] = alice
+	repo.users[deleted.ID] = deleted
+
+	users, err := service.GetUsers(context.Background(), []uuid.UUID{deleted.ID, alice.ID, uuid.New(), alice.ID})
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 4 || users[0] != nil || users[2] != nil {
+		t.Fatalf("GetUsers() = %v, want nil for the deleted and unknown users", users)
+	}
+	if users[1].ID != alice.ID || users[3].ID != alice.ID {
+		t.Errorf("GetUsers() = %v, want alice at positions 1 and 3", users)
+	}
+
+	for _, ids := range [][]uuid.UUID{nil, make([]uuid.UUID, 5)} {
+		if _, err := service.GetUsers(context.Background(), ids); !errors.Is(err, ErrValidation) {
+			t.Errorf("GetUsers(%d IDs) error = %v, want %v", len(ids), err, ErrValidation)
+		}
+	}
+}
+
+func TestService_ExportUsers(t *testing.T) {
+	repo := newMockRepository()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, newMockPublisher(), logger)
+
+	// More users than fit a page, so the export has to follow the keyset
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range exportPageSize + 20 {
+		country := "US"
+		if i%2 == 1 {
+			country = "DE"
+		}
+		u := &User{ID: uuid.New(), Nickname: fmt.Sprintf("user%03d", i), Country: country, CreatedAt: created.Add(time.Duration(i) * time.Minute)}
+		repo.users[u.ID] = u
+	}
+
+	var exported []*User
+	err := service.ExportUsers(context.Background(), []Filter{{Field: "country", Operator: OpEq, Value: "US"}}, func(u *User) error {
+		exported = append(exported, u)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ExportUsers() error = %v", err)
+	}
+	if len(exported) != (exportPageSize+20)/2 {
+		t.Fatalf("exported %d users, want %d", len(exported), (exportPageSize+20)/2)
+	}
+	for i := 1; i < len(exported); i++ {
+		if !exported[i].CreatedAt.After(exported[i-1].CreatedAt) {
+			t.Fatalf("exported users out of order at %d", i)
+		}
+	}
+
+	t.Run("stops at the first callback error", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := service.ExportUsers(context.Background(), nil, func(*User) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("ExportUsers() error = %v after %d calls, want %v after 1", err, calls, stop)
+		}
+	})
+
+	t.Run("rejects invalid filters", func(t *testing.T) {
+		err := service.ExportUsers(context.Background(), []Filter{{Field: "password", Value: "x"}}, func(*User) error { return nil })
+		if !errors.Is(err, ErrValidation) {
+			t.Errorf("ExportUsers() error = %v, want %v", err, ErrValidation)
+		}
+	})
+}
+
+// pageFailingRepository fails the SetCountry call numbered failAt, leaving
+// the pages before it moved
+type pageFailingRepository struct {
+	*mockRepository
+	calls  int
+	failAt int
+}
+
+func (r *pageFailingRepository) SetCountry(ctx context.Context, ids []uuid.UUID, country string) ([]User, error) {
+	r.calls++
+	if r.calls == r.failAt {
+		return nil, errors.New("statement timeout")
+	}
+	return r.mockRepository.SetCountry(ctx, ids, country)
+}
+
+func (r *pageFailingRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error {
+	return fn(ctx, r)
+}
+
+func TestService_CorrectCountry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	// More users than fit a page of the batch size of 2
+	seed := func(repo *mockRepository) {
+		created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := range 5 {
+			u := &User{ID: uuid.New(), Nickname: fmt.Sprintf("user%d", i), Country: "YU", Version: 1, CreatedAt: created.Add(time.Duration(i) * time.Minute)}
+			repo.users[u.ID] = u
+		}
+		stayed := &User{ID: uuid.New(), Nickname: "stayed", Country: "DE", Version: 1, CreatedAt: created}
+		repo.users[stayed.ID] = stayed
+	}
+	countIn := func(repo *mockRepository, country string) int {
+		n := 0
+		for _, u := range repo.users {
+			if u.Country == country {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("moves every page", func(t *testing.T) {
+		repo := newMockRepository()
+		seed(repo)
+		pub := newMockPublisher()
+		notifier := &mockNotifier{}
+		service := NewService(repo, pub, logger, WithBatchLimits(2, 1), WithNotifier(notifier))
+
+		count, err := service.CorrectCountry(context.Background(), "YU", "RS")
+		if err != nil {
+			t.Fatalf("CorrectCountry() error = %v", err)
+		}
+		if count != 5 {
+			t.Errorf("CorrectCountry() = %d, want 5", count)
+		}
+		if countIn(repo, "RS") != 5 || countIn(repo, "YU") != 0 || countIn(repo, "DE") != 1 {
+			t.Errorf("countries after correction: RS %d, YU %d, DE %d", countIn(repo, "RS"), countIn(repo, "YU"), countIn(repo, "DE"))
+		}
+		if repo.committed != 3 {
+			t.Errorf("committed %d units of work, want one per page (3)", repo.committed)
+		}
+
+		// One event per moved user, with the state before the move
+		if len(pub.updatedUsers) != 5 {
+			t.Fatalf("published %d update events, want 5", len(pub.updatedUsers))
+		}
+		for i, u := range pub.updatedUsers {
+			previous := pub.previousUsers[i]
+			if previous == nil || previous.ID != u.ID || previous.Country != "YU" || u.Country != "RS" || u.Version != previous.Version+1 {
+				t.Errorf("event %d = %+v after %+v, want a move from YU to RS", i, u, previous)
+			}
+		}
+		if len(notifier.changes) != 5 {
+			t.Errorf("notified %v, want the 5 moved users", notifier.changes)
+		}
+	})
+
+	t.Run("retry resumes after a failed page", func(t *testing.T) {
+		repo := &pageFailingRepository{mockRepository: newMockRepository(), failAt: 2}
+		seed(repo.mockRepository)
+		service := NewService(repo, newMockPublisher(), logger, WithBatchLimits(2, 1))
+
+		count, err := service.CorrectCountry(context.Background(), "YU", "RS")
+		if err == nil {
+			t.Fatal("CorrectCountry() error = nil, want the failed page")
+		}
+		if count != 2 || countIn(repo.mockRepository, "RS") != 2 {
+			t.Fatalf("CorrectCountry() moved %d users before failing, want the first page of 2", count)
+		}
+
+		count, err = service.CorrectCountry(context.Background(), "YU", "RS")
+		if err != nil {
+			t.Fatalf("retried CorrectCountry() error = %v", err)
+		}
+		if count != 3 || countIn(repo.mockRepository, "YU") != 0 {
+			t.Errorf("retried CorrectCountry() = %d, want the 3 users left", count)
+		}
+	})
+
+	for name, countries := range map[string][2]string{
+		"invalid country": {"YU", "Serbia"},
+		"same country":    {"RS", "RS"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			service := NewService(newMockRepository(), newMockPublisher(), logger)
+			if _, err := service.CorrectCountry(context.Background(), countries[0], countries[1]); !errors.Is(err, ErrValidation) {
+				t.Errorf("CorrectCountry(%q, %q) error = %v, want %v", countries[0], countries[1], err, ErrValidation)
+			}
+		})
+	}
+}
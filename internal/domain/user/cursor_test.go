@@ -0,0 +1,64 @@
+package user
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorCodec(t *testing.T) {
+	codec := NewCursorCodec([]byte("test-key"))
+	cursor := Cursor{
+		OrderBy: "created_at",
+		Desc:    true,
+		Value:   "2024-01-02T03:04:05.000000000Z",
+		ID:      uuid.New(),
+	}
+
+	token, err := codec.Encode(cursor)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	got, err := codec.Decode(token)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if *got != cursor {
+		t.Errorf("Decode() = %+v, want %+v", *got, cursor)
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+	forged, _ := NewCursorCodec([]byte("other-key")).Encode(cursor)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "no signature", token: payload},
+		{name: "tampered payload", token: "x" + payload + "." + sig},
+		{name: "tampered signature", token: payload + "." + sig[:len(sig)-2]},
+		{name: "signed with another key", token: forged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := codec.Decode(tt.token); !IsValidationError(err) {
+				t.Errorf("Decode() error = %v, want validation error", err)
+			}
+		})
+	}
+}
+
+func TestSortValue_TimestampsOrderAsStrings(t *testing.T) {
+	base := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	earlier := &User{CreatedAt: base.Add(120 * time.Millisecond)}
+	later := &User{CreatedAt: base.Add(123456789 * time.Nanosecond)}
+
+	if sortValue(earlier, "created_at") >= sortValue(later, "created_at") {
+		t.Errorf("sortValue() %q does not sort before %q", sortValue(earlier, "created_at"), sortValue(later, "created_at"))
+	}
+}
@@ -3,16 +3,26 @@ package user
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // Common error types for the user domain
 var (
-	ErrNotFound      = fmt.Errorf("user not found")
-	ErrAlreadyExists = fmt.Errorf("user already exists")
-	ErrInvalidInput  = fmt.Errorf("invalid input")
-	ErrEmailTaken    = fmt.Errorf("email is already taken")
-	ErrNicknameTaken = fmt.Errorf("nickname is already taken")
-	ErrValidation    = fmt.Errorf("validation error")
+	ErrNotFound           = fmt.Errorf("user not found")
+	ErrAlreadyExists      = fmt.Errorf("user already exists")
+	ErrInvalidInput       = fmt.Errorf("invalid input")
+	ErrEmailTaken         = fmt.Errorf("email is already taken")
+	ErrNicknameTaken      = fmt.Errorf("nickname is already taken")
+	ErrValidation         = fmt.Errorf("validation error")
+	ErrInvalidCredentials = fmt.Errorf("invalid credentials")
+	ErrInvalidResetToken  = fmt.Errorf("invalid or expired password reset token")
+	ErrForbidden          = fmt.Errorf("operation not permitted")
+	ErrConflict           = fmt.Errorf("user was modified concurrently")
+	ErrNicknameCooldown   = fmt.Errorf("nickname was changed too recently")
+	ErrSerialization      = fmt.Errorf("transaction conflicted with a concurrent one, retry it")
+	ErrTimeout            = fmt.Errorf("operation timed out")
+	ErrBatchAborted       = fmt.Errorf("not created because another user of the batch failed")
+	ErrBanned             = fmt.Errorf("user is banned")
 )
 
 // ValidationError represents a validation error with details
@@ -25,6 +35,11 @@ func (e *ValidationError) Error() string {
 	return fmt.Sprintf("validation error: %s - %s", e.Field, e.Message)
 }
 
+// Is reports ValidationError as a kind of ErrValidation
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
 func NewValidationError(field, message string) error {
 	return &ValidationError{
 		Field:   field,
@@ -32,6 +47,68 @@ func NewValidationError(field, message string) error {
 	}
 }
 
+// ValidationErrors reports several invalid fields at once
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Field + " - " + err.Message
+	}
+	return "validation error: " + strings.Join(messages, "; ")
+}
+
+// Is reports ValidationErrors as a kind of ErrValidation
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// JoinValidationErrors merges the given validation errors, ignoring nil ones,
+// into a single ValidationErrors. It returns nil if all are nil and the first
+// error that is not a validation error, if any.
+func JoinValidationErrors(errs ...error) error {
+	var joined ValidationErrors
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		var many ValidationErrors
+		var one *ValidationError
+		switch {
+		case errors.As(err, &many):
+			joined = append(joined, many...)
+		case errors.As(err, &one):
+			joined = append(joined, one)
+		default:
+			return err
+		}
+	}
+	if len(joined) == 0 {
+		return nil
+	}
+	return joined
+}
+
+// ValidationDetails maps each invalid field reported by err to its message
+func ValidationDetails(err error) map[string]string {
+	var many ValidationErrors
+	if !errors.As(err, &many) {
+		var one *ValidationError
+		if !errors.As(err, &one) {
+			return nil
+		}
+		many = ValidationErrors{one}
+	}
+
+	details := make(map[string]string, len(many))
+	for _, e := range many {
+		if _, exists := details[e.Field]; !exists {
+			details[e.Field] = e.Message
+		}
+	}
+	return details
+}
+
 func IsNotFound(err error) bool {
 	return errors.Is(err, ErrNotFound)
 }
@@ -40,6 +117,10 @@ func IsAlreadyExists(err error) bool {
 	return errors.Is(err, ErrAlreadyExists) || errors.Is(err, ErrEmailTaken) || errors.Is(err, ErrNicknameTaken)
 }
 
+func IsConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
 func IsValidationError(err error) bool {
 	var validationError *ValidationError
 	ok := errors.As(err, &validationError)
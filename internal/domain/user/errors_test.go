@@ -2,6 +2,7 @@ package user
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -197,3 +198,47 @@ func TestNewValidationError(t *testing.T) {
 		})
 	}
 }
+
+func TestValidationError_Is(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", NewValidationError("password", "must not be empty"))
+
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("errors.Is(%v, ErrValidation) = false, want true", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("errors.Is(%v, ErrNotFound) = true, want false", err)
+	}
+}
+
+func TestJoinValidationErrors(t *testing.T) {
+	if err := JoinValidationErrors(nil, nil); err != nil {
+		t.Errorf("JoinValidationErrors() = %v, want nil", err)
+	}
+
+	other := errors.New("database down")
+	if err := JoinValidationErrors(NewValidationError("limit", "too large"), other); err != other {
+		t.Errorf("JoinValidationErrors() = %v, want %v", err, other)
+	}
+
+	err := JoinValidationErrors(
+		NewValidationError("page", "must be positive"),
+		nil,
+		fmt.Errorf("wrapped: %w", ValidationErrors{
+			{Field: "limit", Message: "too large"},
+			{Field: "page", Message: "reported twice"},
+		}),
+	)
+	if !IsValidationError(err) {
+		t.Fatalf("JoinValidationErrors() = %v, want validation error", err)
+	}
+
+	details := ValidationDetails(err)
+	want := map[string]string{"page": "must be positive", "limit": "too large"}
+	if len(details) != len(want) || details["page"] != want["page"] || details["limit"] != want["limit"] {
+		t.Errorf("ValidationDetails() = %v, want %v", details, want)
+	}
+
+	if details := ValidationDetails(ErrNotFound); details != nil {
+		t.Errorf("ValidationDetails() = %v, want nil", details)
+	}
+}
@@ -0,0 +1,131 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FilterOperator is the comparison a Filter applies to its field
+type FilterOperator string
+
+const (
+	OpEq       FilterOperator = "eq"       // Equal to the value
+	OpNeq      FilterOperator = "neq"      // Not equal to the value
+	OpPrefix   FilterOperator = "prefix"   // Starts with the value, ignoring case
+	OpContains FilterOperator = "contains" // Contains the value, ignoring case
+	OpIn       FilterOperator = "in"       // Equal to one of the values
+	OpGt       FilterOperator = "gt"       // Later than the value
+	OpLt       FilterOperator = "lt"       // Earlier than the value
+)
+
+var (
+	textOperators = []FilterOperator{OpEq, OpNeq, OpPrefix, OpContains, OpIn}
+	timeOperators = []FilterOperator{OpGt, OpLt}
+)
+
+// filterableFields lists the operators supported by each filterable field
+var filterableFields = map[string][]FilterOperator{
+	"first_name": textOperators,
+	"last_name":  textOperators,
+	"nickname":   textOperators,
+	"email":      textOperators,
+	"country":    textOperators,
+	"created_at": timeOperators,
+	"updated_at": timeOperators,
+}
+
+// sortableFields lists the fields users can be ordered by
+var sortableFields = map[string]struct{}{
+	"first_name": {},
+	"last_name":  {},
+	"nickname":   {},
+	"email":      {},
+	"country":    {},
+	"created_at": {},
+	"updated_at": {},
+}
+
+// DefaultMaxListLimit is the largest page size unless configured otherwise
+const DefaultMaxListLimit = 100
+
+// Validate checks params against the sortable and filterable fields and the
+// page size limit, reporting every problem at once. An empty OrderBy defaults
+// to created_at and filters without an operator to contains.
+func (p *ListParams) Validate(maxLimit int) error {
+	var errs []error
+
+	if p.Limit < 1 || p.Limit > maxLimit {
+		errs = append(errs, NewValidationError("limit", fmt.Sprintf("must be between 1 and %d", maxLimit)))
+	}
+	if p.Offset < 0 {
+		errs = append(errs, NewValidationError("offset", "must not be negative"))
+	}
+
+	if p.OrderBy == "" {
+		p.OrderBy = "created_at"
+	} else if _, ok := sortableFields[p.OrderBy]; !ok {
+		errs = append(errs, NewValidationError("order_by", "is not a sortable field"))
+	}
+
+	for i := range p.Filters {
+		errs = append(errs, p.Filters[i].normalize())
+	}
+
+	return JoinValidationErrors(errs...)
+}
+
+// normalize defaults the operator of f to contains, which is how filters
+// without an operator have always matched, and validates f
+// Errors name the filter as written in a query string, field or field[operator].
+func (f *Filter) normalize() error {
+	name := f.Field
+	if f.Operator == "" {
+		f.Operator = OpContains
+	} else {
+		name += "[" + string(f.Operator) + "]"
+	}
+
+	operators, ok := filterableFields[f.Field]
+	if !ok {
+		return NewValidationError(name, "is not a filterable field")
+	}
+	if !containsOperator(operators, f.Operator) {
+		return NewValidationError(name, fmt.Sprintf("unsupported operator, use one of %s", joinOperators(operators)))
+	}
+
+	switch f.Operator {
+	case OpIn:
+		if len(f.Values) == 0 {
+			return NewValidationError(name, "requires at least one value")
+		}
+		return nil
+	}
+	if f.Value == "" {
+		return NewValidationError(name, "must not be empty")
+	}
+	switch f.Operator {
+	case OpGt, OpLt:
+		if _, err := time.Parse(time.RFC3339, f.Value); err != nil {
+			return NewValidationError(name, "must be an RFC 3339 timestamp")
+		}
+	}
+	return nil
+}
+
+func containsOperator(operators []FilterOperator, op FilterOperator) bool {
+	for _, candidate := range operators {
+		if candidate == op {
+			return true
+		}
+	}
+	return false
+}
+
+func joinOperators(operators []FilterOperator) string {
+	names := make([]string, len(operators))
+	for i, op := range operators {
+		names[i] = string(op)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,75 @@
+package user
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListParams_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      ListParams
+		wantDetails map[string]string
+	}{
+		{
+			name:   "valid",
+			params: ListParams{Limit: 10, OrderBy: "nickname", Filters: []Filter{{Field: "country", Operator: OpEq, Value: "DE"}}},
+		},
+		{
+			name: "every problem at once",
+			params: ListParams{
+				Limit:   500,
+				Offset:  -1,
+				OrderBy: "password_hash",
+				Filters: []Filter{
+					{Field: "password_hash", Value: "x"},
+					{Field: "country", Operator: OpGt, Value: "DE"},
+					{Field: "created_at", Operator: OpLt, Value: "yesterday"},
+					{Field: "country", Operator: OpIn},
+					{Field: "email", Operator: OpEq},
+				},
+			},
+			wantDetails: map[string]string{
+				"limit":          "must be between 1 and 100",
+				"offset":         "must not be negative",
+				"order_by":       "is not a sortable field",
+				"password_hash":  "is not a filterable field",
+				"country[gt]":    "unsupported operator, use one of eq, neq, prefix, contains, in",
+				"created_at[lt]": "must be an RFC 3339 timestamp",
+				"country[in]":    "requires at least one value",
+				"email[eq]":      "must not be empty",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.params.Validate(DefaultMaxListLimit)
+			if tt.wantDetails == nil {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if !IsValidationError(err) {
+				t.Fatalf("Validate() error = %v, want validation error", err)
+			}
+			if got := ValidationDetails(err); !reflect.DeepEqual(got, tt.wantDetails) {
+				t.Errorf("Validate() details = %v, want %v", got, tt.wantDetails)
+			}
+		})
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		params := ListParams{Limit: 1, Filters: []Filter{{Field: "nickname", Value: "jo"}}}
+		if err := params.Validate(DefaultMaxListLimit); err != nil {
+			t.Fatalf("Validate() error = %v", err)
+		}
+		if params.OrderBy != "created_at" {
+			t.Errorf("Validate() order by = %q, want created_at", params.OrderBy)
+		}
+		if params.Filters[0].Operator != OpContains {
+			t.Errorf("Validate() operator = %q, want contains", params.Filters[0].Operator)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NicknameHistoryRepository defines the interface for persisting the nicknames
+// users had before renaming themselves
+type NicknameHistoryRepository interface {
+	// Record stores that the user stopped using nickname at changedAt
+	Record(ctx context.Context, userID uuid.UUID, nickname string, changedAt time.Time) error
+	// LastChange returns when the user last changed nickname. It returns
+	// ErrNotFound if the user never did.
+	LastChange(ctx context.Context, userID uuid.UUID) (time.Time, error)
+	// Resolve returns the user who most recently gave up nickname after since.
+	// It returns ErrNotFound if nobody did.
+	Resolve(ctx context.Context, nickname string, since time.Time) (uuid.UUID, error)
+}
@@ -0,0 +1,34 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PasswordReset is a freshly issued password reset token.
+// The plain token is only ever returned here; storage keeps a hash of it.
+type PasswordReset struct {
+	UserID    uuid.UUID
+	Token     string
+	ExpiresAt time.Time
+}
+
+// ResetSender delivers password reset tokens to their users, e.g. by email.
+// It is the only thing a plain token is handed to: tokens are neither stored
+// nor carried by events.
+type ResetSender interface {
+	SendPasswordReset(ctx context.Context, User *User, reset *PasswordReset) error
+}
+
+// PasswordResetRepository defines the interface for persisting password reset tokens
+type PasswordResetRepository interface {
+	// Create stores the hash of a reset token for the given user
+	Create(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	// Consume marks an unused, unexpired token as used and returns its owner.
+	// It returns ErrNotFound if no such token exists.
+	Consume(ctx context.Context, tokenHash string) (uuid.UUID, error)
+	// DeleteByUserID removes all outstanding tokens of a user
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+}
@@ -0,0 +1,124 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// Action is an operation a principal may attempt on a user
+type Action string
+
+const (
+	ActionRead           Action = "read"
+	ActionList           Action = "list"
+	ActionUpdate         Action = "update"
+	ActionDelete         Action = "delete"
+	ActionRestore        Action = "restore"
+	ActionChangePassword Action = "change_password"
+	ActionAssignRole     Action = "assign_role"
+	ActionBatchCreate    Action = "batch_create"
+	ActionExport         Action = "export"
+)
+
+// Principal is the authenticated caller of an operation
+type Principal struct {
+	UserID uuid.UUID
+	Role   Role
+}
+
+// Policy decides which principals may perform which actions on which users.
+//
+// Players may only modify their own account. Moderators may additionally
+// update and delete players. Admins may do anything except change their own
+// role, so the last admin cannot lock everyone out by accident. Only admins
+// may restore deleted users, create users in bulk and export them.
+//
+// The role in a principal comes from its access token, which outlives role
+// changes and bans. It is only trusted to deny: actions a player could not
+// perform are decided on the role of the stored user, and are denied to
+// banned and deleted users.
+type Policy struct {
+	repo Repository
+}
+
+// NewPolicy creates a policy that looks up principals and target users in repo
+// when their role matters for the decision
+func NewPolicy(repo Repository) *Policy {
+	return &Policy{repo: repo}
+}
+
+// Authorize returns ErrForbidden unless principal may perform action on the
+// user identified by targetID. targetID is ignored for actions that are not
+// bound to a single user.
+func (p *Policy) Authorize(ctx context.Context, principal *Principal, action Action, targetID uuid.UUID) error {
+	if principal == nil {
+		return ErrForbidden
+	}
+
+	self := principal.UserID == targetID
+
+	switch action {
+	case ActionRead, ActionList:
+		return nil
+	case ActionChangePassword, ActionUpdate, ActionDelete:
+		if self {
+			return nil
+		}
+	}
+	if principal.Role != RoleModerator && principal.Role != RoleAdmin {
+		return ErrForbidden
+	}
+
+	role, err := p.storedRole(ctx, principal)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case ActionChangePassword:
+		if role == RoleAdmin {
+			return nil
+		}
+	case ActionUpdate, ActionDelete:
+		if role == RoleAdmin {
+			return nil
+		}
+		if role == RoleModerator {
+			target, err := p.repo.GetByID(ctx, targetID)
+			if err != nil {
+				return err
+			}
+			if target.Role == RolePlayer {
+				return nil
+			}
+		}
+	case ActionRestore, ActionBatchCreate, ActionExport:
+		if role == RoleAdmin {
+			return nil
+		}
+	case ActionAssignRole:
+		if role == RoleAdmin && !self {
+			return nil
+		}
+	}
+
+	return ErrForbidden
+}
+
+// storedRole returns the role principal holds now, or ErrForbidden if they
+// have since been banned or deleted
+func (p *Policy) storedRole(ctx context.Context, principal *Principal) (Role, error) {
+	u, err := p.repo.GetByID(ctx, principal.UserID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", ErrForbidden
+		}
+		return "", err
+	}
+	if u.BannedAt != nil {
+		return "", ErrForbidden
+	}
+	return u.Role, nil
+}
@@ -0,0 +1,92 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPolicy_Authorize(t *testing.T) {
+	repo := newMockRepository()
+	player := &User{ID: uuid.New(), Role: RolePlayer}
+	otherPlayer := &User{ID: uuid.New(), Role: RolePlayer}
+	moderator := &User{ID: uuid.New(), Role: RoleModerator}
+	admin := &User{ID: uuid.New(), Role: RoleAdmin}
+	bannedAt := time.Now().UTC()
+	bannedAdmin := &User{ID: uuid.New(), Role: RoleAdmin, BannedAt: &bannedAt}
+	demotedAdmin := &User{ID: uuid.New(), Role: RolePlayer}
+	for _, u := range []*User{player, otherPlayer, moderator, admin, bannedAdmin, demotedAdmin} {
+		repo.users[u.ID] = u
+	}
+
+	policy := NewPolicy(repo)
+	principal := func(u *User) *Principal {
+		return &Principal{UserID: u.ID, Role: u.Role}
+	}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		action    Action
+		target    uuid.UUID
+		wantErr   error
+	}{
+		{name: "anonymous", principal: nil, action: ActionRead, target: player.ID, wantErr: ErrForbidden},
+		{name: "player reads other", principal: principal(player), action: ActionRead, target: otherPlayer.ID},
+		{name: "player lists", principal: principal(player), action: ActionList},
+		{name: "player updates self", principal: principal(player), action: ActionUpdate, target: player.ID},
+		{name: "player updates other", principal: principal(player), action: ActionUpdate, target: otherPlayer.ID, wantErr: ErrForbidden},
+		{name: "player deletes other", principal: principal(player), action: ActionDelete, target: otherPlayer.ID, wantErr: ErrForbidden},
+		{name: "player changes own password", principal: principal(player), action: ActionChangePassword, target: player.ID},
+		{name: "player assigns role", principal: principal(player), action: ActionAssignRole, target: otherPlayer.ID, wantErr: ErrForbidden},
+		{name: "moderator updates player", principal: principal(moderator), action: ActionUpdate, target: player.ID},
+		{name: "moderator deletes player", principal: principal(moderator), action: ActionDelete, target: player.ID},
+		{name: "moderator deletes admin", principal: principal(moderator), action: ActionDelete, target: admin.ID, wantErr: ErrForbidden},
+		{name: "moderator updates missing user", principal: principal(moderator), action: ActionUpdate, target: uuid.New(), wantErr: ErrNotFound},
+		{name: "moderator changes player password", principal: principal(moderator), action: ActionChangePassword, target: player.ID, wantErr: ErrForbidden},
+		{name: "moderator restores player", principal: principal(moderator), action: ActionRestore, target: player.ID, wantErr: ErrForbidden},
+		{name: "admin restores player", principal: principal(admin), action: ActionRestore, target: player.ID},
+		{name: "admin deletes moderator", principal: principal(admin), action: ActionDelete, target: moderator.ID},
+		{name: "admin changes player password", principal: principal(admin), action: ActionChangePassword, target: player.ID},
+		{name: "admin assigns role", principal: principal(admin), action: ActionAssignRole, target: player.ID},
+		{name: "moderator exports", principal: principal(moderator), action: ActionExport, wantErr: ErrForbidden},
+		{name: "player batch creates", principal: principal(player), action: ActionBatchCreate, wantErr: ErrForbidden},
+		{name: "admin batch creates", principal: principal(admin), action: ActionBatchCreate},
+		{name: "admin exports", principal: principal(admin), action: ActionExport},
+		{name: "admin assigns own role", principal: principal(admin), action: ActionAssignRole, target: admin.ID, wantErr: ErrForbidden},
+		// The role claimed by a token only counts while the stored user still holds it
+		{name: "demoted admin assigns role", principal: &Principal{UserID: demotedAdmin.ID, Role: RoleAdmin}, action: ActionAssignRole, target: player.ID, wantErr: ErrForbidden},
+		{name: "demoted admin deletes player", principal: &Principal{UserID: demotedAdmin.ID, Role: RoleAdmin}, action: ActionDelete, target: player.ID, wantErr: ErrForbidden},
+		{name: "player claiming admin exports", principal: &Principal{UserID: player.ID, Role: RoleAdmin}, action: ActionExport, wantErr: ErrForbidden},
+		{name: "banned admin exports", principal: principal(bannedAdmin), action: ActionExport, wantErr: ErrForbidden},
+		{name: "banned admin restores player", principal: principal(bannedAdmin), action: ActionRestore, target: player.ID, wantErr: ErrForbidden},
+		{name: "deleted admin batch creates", principal: &Principal{UserID: uuid.New(), Role: RoleAdmin}, action: ActionBatchCreate, wantErr: ErrForbidden},
+		{name: "banned admin updates self", principal: principal(bannedAdmin), action: ActionUpdate, target: bannedAdmin.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Authorize(context.Background(), tt.principal, tt.action, tt.target)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Policy.Authorize() unexpected error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Policy.Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, valid := range []string{"player", "moderator", "admin"} {
+		if role, err := ParseRole(valid); err != nil || string(role) != valid {
+			t.Errorf("ParseRole(%q) = %v, %v", valid, role, err)
+		}
+	}
+	if _, err := ParseRole("root"); !errors.Is(err, ErrValidation) {
+		t.Errorf("ParseRole(\"root\") error = %v, want %v", err, ErrValidation)
+	}
+}
@@ -2,11 +2,41 @@ package user
 
 import (
 	"context"
+	"time"
 )
 
 // Publisher defines the interface for publishing user events
 type Publisher interface {
 	PublishCreatedUser(ctx context.Context, User *User) error
-	PublishUpdatedUser(ctx context.Context, User *User) error
+	// PublishUpdatedUser publishes a change of a user. previous is the user
+	// before the change, or nil when it is not known.
+	PublishUpdatedUser(ctx context.Context, User *User, previous *User) error
 	PublishDeletedUser(ctx context.Context, User *User) error
+	PublishRestoredUser(ctx context.Context, User *User) error
+	PublishPurgedUser(ctx context.Context, User *User) error
+	PublishPasswordChanged(ctx context.Context, User *User) error
+	// PublishPasswordResetRequested announces that a reset token expiring at
+	// expiresAt was issued to the user. The token itself goes to the
+	// ResetSender only.
+	PublishPasswordResetRequested(ctx context.Context, User *User, expiresAt time.Time) error
+	PublishRoleChanged(ctx context.Context, User *User, previousRole Role) error
+	PublishNicknameChanged(ctx context.Context, User *User, previousNickname string) error
+	PublishUserBanned(ctx context.Context, User *User) error
 }
+
+// Notifier is told about users created, updated or deleted once the change is
+// committed, e.g. to push it to clients watching users. Restored users are
+// notified as created. Unlike a Publisher it
+// is not part of the unit of work, so it must neither block nor fail.
+type Notifier interface {
+	NotifyCreated(User *User)
+	NotifyUpdated(User *User)
+	NotifyDeleted(User *User)
+}
+
+// nopNotifier is the Notifier of a Service nobody watches
+type nopNotifier struct{}
+
+func (nopNotifier) NotifyCreated(*User) {}
+func (nopNotifier) NotifyUpdated(*User) {}
+func (nopNotifier) NotifyDeleted(*User) {}
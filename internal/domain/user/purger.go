@@ -0,0 +1,57 @@
+package user
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Purger periodically hard deletes users whose soft delete is older than the
+// service's retention
+type Purger struct {
+	service   *Service
+	interval  time.Duration
+	batchSize int
+	logger    *slog.Logger
+}
+
+// NewPurger creates a purger running every interval and removing at most
+// batchSize users per database round trip
+func NewPurger(service *Service, interval time.Duration, batchSize int, logger *slog.Logger) *Purger {
+	return &Purger{
+		service:   service,
+		interval:  interval,
+		batchSize: batchSize,
+		logger:    logger,
+	}
+}
+
+// Run purges once immediately and then on every tick until ctx is cancelled
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purge(ctx context.Context) {
+	purged, err := p.service.PurgeDeletedUsers(ctx, p.batchSize)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		p.logger.Error("failed to purge deleted users", "error", err, "purged", purged)
+		return
+	}
+	if purged > 0 {
+		p.logger.Info("purged deleted users", "count", purged)
+	}
+}
@@ -0,0 +1,46 @@
+package user
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPurger_Run(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger, WithDeletionRetention(time.Hour, time.Hour))
+
+	deletedAt := time.Now().UTC().Add(-2 * time.Hour)
+	u := &User{ID: uuid.New(), DeletedAt: &deletedAt}
+	repo.users[u.ID] = u
+
+	// The first purge runs before Run waits on the context, so a cancelled
+	// context purges exactly once and returns
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewPurger(service, time.Hour, 10, logger).Run(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Purger.Run() did not stop after context cancellation")
+	}
+
+	if len(repo.users) != 0 {
+		t.Errorf("Purger.Run() left %d users, want 0", len(repo.users))
+	}
+	if len(pub.purgedUsers) != 1 {
+		t.Errorf("Purger.Run() published %d purged events, want 1", len(pub.purgedUsers))
+	}
+}
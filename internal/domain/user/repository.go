@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -9,25 +10,82 @@ import (
 // Repository defines the interface for user persistence operations
 type Repository interface {
 	Create(ctx context.Context, user *User) error
+	// CreateBatch inserts users with as few statements as possible; it fails
+	// as a whole if any of them cannot be inserted
+	CreateBatch(ctx context.Context, users []*User) error
+	// Taken returns those of emails and nicknames that belong to a user,
+	// including soft deleted users, who keep theirs until they are purged
+	Taken(ctx context.Context, emails, nicknames []string) (takenEmails, takenNicknames []string, err error)
 	GetByID(ctx context.Context, id uuid.UUID) (*User, error)
+	// GetByIDs returns the users with the given IDs in no particular order,
+	// leaving out IDs of unknown and soft deleted users
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetByNickname(ctx context.Context, nickname string) (*User, error)
+	// Update saves user if its stored version still equals user.Version, and
+	// increments user.Version; it returns ErrConflict if the version moved on
 	Update(ctx context.Context, user *User) error
+	// SetCountry moves the users with the given IDs to country with one
+	// statement and returns them as saved, leaving out unknown and soft
+	// deleted users
+	SetCountry(ctx context.Context, ids []uuid.UUID, country string) ([]User, error)
+	// Delete soft deletes a user; deleted users are hidden from every read
 	Delete(ctx context.Context, id uuid.UUID) error
+	// Restore undoes a soft delete performed after deletedAfter
+	Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) error
+	// Purge permanently removes up to limit users soft deleted before
+	// deletedBefore and returns them
+	Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]User, error)
+	// Erase permanently removes a user, soft deleted or not, along with their
+	// nickname history and reset tokens, and returns it
+	Erase(ctx context.Context, id uuid.UUID) (*User, error)
+	// List returns up to params.Limit users after params.After or
+	// params.Offset, and the number of all matching users when
+	// params.IncludeTotal is set
 	List(ctx context.Context, params ListParams) ([]User, int64, error)
+	// Search returns up to limit users whose nickname, first or last name or
+	// email local part resemble query, most relevant first
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+	// WithTx runs fn as a unit of work: the calls fn makes through repo, and
+	// those to other repositories and the publisher made with ctx, either all
+	// take effect or none do. fn runs again from the start when the unit of
+	// work is retried after a transient failure, so it must not have other
+	// side effects. Calls nested in a unit of work join it.
+	WithTx(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error
+}
+
+// Transactor runs fn atomically: repository and publisher calls made with the
+// ctx passed to fn either all take effect or none do
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 // Filter represents a single filter condition
 type Filter struct {
-	Field string
-	Value string
+	Field    string
+	Operator FilterOperator // Defaults to OpContains
+	Value    string
+	Values   []string // Candidates of OpIn
 }
 
-// ListParams defines the parameters for listing users using limit/offset
+// ListParams defines the parameters for listing users. Lists are paginated
+// either by limit/offset or, when a cursor is given, by keyset.
 type ListParams struct {
 	Limit     int
 	Offset    int
 	Filters   []Filter
 	OrderBy   string // Field to order by (e.g., "created_at", "email")
 	OrderDesc bool
+
+	Cursor       string  // Opaque token of the previous page; overrides Offset and the ordering
+	After        *Cursor // Decoded Cursor, set by the service for the repository
+	IncludeTotal bool    // Count all matching users, which costs an extra query
+}
+
+// ListResult is a page of users
+type ListResult struct {
+	Users      []User
+	HasMore    bool
+	TotalCount *int64 // Set only when requested through ListParams.IncludeTotal
+	NextCursor string // Token for the next page, empty on the last one
 }
@@ -0,0 +1,29 @@
+package user
+
+// Role determines what a user is allowed to do
+type Role string
+
+const (
+	RolePlayer    Role = "player"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// IsValid reports whether r is one of the known roles
+func (r Role) IsValid() bool {
+	switch r {
+	case RolePlayer, RoleModerator, RoleAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseRole converts a string into a Role, rejecting unknown values
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if !role.IsValid() {
+		return "", NewValidationError("role", "must be one of player, moderator, admin")
+	}
+	return role, nil
+}
@@ -0,0 +1,43 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultSearchLimit is the number of results returned when none is requested
+	DefaultSearchLimit = 10
+	// MaxSearchQueryLength bounds search queries, in characters
+	MaxSearchQueryLength = 100
+)
+
+// SearchResult is a user matching a search query with its relevance; a
+// higher Score is a better match
+type SearchResult struct {
+	User  User    `json:"user"`
+	Score float64 `json:"score"`
+}
+
+// validateSearch trims query and checks it and limit, reporting every problem
+// at once. A zero limit defaults to DefaultSearchLimit.
+func validateSearch(query string, limit, maxLimit int) (string, int, error) {
+	var errs []error
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		errs = append(errs, NewValidationError("query", "must not be empty"))
+	} else if utf8.RuneCountInString(query) > MaxSearchQueryLength {
+		errs = append(errs, NewValidationError("query", fmt.Sprintf("must be at most %d characters", MaxSearchQueryLength)))
+	}
+
+	if limit == 0 {
+		limit = min(DefaultSearchLimit, maxLimit)
+	}
+	if limit < 1 || limit > maxLimit {
+		errs = append(errs, NewValidationError("limit", fmt.Sprintf("must be between 1 and %d", maxLimit)))
+	}
+
+	return query, limit, JoinValidationErrors(errs...)
+}
@@ -2,9 +2,15 @@ package user
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,154 +21,882 @@ import (
 type Service struct {
 	repo      Repository
 	publisher Publisher
+	notifier  Notifier
 	logger    *slog.Logger
+
+	resets      PasswordResetRepository
+	resetSender ResetSender
+	resetTTL    time.Duration
+
+	restoreGracePeriod time.Duration
+	purgeRetention     time.Duration
+
+	cursors      *CursorCodec
+	maxListLimit int
+
+	nicknames         NicknameHistoryRepository
+	nicknameCooldown  time.Duration
+	nicknameRetention time.Duration
+
+	maxBatchSize int
+	hashWorkers  int
+}
+
+// Option configures optional dependencies of the Service
+type Option func(*Service)
+
+// WithPasswordResets enables the password reset flow, issuing tokens valid for ttl
+func WithPasswordResets(repo PasswordResetRepository, ttl time.Duration) Option {
+	return func(s *Service) {
+		s.resets = repo
+		s.resetTTL = ttl
+	}
+}
+
+// WithResetSender delivers the password reset tokens the service issues
+// through sender
+func WithResetSender(sender ResetSender) Option {
+	return func(s *Service) {
+		s.resetSender = sender
+	}
 }
 
-func NewService(repo Repository, publisher Publisher, logger *slog.Logger) *Service {
-	return &Service{
+// WithNicknameHistory records the nicknames users give up so they keep
+// resolving to their user for retention, and makes users wait cooldown
+// between two nickname changes
+func WithNicknameHistory(repo NicknameHistoryRepository, cooldown, retention time.Duration) Option {
+	return func(s *Service) {
+		s.nicknames = repo
+		s.nicknameCooldown = cooldown
+		s.nicknameRetention = retention
+	}
+}
+
+// WithDeletionRetention enables restoring deleted users within gracePeriod and
+// purging them for good once they have been deleted for longer than retention
+func WithDeletionRetention(gracePeriod, retention time.Duration) Option {
+	return func(s *Service) {
+		s.restoreGracePeriod = gracePeriod
+		s.purgeRetention = retention
+	}
+}
+
+// WithCursorSigningKey enables keyset pagination of ListUsers with cursors
+// signed by key
+func WithCursorSigningKey(key []byte) Option {
+	return func(s *Service) {
+		s.cursors = NewCursorCodec(key)
+	}
+}
+
+// WithMaxListLimit sets the largest page size ListUsers accepts
+func WithMaxListLimit(limit int) Option {
+	return func(s *Service) {
+		s.maxListLimit = limit
+	}
+}
+
+// WithBatchLimits sets the largest batch BatchCreateUsers and GetUsers accept
+// and how many passwords of a batch are hashed in parallel
+func WithBatchLimits(maxSize, hashWorkers int) Option {
+	return func(s *Service) {
+		s.maxBatchSize = maxSize
+		s.hashWorkers = hashWorkers
+	}
+}
+
+// WithNotifier tells notifier about the users created, updated and deleted
+func WithNotifier(notifier Notifier) Option {
+	return func(s *Service) {
+		s.notifier = notifier
+	}
+}
+
+func NewService(repo Repository, publisher Publisher, logger *slog.Logger, opts ...Option) *Service {
+	s := &Service{
 		repo:      repo,
 		publisher: publisher,
+		notifier:  nopNotifier{},
 		logger:    logger,
+
+		maxListLimit: DefaultMaxListLimit,
+		maxBatchSize: DefaultMaxBatchSize,
+		hashWorkers:  DefaultHashWorkers,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
+// CreateUser validates user as BatchCreateUsers does, whichever API it came
+// through, and saves it with its password hashed
 func (s *Service) CreateUser(ctx context.Context, user *User) (*User, error) {
+	if err := validateNewUser(user); err != nil {
+		return nil, err
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
+	if user.Role == "" {
+		user.Role = RolePlayer
+	}
+
 	user.ID = uuid.New()
 	user.Password = string(hashedPassword)
 	user.CreatedAt = time.Now().UTC()
 	user.UpdatedAt = time.Now().UTC()
+	user.Version = 1
+
+	// Checking availability in the unit of work that inserts the user keeps
+	// a concurrent registration from slipping in between
+	err = s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		if _, err := repo.GetByEmail(ctx, user.Email); err == nil {
+			return ErrEmailTaken
+		} else if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to check email availability: %w", err)
+		}
+		if _, err := repo.GetByNickname(ctx, user.Nickname); err == nil {
+			return ErrNicknameTaken
+		} else if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to check nickname availability: %w", err)
+		}
 
-	if _, err := s.repo.GetByEmail(ctx, user.Email); err == nil {
-		return nil, ErrEmailTaken
+		if err := repo.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to save user: %w", err)
+		}
+		if err := s.publisher.PublishCreatedUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to publish user created event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if _, err := s.repo.GetByNickname(ctx, user.Nickname); err == nil {
-		return nil, ErrNicknameTaken
+	s.notifier.NotifyCreated(user)
+	return user, nil
+}
+
+func (s *Service) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	return user, nil
+}
 
-	if err := s.repo.Create(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to save user: %w", err)
+// UpdateUser sets the given fields of the user to their values in changes;
+// other fields keep their stored values, and listing a field with an empty
+// value clears it. A non-zero changes.Version is the version the caller last
+// saw; the update fails with ErrConflict unless the user is still at that
+// version.
+func (s *Service) UpdateUser(ctx context.Context, id uuid.UUID, changes *User, fields []Field) (*User, error) {
+	if err := validateChanges(changes, fields); err != nil {
+		return nil, err
 	}
 
-	if err := s.publisher.PublishCreatedUser(ctx, user); err != nil {
-		s.logger.Warn("failed to publish user created event",
-			"error", err,
-			"user_id", user.ID,
-		)
+	var user *User
+	var changed bool
+	err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		changed = false
+		var err error
+		user, err = repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) { // Assuming repo returns ErrNotFound
+				return err
+			}
+			return fmt.Errorf("failed to get user for update: %w", err)
+		}
+		if changes.Version != 0 && changes.Version != user.Version {
+			return ErrConflict
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		changed = true
+
+		previous := *user // State before the update, for the event
+		for _, field := range fields {
+			switch field {
+			case FieldFirstName:
+				user.FirstName = changes.FirstName
+			case FieldLastName:
+				user.LastName = changes.LastName
+			case FieldNickname:
+				if user.Nickname == changes.Nickname {
+					continue
+				}
+				if err := s.checkNicknameChange(ctx, repo, id, changes.Nickname); err != nil {
+					return err
+				}
+				user.Nickname = changes.Nickname
+			case FieldCountry:
+				user.Country = changes.Country
+			case FieldEmail:
+				if user.Email == changes.Email {
+					continue
+				}
+				if existingUser, err := repo.GetByEmail(ctx, changes.Email); err == nil && existingUser.ID != id {
+					return ErrEmailTaken
+				}
+				user.Email = changes.Email
+			}
+		}
+
+		renamed := user.Nickname != previous.Nickname
+		if err := repo.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to save user changes: %w", err)
+		}
+		if renamed && s.nicknames != nil {
+			if err := s.nicknames.Record(ctx, id, previous.Nickname, time.Now().UTC()); err != nil {
+				return fmt.Errorf("failed to record nickname history: %w", err)
+			}
+		}
+		if err := s.publisher.PublishUpdatedUser(ctx, user, &previous); err != nil {
+			return fmt.Errorf("failed to publish user updated event: %w", err)
+		}
+		if renamed {
+			if err := s.publisher.PublishNicknameChanged(ctx, user, previous.Nickname); err != nil {
+				return fmt.Errorf("failed to publish nickname changed event: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	if changed {
+		s.notifier.NotifyUpdated(user)
+	}
 	return user, nil
 }
 
-func (s *Service) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
-	user, err := s.repo.GetByID(ctx, id)
+// checkNicknameChange reports whether the user may rename itself to nickname:
+// it must be free and, with a nickname history, the cooldown since the last
+// rename must have passed
+func (s *Service) checkNicknameChange(ctx context.Context, repo Repository, id uuid.UUID, nickname string) error {
+	existingUser, err := repo.GetByNickname(ctx, nickname)
+	if err == nil && existingUser.ID != id {
+		return ErrNicknameTaken
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to check nickname availability: %w", err)
+	}
+
+	if s.nicknames == nil || s.nicknameCooldown <= 0 {
+		return nil
+	}
+	lastChange, err := s.nicknames.LastChange(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return fmt.Errorf("failed to get last nickname change: %w", err)
 	}
-	return user, nil
+	if next := lastChange.Add(s.nicknameCooldown); time.Now().Before(next) {
+		return fmt.Errorf("%w, it can be changed again after %s", ErrNicknameCooldown, next.UTC().Format(time.RFC3339))
+	}
+	return nil
 }
 
-func (s *Service) UpdateUser(ctx context.Context, id uuid.UUID, updatedUser *User) (*User, error) {
-	user, err := s.repo.GetByID(ctx, id)
+// GetUserByNickname returns the user currently using nickname or, failing
+// that, the user who gave it up most recently within the nickname history
+// retention
+func (s *Service) GetUserByNickname(ctx context.Context, nickname string) (*User, error) {
+	user, err := s.repo.GetByNickname(ctx, nickname)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, ErrNotFound) || s.nicknames == nil {
+		return nil, fmt.Errorf("failed to get user by nickname: %w", err)
+	}
+
+	id, err := s.nicknames.Resolve(ctx, nickname, time.Now().UTC().Add(-s.nicknameRetention))
 	if err != nil {
-		if errors.Is(err, ErrNotFound) { // Assuming repo returns ErrNotFound
-			return nil, err
+		return nil, fmt.Errorf("failed to resolve previous nickname: %w", err)
+	}
+	return s.GetUser(ctx, id)
+}
+
+func (s *Service) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	var user *User
+	err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		var err error
+		user, err = repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return err // Return ErrNotFound directly if user doesn't exist
+			}
+			return fmt.Errorf("failed to get user for deletion: %w", err)
 		}
-		return nil, fmt.Errorf("failed to get user for update: %w", err)
+
+		if err := repo.Delete(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete user from repository: %w", err)
+		}
+		if err := s.publisher.PublishDeletedUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to publish user deleted event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	if updatedUser.FirstName != "" && user.FirstName != updatedUser.FirstName {
-		user.FirstName = updatedUser.FirstName
+	s.notifier.NotifyDeleted(user)
+	return nil
+}
+
+// RestoreUser undoes a soft delete that happened within the restore grace period
+func (s *Service) RestoreUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	if s.restoreGracePeriod <= 0 {
+		return nil, errors.New("user restore is not configured")
 	}
-	if updatedUser.LastName != "" && user.LastName != updatedUser.LastName {
-		user.LastName = updatedUser.LastName
+
+	deletedAfter := time.Now().UTC().Add(-s.restoreGracePeriod)
+	var user *User
+	err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		if err := repo.Restore(ctx, id, deletedAfter); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return fmt.Errorf("failed to restore user: %w", err)
+		}
+
+		var err error
+		user, err = repo.GetByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get restored user: %w", err)
+		}
+
+		if err := s.publisher.PublishRestoredUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to publish user restored event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if updatedUser.Nickname != "" && user.Nickname != updatedUser.Nickname {
-		user.Nickname = updatedUser.Nickname
+
+	// Watchers dropped the user when it was deleted and take it back as new
+	s.notifier.NotifyCreated(user)
+	return user, nil
+}
+
+// PurgeDeletedUsers permanently removes users that were soft deleted longer
+// than the retention ago, batchSize rows at a time, and returns how many were
+// purged. A purged event is published for each of them.
+func (s *Service) PurgeDeletedUsers(ctx context.Context, batchSize int) (int, error) {
+	if s.purgeRetention <= 0 {
+		return 0, nil
 	}
-	if updatedUser.Country != "" && user.Country != updatedUser.Country {
-		user.Country = updatedUser.Country
+
+	deletedBefore := time.Now().UTC().Add(-s.purgeRetention)
+	purged := 0
+	for {
+		var users []User
+		err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+			var err error
+			users, err = repo.Purge(ctx, deletedBefore, batchSize)
+			if err != nil {
+				return fmt.Errorf("failed to purge deleted users: %w", err)
+			}
+
+			for i := range users {
+				if err := s.publisher.PublishPurgedUser(ctx, &users[i]); err != nil {
+					return fmt.Errorf("failed to publish user purged event: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+
+		purged += len(users)
+		if len(users) < batchSize {
+			return purged, nil
+		}
 	}
-	if updatedUser.Email != "" && user.Email != updatedUser.Email {
-		if existingUser, err := s.repo.GetByEmail(ctx, updatedUser.Email); err == nil && existingUser.ID != id {
-			return nil, ErrEmailTaken
+}
+
+// EraseUser permanently removes a user and their personal data at once, for
+// erasure requests. Unlike DeleteUser it leaves nothing to restore, and it also
+// erases users already deleted. A purged event is published.
+func (s *Service) EraseUser(ctx context.Context, id uuid.UUID) error {
+	var user *User
+	err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		var err error
+		user, err = repo.Erase(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return fmt.Errorf("failed to erase user: %w", err)
+		}
+
+		if err := s.publisher.PublishPurgedUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to publish user purged event: %w", err)
 		}
-		user.Email = updatedUser.Email
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	if err := s.repo.Update(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to save user changes: %w", err)
+	// Watchers already saw users deleted before go
+	if user.DeletedAt == nil {
+		s.notifier.NotifyDeleted(user)
 	}
+	return nil
+}
 
-	if err := s.publisher.PublishUpdatedUser(ctx, user); err != nil {
-		s.logger.Warn("failed to publish user updated event",
-			"error", err,
-			"user_id", user.ID,
-		)
+// BanUser bans a user, who can no longer log in, and announces the ban.
+// Banning a user already banned is a no-op and publishes nothing.
+func (s *Service) BanUser(ctx context.Context, id uuid.UUID, reason string) (*User, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, NewValidationError("reason", "is required")
 	}
 
+	var user *User
+	var banned bool
+	err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		banned = false
+		var err error
+		user, err = repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return fmt.Errorf("failed to get user for ban: %w", err)
+		}
+
+		if user.BannedAt != nil {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		user.BannedAt = &now
+		user.BanReason = reason
+		if err := repo.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to save user ban: %w", err)
+		}
+		if err := s.publisher.PublishUserBanned(ctx, user); err != nil {
+			return fmt.Errorf("failed to publish user banned event: %w", err)
+		}
+		banned = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if banned {
+		s.notifier.NotifyUpdated(user)
+	}
 	return user, nil
 }
 
-func (s *Service) DeleteUser(ctx context.Context, id uuid.UUID) error {
-	user, err := s.repo.GetByID(ctx, id)
+// AssignRole changes the role of a user and announces the change. Assigning
+// the role a user already has is a no-op and publishes nothing.
+func (s *Service) AssignRole(ctx context.Context, id uuid.UUID, role Role) (*User, error) {
+	if !role.IsValid() {
+		return nil, NewValidationError("role", "must be one of player, moderator, admin")
+	}
+
+	var user *User
+	var changed bool
+	err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		var err error
+		changed = false
+		user, err = repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return fmt.Errorf("failed to get user for role assignment: %w", err)
+		}
+
+		previousRole := user.Role
+		if previousRole == role {
+			return nil
+		}
+
+		user.Role = role
+		if err := repo.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to save user role: %w", err)
+		}
+		if err := s.publisher.PublishRoleChanged(ctx, user, previousRole); err != nil {
+			return fmt.Errorf("failed to publish user role changed event: %w", err)
+		}
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		s.notifier.NotifyUpdated(user)
+	}
+	return user, nil
+}
+
+// RepublishUser publishes an updated event carrying the current state of a
+// user, so consumers that missed or lost earlier events can catch up
+func (s *Service) RepublishUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	var user *User
+	err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		var err error
+		user, err = repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return fmt.Errorf("failed to get user for republishing: %w", err)
+		}
+
+		if err := s.publisher.PublishUpdatedUser(ctx, user, nil); err != nil {
+			return fmt.Errorf("failed to publish user updated event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Authenticate resolves a user by email or nickname and verifies the given
+// password against the stored bcrypt hash. Unknown identifiers and wrong
+// passwords both yield ErrInvalidCredentials so callers cannot tell them apart.
+// The user is read in a unit of work, whose reads skip any cache, so the hash
+// is always the one stored.
+func (s *Service) Authenticate(ctx context.Context, identifier, password string) (*User, error) {
+	if identifier == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	var user *User
+	err := s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		var err error
+		if strings.Contains(identifier, "@") {
+			user, err = repo.GetByEmail(ctx, identifier)
+		} else {
+			user, err = repo.GetByNickname(ctx, identifier)
+		}
+		return err
+	})
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
-			return err // Return ErrNotFound directly if user doesn't exist
+			// Burn the same amount of time as a real comparison to avoid
+			// leaking which identifiers exist.
+			_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to get user for authentication: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	// Only told once the password is right, so it reveals nothing to others
+	if user.BannedAt != nil {
+		return nil, ErrBanned
+	}
+
+	return user, nil
+}
+
+// ChangePassword replaces a user's password after verifying the current one.
+// The current password is checked against the stored hash in the unit of work
+// that replaces it, so a concurrent change cannot slip in between.
+func (s *Service) ChangePassword(ctx context.Context, id uuid.UUID, oldPassword, newPassword string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		user, err := repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return fmt.Errorf("failed to get user for password change: %w", err)
 		}
-		return fmt.Errorf("failed to get user for deletion: %w", err)
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
+			return ErrInvalidCredentials
+		}
+
+		return s.setPassword(ctx, repo, user, hashedPassword)
+	})
+}
+
+// ResetPassword sets a new password for a user without verifying the current
+// one, for administrators recovering an account
+func (s *Service) ResetPassword(ctx context.Context, id uuid.UUID, newPassword string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return err
 	}
 
-	if err := s.repo.Delete(ctx, id); err != nil {
-		return fmt.Errorf("failed to delete user from repository: %w", err)
+	return s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		user, err := repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return fmt.Errorf("failed to get user for password reset: %w", err)
+		}
+
+		return s.setPassword(ctx, repo, user, hashedPassword)
+	})
+}
+
+// RequestPasswordReset issues a single-use reset token for the user owning the
+// given email. The token is never returned: once its hash is saved it is
+// handed to the ResetSender, which delivers it to the user. The
+// password_reset_requested event only tells when it expires. Unknown emails
+// are ignored without an error, so callers cannot tell which emails have an
+// account.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	if s.resets == nil || s.resetSender == nil {
+		return errors.New("password reset is not configured")
+	}
+
+	token, err := generateResetToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
 	}
 
-	if err := s.publisher.PublishDeletedUser(ctx, user); err != nil {
-		s.logger.Warn("failed to publish user deleted event",
-			"error", err,
-			"user_id", user.ID,
-		)
+	var user *User
+	var reset *PasswordReset
+	err = s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		user, reset = nil, nil
+		found, err := repo.GetByEmail(ctx, email)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			return fmt.Errorf("failed to get user for password reset: %w", err)
+		}
+
+		issued := &PasswordReset{
+			UserID:    found.ID,
+			Token:     token,
+			ExpiresAt: time.Now().UTC().Add(s.resetTTL),
+		}
+		if err := s.resets.Create(ctx, found.ID, hashResetToken(token), issued.ExpiresAt); err != nil {
+			return fmt.Errorf("failed to save reset token: %w", err)
+		}
+		if err := s.publisher.PublishPasswordResetRequested(ctx, found, issued.ExpiresAt); err != nil {
+			return fmt.Errorf("failed to publish password reset requested event: %w", err)
+		}
+		user, reset = found, issued
+		return nil
+	})
+	if err != nil || reset == nil {
+		return err
 	}
 
+	// Sent once the token is saved, so a delivered token is always usable
+	if err := s.resetSender.SendPasswordReset(ctx, user, reset); err != nil {
+		return fmt.Errorf("failed to send password reset: %w", err)
+	}
 	return nil
 }
 
-func (s *Service) ListUsers(ctx context.Context, params ListParams) ([]User, bool, int64, error) {
-	allowedFilters := map[string]struct{}{
-		"first_name": {},
-		"last_name":  {},
-		"nickname":   {},
-		"email":      {},
-		"country":    {},
+// ConfirmPasswordReset consumes a reset token and sets a new password for its owner
+func (s *Service) ConfirmPasswordReset(ctx context.Context, token, newPassword string) error {
+	if s.resets == nil {
+		return errors.New("password reset is not configured")
+	}
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// The token is only used up if the new password is saved along with it
+	return s.repo.WithTx(ctx, func(ctx context.Context, repo Repository) error {
+		userID, err := s.resets.Consume(ctx, hashResetToken(token))
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return ErrInvalidResetToken
+			}
+			return fmt.Errorf("failed to consume reset token: %w", err)
+		}
+
+		user, err := repo.GetByID(ctx, userID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return ErrInvalidResetToken
+			}
+			return fmt.Errorf("failed to get user for password reset: %w", err)
+		}
+
+		return s.setPassword(ctx, repo, user, hashedPassword)
+	})
+}
+
+// setPassword stores a new password hash, revokes outstanding reset tokens and
+// announces the change so sessions elsewhere can be revoked. It saves a copy
+// of user, which a retried unit of work can then pass in again unchanged.
+func (s *Service) setPassword(ctx context.Context, repo Repository, user *User, hashedPassword string) error {
+	updated := *user
+	updated.Password = hashedPassword
+	if err := repo.Update(ctx, &updated); err != nil {
+		return fmt.Errorf("failed to save new password: %w", err)
 	}
 
-	validFilters := make([]Filter, 0, len(params.Filters))
-	for _, filter := range params.Filters {
-		if _, ok := allowedFilters[filter.Field]; ok {
-			validFilters = append(validFilters, filter)
+	if s.resets != nil {
+		if err := s.resets.DeleteByUserID(ctx, updated.ID); err != nil {
+			return fmt.Errorf("failed to revoke password reset tokens: %w", err)
 		}
 	}
-	params.Filters = validFilters
-	if params.OrderBy != "" {
-		if _, ok := allowedFilters[params.OrderBy]; !ok && params.OrderBy != "created_at" && params.OrderBy != "updated_at" {
-			params.OrderBy = "created_at" // Default to created_at if invalid
+
+	if err := s.publisher.PublishPasswordChanged(ctx, &updated); err != nil {
+		return fmt.Errorf("failed to publish password changed event: %w", err)
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashedPassword), nil
+}
+
+// maxPasswordBytes is the longest password bcrypt hashes
+const maxPasswordBytes = 72
+
+func validatePassword(password string) error {
+	if password == "" {
+		return NewValidationError("password", "must not be empty")
+	}
+	// bcrypt refuses longer passwords
+	if len(password) > maxPasswordBytes {
+		return NewValidationError("password", fmt.Sprintf("must be at most %d bytes", maxPasswordBytes))
+	}
+	return nil
+}
+
+func generateResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+// ValidateListParams reports every problem ListUsers would reject params for
+func (s *Service) ValidateListParams(params ListParams) error {
+	params.Filters = append([]Filter(nil), params.Filters...)
+	return params.Validate(s.maxListLimit)
+}
+
+func (s *Service) ListUsers(ctx context.Context, params ListParams) (*ListResult, error) {
+	params.Filters = append([]Filter(nil), params.Filters...) // Validate normalizes the caller's filters otherwise
+	if err := params.Validate(s.maxListLimit); err != nil {
+		return nil, err
+	}
+
+	if params.Cursor != "" {
+		if s.cursors == nil {
+			return nil, errors.New("cursor pagination is not configured")
+		}
+		after, err := s.cursors.Decode(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := sortableFields[after.OrderBy]; !ok {
+			return nil, NewValidationError("cursor", "orders by an unknown field")
 		}
+		// The cursor only makes sense with the ordering it was issued for
+		params.After = after
+		params.OrderBy = after.OrderBy
+		params.OrderDesc = after.Desc
+		params.Offset = 0
 	}
 
-	users, totalCount, err := s.repo.List(ctx, params)
+	// Fetch one extra user to find out whether another page follows
+	fetch := params
+	if params.Limit > 0 {
+		fetch.Limit = params.Limit + 1
+	}
+	users, totalCount, err := s.repo.List(ctx, fetch)
 	if err != nil {
-		return nil, false, 0, fmt.Errorf("failed to list users: %w", err)
+		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
 
-	hasMore := false
-	if params.Limit > 0 && totalCount > int64(params.Offset+params.Limit) {
-		hasMore = true
+	result := &ListResult{Users: users}
+	if params.Limit > 0 && len(users) > params.Limit {
+		result.Users = users[:params.Limit]
+		result.HasMore = true
+	}
+	if params.IncludeTotal {
+		result.TotalCount = &totalCount
+	}
+	if result.HasMore && s.cursors != nil {
+		last := &result.Users[len(result.Users)-1]
+		result.NextCursor, err = s.cursors.Encode(cursorAfter(last, params.OrderBy, params.OrderDesc))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode list cursor: %w", err)
+		}
 	}
 
-	return users, hasMore, totalCount, nil
+	return result, nil
+}
+
+// SearchUsers finds the users most similar to query by nickname, name or email
+// local part. A zero limit returns DefaultSearchLimit results.
+func (s *Service) SearchUsers(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	query, limit, err := validateSearch(query, limit, s.maxListLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := s.repo.Search(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	return results, nil
 }
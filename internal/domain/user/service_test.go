@@ -2,15 +2,24 @@ package user
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type mockRepository struct {
 	users map[uuid.UUID]*User
+
+	// Outcomes of the units of work run through WithTx
+	committed  int
+	rolledBack int
 }
 
 func newMockRepository() *mockRepository {
@@ -27,16 +36,53 @@ func (m *mockRepository) Create(ctx context.Context, u *User) error {
 	return nil
 }
 
+func (m *mockRepository) CreateBatch(ctx context.Context, users []*User) error {
+	for _, u := range users {
+		if err := m.Create(ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Taken reports the emails and nicknames held by any user, deleted or not
+func (m *mockRepository) Taken(ctx context.Context, emails, nicknames []string) ([]string, []string, error) {
+	var takenEmails, takenNicknames []string
+	for _, u := range m.users {
+		for _, email := range emails {
+			if u.Email == email {
+				takenEmails = append(takenEmails, email)
+			}
+		}
+		for _, nickname := range nicknames {
+			if u.Nickname == nickname {
+				takenNicknames = append(takenNicknames, nickname)
+			}
+		}
+	}
+	return takenEmails, takenNicknames, nil
+}
+
 func (m *mockRepository) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
-	if u, exists := m.users[id]; exists {
+	if u, exists := m.users[id]; exists && u.DeletedAt == nil {
 		return u, nil
 	}
 	return nil, ErrNotFound
 }
 
+func (m *mockRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]User, error) {
+	users := make([]User, 0, len(ids))
+	for _, id := range ids {
+		if u, exists := m.users[id]; exists && u.DeletedAt == nil {
+			users = append(users, *u)
+		}
+	}
+	return users, nil
+}
+
 func (m *mockRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
 	for _, u := range m.users {
-		if u.Email == email {
+		if u.Email == email && u.DeletedAt == nil {
 			return u, nil
 		}
 	}
@@ -45,7 +91,7 @@ func (m *mockRepository) GetByEmail(ctx context.Context, email string) (*User, e
 
 func (m *mockRepository) GetByNickname(ctx context.Context, nickname string) (*User, error) {
 	for _, u := range m.users {
-		if u.Nickname == nickname {
+		if u.Nickname == nickname && u.DeletedAt == nil {
 			return u, nil
 		}
 	}
@@ -53,48 +99,88 @@ func (m *mockRepository) GetByNickname(ctx context.Context, nickname string) (*U
 }
 
 func (m *mockRepository) Update(ctx context.Context, u *User) error {
-	if _, exists := m.users[u.ID]; !exists {
+	existing, exists := m.users[u.ID]
+	if !exists || existing.DeletedAt != nil {
 		return ErrNotFound
 	}
+	if existing.Version != u.Version {
+		return ErrConflict
+	}
+	u.Version++
+	u.UpdatedAt = time.Now().UTC()
 	m.users[u.ID] = u
 	return nil
 }
 
+func (m *mockRepository) SetCountry(ctx context.Context, ids []uuid.UUID, country string) ([]User, error) {
+	var moved []User
+	for _, id := range ids {
+		u, exists := m.users[id]
+		if !exists || u.DeletedAt != nil {
+			continue
+		}
+		u.Country = country
+		u.Version++
+		u.UpdatedAt = time.Now().UTC()
+		moved = append(moved, *u)
+	}
+	return moved, nil
+}
+
 func (m *mockRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	if _, exists := m.users[id]; !exists {
+	u, exists := m.users[id]
+	if !exists || u.DeletedAt != nil {
 		return ErrNotFound
 	}
-	delete(m.users, id)
+	now := time.Now().UTC()
+	u.DeletedAt = &now
+	return nil
+}
+
+func (m *mockRepository) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) error {
+	u, exists := m.users[id]
+	if !exists || u.DeletedAt == nil || !u.DeletedAt.After(deletedAfter) {
+		return ErrNotFound
+	}
+	u.DeletedAt = nil
 	return nil
 }
 
+func (m *mockRepository) Erase(ctx context.Context, id uuid.UUID) (*User, error) {
+	u, exists := m.users[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	delete(m.users, id)
+	erased := *u
+	return &erased, nil
+}
+
+func (m *mockRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]User, error) {
+	purged := make([]User, 0)
+	for id, u := range m.users {
+		if len(purged) == limit {
+			break
+		}
+		if u.DeletedAt != nil && u.DeletedAt.Before(deletedBefore) {
+			purged = append(purged, *u)
+			delete(m.users, id)
+		}
+	}
+	return purged, nil
+}
+
 func (m *mockRepository) List(ctx context.Context, params ListParams) ([]User, int64, error) {
 	var filteredUsers []User
 
 	for _, u := range m.users {
+		if u.DeletedAt != nil {
+			continue
+		}
 		match := true
 		for _, filter := range params.Filters {
-			switch filter.Field {
-			case "country":
-				if u.Country != filter.Value {
-					match = false
-				}
-			case "first_name":
-				if u.FirstName != filter.Value {
-					match = false
-				}
-			case "last_name":
-				if u.LastName != filter.Value {
-					match = false
-				}
-			case "nickname":
-				if u.Nickname != filter.Value {
-					match = false
-				}
-			case "email":
-				if u.Email != filter.Value {
-					match = false
-				}
+			if !matchesFilter(u, filter) {
+				match = false
 			}
 		}
 		if match {
@@ -104,6 +190,33 @@ func (m *mockRepository) List(ctx context.Context, params ListParams) ([]User, i
 
 	totalCount := int64(len(filteredUsers))
 
+	// Order like the database does, by the sort column with the ID breaking ties
+	compare := func(u *User, value string, id uuid.UUID) int {
+		if c := strings.Compare(sortValue(u, params.OrderBy), value); c != 0 {
+			return c
+		}
+		return strings.Compare(u.ID.String(), id.String())
+	}
+	sort.Slice(filteredUsers, func(i, j int) bool {
+		b := &filteredUsers[j]
+		c := compare(&filteredUsers[i], sortValue(b, params.OrderBy), b.ID)
+		if params.OrderDesc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if params.After != nil {
+		remaining := make([]User, 0, len(filteredUsers))
+		for _, u := range filteredUsers {
+			c := compare(&u, params.After.Value, params.After.ID)
+			if (params.OrderDesc && c < 0) || (!params.OrderDesc && c > 0) {
+				remaining = append(remaining, u)
+			}
+		}
+		filteredUsers = remaining
+	}
+
 	start := params.Offset
 	if start > len(filteredUsers) {
 		return []User{}, totalCount, nil
@@ -117,35 +230,254 @@ func (m *mockRepository) List(ctx context.Context, params ListParams) ([]User, i
 	return filteredUsers[start:end], totalCount, nil
 }
 
+// Search ranks users whose nickname contains query by how much of the
+// nickname the query covers
+func (m *mockRepository) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	results := make([]SearchResult, 0)
+	for _, u := range m.users {
+		if u.DeletedAt != nil || !strings.Contains(strings.ToLower(u.Nickname), strings.ToLower(query)) {
+			continue
+		}
+		results = append(results, SearchResult{User: *u, Score: float64(len(query)) / float64(len(u.Nickname))})
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (m *mockRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error {
+	if err := fn(ctx, m); err != nil {
+		m.rolledBack++
+		return err
+	}
+	m.committed++
+	return nil
+}
+
+// matchesFilter applies the text operators of filter to u
+func matchesFilter(u *User, filter Filter) bool {
+	value := sortValue(u, filter.Field)
+	switch filter.Operator {
+	case OpEq:
+		return value == filter.Value
+	case OpNeq:
+		return value != filter.Value
+	case OpPrefix:
+		return strings.HasPrefix(strings.ToLower(value), strings.ToLower(filter.Value))
+	case OpIn:
+		for _, candidate := range filter.Values {
+			if value == candidate {
+				return true
+			}
+		}
+		return false
+	default:
+		return strings.Contains(strings.ToLower(value), strings.ToLower(filter.Value))
+	}
+}
+
 type mockPublisher struct {
-	createdUsers []*User
-	updatedUsers []*User
-	deletedUsers []*User
+	createdUsers         []*User
+	updatedUsers         []*User
+	previousUsers        []*User
+	deletedUsers         []*User
+	restoredUsers        []*User
+	purgedUsers          []*User
+	passwordChangedUsers []*User
+	roleChangedUsers     []*User
+	previousRoles        []Role
+	nicknameChangedUsers []*User
+	previousNicknames    []string
+	resetRequests        []time.Time // Expiry of the announced reset tokens
+	bannedUsers          []*User
+	err                  error // Returned by every publish when set
 }
 
 func newMockPublisher() *mockPublisher {
 	return &mockPublisher{
-		createdUsers: make([]*User, 0),
-		updatedUsers: make([]*User, 0),
-		deletedUsers: make([]*User, 0),
+		createdUsers:         make([]*User, 0),
+		updatedUsers:         make([]*User, 0),
+		previousUsers:        make([]*User, 0),
+		deletedUsers:         make([]*User, 0),
+		restoredUsers:        make([]*User, 0),
+		purgedUsers:          make([]*User, 0),
+		passwordChangedUsers: make([]*User, 0),
+		roleChangedUsers:     make([]*User, 0),
+		previousRoles:        make([]Role, 0),
+		nicknameChangedUsers: make([]*User, 0),
+		previousNicknames:    make([]string, 0),
 	}
 }
 
 func (m *mockPublisher) PublishCreatedUser(ctx context.Context, user *User) error {
+	if m.err != nil {
+		return m.err
+	}
 	m.createdUsers = append(m.createdUsers, user)
 	return nil
 }
 
-func (m *mockPublisher) PublishUpdatedUser(ctx context.Context, user *User) error {
+func (m *mockPublisher) PublishUpdatedUser(ctx context.Context, user *User, previous *User) error {
+	if m.err != nil {
+		return m.err
+	}
 	m.updatedUsers = append(m.updatedUsers, user)
+	m.previousUsers = append(m.previousUsers, previous)
 	return nil
 }
 
 func (m *mockPublisher) PublishDeletedUser(ctx context.Context, user *User) error {
+	if m.err != nil {
+		return m.err
+	}
 	m.deletedUsers = append(m.deletedUsers, user)
 	return nil
 }
 
+func (m *mockPublisher) PublishRestoredUser(ctx context.Context, user *User) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.restoredUsers = append(m.restoredUsers, user)
+	return nil
+}
+
+func (m *mockPublisher) PublishPurgedUser(ctx context.Context, user *User) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.purgedUsers = append(m.purgedUsers, user)
+	return nil
+}
+
+func (m *mockPublisher) PublishPasswordChanged(ctx context.Context, user *User) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.passwordChangedUsers = append(m.passwordChangedUsers, user)
+	return nil
+}
+
+func (m *mockPublisher) PublishPasswordResetRequested(ctx context.Context, user *User, expiresAt time.Time) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.resetRequests = append(m.resetRequests, expiresAt)
+	return nil
+}
+
+func (m *mockPublisher) PublishUserBanned(ctx context.Context, user *User) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.bannedUsers = append(m.bannedUsers, user)
+	return nil
+}
+
+func (m *mockPublisher) PublishRoleChanged(ctx context.Context, user *User, previousRole Role) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.roleChangedUsers = append(m.roleChangedUsers, user)
+	m.previousRoles = append(m.previousRoles, previousRole)
+	return nil
+}
+
+func (m *mockPublisher) PublishNicknameChanged(ctx context.Context, user *User, previousNickname string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.nicknameChangedUsers = append(m.nicknameChangedUsers, user)
+	m.previousNicknames = append(m.previousNicknames, previousNickname)
+	return nil
+}
+
+// mockNicknameHistory keeps nickname history entries in memory
+type mockNicknameHistory struct {
+	entries []nicknameHistoryEntry
+}
+
+type nicknameHistoryEntry struct {
+	userID    uuid.UUID
+	nickname  string
+	changedAt time.Time
+}
+
+func (m *mockNicknameHistory) Record(ctx context.Context, userID uuid.UUID, nickname string, changedAt time.Time) error {
+	m.entries = append(m.entries, nicknameHistoryEntry{userID: userID, nickname: nickname, changedAt: changedAt})
+	return nil
+}
+
+func (m *mockNicknameHistory) LastChange(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if m.entries[i].userID == userID {
+			return m.entries[i].changedAt, nil
+		}
+	}
+	return time.Time{}, ErrNotFound
+}
+
+func (m *mockNicknameHistory) Resolve(ctx context.Context, nickname string, since time.Time) (uuid.UUID, error) {
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if e := m.entries[i]; e.nickname == nickname && e.changedAt.After(since) {
+			return e.userID, nil
+		}
+	}
+	return uuid.Nil, ErrNotFound
+}
+
+// mockResetSender records the reset tokens it is asked to deliver
+type mockResetSender struct {
+	resets []*PasswordReset
+}
+
+func (m *mockResetSender) SendPasswordReset(ctx context.Context, user *User, reset *PasswordReset) error {
+	m.resets = append(m.resets, reset)
+	return nil
+}
+
+type mockResetToken struct {
+	userID    uuid.UUID
+	expiresAt time.Time
+	used      bool
+}
+
+type mockPasswordResetRepository struct {
+	tokens map[string]*mockResetToken
+}
+
+func newMockPasswordResetRepository() *mockPasswordResetRepository {
+	return &mockPasswordResetRepository{
+		tokens: make(map[string]*mockResetToken),
+	}
+}
+
+func (m *mockPasswordResetRepository) Create(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	m.tokens[tokenHash] = &mockResetToken{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (m *mockPasswordResetRepository) Consume(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	t, exists := m.tokens[tokenHash]
+	if !exists || t.used || time.Now().After(t.expiresAt) {
+		return uuid.Nil, ErrNotFound
+	}
+	t.used = true
+	return t.userID, nil
+}
+
+func (m *mockPasswordResetRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	for hash, t := range m.tokens {
+		if t.userID == userID {
+			delete(m.tokens, hash)
+		}
+	}
+	return nil
+}
+
 func TestService_CreateUser(t *testing.T) {
 	repo := newMockRepository()
 	pub := newMockPublisher()
@@ -192,6 +524,22 @@ func TestService_CreateUser(t *testing.T) {
 			country:   "US",
 			wantErr:   true,
 		},
+		{
+			name:     "invalid fields",
+			nickname: "",
+			password: "secret123",
+			email:    "not-an-email",
+			country:  "USA",
+			wantErr:  true,
+		},
+		{
+			name:     "password too long for bcrypt",
+			nickname: "longpass",
+			password: strings.Repeat("x", 73),
+			email:    "long@example.com",
+			country:  "US",
+			wantErr:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -287,7 +635,7 @@ func TestService_UpdateUser(t *testing.T) {
 				Country:   tt.country,
 			}
 
-			u, err := service.UpdateUser(context.Background(), tt.id, updatedUser)
+			u, err := service.UpdateUser(context.Background(), tt.id, updatedUser, UpdatableFields)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Service.UpdateUser() error = %v, wantErr %v", err, tt.wantErr)
@@ -303,6 +651,10 @@ func TestService_UpdateUser(t *testing.T) {
 				if lastUser.ID != u.ID {
 					t.Errorf("Service.UpdateUser() published user ID = %v, want %v", lastUser.ID, u.ID)
 				}
+				previous := pub.previousUsers[len(pub.previousUsers)-1]
+				if previous == nil || previous.ID != u.ID || previous.Nickname != "johndoe" {
+					t.Errorf("Service.UpdateUser() published previous state %+v, want the user as it was before", previous)
+				}
 
 				if u.FirstName != tt.firstName {
 					t.Errorf("UpdateUser() FirstName = %v, want %v", u.FirstName, tt.firstName)
@@ -324,6 +676,200 @@ func TestService_UpdateUser(t *testing.T) {
 	}
 }
 
+func TestService_UpdateUser_Fields(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger)
+
+	created, err := service.CreateUser(context.Background(), &User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Nickname:  "johndoe",
+		Email:     "john@example.com",
+		Country:   "US",
+		Password:  "secret123",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	t.Run("only listed fields change and may be cleared", func(t *testing.T) {
+		u, err := service.UpdateUser(context.Background(), created.ID, &User{Nickname: "ignored"}, []Field{FieldLastName})
+		if err != nil {
+			t.Fatalf("Service.UpdateUser() error = %v", err)
+		}
+		if u.LastName != "" || u.FirstName != "John" || u.Nickname != "johndoe" {
+			t.Errorf("Service.UpdateUser() = %s/%s/%s, want John//johndoe", u.FirstName, u.LastName, u.Nickname)
+		}
+	})
+
+	t.Run("no fields", func(t *testing.T) {
+		published := len(pub.updatedUsers)
+		u, err := service.UpdateUser(context.Background(), created.ID, &User{}, nil)
+		if err != nil {
+			t.Fatalf("Service.UpdateUser() error = %v", err)
+		}
+		if u.Nickname != "johndoe" {
+			t.Errorf("Service.UpdateUser() nickname = %s, want johndoe", u.Nickname)
+		}
+		if len(pub.updatedUsers) != published {
+			t.Error("Service.UpdateUser() published an event without changes")
+		}
+	})
+
+	t.Run("invalid changes", func(t *testing.T) {
+		_, err := service.UpdateUser(context.Background(), created.ID, &User{Email: "not-an-email", Country: "DEU"},
+			[]Field{FieldNickname, FieldEmail, FieldCountry, "role"})
+		details := ValidationDetails(err)
+		for _, field := range []string{"nickname", "email", "country", "role"} {
+			if _, ok := details[field]; !ok {
+				t.Errorf("Service.UpdateUser() error = %v, want %s reported", err, field)
+			}
+		}
+	})
+}
+
+func TestService_UpdateUser_Nickname(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	history := &mockNicknameHistory{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger, WithNicknameHistory(history, time.Hour, 24*time.Hour))
+
+	var users []*User
+	for _, nickname := range []string{"johndoe", "janedoe"} {
+		u, err := service.CreateUser(context.Background(), &User{
+			Nickname: nickname,
+			Email:    nickname + "@example.com",
+			Password: "secret123",
+			Country:  "US",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test user: %v", err)
+		}
+		users = append(users, u)
+	}
+	john, jane := users[0], users[1]
+	rename := func(u *User, nickname string) (*User, error) {
+		return service.UpdateUser(context.Background(), u.ID, &User{Nickname: nickname}, []Field{FieldNickname})
+	}
+
+	t.Run("taken nickname", func(t *testing.T) {
+		if _, err := rename(john, "janedoe"); !errors.Is(err, ErrNicknameTaken) {
+			t.Errorf("Service.UpdateUser() error = %v, want %v", err, ErrNicknameTaken)
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		if _, err := rename(john, "johnny"); err != nil {
+			t.Fatalf("Service.UpdateUser() error = %v", err)
+		}
+		if len(pub.nicknameChangedUsers) != 1 || pub.previousNicknames[0] != "johndoe" || pub.nicknameChangedUsers[0].Nickname != "johnny" {
+			t.Errorf("Service.UpdateUser() published nickname changes %v from %v, want johndoe to johnny", pub.nicknameChangedUsers, pub.previousNicknames)
+		}
+
+		resolved, err := service.GetUserByNickname(context.Background(), "johndoe")
+		if err != nil {
+			t.Fatalf("Service.GetUserByNickname() error = %v", err)
+		}
+		if resolved.ID != john.ID {
+			t.Errorf("Service.GetUserByNickname() = %v, want %v", resolved.ID, john.ID)
+		}
+	})
+
+	t.Run("cooldown", func(t *testing.T) {
+		_, err := rename(john, "john")
+		if !errors.Is(err, ErrNicknameCooldown) {
+			t.Errorf("Service.UpdateUser() error = %v, want %v", err, ErrNicknameCooldown)
+		}
+
+		// Other users and other fields are not affected
+		if _, err := rename(jane, "jane"); err != nil {
+			t.Errorf("Service.UpdateUser() error = %v", err)
+		}
+		if _, err := service.UpdateUser(context.Background(), john.ID, &User{Nickname: "john", Country: "DE"}, []Field{FieldCountry, FieldNickname}); !errors.Is(err, ErrNicknameCooldown) {
+			t.Errorf("Service.UpdateUser() error = %v, want %v", err, ErrNicknameCooldown)
+		}
+		if _, err := service.UpdateUser(context.Background(), john.ID, &User{Nickname: "johnny", Country: "DE"}, []Field{FieldCountry, FieldNickname}); err != nil {
+			t.Errorf("Service.UpdateUser() with unchanged nickname error = %v", err)
+		}
+	})
+
+	t.Run("current owner wins over history", func(t *testing.T) {
+		for i := range history.entries {
+			history.entries[i].changedAt = time.Now().Add(-2 * time.Hour) // Let the cooldown pass
+		}
+		if _, err := rename(jane, "johndoe"); err != nil {
+			t.Fatalf("Service.UpdateUser() error = %v", err)
+		}
+
+		resolved, err := service.GetUserByNickname(context.Background(), "johndoe")
+		if err != nil {
+			t.Fatalf("Service.GetUserByNickname() error = %v", err)
+		}
+		if resolved.ID != jane.ID {
+			t.Errorf("Service.GetUserByNickname() = %v, want current owner %v", resolved.ID, jane.ID)
+		}
+	})
+
+	t.Run("history expires", func(t *testing.T) {
+		for i := range history.entries {
+			history.entries[i].changedAt = time.Now().Add(-48 * time.Hour)
+		}
+		if _, err := service.GetUserByNickname(context.Background(), "janedoe"); !IsNotFound(err) {
+			t.Errorf("Service.GetUserByNickname() error = %v, want not found", err)
+		}
+	})
+}
+
+func TestService_UpdateUser_Version(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger)
+
+	created, err := service.CreateUser(context.Background(), &User{
+		Nickname: "johndoe",
+		Email:    "john@example.com",
+		Password: "secret123",
+		Country:  "US",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	if created.Version != 1 {
+		t.Fatalf("Service.CreateUser() version = %d, want 1", created.Version)
+	}
+
+	updated, err := service.UpdateUser(context.Background(), created.ID, &User{Country: "DE", Version: 1}, []Field{FieldCountry})
+	if err != nil {
+		t.Fatalf("Service.UpdateUser() error = %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("Service.UpdateUser() version = %d, want 2", updated.Version)
+	}
+
+	// A second writer that also read version 1 loses
+	published := len(pub.updatedUsers)
+	_, err = service.UpdateUser(context.Background(), created.ID, &User{Country: "FR", Version: 1}, []Field{FieldCountry})
+	if !IsConflict(err) {
+		t.Errorf("Service.UpdateUser() error = %v, want conflict", err)
+	}
+	if len(pub.updatedUsers) != published {
+		t.Error("Service.UpdateUser() published an event for a conflicting update")
+	}
+
+	// Without an expected version the update applies to whatever is stored
+	updated, err = service.UpdateUser(context.Background(), created.ID, &User{Country: "FR"}, []Field{FieldCountry})
+	if err != nil {
+		t.Fatalf("Service.UpdateUser() error = %v", err)
+	}
+	if updated.Version != 3 || updated.Country != "FR" {
+		t.Errorf("Service.UpdateUser() = version %d, country %s, want version 3, country FR", updated.Version, updated.Country)
+	}
+}
+
 func TestService_DeleteUser(t *testing.T) {
 	repo := newMockRepository()
 	pub := newMockPublisher()
@@ -461,48 +1007,1125 @@ func TestService_ListUsers(t *testing.T) {
 			wantErr:     false,
 		},
 		{
-			name: "pagination",
+			name: "filter by country in",
 			params: ListParams{
-				Limit:  1,
-				Offset: 1,
+				Limit: 10,
+				Filters: []Filter{
+					{Field: "country", Operator: OpIn, Values: []string{"UK", "DE"}},
+				},
 			},
-			wantCount: 1,
-			wantTotal: 3,
-			wantErr:   false,
+			wantCount:   1,
+			wantTotal:   1,
+			wantCountry: "UK",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			users, hasMore, total, err := service.ListUsers(context.Background(), tt.params)
-
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Service.ListUsers() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if err == nil {
-				if len(users) != tt.wantCount {
-					t.Errorf("Service.ListUsers() got %v users, want %v", len(users), tt.wantCount)
-				}
-
-				if total != tt.wantTotal {
-					t.Errorf("Service.ListUsers() total = %v, want %v", total, tt.wantTotal)
-				}
-
-				if tt.wantCountry != "" {
-					for _, u := range users {
-						if u.Country != tt.wantCountry {
-							t.Errorf("Service.ListUsers() got user with country %v, want %v", u.Country, tt.wantCountry)
+		{
+			name: "filter by nickname prefix",
+			params: ListParams{
+				Limit: 10,
+				Filters: []Filter{
+					{Field: "nickname", Operator: OpPrefix, Value: "J"},
+				},
+			},
+			wantCount: 2,
+			wantTotal: 2,
+		},
+		{
+			name: "unknown filter field",
+			params: ListParams{
+				Limit: 10,
+				Filters: []Filter{
+					{Field: "password_hash", Value: "x"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported operator",
+			params: ListParams{
+				Limit: 10,
+				Filters: []Filter{
+					{Field: "country", Operator: OpGt, Value: "DE"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed timestamp",
+			params: ListParams{
+				Limit: 10,
+				Filters: []Filter{
+					{Field: "created_at", Operator: OpGt, Value: "yesterday"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "in without values",
+			params: ListParams{
+				Limit: 10,
+				Filters: []Filter{
+					{Field: "country", Operator: OpIn},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "pagination",
+			params: ListParams{
+				Limit:  1,
+				Offset: 1,
+			},
+			wantCount: 1,
+			wantTotal: 3,
+			wantErr:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.IncludeTotal = true
+			result, err := service.ListUsers(context.Background(), tt.params)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Service.ListUsers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if err == nil {
+				if len(result.Users) != tt.wantCount {
+					t.Errorf("Service.ListUsers() got %v users, want %v", len(result.Users), tt.wantCount)
+				}
+
+				if result.TotalCount == nil || *result.TotalCount != tt.wantTotal {
+					t.Errorf("Service.ListUsers() total = %v, want %v", result.TotalCount, tt.wantTotal)
+				}
+
+				if tt.wantCountry != "" {
+					for _, u := range result.Users {
+						if u.Country != tt.wantCountry {
+							t.Errorf("Service.ListUsers() got user with country %v, want %v", u.Country, tt.wantCountry)
 						}
 					}
 				}
 
 				expectedHasMore := tt.params.Offset+tt.params.Limit < int(tt.wantTotal)
-				if hasMore != expectedHasMore {
-					t.Errorf("Service.ListUsers() hasMore = %v, want %v", hasMore, expectedHasMore)
+				if result.HasMore != expectedHasMore {
+					t.Errorf("Service.ListUsers() hasMore = %v, want %v", result.HasMore, expectedHasMore)
+				}
+			}
+		})
+	}
+}
+
+func TestService_ListUsers_Cursor(t *testing.T) {
+	repo := newMockRepository()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, newMockPublisher(), logger, WithCursorSigningKey([]byte("test-key")))
+
+	for _, nickname := range []string{"delta", "alpha", "echo", "charlie", "bravo"} {
+		_, err := service.CreateUser(context.Background(), &User{
+			Nickname: nickname,
+			Email:    nickname + "@example.com",
+			Password: "secret123",
+			Country:  "US",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test user: %v", err)
+		}
+	}
+
+	// Walk all pages; the ordering given on the first request sticks to the cursor
+	params := ListParams{Limit: 2, OrderBy: "nickname"}
+	var got []string
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Service.ListUsers() did not reach the last page")
+		}
+
+		result, err := service.ListUsers(context.Background(), params)
+		if err != nil {
+			t.Fatalf("Service.ListUsers() error = %v", err)
+		}
+		if result.TotalCount != nil {
+			t.Error("Service.ListUsers() counted users without being asked to")
+		}
+		for _, u := range result.Users {
+			got = append(got, u.Nickname)
+		}
+
+		if result.HasMore != (result.NextCursor != "") {
+			t.Fatalf("Service.ListUsers() hasMore = %v with next cursor %q", result.HasMore, result.NextCursor)
+		}
+		if !result.HasMore {
+			break
+		}
+		params = ListParams{Limit: 2, OrderBy: "email", OrderDesc: true, Cursor: result.NextCursor}
+	}
+
+	want := []string{"alpha", "bravo", "charlie", "delta", "echo"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Service.ListUsers() pages = %v, want %v", got, want)
+	}
+
+	t.Run("tampered cursor", func(t *testing.T) {
+		result, err := service.ListUsers(context.Background(), ListParams{Limit: 2, OrderBy: "nickname"})
+		if err != nil {
+			t.Fatalf("Service.ListUsers() error = %v", err)
+		}
+
+		_, err = service.ListUsers(context.Background(), ListParams{Limit: 2, Cursor: result.NextCursor + "x"})
+		if !IsValidationError(err) {
+			t.Errorf("Service.ListUsers() error = %v, want validation error", err)
+		}
+	})
+
+	t.Run("cursors not configured", func(t *testing.T) {
+		unsigned := NewService(repo, newMockPublisher(), logger)
+
+		result, err := unsigned.ListUsers(context.Background(), ListParams{Limit: 2})
+		if err != nil {
+			t.Fatalf("Service.ListUsers() error = %v", err)
+		}
+		if !result.HasMore || result.NextCursor != "" {
+			t.Errorf("Service.ListUsers() hasMore = %v, next cursor = %q, want more without cursor", result.HasMore, result.NextCursor)
+		}
+
+		if _, err := unsigned.ListUsers(context.Background(), ListParams{Limit: 2, Cursor: "abc.def"}); err == nil {
+			t.Error("Service.ListUsers() accepted a cursor without a signing key")
+		}
+	})
+}
+
+func TestService_SearchUsers(t *testing.T) {
+	repo := newMockRepository()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, newMockPublisher(), logger, WithMaxListLimit(5))
+
+	for _, nickname := range []string{"johnny_walker", "john", "johnny", "alice"} {
+		_, err := service.CreateUser(context.Background(), &User{
+			Nickname: nickname,
+			Email:    nickname + "@example.com",
+			Password: "secret123",
+			Country:  "US",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test user: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		limit   int
+		want    []string
+		wantErr []string // Fields reported invalid
+	}{
+		{
+			name:  "ranked by relevance",
+			query: "john",
+			limit: 5,
+			want:  []string{"john", "johnny", "johnny_walker"},
+		},
+		{
+			name:  "trimmed query with default limit",
+			query: "  alice ",
+			want:  []string{"alice"},
+		},
+		{
+			name:  "limited",
+			query: "john",
+			limit: 1,
+			want:  []string{"john"},
+		},
+		{
+			name:  "no match",
+			query: "bob",
+			want:  []string{},
+		},
+		{
+			name:    "blank query",
+			query:   "   ",
+			wantErr: []string{"query"},
+		},
+		{
+			name:    "query too long",
+			query:   strings.Repeat("a", MaxSearchQueryLength+1),
+			wantErr: []string{"query"},
+		},
+		{
+			name:    "every problem at once",
+			query:   "",
+			limit:   6,
+			wantErr: []string{"query", "limit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := service.SearchUsers(context.Background(), tt.query, tt.limit)
+			if tt.wantErr != nil {
+				details := ValidationDetails(err)
+				if len(details) != len(tt.wantErr) {
+					t.Fatalf("Service.SearchUsers() error = %v, want invalid %v", err, tt.wantErr)
+				}
+				for _, field := range tt.wantErr {
+					if _, ok := details[field]; !ok {
+						t.Errorf("Service.SearchUsers() error = %v, want %s reported", err, field)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Service.SearchUsers() error = %v", err)
+			}
+
+			got := make([]string, len(results))
+			for i, r := range results {
+				got[i] = r.User.Nickname
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Service.SearchUsers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Authenticate(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger)
+
+	createdUser, err := service.CreateUser(context.Background(), &User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Nickname:  "johndoe",
+		Password:  "secret123",
+		Email:     "john@example.com",
+		Country:   "US",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		identifier string
+		password   string
+		wantErr    error
+	}{
+		{
+			name:       "valid email",
+			identifier: "john@example.com",
+			password:   "secret123",
+		},
+		{
+			name:       "valid nickname",
+			identifier: "johndoe",
+			password:   "secret123",
+		},
+		{
+			name:       "wrong password",
+			identifier: "johndoe",
+			password:   "wrong",
+			wantErr:    ErrInvalidCredentials,
+		},
+		{
+			name:       "unknown email",
+			identifier: "nobody@example.com",
+			password:   "secret123",
+			wantErr:    ErrInvalidCredentials,
+		},
+		{
+			name:       "unknown nickname",
+			identifier: "nobody",
+			password:   "secret123",
+			wantErr:    ErrInvalidCredentials,
+		},
+		{
+			name:       "empty password",
+			identifier: "johndoe",
+			password:   "",
+			wantErr:    ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := service.Authenticate(context.Background(), tt.identifier, tt.password)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Service.Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Service.Authenticate() unexpected error = %v", err)
+			}
+			if u.ID != createdUser.ID {
+				t.Errorf("Service.Authenticate() user ID = %v, want %v", u.ID, createdUser.ID)
+			}
+		})
+	}
+}
+
+func TestService_RestoreUser(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	newDeletedUser := func(repo *mockRepository, deletedAgo time.Duration) *User {
+		deletedAt := time.Now().UTC().Add(-deletedAgo)
+		u := &User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", DeletedAt: &deletedAt}
+		repo.users[u.ID] = u
+		return u
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		repo := newMockRepository()
+		service := NewService(repo, newMockPublisher(), logger)
+		u := newDeletedUser(repo, time.Hour)
+
+		if _, err := service.RestoreUser(context.Background(), u.ID); err == nil {
+			t.Error("Service.RestoreUser() expected error when restore is not configured")
+		}
+	})
+
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	service := NewService(repo, pub, logger, WithDeletionRetention(24*time.Hour, 48*time.Hour))
+
+	recent := newDeletedUser(repo, time.Hour)
+	expired := newDeletedUser(repo, 36*time.Hour)
+	active := &User{ID: uuid.New(), Email: "active@example.com"}
+	repo.users[active.ID] = active
+
+	tests := []struct {
+		name    string
+		id      uuid.UUID
+		wantErr error
+	}{
+		{name: "within grace period", id: recent.ID},
+		{name: "grace period expired", id: expired.ID, wantErr: ErrNotFound},
+		{name: "not deleted", id: active.ID, wantErr: ErrNotFound},
+		{name: "unknown user", id: uuid.New(), wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored, err := service.RestoreUser(context.Background(), tt.id)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Service.RestoreUser() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Service.RestoreUser() unexpected error = %v", err)
+			}
+			if restored.DeletedAt != nil {
+				t.Errorf("Service.RestoreUser() deleted_at = %v, want nil", restored.DeletedAt)
+			}
+			if _, err := service.GetUser(context.Background(), tt.id); err != nil {
+				t.Errorf("Service.GetUser() after restore error = %v", err)
+			}
+			if len(pub.restoredUsers) != 1 {
+				t.Errorf("Service.RestoreUser() published %d events, want 1", len(pub.restoredUsers))
+			}
+		})
+	}
+}
+
+func TestService_PurgeDeletedUsers(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger, WithDeletionRetention(24*time.Hour, 48*time.Hour))
+
+	oldDeletedAt := time.Now().UTC().Add(-72 * time.Hour)
+	recentDeletedAt := time.Now().UTC().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		u := &User{ID: uuid.New(), DeletedAt: &oldDeletedAt}
+		repo.users[u.ID] = u
+	}
+	recent := &User{ID: uuid.New(), DeletedAt: &recentDeletedAt}
+	active := &User{ID: uuid.New()}
+	repo.users[recent.ID] = recent
+	repo.users[active.ID] = active
+
+	purged, err := service.PurgeDeletedUsers(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Service.PurgeDeletedUsers() unexpected error = %v", err)
+	}
+	if purged != 5 {
+		t.Errorf("Service.PurgeDeletedUsers() = %d, want 5", purged)
+	}
+	if len(pub.purgedUsers) != 5 {
+		t.Errorf("Service.PurgeDeletedUsers() published %d events, want 5", len(pub.purgedUsers))
+	}
+	if len(repo.users) != 2 {
+		t.Errorf("repository holds %d users after purge, want 2", len(repo.users))
+	}
+	if len(pub.deletedUsers) != 0 {
+		t.Errorf("Service.PurgeDeletedUsers() published %d deleted events, want 0", len(pub.deletedUsers))
+	}
+}
+
+func TestService_EraseUser(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger, WithDeletionRetention(24*time.Hour, 48*time.Hour))
+	ctx := context.Background()
+
+	active, err := service.CreateUser(ctx, &User{
+		Nickname: "johndoe",
+		Password: "secret123",
+		Email:    "john@example.com",
+		Country:  "US",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	deletedAt := time.Now().UTC().Add(-time.Hour)
+	deleted := &User{ID: uuid.New(), DeletedAt: &deletedAt}
+	repo.users[deleted.ID] = deleted
+
+	t.Run("erases at once", func(t *testing.T) {
+		if err := service.EraseUser(ctx, active.ID); err != nil {
+			t.Fatalf("Service.EraseUser() error = %v", err)
+		}
+		if _, exists := repo.users[active.ID]; exists {
+			t.Error("Service.EraseUser() left the user in the repository")
+		}
+		if _, err := service.RestoreUser(ctx, active.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Service.RestoreUser() after erasure error = %v, want %v", err, ErrNotFound)
+		}
+		if len(pub.purgedUsers) != 1 || pub.purgedUsers[0].ID != active.ID {
+			t.Errorf("Service.EraseUser() published %v, want one purged event for %s", pub.purgedUsers, active.ID)
+		}
+		if len(pub.deletedUsers) != 0 {
+			t.Errorf("Service.EraseUser() published %d deleted events, want 0", len(pub.deletedUsers))
+		}
+	})
+
+	t.Run("erases a deleted user within the grace period", func(t *testing.T) {
+		if err := service.EraseUser(ctx, deleted.ID); err != nil {
+			t.Fatalf("Service.EraseUser() error = %v", err)
+		}
+		if _, exists := repo.users[deleted.ID]; exists {
+			t.Error("Service.EraseUser() left the deleted user in the repository")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if err := service.EraseUser(ctx, active.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Service.EraseUser() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestService_BanUser(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger)
+	ctx := context.Background()
+
+	createdUser, err := service.CreateUser(ctx, &User{
+		Nickname: "johndoe",
+		Password: "secret123",
+		Email:    "john@example.com",
+		Country:  "US",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	t.Run("reason is required", func(t *testing.T) {
+		if _, err := service.BanUser(ctx, createdUser.ID, " "); !errors.Is(err, ErrValidation) {
+			t.Errorf("Service.BanUser() error = %v, want %v", err, ErrValidation)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := service.BanUser(ctx, uuid.New(), "cheating"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Service.BanUser() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("bans the user", func(t *testing.T) {
+		u, err := service.BanUser(ctx, createdUser.ID, "cheating")
+		if err != nil {
+			t.Fatalf("Service.BanUser() error = %v", err)
+		}
+		if u.BannedAt == nil || u.BanReason != "cheating" {
+			t.Errorf("Service.BanUser() = %+v, want a user banned for cheating", u)
+		}
+		if len(pub.bannedUsers) != 1 {
+			t.Errorf("Service.BanUser() published %d events, want 1", len(pub.bannedUsers))
+		}
+		if _, err := service.Authenticate(ctx, "johndoe", "secret123"); !errors.Is(err, ErrBanned) {
+			t.Errorf("Service.Authenticate() of a banned user error = %v, want %v", err, ErrBanned)
+		}
+		if _, err := service.Authenticate(ctx, "johndoe", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Service.Authenticate() of a banned user with a wrong password error = %v, want %v", err, ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("banning again is a no-op", func(t *testing.T) {
+		u, err := service.BanUser(ctx, createdUser.ID, "spam")
+		if err != nil {
+			t.Fatalf("Service.BanUser() error = %v", err)
+		}
+		if u.BanReason != "cheating" {
+			t.Errorf("Service.BanUser() reason = %q, want the first ban's", u.BanReason)
+		}
+		if len(pub.bannedUsers) != 1 {
+			t.Errorf("Service.BanUser() published %d events, want 1", len(pub.bannedUsers))
+		}
+	})
+}
+
+func TestService_AssignRole(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger)
+
+	createdUser, err := service.CreateUser(context.Background(), &User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Nickname:  "johndoe",
+		Password:  "secret123",
+		Email:     "john@example.com",
+		Country:   "US",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	if createdUser.Role != RolePlayer {
+		t.Fatalf("Service.CreateUser() role = %v, want %v", createdUser.Role, RolePlayer)
+	}
+
+	tests := []struct {
+		name         string
+		id           uuid.UUID
+		role         Role
+		wantErr      error
+		wantEvents   int
+		wantPrevious Role
+	}{
+		{
+			name:    "invalid role",
+			id:      createdUser.ID,
+			role:    Role("superuser"),
+			wantErr: ErrValidation,
+		},
+		{
+			name:    "not found",
+			id:      uuid.New(),
+			role:    RoleAdmin,
+			wantErr: ErrNotFound,
+		},
+		{
+			name:         "promote to moderator",
+			id:           createdUser.ID,
+			role:         RoleModerator,
+			wantEvents:   1,
+			wantPrevious: RolePlayer,
+		},
+		{
+			name:         "same role publishes nothing",
+			id:           createdUser.ID,
+			role:         RoleModerator,
+			wantEvents:   1,
+			wantPrevious: RolePlayer,
+		},
+		{
+			name:         "promote to admin",
+			id:           createdUser.ID,
+			role:         RoleAdmin,
+			wantEvents:   2,
+			wantPrevious: RoleModerator,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.AssignRole(context.Background(), tt.id, tt.role)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Service.AssignRole() error = %v, want %v", err, tt.wantErr)
 				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Service.AssignRole() unexpected error = %v", err)
+			}
+			if got.Role != tt.role {
+				t.Errorf("Service.AssignRole() role = %v, want %v", got.Role, tt.role)
+			}
+			if len(pub.roleChangedUsers) != tt.wantEvents {
+				t.Fatalf("Service.AssignRole() published %d events, want %d", len(pub.roleChangedUsers), tt.wantEvents)
+			}
+			if prev := pub.previousRoles[len(pub.previousRoles)-1]; prev != tt.wantPrevious {
+				t.Errorf("Service.AssignRole() previous role = %v, want %v", prev, tt.wantPrevious)
 			}
 		})
 	}
 }
+
+func TestService_ChangePassword(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger)
+
+	createdUser, err := service.CreateUser(context.Background(), &User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Nickname:  "johndoe",
+		Password:  "secret123",
+		Email:     "john@example.com",
+		Country:   "US",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		id          uuid.UUID
+		oldPassword string
+		newPassword string
+		wantErr     error
+	}{
+		{
+			name:        "wrong old password",
+			id:          createdUser.ID,
+			oldPassword: "wrong",
+			newPassword: "newsecret",
+			wantErr:     ErrInvalidCredentials,
+		},
+		{
+			name:        "empty new password",
+			id:          createdUser.ID,
+			oldPassword: "secret123",
+			newPassword: "",
+			wantErr:     ErrValidation,
+		},
+		{
+			name:        "not found",
+			id:          uuid.New(),
+			oldPassword: "secret123",
+			newPassword: "newsecret",
+			wantErr:     ErrNotFound,
+		},
+		{
+			name:        "valid change",
+			id:          createdUser.ID,
+			oldPassword: "secret123",
+			newPassword: "newsecret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.ChangePassword(context.Background(), tt.id, tt.oldPassword, tt.newPassword)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Service.ChangePassword() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Service.ChangePassword() unexpected error = %v", err)
+			}
+			if len(pub.passwordChangedUsers) != 1 {
+				t.Errorf("Service.ChangePassword() published %d events, want 1", len(pub.passwordChangedUsers))
+			}
+			if _, err := service.Authenticate(context.Background(), "johndoe", tt.newPassword); err != nil {
+				t.Errorf("Service.Authenticate() with new password error = %v", err)
+			}
+			if _, err := service.Authenticate(context.Background(), "johndoe", tt.oldPassword); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Service.Authenticate() with old password error = %v, want %v", err, ErrInvalidCredentials)
+			}
+		})
+	}
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	resets := newMockPasswordResetRepository()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sender := &mockResetSender{}
+	service := NewService(repo, pub, logger, WithPasswordResets(resets, time.Hour), WithResetSender(sender))
+	ctx := context.Background()
+
+	createdUser, err := service.CreateUser(ctx, &User{
+		Nickname: "johndoe",
+		Password: "secret123",
+		Email:    "john@example.com",
+		Country:  "US",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	t.Run("empty password", func(t *testing.T) {
+		err := service.ResetPassword(ctx, createdUser.ID, "")
+		if !errors.Is(err, ErrValidation) {
+			t.Errorf("Service.ResetPassword() error = %v, want %v", err, ErrValidation)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := service.ResetPassword(ctx, uuid.New(), "newsecret")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Service.ResetPassword() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("valid reset", func(t *testing.T) {
+		if err := service.RequestPasswordReset(ctx, "john@example.com"); err != nil {
+			t.Fatalf("Service.RequestPasswordReset() error = %v", err)
+		}
+		reset := sender.resets[0]
+
+		if err := service.ResetPassword(ctx, createdUser.ID, "newsecret"); err != nil {
+			t.Fatalf("Service.ResetPassword() error = %v", err)
+		}
+		if _, err := service.Authenticate(ctx, "johndoe", "newsecret"); err != nil {
+			t.Errorf("Service.Authenticate() with new password error = %v", err)
+		}
+		if len(pub.passwordChangedUsers) != 1 {
+			t.Errorf("Service.ResetPassword() published %d events, want 1", len(pub.passwordChangedUsers))
+		}
+		if err := service.ConfirmPasswordReset(ctx, reset.Token, "another"); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("Service.ConfirmPasswordReset() after reset error = %v, want %v", err, ErrInvalidResetToken)
+		}
+	})
+}
+
+func TestService_RepublishUser(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewService(repo, pub, logger)
+	ctx := context.Background()
+
+	createdUser, err := service.CreateUser(ctx, &User{
+		Nickname: "johndoe",
+		Password: "secret123",
+		Email:    "john@example.com",
+		Country:  "US",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := service.RepublishUser(ctx, uuid.New())
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Service.RepublishUser() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("publishes the current state", func(t *testing.T) {
+		u, err := service.RepublishUser(ctx, createdUser.ID)
+		if err != nil {
+			t.Fatalf("Service.RepublishUser() error = %v", err)
+		}
+		if len(pub.updatedUsers) != 1 || pub.updatedUsers[0].ID != createdUser.ID {
+			t.Fatalf("Service.RepublishUser() published %v, want one updated event for %s", pub.updatedUsers, createdUser.ID)
+		}
+		if pub.previousUsers[0] != nil {
+			t.Errorf("Service.RepublishUser() published previous state %+v, want none", pub.previousUsers[0])
+		}
+		if u.Version != createdUser.Version {
+			t.Errorf("Service.RepublishUser() version = %d, want %d unchanged", u.Version, createdUser.Version)
+		}
+	})
+}
+
+func TestService_PasswordReset(t *testing.T) {
+	repo := newMockRepository()
+	pub := newMockPublisher()
+	resets := newMockPasswordResetRepository()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sender := &mockResetSender{}
+	service := NewService(repo, pub, logger, WithPasswordResets(resets, time.Hour), WithResetSender(sender))
+	ctx := context.Background()
+
+	_, err := service.CreateUser(ctx, &User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Nickname:  "johndoe",
+		Password:  "secret123",
+		Email:     "john@example.com",
+		Country:   "US",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	t.Run("unknown email", func(t *testing.T) {
+		// Succeeds as for a known email, so callers cannot probe for accounts
+		if err := service.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+			t.Errorf("Service.RequestPasswordReset() error = %v, want nil", err)
+		}
+		if len(pub.resetRequests) != 0 || len(sender.resets) != 0 || len(resets.tokens) != 0 {
+			t.Errorf("Service.RequestPasswordReset() issued a token for an unknown email")
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		err := service.ConfirmPasswordReset(ctx, "not-a-token", "newsecret")
+		if !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("Service.ConfirmPasswordReset() error = %v, want %v", err, ErrInvalidResetToken)
+		}
+	})
+
+	t.Run("token is single use", func(t *testing.T) {
+		if err := service.RequestPasswordReset(ctx, "john@example.com"); err != nil {
+			t.Fatalf("Service.RequestPasswordReset() error = %v", err)
+		}
+		if len(pub.resetRequests) != 1 || len(sender.resets) != 1 {
+			t.Fatalf("Service.RequestPasswordReset() published %d events and sent %d tokens, want 1 and 1", len(pub.resetRequests), len(sender.resets))
+		}
+		reset := sender.resets[0]
+		if _, stored := resets.tokens[reset.Token]; stored {
+			t.Error("Service.RequestPasswordReset() stored the plain token")
+		}
+		if !pub.resetRequests[0].Equal(reset.ExpiresAt) {
+			t.Errorf("Service.RequestPasswordReset() published expiry %v, want %v", pub.resetRequests[0], reset.ExpiresAt)
+		}
+
+		if err := service.ConfirmPasswordReset(ctx, reset.Token, "newsecret"); err != nil {
+			t.Fatalf("Service.ConfirmPasswordReset() error = %v", err)
+		}
+		if _, err := service.Authenticate(ctx, "johndoe", "newsecret"); err != nil {
+			t.Errorf("Service.Authenticate() with new password error = %v", err)
+		}
+		if len(pub.passwordChangedUsers) != 1 {
+			t.Errorf("Service.ConfirmPasswordReset() published %d events, want 1", len(pub.passwordChangedUsers))
+		}
+
+		err = service.ConfirmPasswordReset(ctx, reset.Token, "another")
+		if !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("Service.ConfirmPasswordReset() reuse error = %v, want %v", err, ErrInvalidResetToken)
+		}
+	})
+}
+
+func TestService_UnitOfWork(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("write and event commit together", func(t *testing.T) {
+		tx := newMockRepository()
+		pub := newMockPublisher()
+		service := NewService(tx, pub, logger)
+
+		u, err := service.CreateUser(context.Background(), &User{
+			Nickname: "johndoe",
+			Email:    "john@example.com",
+			Password: "secret123",
+			Country:  "US",
+		})
+		if err != nil {
+			t.Fatalf("Service.CreateUser() error = %v", err)
+		}
+		if err := service.DeleteUser(context.Background(), u.ID); err != nil {
+			t.Fatalf("Service.DeleteUser() error = %v", err)
+		}
+
+		if tx.committed != 2 || tx.rolledBack != 0 {
+			t.Errorf("transactions committed = %d, rolled back = %d, want 2 and 0", tx.committed, tx.rolledBack)
+		}
+		if len(pub.createdUsers) != 1 || len(pub.deletedUsers) != 1 {
+			t.Errorf("published created = %d, deleted = %d, want 1 each", len(pub.createdUsers), len(pub.deletedUsers))
+		}
+	})
+
+	t.Run("publish failure rolls back the write", func(t *testing.T) {
+		tx := newMockRepository()
+		pub := newMockPublisher()
+		pub.err = errors.New("outbox unavailable")
+		service := NewService(tx, pub, logger)
+
+		_, err := service.CreateUser(context.Background(), &User{
+			Nickname: "johndoe",
+			Email:    "john@example.com",
+			Password: "secret123",
+			Country:  "US",
+		})
+		if !errors.Is(err, pub.err) {
+			t.Fatalf("Service.CreateUser() error = %v, want %v", err, pub.err)
+		}
+		if tx.committed != 0 || tx.rolledBack != 1 {
+			t.Errorf("transactions committed = %d, rolled back = %d, want 0 and 1", tx.committed, tx.rolledBack)
+		}
+	})
+
+	t.Run("retried unit of work starts over", func(t *testing.T) {
+		repo := &retryingRepository{mockRepository: newMockRepository()}
+		service := NewService(repo, newMockPublisher(), logger)
+
+		u, err := service.CreateUser(context.Background(), &User{
+			Nickname: "johndoe",
+			Email:    "john@example.com",
+			Password: "secret123",
+			Country:  "US",
+		})
+		if err != nil {
+			t.Fatalf("Service.CreateUser() error = %v", err)
+		}
+		if _, err := service.UpdateUser(context.Background(), u.ID, &User{Nickname: "janedoe"}, []Field{FieldNickname}); err != nil {
+			t.Fatalf("Service.UpdateUser() error = %v", err)
+		}
+		if err := service.ChangePassword(context.Background(), u.ID, "secret123", "newsecret"); err != nil {
+			t.Fatalf("Service.ChangePassword() error = %v", err)
+		}
+		if _, err := service.Authenticate(context.Background(), "janedoe", "newsecret"); err != nil {
+			t.Errorf("Service.Authenticate() with the new password error = %v", err)
+		}
+		if repo.committed != 4 {
+			t.Errorf("transactions committed = %d, want 4", repo.committed)
+		}
+	})
+
+	t.Run("password change reads through the unit of work", func(t *testing.T) {
+		inner := newMockRepository()
+		service := NewService(inner, newMockPublisher(), logger)
+		u, err := service.CreateUser(context.Background(), &User{
+			Nickname: "johndoe",
+			Email:    "john@example.com",
+			Password: "secret123",
+			Country:  "US",
+		})
+		if err != nil {
+			t.Fatalf("Service.CreateUser() error = %v", err)
+		}
+
+		repo := &txOnlyRepository{mockRepository: inner}
+		service = NewService(repo, newMockPublisher(), logger)
+		if err := service.ChangePassword(context.Background(), u.ID, "wrong", "newsecret"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Service.ChangePassword() with a wrong password error = %v, want %v", err, ErrInvalidCredentials)
+		}
+		if err := service.ChangePassword(context.Background(), u.ID, "secret123", "newsecret"); err != nil {
+			t.Fatalf("Service.ChangePassword() error = %v", err)
+		}
+		if inner.committed != 2 || inner.rolledBack != 1 {
+			t.Errorf("transactions committed = %d, rolled back = %d, want 2 and 1", inner.committed, inner.rolledBack)
+		}
+
+		// Authentication reads the stored hash, never a cached user
+		for _, identifier := range []string{"john@example.com", "johndoe"} {
+			if _, err := service.Authenticate(context.Background(), identifier, "newsecret"); err != nil {
+				t.Errorf("Service.Authenticate(%q) error = %v", identifier, err)
+			}
+		}
+	})
+}
+
+// txOnlyRepository fails reads made outside a unit of work, which could act
+// on a state the unit of work no longer sees
+type txOnlyRepository struct {
+	*mockRepository
+}
+
+func (r *txOnlyRepository) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	return nil, errors.New("read outside the unit of work")
+}
+
+func (r *txOnlyRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return nil, errors.New("read outside the unit of work")
+}
+
+func (r *txOnlyRepository) GetByNickname(ctx context.Context, nickname string) (*User, error) {
+	return nil, errors.New("read outside the unit of work")
+}
+
+func (r *txOnlyRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error {
+	return r.mockRepository.WithTx(ctx, fn)
+}
+
+// mockNotifier records the changes a Service notifies
+type mockNotifier struct {
+	changes []string
+}
+
+func (m *mockNotifier) NotifyCreated(u *User) { m.changes = append(m.changes, "created "+u.Nickname) }
+func (m *mockNotifier) NotifyUpdated(u *User) { m.changes = append(m.changes, "updated "+u.Nickname) }
+func (m *mockNotifier) NotifyDeleted(u *User) { m.changes = append(m.changes, "deleted "+u.Nickname) }
+
+func TestService_Notifier(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	repo := &retryingRepository{mockRepository: newMockRepository()}
+	notifier := &mockNotifier{}
+	service := NewService(repo, newMockPublisher(), logger, WithNotifier(notifier), WithDeletionRetention(time.Hour, 24*time.Hour))
+
+	u, err := service.CreateUser(context.Background(), &User{
+		Nickname: "johndoe",
+		Email:    "john@example.com",
+		Country:  "US",
+		Password: "secret123",
+	})
+	if err != nil {
+		t.Fatalf("Service.CreateUser() error = %v", err)
+	}
+	if _, err := service.UpdateUser(context.Background(), u.ID, &User{}, nil); err != nil {
+		t.Fatalf("Service.UpdateUser() without changes error = %v", err)
+	}
+	if _, err := service.UpdateUser(context.Background(), u.ID, &User{Nickname: "janedoe"}, []Field{FieldNickname}); err != nil {
+		t.Fatalf("Service.UpdateUser() error = %v", err)
+	}
+	if err := service.DeleteUser(context.Background(), u.ID); err != nil {
+		t.Fatalf("Service.DeleteUser() error = %v", err)
+	}
+	if err := service.DeleteUser(context.Background(), u.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Service.DeleteUser() of a deleted user error = %v, want ErrNotFound", err)
+	}
+	if _, err := service.RestoreUser(context.Background(), u.ID); err != nil {
+		t.Fatalf("Service.RestoreUser() error = %v", err)
+	}
+	if _, err := service.AssignRole(context.Background(), u.ID, RoleModerator); err != nil {
+		t.Fatalf("Service.AssignRole() error = %v", err)
+	}
+	if _, err := service.AssignRole(context.Background(), u.ID, RoleModerator); err != nil {
+		t.Fatalf("Service.AssignRole() of the same role error = %v", err)
+	}
+
+	// Retried units of work notify once, and only when they commit a change
+	want := []string{"created johndoe", "updated janedoe", "deleted janedoe", "created janedoe", "updated janedoe"}
+	if !reflect.DeepEqual(notifier.changes, want) {
+		t.Errorf("notified changes = %v, want %v", notifier.changes, want)
+	}
+}
+
+// retryingRepository runs every unit of work twice and undoes the first
+// attempt, like a transaction retried after a serialization failure
+type retryingRepository struct {
+	*mockRepository
+}
+
+func (r *retryingRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error {
+	snapshot := make(map[uuid.UUID]*User, len(r.users))
+	for id, u := range r.users {
+		copied := *u
+		snapshot[id] = &copied
+	}
+	_ = fn(ctx, r)
+	r.users = snapshot
+	return r.mockRepository.WithTx(ctx, func(ctx context.Context, _ Repository) error {
+		return fn(ctx, r)
+	})
+}
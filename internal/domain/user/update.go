@@ -0,0 +1,60 @@
+package user
+
+import "net/mail"
+
+// Field names a user attribute that UpdateUser can change
+type Field string
+
+const (
+	FieldFirstName Field = "first_name"
+	FieldLastName  Field = "last_name"
+	FieldNickname  Field = "nickname"
+	FieldEmail     Field = "email"
+	FieldCountry   Field = "country"
+)
+
+// UpdatableFields lists every Field, in the order a full replacement sets them
+var UpdatableFields = []Field{FieldFirstName, FieldLastName, FieldNickname, FieldEmail, FieldCountry}
+
+// IsUpdatable reports whether f can be changed through UpdateUser
+func (f Field) IsUpdatable() bool {
+	for _, updatable := range UpdatableFields {
+		if f == updatable {
+			return true
+		}
+	}
+	return false
+}
+
+// validateChanges checks the fields of changes listed in fields, reporting
+// every problem at once. First and last name are optional and may be cleared;
+// nickname, email and country are required.
+func validateChanges(changes *User, fields []Field) error {
+	var errs []error
+	seen := make(map[Field]bool, len(fields))
+	for _, field := range fields {
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+
+		switch field {
+		case FieldFirstName, FieldLastName:
+		case FieldNickname:
+			if changes.Nickname == "" {
+				errs = append(errs, NewValidationError(string(field), "must not be empty"))
+			}
+		case FieldEmail:
+			if address, err := mail.ParseAddress(changes.Email); err != nil || address.Address != changes.Email {
+				errs = append(errs, NewValidationError(string(field), "must be a valid email address"))
+			}
+		case FieldCountry:
+			if len(changes.Country) != 2 {
+				errs = append(errs, NewValidationError(string(field), "must be an ISO 3166-1 alpha-2 code"))
+			}
+		default:
+			errs = append(errs, NewValidationError(string(field), "is not an updatable field"))
+		}
+	}
+	return JoinValidationErrors(errs...)
+}
@@ -7,13 +7,18 @@ import (
 )
 
 type User struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	FirstName string    `json:"first_name" db:"first_name"`
-	LastName  string    `json:"last_name" db:"last_name"`
-	Nickname  string    `json:"nickname" db:"nickname"`
-	Password  string    `json:"-" db:"password_hash"`
-	Email     string    `json:"email" db:"email"`
-	Country   string    `json:"country" db:"country"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID        uuid.UUID  `json:"id" db:"id"`
+	FirstName string     `json:"first_name" db:"first_name"`
+	LastName  string     `json:"last_name" db:"last_name"`
+	Nickname  string     `json:"nickname" db:"nickname"`
+	Password  string     `json:"-" db:"password_hash"`
+	Email     string     `json:"email" db:"email"`
+	Country   string     `json:"country" db:"country"`
+	Role      Role       `json:"role" db:"role"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	BannedAt  *time.Time `json:"banned_at,omitempty" db:"banned_at"` // Banned users cannot log in
+	BanReason string     `json:"ban_reason,omitempty" db:"ban_reason"`
+	Version   int64      `json:"version" db:"version"` // Incremented by every change
 }
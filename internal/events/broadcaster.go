@@ -0,0 +1,205 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+var (
+	// ErrResumeExpired is returned when subscribing after a token that is
+	// malformed, from another process, or older than the buffered changes
+	ErrResumeExpired = errors.New("resume token is unknown or expired")
+	// ErrSlowConsumer is the reason a subscription was dropped for not
+	// keeping up with the changes
+	ErrSlowConsumer = errors.New("subscriber fell too far behind")
+	// ErrBroadcasterClosed is the reason subscriptions end when the
+	// broadcaster is closed, and the error of subscribing afterwards
+	ErrBroadcasterClosed = errors.New("broadcaster closed")
+)
+
+// Notification is an event broadcast to the subscribers of a Broadcaster
+type Notification struct {
+	Token string // Resumes a subscription right after this notification
+	Event *Event
+}
+
+// Broadcaster implements user.Notifier by sending the created, updated and
+// deleted events of users to the subscribers in this process. The most recent
+// events are kept in a ring buffer, so that a subscriber reconnecting with the
+// token of the last notification it saw gets the ones it missed.
+type Broadcaster struct {
+	mu               sync.Mutex
+	epoch            string         // Tells tokens of this process from those of an earlier one
+	seq              uint64         // Sequence number of the latest notification
+	ring             []Notification // Notification n is at index (n-1) % len(ring)
+	buffered         int            // Number of notifications in ring
+	subscribers      map[*Subscription]struct{}
+	subscriberBuffer int
+	closed           bool
+}
+
+// NewBroadcaster creates a broadcaster keeping cfg.BufferSize notifications
+// for resuming subscribers, dropping those falling more than
+// cfg.SubscriberBuffer notifications behind
+func NewBroadcaster(cfg *config.WatchConfig) *Broadcaster {
+	epoch := make([]byte, 4)
+	_, _ = rand.Read(epoch)
+
+	return &Broadcaster{
+		epoch:            hex.EncodeToString(epoch),
+		ring:             make([]Notification, max(cfg.BufferSize, 1)),
+		subscribers:      make(map[*Subscription]struct{}),
+		subscriberBuffer: max(cfg.SubscriberBuffer, 1),
+	}
+}
+
+func (b *Broadcaster) NotifyCreated(User *user.User) {
+	b.broadcast(newUserEvent(User, EventTypeCreated))
+}
+
+func (b *Broadcaster) NotifyUpdated(User *user.User) {
+	b.broadcast(newUserEvent(User, EventTypeUpdated))
+}
+
+func (b *Broadcaster) NotifyDeleted(User *user.User) {
+	b.broadcast(newUserEvent(User, EventTypeDeleted))
+}
+
+// broadcast buffers event and sends it to the subscribers it matches, never
+// blocking: subscribers whose buffer is full are dropped instead
+func (b *Broadcaster) broadcast(event *Event) {
+	// The caller keeps its user, so subscribers get a copy that stays as it was
+	u := *event.User
+	event.User = &u
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	n := Notification{Token: b.token(b.seq), Event: event}
+	b.ring[(b.seq-1)%uint64(len(b.ring))] = n
+	b.buffered = min(b.buffered+1, len(b.ring))
+
+	for sub := range b.subscribers {
+		if !sub.match(event) {
+			continue
+		}
+		select {
+		case sub.ch <- n:
+		default:
+			b.drop(sub, ErrSlowConsumer)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events match accepts, or to all of
+// them if match is nil. With an after token the buffered events following it
+// are delivered first; without one only events broadcast from now on are.
+func (b *Broadcaster) Subscribe(after string, match func(*Event) bool) (*Subscription, error) {
+	if match == nil {
+		match = func(*Event) bool { return true }
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBroadcasterClosed
+	}
+	var backlog []Notification
+	if after != "" {
+		seq, ok := b.parseToken(after)
+		oldest := b.seq - uint64(b.buffered) // Latest notification before the buffered ones
+		if !ok || seq > b.seq || seq < oldest {
+			return nil, ErrResumeExpired
+		}
+		for n := seq + 1; n <= b.seq; n++ {
+			if notification := b.ring[(n-1)%uint64(len(b.ring))]; match(notification.Event) {
+				backlog = append(backlog, notification)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		broadcaster: b,
+		ch:          make(chan Notification, len(backlog)+b.subscriberBuffer),
+		match:       match,
+	}
+	for _, n := range backlog {
+		sub.ch <- n
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// Close ends every subscription with ErrBroadcasterClosed, so that servers
+// can stop without waiting for their subscribers to leave
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.drop(sub, ErrBroadcasterClosed)
+	}
+}
+
+// drop ends sub, which must still be subscribed, for reason
+func (b *Broadcaster) drop(sub *Subscription, reason error) {
+	delete(b.subscribers, sub)
+	sub.err = reason
+	close(sub.ch)
+}
+
+func (b *Broadcaster) token(seq uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+func (b *Broadcaster) parseToken(token string) (uint64, bool) {
+	epoch, seq, found := strings.Cut(token, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// Subscription is a subscriber of a Broadcaster
+type Subscription struct {
+	broadcaster *Broadcaster
+	ch          chan Notification
+	match       func(*Event) bool
+	err         error
+}
+
+// Notifications returns the channel the notifications are delivered on. It
+// is closed when the subscription ends, after which Err tells why.
+func (s *Subscription) Notifications() <-chan Notification {
+	return s.ch
+}
+
+// Err returns ErrSlowConsumer if the subscription was dropped for falling
+// behind, ErrBroadcasterClosed if the broadcaster was closed, and nil while
+// it lasts or once it was closed itself
+func (s *Subscription) Err() error {
+	s.broadcaster.mu.Lock()
+	defer s.broadcaster.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	b := s.broadcaster
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[s]; ok {
+		b.drop(s, nil)
+	}
+}
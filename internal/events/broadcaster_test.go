@@ -0,0 +1,190 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// receive returns the notifications waiting on sub
+func receive(sub *Subscription) []Notification {
+	var received []Notification
+	for {
+		select {
+		case n, ok := <-sub.Notifications():
+			if !ok {
+				return received
+			}
+			received = append(received, n)
+		default:
+			return received
+		}
+	}
+}
+
+func TestBroadcaster_Subscribe(t *testing.T) {
+	b := NewBroadcaster(&config.WatchConfig{BufferSize: 10, SubscriberBuffer: 10})
+	all, err := b.Subscribe("", nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer all.Close()
+	german, err := b.Subscribe("", func(e *Event) bool { return e.User.Country == "DE" })
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer german.Close()
+
+	u := &user.User{ID: uuid.New(), Nickname: "johndoe", Country: "DE"}
+	b.NotifyCreated(u)
+	u.Country = "FR"
+	b.NotifyUpdated(u)
+	b.NotifyDeleted(u)
+
+	got := receive(all)
+	if len(got) != 3 {
+		t.Fatalf("Got %d notifications, want 3", len(got))
+	}
+	wantTypes := []EventType{EventTypeCreated, EventTypeUpdated, EventTypeDeleted}
+	for i, n := range got {
+		if n.Event.Type != wantTypes[i] {
+			t.Errorf("Notification %d has type %s, want %s", i, n.Event.Type, wantTypes[i])
+		}
+	}
+	if got[0].Event.User.Country != "DE" {
+		t.Error("Notified user changed along with the caller's user")
+	}
+
+	if got := receive(german); len(got) != 1 || got[0].Event.Type != EventTypeCreated {
+		t.Errorf("Filtered subscriber got %v, want only the created event", got)
+	}
+}
+
+// Restored users come back as created and role changes as updated, so
+// watchers keep track of both
+func TestBroadcaster_RestoreAndRoleChange(t *testing.T) {
+	b := NewBroadcaster(&config.WatchConfig{BufferSize: 10, SubscriberBuffer: 10})
+	sub, err := b.Subscribe("", nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer sub.Close()
+
+	u := &user.User{ID: uuid.New(), Nickname: "johndoe", Role: user.RolePlayer}
+	b.NotifyDeleted(u)
+	b.NotifyCreated(u) // Restored
+	u.Role = user.RoleModerator
+	b.NotifyUpdated(u) // Promoted
+
+	got := receive(sub)
+	wantTypes := []EventType{EventTypeDeleted, EventTypeCreated, EventTypeUpdated}
+	if len(got) != len(wantTypes) {
+		t.Fatalf("Got %d notifications, want %d", len(got), len(wantTypes))
+	}
+	for i, n := range got {
+		if n.Event.Type != wantTypes[i] {
+			t.Errorf("Notification %d has type %s, want %s", i, n.Event.Type, wantTypes[i])
+		}
+	}
+	if got[1].Event.User.Role != user.RolePlayer || got[2].Event.User.Role != user.RoleModerator {
+		t.Errorf("Notified roles = %s, %s, want the role at each change", got[1].Event.User.Role, got[2].Event.User.Role)
+	}
+}
+
+func TestBroadcaster_Resume(t *testing.T) {
+	b := NewBroadcaster(&config.WatchConfig{BufferSize: 3, SubscriberBuffer: 10})
+	sub, err := b.Subscribe("", nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	u := &user.User{ID: uuid.New()}
+	b.NotifyCreated(u)
+	b.NotifyUpdated(u)
+	first := receive(sub)[0]
+	sub.Close()
+
+	b.NotifyUpdated(u)
+	b.NotifyDeleted(u)
+
+	resumed, err := b.Subscribe(first.Token, nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer resumed.Close()
+	got := receive(resumed)
+	if len(got) != 3 {
+		t.Fatalf("Got %d missed notifications, want 3", len(got))
+	}
+	if got[2].Event.Type != EventTypeDeleted {
+		t.Errorf("Last missed notification has type %s, want deleted", got[2].Event.Type)
+	}
+
+	b.NotifyCreated(u) // Pushes the first notification's successor out of the buffer
+	if _, err := b.Subscribe(first.Token, nil); !errors.Is(err, ErrResumeExpired) {
+		t.Errorf("Subscribe() with an overwritten token error = %v, want ErrResumeExpired", err)
+	}
+
+	other := NewBroadcaster(&config.WatchConfig{BufferSize: 3, SubscriberBuffer: 10})
+	for _, token := range []string{got[2].Token, "garbage"} {
+		if _, err := other.Subscribe(token, nil); !errors.Is(err, ErrResumeExpired) {
+			t.Errorf("Subscribe(%q) error = %v, want ErrResumeExpired", token, err)
+		}
+	}
+}
+
+func TestBroadcaster_SlowConsumer(t *testing.T) {
+	b := NewBroadcaster(&config.WatchConfig{BufferSize: 10, SubscriberBuffer: 2})
+	slow, err := b.Subscribe("", nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	u := &user.User{ID: uuid.New()}
+	for i := 0; i < 3; i++ {
+		b.NotifyUpdated(u)
+	}
+
+	if got := receive(slow); len(got) != 2 {
+		t.Errorf("Got %d notifications before the drop, want 2", len(got))
+	}
+	if _, ok := <-slow.Notifications(); ok {
+		t.Error("Notifications of a dropped subscriber are still open")
+	}
+	if !errors.Is(slow.Err(), ErrSlowConsumer) {
+		t.Errorf("Err() = %v, want ErrSlowConsumer", slow.Err())
+	}
+	slow.Close() // Closing a dropped subscription is harmless
+
+	closed, err := b.Subscribe("", nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	closed.Close()
+	if closed.Err() != nil {
+		t.Errorf("Err() of a closed subscription = %v, want nil", closed.Err())
+	}
+}
+
+func TestBroadcaster_Close(t *testing.T) {
+	b := NewBroadcaster(&config.WatchConfig{BufferSize: 10, SubscriberBuffer: 10})
+	sub, err := b.Subscribe("", nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	b.Close()
+	if _, ok := <-sub.Notifications(); ok {
+		t.Error("Notifications are still open after Close")
+	}
+	if !errors.Is(sub.Err(), ErrBroadcasterClosed) {
+		t.Errorf("Err() = %v, want ErrBroadcasterClosed", sub.Err())
+	}
+	if _, err := b.Subscribe("", nil); !errors.Is(err, ErrBroadcasterClosed) {
+		t.Errorf("Subscribe() after Close error = %v, want ErrBroadcasterClosed", err)
+	}
+	b.NotifyCreated(&user.User{ID: uuid.New()}) // Still buffers without subscribers
+}
@@ -0,0 +1,252 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	eventspb "github.com/bentalebwael/faceit-users-service/internal/api/grpc/gen/events"
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// Encodings of events on Kafka, selected with KAFKA_EVENT_ENCODING
+const (
+	EncodingJSON        = "json"        // The JSON form of the schema version
+	EncodingProtobuf    = "protobuf"    // The events.UserEvent message of proto/events/user_events.proto
+	EncodingCloudEvents = "cloudevents" // CloudEvents 1.0 in binary mode, with the JSON form as data
+)
+
+const (
+	contentTypeHeader   = "content-type"
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/x-protobuf"
+
+	// cloudEventTypePrefix prefixes the event type to make the CloudEvents type
+	cloudEventTypePrefix = "com.faceit.user."
+)
+
+// Encoder turns events into Kafka messages of one encoding and schema version
+type Encoder struct {
+	encoding string
+	version  string
+	source   string // CloudEvents source
+}
+
+// NewEncoder creates an encoder of the configured encoding and schema version
+func NewEncoder(cfg *config.KafkaConfig) (*Encoder, error) {
+	e := &Encoder{
+		encoding: cfg.EventEncoding,
+		version:  cfg.EventSchemaVersion,
+		source:   cfg.EventSource,
+	}
+	if e.encoding == "" {
+		e.encoding = EncodingJSON
+	}
+	if e.version == "" {
+		e.version = CurrentSchemaVersion
+	}
+
+	if _, err := lookupSchema(e.version); err != nil {
+		return nil, err
+	}
+	switch e.encoding {
+	case EncodingJSON:
+	case EncodingProtobuf:
+		if e.version == SchemaV1 {
+			return nil, fmt.Errorf("the protobuf encoding needs event schema version %s or later", SchemaV1_1)
+		}
+	case EncodingCloudEvents:
+		if e.source == "" {
+			return nil, fmt.Errorf("the cloudevents encoding needs an event source")
+		}
+	default:
+		return nil, fmt.Errorf("unknown event encoding %q", e.encoding)
+	}
+	return e, nil
+}
+
+// Encode turns event into a Kafka message keyed by the user ID, so all events
+// of a user go to one partition, in order. Every encoding sets the event-id,
+// event-type, event-schema-version and content-type headers.
+func (e *Encoder) Encode(event *Event) (kafka.Message, error) {
+	versioned := *event
+	versioned.Version = e.version
+
+	var value []byte
+	var err error
+	contentType := contentTypeJSON
+	if e.encoding == EncodingProtobuf {
+		value, err = proto.Marshal(toProtoEvent(&versioned))
+		contentType = contentTypeProtobuf
+	} else {
+		value, err = json.Marshal(versioned)
+	}
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+
+	key := event.ID
+	if event.User != nil {
+		key = event.User.ID.String()
+	}
+
+	msg := kafka.Message{
+		Key:   []byte(key),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(event.ID)},
+			{Key: "event-type", Value: []byte(event.Type)},
+			{Key: "event-schema-version", Value: []byte(versioned.Version)},
+			{Key: contentTypeHeader, Value: []byte(contentType)},
+		},
+	}
+	if e.encoding == EncodingCloudEvents {
+		msg.Headers = append(msg.Headers, e.cloudEventHeaders(event)...)
+	}
+	return msg, nil
+}
+
+// cloudEventHeaders returns the attributes of event as the headers of the
+// CloudEvents Kafka protocol binding in binary mode. The datacontenttype
+// attribute is the content-type header.
+func (e *Encoder) cloudEventHeaders(event *Event) []kafka.Header {
+	headers := []kafka.Header{
+		{Key: "ce_specversion", Value: []byte("1.0")},
+		{Key: "ce_id", Value: []byte(event.ID)},
+		{Key: "ce_source", Value: []byte(e.source)},
+		{Key: "ce_type", Value: []byte(cloudEventTypePrefix + string(event.Type))},
+		{Key: "ce_time", Value: []byte(event.Timestamp.UTC().Format(time.RFC3339Nano))},
+	}
+	if event.User != nil {
+		headers = append(headers, kafka.Header{Key: "ce_subject", Value: []byte(event.User.ID.String())})
+	}
+	return headers
+}
+
+// DecodeMessage decodes a user event from a Kafka message of any encoding and
+// known schema version
+func DecodeMessage(msg kafka.Message) (*Event, error) {
+	var event Event
+	for _, h := range msg.Headers {
+		if h.Key == contentTypeHeader && string(h.Value) == contentTypeProtobuf {
+			var pb eventspb.UserEvent
+			if err := proto.Unmarshal(msg.Value, &pb); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal event payload: %w", err)
+			}
+			return fromProtoEvent(&pb)
+		}
+	}
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event payload: %w", err)
+	}
+	return &event, nil
+}
+
+func toProtoEvent(e *Event) *eventspb.UserEvent {
+	pb := &eventspb.UserEvent{
+		Id:               e.ID,
+		Type:             string(e.Type),
+		Timestamp:        timestamppb.New(e.Timestamp),
+		Version:          e.Version,
+		User:             toProtoUserState(e.User),
+		Before:           toProtoUserState(e.Before),
+		ChangedFields:    e.ChangedFields,
+		PreviousRole:     string(e.PreviousRole),
+		PreviousNickname: e.PreviousNickname,
+	}
+	if e.ResetExpiresAt != nil {
+		pb.ResetExpiresAt = timestamppb.New(*e.ResetExpiresAt)
+	}
+	return pb
+}
+
+func toProtoUserState(u *user.User) *eventspb.UserState {
+	if u == nil {
+		return nil
+	}
+	state := &eventspb.UserState{
+		Id:        u.ID.String(),
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Nickname:  u.Nickname,
+		Email:     u.Email,
+		Country:   u.Country,
+		Role:      string(u.Role),
+		CreatedAt: timestamppb.New(u.CreatedAt),
+		UpdatedAt: timestamppb.New(u.UpdatedAt),
+		BanReason: u.BanReason,
+		Version:   u.Version,
+	}
+	if u.DeletedAt != nil {
+		state.DeletedAt = timestamppb.New(*u.DeletedAt)
+	}
+	if u.BannedAt != nil {
+		state.BannedAt = timestamppb.New(*u.BannedAt)
+	}
+	return state
+}
+
+func fromProtoEvent(pb *eventspb.UserEvent) (*Event, error) {
+	after, err := fromProtoUserState(pb.User)
+	if err != nil {
+		return nil, err
+	}
+	before, err := fromProtoUserState(pb.Before)
+	if err != nil {
+		return nil, err
+	}
+	event := &Event{
+		Type:             EventType(pb.Type),
+		ID:               pb.Id,
+		User:             after,
+		Timestamp:        pb.Timestamp.AsTime(),
+		Version:          pb.Version,
+		Before:           before,
+		ChangedFields:    pb.ChangedFields,
+		PreviousRole:     user.Role(pb.PreviousRole),
+		PreviousNickname: pb.PreviousNickname,
+	}
+	if pb.ResetExpiresAt != nil {
+		expiresAt := pb.ResetExpiresAt.AsTime()
+		event.ResetExpiresAt = &expiresAt
+	}
+	return event, nil
+}
+
+func fromProtoUserState(state *eventspb.UserState) (*user.User, error) {
+	if state == nil {
+		return nil, nil
+	}
+	id, err := uuid.Parse(state.Id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID %q in event: %w", state.Id, err)
+	}
+	u := &user.User{
+		ID:        id,
+		FirstName: state.FirstName,
+		LastName:  state.LastName,
+		Nickname:  state.Nickname,
+		Email:     state.Email,
+		Country:   state.Country,
+		Role:      user.Role(state.Role),
+		CreatedAt: state.CreatedAt.AsTime(),
+		UpdatedAt: state.UpdatedAt.AsTime(),
+		BanReason: state.BanReason,
+		Version:   state.Version,
+	}
+	if state.DeletedAt != nil {
+		deletedAt := state.DeletedAt.AsTime()
+		u.DeletedAt = &deletedAt
+	}
+	if state.BannedAt != nil {
+		bannedAt := state.BannedAt.AsTime()
+		u.BannedAt = &bannedAt
+	}
+	return u, nil
+}
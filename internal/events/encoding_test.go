@@ -0,0 +1,190 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+)
+
+func messageHeader(msg kafka.Message, key string) (string, bool) {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+func TestNewEncoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.KafkaConfig
+		wantErr bool
+	}{
+		{name: "defaults", cfg: config.KafkaConfig{}},
+		{name: "json of version 1.0", cfg: config.KafkaConfig{EventEncoding: EncodingJSON, EventSchemaVersion: SchemaV1}},
+		{name: "protobuf", cfg: config.KafkaConfig{EventEncoding: EncodingProtobuf, EventSchemaVersion: SchemaV2}},
+		{name: "cloudevents", cfg: config.KafkaConfig{EventEncoding: EncodingCloudEvents, EventSource: "users"}},
+		{name: "unknown encoding", cfg: config.KafkaConfig{EventEncoding: "avro"}, wantErr: true},
+		{name: "unknown schema version", cfg: config.KafkaConfig{EventSchemaVersion: "2.1"}, wantErr: true},
+		{name: "protobuf of version 1.0", cfg: config.KafkaConfig{EventEncoding: EncodingProtobuf, EventSchemaVersion: SchemaV1}, wantErr: true},
+		{name: "cloudevents without source", cfg: config.KafkaConfig{EventEncoding: EncodingCloudEvents}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEncoder(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewEncoder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncoder_Encode(t *testing.T) {
+	for _, encoding := range []string{EncodingJSON, EncodingProtobuf, EncodingCloudEvents} {
+		t.Run(encoding, func(t *testing.T) {
+			encoder, err := NewEncoder(&config.KafkaConfig{EventEncoding: encoding, EventSource: "users"})
+			if err != nil {
+				t.Fatalf("NewEncoder() error = %v", err)
+			}
+			event := testUpdatedEvent()
+
+			msg, err := encoder.Encode(event)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if string(msg.Key) != event.User.ID.String() {
+				t.Errorf("message key = %s, want the user ID %s", msg.Key, event.User.ID)
+			}
+			for key, want := range map[string]string{
+				"event-id":             event.ID,
+				"event-type":           string(EventTypeUpdated),
+				"event-schema-version": CurrentSchemaVersion,
+			} {
+				if got, _ := messageHeader(msg, key); got != want {
+					t.Errorf("header %s = %q, want %q", key, got, want)
+				}
+			}
+
+			decoded, err := DecodeMessage(msg)
+			if err != nil {
+				t.Fatalf("DecodeMessage() error = %v", err)
+			}
+			if !reflect.DeepEqual(*decoded, *event) {
+				t.Errorf("DecodeMessage() = %+v, want %+v", decoded, event)
+			}
+		})
+	}
+}
+
+func TestEncoder_EncodeBannedUser(t *testing.T) {
+	encoder, err := NewEncoder(&config.KafkaConfig{EventEncoding: EncodingProtobuf})
+	if err != nil {
+		t.Fatalf("NewEncoder() error = %v", err)
+	}
+	event := testUpdatedEvent()
+	bannedAt := event.Timestamp
+	event.Type = EventTypeBanned
+	event.User.BannedAt = &bannedAt
+	event.User.BanReason = "cheating"
+
+	msg, err := encoder.Encode(event)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	decoded, err := DecodeMessage(msg)
+	if err != nil {
+		t.Fatalf("DecodeMessage() error = %v", err)
+	}
+	if !reflect.DeepEqual(*decoded, *event) {
+		t.Errorf("DecodeMessage() = %+v, want %+v", decoded, event)
+	}
+}
+
+func TestEncoder_EncodeOlderVersion(t *testing.T) {
+	encoder, err := NewEncoder(&config.KafkaConfig{EventSchemaVersion: SchemaV1})
+	if err != nil {
+		t.Fatalf("NewEncoder() error = %v", err)
+	}
+
+	msg, err := encoder.Encode(testUpdatedEvent())
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if got, _ := messageHeader(msg, "event-schema-version"); got != SchemaV1 {
+		t.Errorf("header event-schema-version = %q, want %q", got, SchemaV1)
+	}
+	decoded, err := DecodeMessage(msg)
+	if err != nil {
+		t.Fatalf("DecodeMessage() error = %v", err)
+	}
+	if decoded.Version != SchemaV1 || decoded.Before != nil {
+		t.Errorf("DecodeMessage() = %+v, want a version 1.0 event without before state", decoded)
+	}
+}
+
+func TestEncoder_CloudEventsHeaders(t *testing.T) {
+	encoder, err := NewEncoder(&config.KafkaConfig{EventEncoding: EncodingCloudEvents, EventSource: "faceit-users-service"})
+	if err != nil {
+		t.Fatalf("NewEncoder() error = %v", err)
+	}
+	event := testUpdatedEvent()
+
+	msg, err := encoder.Encode(event)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	for key, want := range map[string]string{
+		"ce_specversion": "1.0",
+		"ce_id":          event.ID,
+		"ce_source":      "faceit-users-service",
+		"ce_type":        "com.faceit.user.updated",
+		"ce_time":        "2024-05-01T13:00:00Z",
+		"ce_subject":     event.User.ID.String(),
+		"content-type":   "application/json",
+	} {
+		if got, ok := messageHeader(msg, key); !ok || got != want {
+			t.Errorf("header %s = %q, want %q", key, got, want)
+		}
+	}
+
+	// Binary mode leaves the data as the JSON encoding would write it
+	jsonMsg, err := (&Encoder{encoding: EncodingJSON, version: CurrentSchemaVersion}).Encode(event)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if string(msg.Value) != string(jsonMsg.Value) {
+		t.Errorf("data = %s, want the JSON event %s", msg.Value, jsonMsg.Value)
+	}
+}
+
+// Protobuf consumers built against an older proto/events/user_events.proto
+// skip the fields added since, so events with fields unknown to them decode
+func TestCompatibility_ProtobufUnknownFields(t *testing.T) {
+	encoder, err := NewEncoder(&config.KafkaConfig{EventEncoding: EncodingProtobuf})
+	if err != nil {
+		t.Fatalf("NewEncoder() error = %v", err)
+	}
+	event := testUpdatedEvent()
+	msg, err := encoder.Encode(event)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	// A field a later version of the message could add
+	msg.Value = protowire.AppendTag(msg.Value, 100, protowire.BytesType)
+	msg.Value = protowire.AppendString(msg.Value, "added later")
+
+	decoded, err := DecodeMessage(msg)
+	if err != nil {
+		t.Fatalf("DecodeMessage() error = %v", err)
+	}
+	if !reflect.DeepEqual(*decoded, *event) {
+		t.Errorf("DecodeMessage() = %+v, want %+v", decoded, event)
+	}
+}
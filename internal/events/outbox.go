@@ -0,0 +1,116 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// OutboxMessage is an event stored in the outbox until the relay delivers it
+type OutboxMessage struct {
+	ID          int64     `db:"id"`
+	AggregateID uuid.UUID `db:"aggregate_id"` // User the event belongs to
+	EventType   EventType `db:"event_type"`
+	Payload     []byte    `db:"payload"` // JSON encoded Event, of the schema version it was written with
+	Attempts    int       `db:"attempts"`
+	AvailableAt time.Time `db:"available_at"` // Earliest time of the next delivery attempt
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// OutboxStore persists outbox messages. Every method joins the transaction
+// carried by ctx, if any.
+type OutboxStore interface {
+	Enqueue(ctx context.Context, msg *OutboxMessage) error
+	// TryLock makes the caller the only relay claiming messages until its
+	// transaction ends
+	TryLock(ctx context.Context) (bool, error)
+	// Pending returns up to limit messages in insertion order, skipping users
+	// that have a message waiting for a retry after now
+	Pending(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error)
+	// Lease makes the messages unavailable until until, which holds back
+	// their users from Pending, so no other relay takes them meanwhile
+	Lease(ctx context.Context, ids []int64, until time.Time) error
+	Delete(ctx context.Context, id int64) error
+	Reschedule(ctx context.Context, id int64, attempts int, availableAt time.Time, lastErr string) error
+}
+
+// OutboxPublisher implements user.Publisher by writing events to the outbox
+// in the caller's transaction instead of sending them to Kafka directly
+type OutboxPublisher struct {
+	store OutboxStore
+}
+
+// NewOutboxPublisher creates a new publisher writing to the given outbox.
+func NewOutboxPublisher(store OutboxStore) *OutboxPublisher {
+	return &OutboxPublisher{
+		store: store,
+	}
+}
+
+func (p *OutboxPublisher) PublishCreatedUser(ctx context.Context, User *user.User) error {
+	return p.enqueue(ctx, newUserEvent(User, EventTypeCreated))
+}
+
+func (p *OutboxPublisher) PublishUpdatedUser(ctx context.Context, User *user.User, previous *user.User) error {
+	return p.enqueue(ctx, newUpdatedEvent(User, previous))
+}
+
+func (p *OutboxPublisher) PublishDeletedUser(ctx context.Context, User *user.User) error {
+	return p.enqueue(ctx, newUserEvent(User, EventTypeDeleted))
+}
+
+func (p *OutboxPublisher) PublishRestoredUser(ctx context.Context, User *user.User) error {
+	return p.enqueue(ctx, newUserEvent(User, EventTypeRestored))
+}
+
+func (p *OutboxPublisher) PublishPurgedUser(ctx context.Context, User *user.User) error {
+	return p.enqueue(ctx, newPurgedEvent(User))
+}
+
+func (p *OutboxPublisher) PublishPasswordChanged(ctx context.Context, User *user.User) error {
+	return p.enqueue(ctx, newUserEvent(User, EventTypePasswordChanged))
+}
+
+func (p *OutboxPublisher) PublishPasswordResetRequested(ctx context.Context, User *user.User, expiresAt time.Time) error {
+	return p.enqueue(ctx, newPasswordResetEvent(User, expiresAt))
+}
+
+func (p *OutboxPublisher) PublishUserBanned(ctx context.Context, User *user.User) error {
+	return p.enqueue(ctx, newUserEvent(User, EventTypeBanned))
+}
+
+func (p *OutboxPublisher) PublishRoleChanged(ctx context.Context, User *user.User, previousRole user.Role) error {
+	event := newUserEvent(User, EventTypeRoleChanged)
+	event.PreviousRole = previousRole
+	return p.enqueue(ctx, event)
+}
+
+func (p *OutboxPublisher) PublishNicknameChanged(ctx context.Context, User *user.User, previousNickname string) error {
+	event := newUserEvent(User, EventTypeNicknameChanged)
+	event.PreviousNickname = previousNickname
+	return p.enqueue(ctx, event)
+}
+
+func (p *OutboxPublisher) enqueue(ctx context.Context, event *Event) error {
+	payload, err := json.Marshal(*event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+
+	msg := &OutboxMessage{
+		AggregateID: event.User.ID,
+		EventType:   event.Type,
+		Payload:     payload,
+		AvailableAt: event.Timestamp,
+		CreatedAt:   event.Timestamp,
+	}
+	if err := p.store.Enqueue(ctx, msg); err != nil {
+		return fmt.Errorf("failed to enqueue event: %w", err)
+	}
+	return nil
+}
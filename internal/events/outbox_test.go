@@ -0,0 +1,177 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// mockOutboxStore keeps outbox messages in memory
+type mockOutboxStore struct {
+	messages map[int64]*OutboxMessage
+	nextID   int64
+	locked   bool // Simulates another relay holding the lock
+	lastErrs map[int64]string
+}
+
+func newMockOutboxStore() *mockOutboxStore {
+	return &mockOutboxStore{
+		messages: make(map[int64]*OutboxMessage),
+		lastErrs: make(map[int64]string),
+	}
+}
+
+func (m *mockOutboxStore) Enqueue(ctx context.Context, msg *OutboxMessage) error {
+	m.nextID++
+	msg.ID = m.nextID
+	stored := *msg
+	m.messages[msg.ID] = &stored
+	return nil
+}
+
+func (m *mockOutboxStore) TryLock(ctx context.Context) (bool, error) {
+	return !m.locked, nil
+}
+
+func (m *mockOutboxStore) Pending(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error) {
+	waiting := make(map[uuid.UUID]struct{})
+	for _, msg := range m.messages {
+		if msg.AvailableAt.After(now) {
+			waiting[msg.AggregateID] = struct{}{}
+		}
+	}
+
+	pending := make([]OutboxMessage, 0)
+	for _, msg := range m.messages {
+		if _, ok := waiting[msg.AggregateID]; !ok {
+			pending = append(pending, *msg)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (m *mockOutboxStore) Lease(ctx context.Context, ids []int64, until time.Time) error {
+	for _, id := range ids {
+		m.messages[id].AvailableAt = until
+	}
+	return nil
+}
+
+func (m *mockOutboxStore) Delete(ctx context.Context, id int64) error {
+	delete(m.messages, id)
+	return nil
+}
+
+func (m *mockOutboxStore) Reschedule(ctx context.Context, id int64, attempts int, availableAt time.Time, lastErr string) error {
+	msg := m.messages[id]
+	msg.Attempts = attempts
+	msg.AvailableAt = availableAt
+	m.lastErrs[id] = lastErr
+	return nil
+}
+
+func TestOutboxPublisher_PublishPurgedUser(t *testing.T) {
+	store := newMockOutboxStore()
+	publisher := NewOutboxPublisher(store)
+
+	testUser := &user.User{
+		ID:        uuid.New(),
+		FirstName: "John",
+		LastName:  "Doe",
+		Nickname:  "johndoe",
+		Email:     "john@example.com",
+		Version:   4,
+	}
+	if err := publisher.PublishPurgedUser(context.Background(), testUser); err != nil {
+		t.Fatalf("PublishPurgedUser() error = %v", err)
+	}
+
+	msg := store.messages[1]
+	for _, personal := range []string{"John", "Doe", "johndoe", "john@example.com"} {
+		if strings.Contains(string(msg.Payload), personal) {
+			t.Errorf("purged event carries %q of the erased user: %s", personal, msg.Payload)
+		}
+	}
+	var event Event
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		t.Fatalf("payload is not an event: %v", err)
+	}
+	if event.Type != EventTypePurged || event.User.ID != testUser.ID || event.User.Version != 4 || event.Timestamp.IsZero() {
+		t.Errorf("purged event = %+v, want the ID and version of %v", event, testUser.ID)
+	}
+}
+
+func TestOutboxPublisher(t *testing.T) {
+	store := newMockOutboxStore()
+	publisher := NewOutboxPublisher(store)
+
+	testUser := &user.User{
+		ID:       uuid.New(),
+		Nickname: "johndoe",
+		Email:    "john@example.com",
+		Role:     user.RoleModerator,
+	}
+
+	if err := publisher.PublishCreatedUser(context.Background(), testUser); err != nil {
+		t.Fatalf("PublishCreatedUser() error = %v", err)
+	}
+	if err := publisher.PublishRoleChanged(context.Background(), testUser, user.RolePlayer); err != nil {
+		t.Fatalf("PublishRoleChanged() error = %v", err)
+	}
+	if err := publisher.PublishNicknameChanged(context.Background(), testUser, "janedoe"); err != nil {
+		t.Fatalf("PublishNicknameChanged() error = %v", err)
+	}
+
+	if len(store.messages) != 3 {
+		t.Fatalf("outbox holds %d messages, want 3", len(store.messages))
+	}
+
+	tests := []struct {
+		id               int64
+		eventType        EventType
+		previousRole     user.Role
+		previousNickname string
+	}{
+		{id: 1, eventType: EventTypeCreated},
+		{id: 2, eventType: EventTypeRoleChanged, previousRole: user.RolePlayer},
+		{id: 3, eventType: EventTypeNicknameChanged, previousNickname: "janedoe"},
+	}
+
+	for _, tt := range tests {
+		msg := store.messages[tt.id]
+		if msg.AggregateID != testUser.ID {
+			t.Errorf("message %d aggregate ID = %v, want %v", tt.id, msg.AggregateID, testUser.ID)
+		}
+		if msg.EventType != tt.eventType {
+			t.Errorf("message %d event type = %v, want %v", tt.id, msg.EventType, tt.eventType)
+		}
+		if msg.AvailableAt.IsZero() {
+			t.Errorf("message %d is never available", tt.id)
+		}
+
+		var event Event
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			t.Fatalf("message %d payload is not an event: %v", tt.id, err)
+		}
+		if event.Type != tt.eventType || event.ID == "" || event.User.ID != testUser.ID {
+			t.Errorf("message %d payload = %+v, want a %s event for user %v", tt.id, event, tt.eventType, testUser.ID)
+		}
+		if event.PreviousRole != tt.previousRole {
+			t.Errorf("message %d previous role = %v, want %v", tt.id, event.PreviousRole, tt.previousRole)
+		}
+		if event.PreviousNickname != tt.previousNickname {
+			t.Errorf("message %d previous nickname = %v, want %v", tt.id, event.PreviousNickname, tt.previousNickname)
+		}
+	}
+}
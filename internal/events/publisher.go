@@ -2,7 +2,6 @@ package events
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -15,17 +14,35 @@ import (
 type EventType string
 
 const (
-	EventTypeCreated EventType = "created"
-	EventTypeUpdated EventType = "updated"
-	EventTypeDeleted EventType = "deleted"
+	EventTypeCreated         EventType = "created"
+	EventTypeUpdated         EventType = "updated"
+	EventTypeDeleted         EventType = "deleted"
+	EventTypeRestored        EventType = "restored"
+	EventTypePurged          EventType = "purged"
+	EventTypePasswordChanged EventType = "password_changed"
+	EventTypeRoleChanged     EventType = "role_changed"
+	EventTypeNicknameChanged EventType = "nickname_changed"
+	EventTypeBanned          EventType = "banned"
+
+	EventTypePasswordResetRequested EventType = "password_reset_requested"
 )
 
+// Event is a user event. Its JSON form is that of its schema Version, see
+// schema.go.
 type Event struct {
-	Type      EventType  `json:"type"`
-	ID        string     `json:"id"`        // Event ID
-	User      *user.User `json:"User"`      // Event payload
-	Timestamp time.Time  `json:"timestamp"` // When the event occurred
-	Version   string     `json:"version"`   // Event schema version
+	Type      EventType
+	ID        string     // Event ID
+	User      *user.User // Event payload, the user after the event
+	Timestamp time.Time  // When the event occurred
+	Version   string     // Event schema version
+
+	Before        *user.User // User before an updated event, if known
+	ChangedFields []string   // JSON names of the fields an updated event changed
+
+	PreviousRole     user.Role // Role before a role_changed event
+	PreviousNickname string    // Nickname before a nickname_changed event
+
+	ResetExpiresAt *time.Time // When the token of a password_reset_requested event expires
 }
 
 // KafkaWriter interface defines the methods we need from kafka.Writer
@@ -35,14 +52,31 @@ type KafkaWriter interface {
 }
 
 type UserEventPublisher struct {
-	writer KafkaWriter
+	writer  KafkaWriter
+	encoder *Encoder
+}
+
+// PublisherOption configures a UserEventPublisher
+type PublisherOption func(*UserEventPublisher)
+
+// WithEncoder makes the publisher encode events with encoder instead of as
+// JSON of the current schema version
+func WithEncoder(encoder *Encoder) PublisherOption {
+	return func(p *UserEventPublisher) {
+		p.encoder = encoder
+	}
 }
 
 // NewUserEventPublisher creates a new Kafka event publisher for user events.
-func NewUserEventPublisher(writer KafkaWriter) *UserEventPublisher {
-	return &UserEventPublisher{
-		writer: writer,
+func NewUserEventPublisher(writer KafkaWriter, opts ...PublisherOption) *UserEventPublisher {
+	p := &UserEventPublisher{
+		writer:  writer,
+		encoder: &Encoder{encoding: EncodingJSON, version: CurrentSchemaVersion},
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
 func (p *UserEventPublisher) PublishCreatedUser(ctx context.Context, User *user.User) error {
@@ -50,8 +84,8 @@ func (p *UserEventPublisher) PublishCreatedUser(ctx context.Context, User *user.
 	return p.Publish(ctx, event)
 }
 
-func (p *UserEventPublisher) PublishUpdatedUser(ctx context.Context, User *user.User) error {
-	event := p.createUserEvent(User, EventTypeUpdated)
+func (p *UserEventPublisher) PublishUpdatedUser(ctx context.Context, User *user.User, previous *user.User) error {
+	event := newUpdatedEvent(User, previous)
 	return p.Publish(ctx, event)
 }
 
@@ -60,31 +94,111 @@ func (p *UserEventPublisher) PublishDeletedUser(ctx context.Context, User *user.
 	return p.Publish(ctx, event)
 }
 
-// Publish sends a user event to the message broker, implementing the user.Publisher interface.
+func (p *UserEventPublisher) PublishRestoredUser(ctx context.Context, User *user.User) error {
+	event := p.createUserEvent(User, EventTypeRestored)
+	return p.Publish(ctx, event)
+}
+
+func (p *UserEventPublisher) PublishPurgedUser(ctx context.Context, User *user.User) error {
+	event := newPurgedEvent(User)
+	return p.Publish(ctx, event)
+}
+
+func (p *UserEventPublisher) PublishPasswordChanged(ctx context.Context, User *user.User) error {
+	event := p.createUserEvent(User, EventTypePasswordChanged)
+	return p.Publish(ctx, event)
+}
+
+func (p *UserEventPublisher) PublishPasswordResetRequested(ctx context.Context, User *user.User, expiresAt time.Time) error {
+	event := newPasswordResetEvent(User, expiresAt)
+	return p.Publish(ctx, event)
+}
+
+func (p *UserEventPublisher) PublishUserBanned(ctx context.Context, User *user.User) error {
+	event := p.createUserEvent(User, EventTypeBanned)
+	return p.Publish(ctx, event)
+}
+
+func (p *UserEventPublisher) PublishRoleChanged(ctx context.Context, User *user.User, previousRole user.Role) error {
+	event := p.createUserEvent(User, EventTypeRoleChanged)
+	event.PreviousRole = previousRole
+	return p.Publish(ctx, event)
+}
+
+func (p *UserEventPublisher) PublishNicknameChanged(ctx context.Context, User *user.User, previousNickname string) error {
+	event := p.createUserEvent(User, EventTypeNicknameChanged)
+	event.PreviousNickname = previousNickname
+	return p.Publish(ctx, event)
+}
+
+// Publish sends a user event to the message broker in the encoding and schema
+// version of the publisher's encoder, whatever version the event was created with.
 func (p *UserEventPublisher) Publish(ctx context.Context, event *Event) error {
-	payload, err := json.Marshal(*event)
+	msg, err := p.encoder.Encode(event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event payload: %w", err)
-	}
-
-	msg := kafka.Message{
-		Key:   []byte(event.ID),
-		Value: payload,
-		Headers: []kafka.Header{
-			{Key: "event-id", Value: []byte(event.ID)},
-			{Key: "event-type", Value: []byte(event.Type)},
-			{Key: "event-schema-version", Value: []byte(event.Version)},
-		},
+		return fmt.Errorf("failed to encode event: %w", err)
 	}
 	return p.writer.WriteMessages(ctx, msg)
 }
 
 func (p *UserEventPublisher) createUserEvent(User *user.User, eventType EventType) *Event {
+	return newUserEvent(User, eventType)
+}
+
+func newUserEvent(User *user.User, eventType EventType) *Event {
 	return &Event{
 		Type:      eventType,
 		ID:        uuid.New().String(),
 		User:      User,
 		Timestamp: time.Now().UTC(),
-		Version:   "1.0", // Event schema version
+		Version:   CurrentSchemaVersion,
+	}
+}
+
+// newPurgedEvent creates a purged event carrying only the ID and version of
+// the user, whose personal data the purge or erasure removes
+func newPurgedEvent(User *user.User) *Event {
+	return newUserEvent(&user.User{ID: User.ID, Version: User.Version}, EventTypePurged)
+}
+
+// newPasswordResetEvent creates a password_reset_requested event carrying only
+// the user ID and when the token expires. The token is delivered by the
+// ResetTokenSender and never part of an event.
+func newPasswordResetEvent(User *user.User, expiresAt time.Time) *Event {
+	event := newUserEvent(&user.User{ID: User.ID}, EventTypePasswordResetRequested)
+	event.ResetExpiresAt = &expiresAt
+	return event
+}
+
+// newUpdatedEvent creates an updated event, carrying the state before and the
+// changed fields when the previous state of the user is known
+func newUpdatedEvent(User *user.User, previous *user.User) *Event {
+	event := newUserEvent(User, EventTypeUpdated)
+	if previous != nil {
+		event.Before = previous
+		event.ChangedFields = changedFields(previous, User)
+	}
+	return event
+}
+
+// changedFields returns the JSON names of the fields of a user that differ
+// between before and after, ignoring the bookkeeping ones such as version
+func changedFields(before, after *user.User) []string {
+	var changed []string
+	for _, f := range []struct {
+		name          string
+		before, after string
+	}{
+		{"first_name", before.FirstName, after.FirstName},
+		{"last_name", before.LastName, after.LastName},
+		{"nickname", before.Nickname, after.Nickname},
+		{"email", before.Email, after.Email},
+		{"country", before.Country, after.Country},
+		{"role", string(before.Role), string(after.Role)},
+	} {
+		if f.before != f.after {
+			changed = append(changed, f.name)
+		}
 	}
+	return changed
 }
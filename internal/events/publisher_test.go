@@ -3,6 +3,7 @@ package events
 import (
 	"context"
 	"encoding/json"
+	"reflect"
 	"testing"
 	"time"
 
@@ -15,10 +16,18 @@ import (
 // mockKafkaWriter simulates a Kafka writer for testing
 type mockKafkaWriter struct {
 	messages []kafka.Message
+	fail     func(msg kafka.Message) error // Rejects a message when it returns an error
 }
 
 func (m *mockKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
-	m.messages = append(m.messages, msgs...)
+	for _, msg := range msgs {
+		if m.fail != nil {
+			if err := m.fail(msg); err != nil {
+				return err
+			}
+		}
+		m.messages = append(m.messages, msg)
+	}
 	return nil
 }
 
@@ -83,8 +92,8 @@ func TestUserEventPublisher_createUserEvent(t *testing.T) {
 			if event.Timestamp.IsZero() {
 				t.Error("createUserEvent() timestamp is zero")
 			}
-			if event.Version != "1.0" {
-				t.Errorf("createUserEvent() version = %v, want 1.0", event.Version)
+			if event.Version != "1.1" {
+				t.Errorf("createUserEvent() version = %v, want 1.1", event.Version)
 			}
 		})
 	}
@@ -133,9 +142,9 @@ func TestUserEventPublisher_Publish(t *testing.T) {
 				// Verify the last message
 				lastMsg := mockWriter.messages[len(mockWriter.messages)-1]
 
-				// Check message key
-				if string(lastMsg.Key) != tt.event.ID {
-					t.Errorf("Message key = %s, want %s", string(lastMsg.Key), tt.event.ID)
+				// Check message key is the user ID so a user's events stay ordered
+				if string(lastMsg.Key) != tt.event.User.ID.String() {
+					t.Errorf("Message key = %s, want %s", string(lastMsg.Key), tt.event.User.ID)
 				}
 
 				// Check headers
@@ -156,8 +165,9 @@ func TestUserEventPublisher_Publish(t *testing.T) {
 						}
 					case "event-schema-version":
 						hasVersion = true
-						if string(h.Value) != tt.event.Version {
-							t.Errorf("Header event-schema-version = %s, want %s", string(h.Value), tt.event.Version)
+						// Events are published in the default schema version, whatever version they were created with
+						if string(h.Value) != "1.1" {
+							t.Errorf("Header event-schema-version = %s, want 1.1", string(h.Value))
 						}
 					}
 				}
@@ -216,16 +226,26 @@ func TestUserEventPublisher_PublishMethods(t *testing.T) {
 			method:   publisher.PublishCreatedUser,
 			wantType: EventTypeCreated,
 		},
-		{
-			name:     "publish updated user",
-			method:   publisher.PublishUpdatedUser,
-			wantType: EventTypeUpdated,
-		},
 		{
 			name:     "publish deleted user",
 			method:   publisher.PublishDeletedUser,
 			wantType: EventTypeDeleted,
 		},
+		{
+			name:     "publish restored user",
+			method:   publisher.PublishRestoredUser,
+			wantType: EventTypeRestored,
+		},
+		{
+			name:     "publish purged user",
+			method:   publisher.PublishPurgedUser,
+			wantType: EventTypePurged,
+		},
+		{
+			name:     "publish password changed",
+			method:   publisher.PublishPasswordChanged,
+			wantType: EventTypePasswordChanged,
+		},
 	}
 
 	for _, tt := range tests {
@@ -260,3 +280,171 @@ func TestUserEventPublisher_PublishMethods(t *testing.T) {
 		})
 	}
 }
+
+func TestUserEventPublisher_PublishUpdatedUser(t *testing.T) {
+	mockWriter := newMockKafkaWriter()
+	publisher := NewUserEventPublisher(mockWriter)
+
+	previous := &user.User{ID: uuid.New(), Nickname: "johndoe", Country: "US", Role: user.RolePlayer}
+	updated := *previous
+	updated.Nickname = "johnsmith"
+	updated.Country = "UK"
+
+	if err := publisher.PublishUpdatedUser(context.Background(), &updated, previous); err != nil {
+		t.Fatalf("PublishUpdatedUser() error = %v", err)
+	}
+	if err := publisher.PublishUpdatedUser(context.Background(), &updated, nil); err != nil {
+		t.Fatalf("PublishUpdatedUser() error = %v", err)
+	}
+	if len(mockWriter.messages) != 2 {
+		t.Fatalf("published %d messages, want 2", len(mockWriter.messages))
+	}
+
+	var event Event
+	if err := json.Unmarshal(mockWriter.messages[0].Value, &event); err != nil {
+		t.Fatalf("Failed to decode message payload: %v", err)
+	}
+	if event.Type != EventTypeUpdated || event.User.Nickname != "johnsmith" {
+		t.Errorf("Event = %+v, want an updated event for johnsmith", event)
+	}
+	if event.Before == nil || event.Before.Nickname != "johndoe" {
+		t.Errorf("Before = %+v, want the user as johndoe", event.Before)
+	}
+	if !reflect.DeepEqual(event.ChangedFields, []string{"nickname", "country"}) {
+		t.Errorf("Changed fields = %v, want [nickname country]", event.ChangedFields)
+	}
+
+	// Without the previous state, as when republishing, there is nothing to compare
+	event = Event{}
+	if err := json.Unmarshal(mockWriter.messages[1].Value, &event); err != nil {
+		t.Fatalf("Failed to decode message payload: %v", err)
+	}
+	if event.Before != nil || event.ChangedFields != nil {
+		t.Errorf("Event = %+v, want no before state or changed fields", event)
+	}
+}
+
+func TestUserEventPublisher_PublishRoleChanged(t *testing.T) {
+	mockWriter := newMockKafkaWriter()
+	publisher := NewUserEventPublisher(mockWriter)
+
+	testUser := &user.User{
+		ID:   uuid.New(),
+		Role: user.RoleModerator,
+	}
+
+	if err := publisher.PublishRoleChanged(context.Background(), testUser, user.RolePlayer); err != nil {
+		t.Fatalf("PublishRoleChanged() error = %v", err)
+	}
+	if len(mockWriter.messages) != 1 {
+		t.Fatalf("published %d messages, want 1", len(mockWriter.messages))
+	}
+
+	var event Event
+	if err := json.Unmarshal(mockWriter.messages[0].Value, &event); err != nil {
+		t.Fatalf("Failed to decode message payload: %v", err)
+	}
+	if event.Type != EventTypeRoleChanged {
+		t.Errorf("Event type = %v, want %v", event.Type, EventTypeRoleChanged)
+	}
+	if event.PreviousRole != user.RolePlayer {
+		t.Errorf("Previous role = %v, want %v", event.PreviousRole, user.RolePlayer)
+	}
+	if event.User.Role != user.RoleModerator {
+		t.Errorf("User role = %v, want %v", event.User.Role, user.RoleModerator)
+	}
+}
+
+func TestUserEventPublisher_PublishNicknameChanged(t *testing.T) {
+	mockWriter := newMockKafkaWriter()
+	publisher := NewUserEventPublisher(mockWriter)
+
+	testUser := &user.User{
+		ID:       uuid.New(),
+		Nickname: "new_nick",
+	}
+
+	if err := publisher.PublishNicknameChanged(context.Background(), testUser, "old_nick"); err != nil {
+		t.Fatalf("PublishNicknameChanged() error = %v", err)
+	}
+	if len(mockWriter.messages) != 1 {
+		t.Fatalf("published %d messages, want 1", len(mockWriter.messages))
+	}
+
+	var event Event
+	if err := json.Unmarshal(mockWriter.messages[0].Value, &event); err != nil {
+		t.Fatalf("Failed to decode message payload: %v", err)
+	}
+	if event.Type != EventTypeNicknameChanged {
+		t.Errorf("Event type = %v, want %v", event.Type, EventTypeNicknameChanged)
+	}
+	if event.PreviousNickname != "old_nick" {
+		t.Errorf("Previous nickname = %v, want old_nick", event.PreviousNickname)
+	}
+	if event.User.Nickname != "new_nick" {
+		t.Errorf("User nickname = %v, want new_nick", event.User.Nickname)
+	}
+}
+
+func TestUserEventPublisher_PublishPasswordResetRequested(t *testing.T) {
+	mockWriter := newMockKafkaWriter()
+	publisher := NewUserEventPublisher(mockWriter)
+
+	testUser := &user.User{
+		ID:    uuid.New(),
+		Email: "john@example.com",
+	}
+	expiresAt := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+
+	if err := publisher.PublishPasswordResetRequested(context.Background(), testUser, expiresAt); err != nil {
+		t.Fatalf("PublishPasswordResetRequested() error = %v", err)
+	}
+	if len(mockWriter.messages) != 1 {
+		t.Fatalf("published %d messages, want 1", len(mockWriter.messages))
+	}
+
+	var event Event
+	if err := json.Unmarshal(mockWriter.messages[0].Value, &event); err != nil {
+		t.Fatalf("Failed to decode message payload: %v", err)
+	}
+	if event.Type != EventTypePasswordResetRequested {
+		t.Errorf("Event type = %v, want %v", event.Type, EventTypePasswordResetRequested)
+	}
+	if event.ResetExpiresAt == nil || !event.ResetExpiresAt.Equal(expiresAt) {
+		t.Errorf("Reset expires at = %v, want %v", event.ResetExpiresAt, expiresAt)
+	}
+	// Only the user ID, as the topic is read by many services
+	if event.User.ID != testUser.ID || event.User.Email != "" {
+		t.Errorf("Event user = %+v, want only the ID %s", event.User, testUser.ID)
+	}
+}
+
+func TestUserEventPublisher_PublishUserBanned(t *testing.T) {
+	mockWriter := newMockKafkaWriter()
+	publisher := NewUserEventPublisher(mockWriter)
+
+	bannedAt := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	testUser := &user.User{
+		ID:        uuid.New(),
+		BannedAt:  &bannedAt,
+		BanReason: "cheating",
+	}
+
+	if err := publisher.PublishUserBanned(context.Background(), testUser); err != nil {
+		t.Fatalf("PublishUserBanned() error = %v", err)
+	}
+	if len(mockWriter.messages) != 1 {
+		t.Fatalf("published %d messages, want 1", len(mockWriter.messages))
+	}
+
+	var event Event
+	if err := json.Unmarshal(mockWriter.messages[0].Value, &event); err != nil {
+		t.Fatalf("Failed to decode message payload: %v", err)
+	}
+	if event.Type != EventTypeBanned {
+		t.Errorf("Event type = %v, want %v", event.Type, EventTypeBanned)
+	}
+	if event.User.BannedAt == nil || !event.User.BannedAt.Equal(bannedAt) || event.User.BanReason != "cheating" {
+		t.Errorf("User = %+v, want banned at %v for cheating", event.User, bannedAt)
+	}
+}
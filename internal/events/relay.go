@@ -0,0 +1,226 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// Relay drains the outbox into Kafka. Messages are deleted only after Kafka
+// acknowledged them, so delivery is at least once; consumers must tolerate
+// duplicates and can deduplicate on the event-id header.
+type Relay struct {
+	store     OutboxStore
+	tx        user.Transactor
+	publisher *UserEventPublisher
+	cfg       *config.OutboxConfig
+	logger    *slog.Logger
+}
+
+// NewRelay creates a relay publishing outbox messages through publisher
+func NewRelay(store OutboxStore, tx user.Transactor, publisher *UserEventPublisher, cfg *config.OutboxConfig, logger *slog.Logger) *Relay {
+	return &Relay{
+		store:     store,
+		tx:        tx,
+		publisher: publisher,
+		cfg:       cfg,
+		logger:    logger,
+	}
+}
+
+// Run relays pending messages on every tick until ctx is cancelled. A full
+// batch is followed by the next one right away to catch up on a backlog.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.RelayInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := r.RelayBatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.logger.Error("failed to relay outbox messages", "error", err)
+				}
+				break
+			}
+			if n < r.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes one batch of pending messages in insertion order and
+// returns how many were fetched. A failed message holds back the later
+// messages of its user until it is retried, so each user's events reach Kafka
+// in order.
+//
+// No transaction stays open while Kafka is written to: the batch is claimed
+// in one short transaction, published within OUTBOX_PUBLISH_TIMEOUT, and
+// settled in another.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	msgs, err := r.claim(ctx)
+	if err != nil || len(msgs) == 0 {
+		return len(msgs), err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.cfg.PublishTimeout)
+	defer cancel()
+
+	var result batchResult
+	blocked := make(map[uuid.UUID]struct{})
+	for i := range msgs {
+		msg := &msgs[i]
+		if _, ok := blocked[msg.AggregateID]; ok {
+			result.heldBack = append(result.heldBack, msg.ID)
+			continue
+		}
+
+		if err := r.publish(publishCtx, msg); err != nil {
+			blocked[msg.AggregateID] = struct{}{}
+			if ctx.Err() != nil {
+				// Stopping, which is no fault of the message
+				result.heldBack = append(result.heldBack, msg.ID)
+				continue
+			}
+			result.failed = append(result.failed, failedMessage{msg: msg, err: err})
+			continue
+		}
+		result.sent = append(result.sent, msg.ID)
+	}
+
+	// Settled even when stopping, so that messages Kafka acknowledged are
+	// not sent again
+	if err := r.settle(context.WithoutCancel(ctx), &result); err != nil {
+		return len(msgs), err
+	}
+	return len(msgs), nil
+}
+
+// batchResult is what became of the messages of a claimed batch
+type batchResult struct {
+	sent     []int64
+	failed   []failedMessage
+	heldBack []int64 // Not attempted, behind a failed message of their user
+}
+
+type failedMessage struct {
+	msg *OutboxMessage
+	err error
+}
+
+// claim fetches the next batch of pending messages and leases them for twice
+// the publish timeout, leaving time to settle them once published. Only one
+// relay across all instances claims at a time, and the users of leased
+// messages are held back from other claims, so no two relays ever publish
+// events of the same user at once. If the relay dies before settling, the
+// lease runs out and the messages are published again.
+func (r *Relay) claim(ctx context.Context) ([]OutboxMessage, error) {
+	var msgs []OutboxMessage
+	err := r.tx.WithinTx(ctx, func(ctx context.Context) error {
+		msgs = nil
+		locked, err := r.store.TryLock(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to lock outbox: %w", err)
+		}
+		if !locked {
+			return nil // Another relay is claiming messages
+		}
+
+		now := time.Now().UTC()
+		msgs, err = r.store.Pending(ctx, now, r.cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch outbox messages: %w", err)
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(msgs))
+		for i := range msgs {
+			ids[i] = msgs[i].ID
+		}
+		if err := r.store.Lease(ctx, ids, now.Add(2*r.cfg.PublishTimeout)); err != nil {
+			return fmt.Errorf("failed to lease outbox messages: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// settle deletes the sent messages, reschedules the failed ones and releases
+// those held back
+func (r *Relay) settle(ctx context.Context, result *batchResult) error {
+	return r.tx.WithinTx(ctx, func(ctx context.Context) error {
+		for _, id := range result.sent {
+			if err := r.store.Delete(ctx, id); err != nil {
+				return fmt.Errorf("failed to delete relayed outbox message: %w", err)
+			}
+		}
+		for _, f := range result.failed {
+			if err := r.reschedule(ctx, f.msg, f.err); err != nil {
+				return err
+			}
+		}
+		if len(result.heldBack) > 0 {
+			if err := r.store.Lease(ctx, result.heldBack, time.Now().UTC()); err != nil {
+				return fmt.Errorf("failed to release outbox messages: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Relay) publish(ctx context.Context, msg *OutboxMessage) error {
+	var event Event
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return fmt.Errorf("failed to unmarshal event payload: %w", err)
+	}
+	return r.publisher.Publish(ctx, &event)
+}
+
+func (r *Relay) reschedule(ctx context.Context, msg *OutboxMessage, cause error) error {
+	attempts := msg.Attempts + 1
+	delay := r.retryDelay(attempts)
+
+	r.logger.Warn("failed to relay outbox message, retrying later",
+		"error", cause,
+		"outbox_id", msg.ID,
+		"user_id", msg.AggregateID,
+		"attempts", attempts,
+		"retry_in", delay,
+	)
+
+	if err := r.store.Reschedule(ctx, msg.ID, attempts, time.Now().UTC().Add(delay), cause.Error()); err != nil {
+		return fmt.Errorf("failed to reschedule outbox message: %w", err)
+	}
+	return nil
+}
+
+// retryDelay doubles the base delay for every failed attempt, up to the maximum
+func (r *Relay) retryDelay(attempts int) time.Duration {
+	delay := r.cfg.RetryBaseDelay
+	for i := 1; i < attempts && delay < r.cfg.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.cfg.RetryMaxDelay {
+		delay = r.cfg.RetryMaxDelay
+	}
+	return delay
+}
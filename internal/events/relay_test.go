@@ -0,0 +1,239 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// mockTransactor runs functions without a transaction, noting while one
+// would be open
+type mockTransactor struct {
+	open bool
+}
+
+func (m *mockTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.open = true
+	defer func() { m.open = false }()
+	return fn(ctx)
+}
+
+func newTestRelay(store OutboxStore, writer KafkaWriter) *Relay {
+	cfg := &config.OutboxConfig{
+		RelayInterval:  10 * time.Millisecond,
+		BatchSize:      10,
+		RetryBaseDelay: time.Second,
+		RetryMaxDelay:  time.Minute,
+		PublishTimeout: time.Second,
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	return NewRelay(store, &mockTransactor{}, NewUserEventPublisher(writer), cfg, logger)
+}
+
+func enqueueEvents(t *testing.T, store OutboxStore, users ...*user.User) {
+	t.Helper()
+	publisher := NewOutboxPublisher(store)
+	for _, u := range users {
+		if err := publisher.PublishUpdatedUser(context.Background(), u, nil); err != nil {
+			t.Fatalf("PublishUpdatedUser() error = %v", err)
+		}
+	}
+}
+
+func TestRelay_RelayBatch(t *testing.T) {
+	alice := &user.User{ID: uuid.New(), Nickname: "alice"}
+	bob := &user.User{ID: uuid.New(), Nickname: "bob"}
+
+	t.Run("publishes in order and deletes relayed messages", func(t *testing.T) {
+		store := newMockOutboxStore()
+		writer := newMockKafkaWriter()
+		enqueueEvents(t, store, alice, bob, alice)
+
+		n, err := newTestRelay(store, writer).RelayBatch(context.Background())
+		if err != nil {
+			t.Fatalf("RelayBatch() error = %v", err)
+		}
+		if n != 3 {
+			t.Errorf("RelayBatch() fetched %d messages, want 3", n)
+		}
+		if len(store.messages) != 0 {
+			t.Errorf("outbox still holds %d messages, want 0", len(store.messages))
+		}
+
+		wantKeys := []string{alice.ID.String(), bob.ID.String(), alice.ID.String()}
+		if len(writer.messages) != len(wantKeys) {
+			t.Fatalf("published %d messages, want %d", len(writer.messages), len(wantKeys))
+		}
+		for i, want := range wantKeys {
+			if got := string(writer.messages[i].Key); got != want {
+				t.Errorf("message %d key = %s, want %s", i, got, want)
+			}
+		}
+	})
+
+	t.Run("failure holds back later events of the same user only", func(t *testing.T) {
+		store := newMockOutboxStore()
+		writer := newMockKafkaWriter()
+		writer.fail = func(msg kafka.Message) error {
+			if string(msg.Key) == alice.ID.String() {
+				return errors.New("broker unavailable")
+			}
+			return nil
+		}
+		enqueueEvents(t, store, alice, bob, alice)
+		relay := newTestRelay(store, writer)
+
+		if _, err := relay.RelayBatch(context.Background()); err != nil {
+			t.Fatalf("RelayBatch() error = %v", err)
+		}
+
+		if len(writer.messages) != 1 || string(writer.messages[0].Key) != bob.ID.String() {
+			t.Fatalf("published %v, want only bob's event", writer.messages)
+		}
+		if len(store.messages) != 2 {
+			t.Fatalf("outbox holds %d messages, want alice's 2", len(store.messages))
+		}
+
+		failed := store.messages[1]
+		if failed.Attempts != 1 {
+			t.Errorf("failed message attempts = %d, want 1", failed.Attempts)
+		}
+		if !failed.AvailableAt.After(time.Now()) {
+			t.Error("failed message was not rescheduled into the future")
+		}
+		if store.lastErrs[1] != "broker unavailable" {
+			t.Errorf("failed message last error = %q, want %q", store.lastErrs[1], "broker unavailable")
+		}
+		if store.messages[3].Attempts != 0 {
+			t.Error("message behind the failed one was attempted out of order")
+		}
+
+		// Alice stays blocked until her first event is due again
+		if n, _ := relay.RelayBatch(context.Background()); n != 0 {
+			t.Errorf("RelayBatch() fetched %d messages before the retry was due, want 0", n)
+		}
+
+		// Once the broker recovers and the retry is due both go out in order
+		writer.fail = nil
+		failed.AvailableAt = time.Now().Add(-time.Second)
+		if _, err := relay.RelayBatch(context.Background()); err != nil {
+			t.Fatalf("RelayBatch() error = %v", err)
+		}
+		if len(store.messages) != 0 {
+			t.Errorf("outbox still holds %d messages, want 0", len(store.messages))
+		}
+		if len(writer.messages) != 3 {
+			t.Errorf("published %d messages, want 3", len(writer.messages))
+		}
+	})
+
+	t.Run("publishes leased messages outside the transaction", func(t *testing.T) {
+		store := newMockOutboxStore()
+		writer := newMockKafkaWriter()
+		enqueueEvents(t, store, alice, bob)
+		relay := newTestRelay(store, writer)
+		tx := relay.tx.(*mockTransactor)
+
+		writer.fail = func(msg kafka.Message) error {
+			if tx.open {
+				t.Error("published while the outbox transaction was open")
+			}
+			for _, m := range store.messages {
+				if !m.AvailableAt.After(time.Now()) {
+					t.Errorf("message %d was not leased while being published", m.ID)
+				}
+			}
+			if n, _ := relay.RelayBatch(context.Background()); n != 0 {
+				t.Errorf("another relay fetched %d leased messages, want 0", n)
+			}
+			return nil
+		}
+
+		if _, err := relay.RelayBatch(context.Background()); err != nil {
+			t.Fatalf("RelayBatch() error = %v", err)
+		}
+		if len(writer.messages) != 2 || len(store.messages) != 0 {
+			t.Errorf("published %d and kept %d messages, want 2 and 0", len(writer.messages), len(store.messages))
+		}
+	})
+
+	t.Run("releases messages held back when stopping", func(t *testing.T) {
+		store := newMockOutboxStore()
+		writer := newMockKafkaWriter()
+		enqueueEvents(t, store, alice, alice)
+		ctx, cancel := context.WithCancel(context.Background())
+		writer.fail = func(msg kafka.Message) error {
+			cancel()
+			return context.Canceled
+		}
+
+		if _, err := newTestRelay(store, writer).RelayBatch(ctx); err != nil {
+			t.Fatalf("RelayBatch() error = %v", err)
+		}
+		for _, msg := range store.messages {
+			if msg.Attempts != 0 || msg.AvailableAt.After(time.Now()) {
+				t.Errorf("message %d has %d attempts and is available at %v, want it released untried", msg.ID, msg.Attempts, msg.AvailableAt)
+			}
+		}
+	})
+
+	t.Run("skips when another relay holds the lock", func(t *testing.T) {
+		store := newMockOutboxStore()
+		store.locked = true
+		writer := newMockKafkaWriter()
+		enqueueEvents(t, store, alice)
+
+		n, err := newTestRelay(store, writer).RelayBatch(context.Background())
+		if err != nil {
+			t.Fatalf("RelayBatch() error = %v", err)
+		}
+		if n != 0 || len(writer.messages) != 0 {
+			t.Errorf("RelayBatch() fetched %d and published %d messages, want none", n, len(writer.messages))
+		}
+	})
+}
+
+func TestRelay_retryDelay(t *testing.T) {
+	relay := newTestRelay(newMockOutboxStore(), newMockKafkaWriter())
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 7, want: time.Minute},
+		{attempts: 100, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := relay.retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRelay_Run(t *testing.T) {
+	store := newMockOutboxStore()
+	writer := newMockKafkaWriter()
+	enqueueEvents(t, store, &user.User{ID: uuid.New()})
+
+	// The first batch is relayed before Run waits for a tick
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	newTestRelay(store, writer).Run(ctx)
+
+	if len(writer.messages) != 1 || len(store.messages) != 0 {
+		t.Errorf("published %d and kept %d messages, want 1 and 0", len(writer.messages), len(store.messages))
+	}
+}
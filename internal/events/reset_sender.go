@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// ResetTokenSender hands password reset tokens to the service mailing users
+// by writing them straight to a topic of their own, which only that service
+// may read. Unlike events they never go through the outbox, so no plain token
+// is ever stored in the database or published on the user events topic.
+type ResetTokenSender struct {
+	writer KafkaWriter
+}
+
+// NewResetTokenSender creates a sender writing reset tokens with writer
+func NewResetTokenSender(writer KafkaWriter) *ResetTokenSender {
+	return &ResetTokenSender{writer: writer}
+}
+
+// passwordReset is the JSON form of a reset token sent to the mailer
+type passwordReset struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SendPasswordReset writes reset for delivery to the email of User
+func (s *ResetTokenSender) SendPasswordReset(ctx context.Context, User *user.User, reset *user.PasswordReset) error {
+	value, err := json.Marshal(passwordReset{
+		UserID:    User.ID,
+		Email:     User.Email,
+		Token:     reset.Token,
+		ExpiresAt: reset.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal password reset: %w", err)
+	}
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(User.ID.String()),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: contentTypeHeader, Value: []byte(contentTypeJSON)},
+		},
+	})
+}
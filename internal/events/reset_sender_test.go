@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func TestResetTokenSender_SendPasswordReset(t *testing.T) {
+	writer := newMockKafkaWriter()
+	sender := NewResetTokenSender(writer)
+
+	testUser := &user.User{ID: uuid.New(), Email: "john@example.com"}
+	reset := &user.PasswordReset{
+		UserID:    testUser.ID,
+		Token:     "reset-token",
+		ExpiresAt: time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC),
+	}
+
+	if err := sender.SendPasswordReset(context.Background(), testUser, reset); err != nil {
+		t.Fatalf("SendPasswordReset() error = %v", err)
+	}
+	if len(writer.messages) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(writer.messages))
+	}
+	msg := writer.messages[0]
+	if string(msg.Key) != testUser.ID.String() {
+		t.Errorf("message key = %s, want the user ID %s", msg.Key, testUser.ID)
+	}
+
+	var sent passwordReset
+	if err := json.Unmarshal(msg.Value, &sent); err != nil {
+		t.Fatalf("Failed to decode message payload: %v", err)
+	}
+	want := passwordReset{UserID: testUser.ID, Email: "john@example.com", Token: "reset-token", ExpiresAt: reset.ExpiresAt}
+	if sent != want {
+		t.Errorf("sent %+v, want %+v", sent, want)
+	}
+}
@@ -0,0 +1,234 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// Schema versions of user events. A minor version only adds fields, so
+// consumers of an older minor version of the same major version keep decoding
+// its events; a new major version may rename or remove fields.
+const (
+	// SchemaV1 carries the user under a "User" key
+	SchemaV1 = "1.0"
+	// SchemaV1_1 adds the state before and the changed fields of updated events
+	SchemaV1_1 = "1.1"
+	// SchemaV2 carries the user under "user" instead, for consumers that have
+	// moved to it
+	SchemaV2 = "2.0"
+)
+
+// CurrentSchemaVersion is the version events are created and published with
+// unless configured otherwise. It stays a 1.x version, whose events consumers
+// of 1.0 decode, until they have all moved to 2.0.
+const CurrentSchemaVersion = SchemaV1_1
+
+// schema converts events to and from the JSON form of one schema version
+type schema struct {
+	encode func(e *Event) any
+	decode func(data []byte, e *Event) error
+}
+
+// schemas is the registry of the known schema versions. Events are published
+// in one of them and events of all of them are decoded, so events written by
+// an older release, such as those still waiting in the outbox, are read back.
+var schemas = map[string]schema{
+	SchemaV1:   {encode: encodeV1_0, decode: decodeV1},
+	SchemaV1_1: {encode: encodeV1_1, decode: decodeV1},
+	SchemaV2:   {encode: encodeV2, decode: decodeV2},
+}
+
+// SchemaVersions returns the known schema versions, oldest first
+func SchemaVersions() []string {
+	versions := make([]string, 0, len(schemas))
+	for version := range schemas {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// lookupSchema returns the schema of version to encode events with
+func lookupSchema(version string) (schema, error) {
+	s, ok := schemas[version]
+	if !ok {
+		return schema{}, fmt.Errorf("unknown event schema version %q, must be one of %v", version, SchemaVersions())
+	}
+	return s, nil
+}
+
+// decoderFor returns the schema to decode events of version with. Events of an
+// unknown minor version are decoded with the latest known version of the same
+// major version, of which they only add fields.
+func decoderFor(version string) (schema, error) {
+	if s, ok := schemas[version]; ok {
+		return s, nil
+	}
+	major, _, _ := strings.Cut(version, ".")
+	var latest string
+	for _, known := range SchemaVersions() {
+		if knownMajor, _, _ := strings.Cut(known, "."); knownMajor == major {
+			latest = known
+		}
+	}
+	if latest == "" {
+		return schema{}, fmt.Errorf("unknown event schema version %q", version)
+	}
+	return schemas[latest], nil
+}
+
+// MarshalJSON encodes the event in the JSON form of its schema version, or of
+// the current version if it has none
+func (e Event) MarshalJSON() ([]byte, error) {
+	if e.Version == "" {
+		e.Version = CurrentSchemaVersion
+	}
+	s, err := lookupSchema(e.Version)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s.encode(&e))
+}
+
+// UnmarshalJSON decodes an event of any known schema version. Events without a
+// version predate versioning and are decoded as version 1.0.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var header struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if header.Version == "" {
+		header.Version = SchemaV1
+	}
+
+	s, err := decoderFor(header.Version)
+	if err != nil {
+		return err
+	}
+	*e = Event{}
+	if err := s.decode(data, e); err != nil {
+		return err
+	}
+	e.Version = header.Version
+	return nil
+}
+
+// eventV1 is the JSON form of the 1.x schema versions. Consumers still
+// decode events into copies of its 1.0 fields, so fields may only be added to
+// it along with a new minor version.
+type eventV1 struct {
+	Type      EventType  `json:"type"`
+	ID        string     `json:"id"`
+	User      *user.User `json:"User"`
+	Timestamp time.Time  `json:"timestamp"`
+	Version   string     `json:"version"`
+
+	Before        *user.User `json:"before,omitempty"`         // Since 1.1
+	ChangedFields []string   `json:"changed_fields,omitempty"` // Since 1.1
+
+	PreviousRole     user.Role `json:"previous_role,omitempty"`
+	PreviousNickname string    `json:"previous_nickname,omitempty"`
+
+	ResetExpiresAt *time.Time `json:"reset_expires_at,omitempty"` // Since 1.1
+}
+
+func encodeV1_0(e *Event) any {
+	v := encodeV1_1(e).(eventV1)
+	v.Before = nil
+	v.ChangedFields = nil
+	v.ResetExpiresAt = nil
+	return v
+}
+
+func encodeV1_1(e *Event) any {
+	return eventV1{
+		Type:             e.Type,
+		ID:               e.ID,
+		User:             e.User,
+		Timestamp:        e.Timestamp,
+		Version:          e.Version,
+		Before:           e.Before,
+		ChangedFields:    e.ChangedFields,
+		PreviousRole:     e.PreviousRole,
+		PreviousNickname: e.PreviousNickname,
+		ResetExpiresAt:   e.ResetExpiresAt,
+	}
+}
+
+func decodeV1(data []byte, e *Event) error {
+	var v eventV1
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*e = Event{
+		Type:             v.Type,
+		ID:               v.ID,
+		User:             v.User,
+		Timestamp:        v.Timestamp,
+		Before:           v.Before,
+		ChangedFields:    v.ChangedFields,
+		PreviousRole:     v.PreviousRole,
+		PreviousNickname: v.PreviousNickname,
+		ResetExpiresAt:   v.ResetExpiresAt,
+	}
+	return nil
+}
+
+// eventV2 is the JSON form of schema version 2.0. Fields may only be added to
+// it along with a new minor version.
+type eventV2 struct {
+	Type      EventType  `json:"type"`
+	ID        string     `json:"id"`
+	User      *user.User `json:"user"`
+	Timestamp time.Time  `json:"timestamp"`
+	Version   string     `json:"version"`
+
+	Before        *user.User `json:"before,omitempty"`
+	ChangedFields []string   `json:"changed_fields,omitempty"`
+
+	PreviousRole     user.Role `json:"previous_role,omitempty"`
+	PreviousNickname string    `json:"previous_nickname,omitempty"`
+
+	ResetExpiresAt *time.Time `json:"reset_expires_at,omitempty"`
+}
+
+func encodeV2(e *Event) any {
+	return eventV2{
+		Type:             e.Type,
+		ID:               e.ID,
+		User:             e.User,
+		Timestamp:        e.Timestamp,
+		Version:          e.Version,
+		Before:           e.Before,
+		ChangedFields:    e.ChangedFields,
+		PreviousRole:     e.PreviousRole,
+		PreviousNickname: e.PreviousNickname,
+		ResetExpiresAt:   e.ResetExpiresAt,
+	}
+}
+
+func decodeV2(data []byte, e *Event) error {
+	var v eventV2
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*e = Event{
+		Type:             v.Type,
+		ID:               v.ID,
+		User:             v.User,
+		Timestamp:        v.Timestamp,
+		Before:           v.Before,
+		ChangedFields:    v.ChangedFields,
+		PreviousRole:     v.PreviousRole,
+		PreviousNickname: v.PreviousNickname,
+		ResetExpiresAt:   v.ResetExpiresAt,
+	}
+	return nil
+}
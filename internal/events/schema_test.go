@@ -0,0 +1,303 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	eventspb "github.com/bentalebwael/faceit-users-service/internal/api/grpc/gen/events"
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// v1Consumer is how consumers written against schema version 1.0 decode
+// events. It is frozen: the tests below check that they keep working.
+type v1Consumer struct {
+	Type      string     `json:"type"`
+	ID        string     `json:"id"`
+	User      *user.User `json:"User"`
+	Timestamp time.Time  `json:"timestamp"`
+	Version   string     `json:"version"`
+
+	PreviousRole     user.Role `json:"previous_role,omitempty"`
+	PreviousNickname string    `json:"previous_nickname,omitempty"`
+}
+
+func testUpdatedEvent() *Event {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := &user.User{
+		ID:        uuid.MustParse("7b1a5a4e-5f0e-4d6b-9c53-3c1f2b8a9d10"),
+		FirstName: "John",
+		LastName:  "Doe",
+		Nickname:  "johndoe",
+		Email:     "john@example.com",
+		Country:   "US",
+		Role:      user.RolePlayer,
+		CreatedAt: created,
+		UpdatedAt: created,
+		Version:   1,
+	}
+	after := *before
+	after.Country = "DE"
+	after.UpdatedAt = created.Add(time.Hour)
+	after.Version = 2
+
+	event := newUpdatedEvent(&after, before)
+	event.Timestamp = after.UpdatedAt
+	return event
+}
+
+func TestSchemaVersions(t *testing.T) {
+	if got, want := SchemaVersions(), []string{SchemaV1, SchemaV1_1, SchemaV2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaVersions() = %v, want %v", got, want)
+	}
+	if _, err := lookupSchema(CurrentSchemaVersion); err != nil {
+		t.Errorf("current schema version %s is not registered: %v", CurrentSchemaVersion, err)
+	}
+}
+
+func TestEvent_JSONRoundTrip(t *testing.T) {
+	for _, version := range SchemaVersions() {
+		t.Run(version, func(t *testing.T) {
+			event := testUpdatedEvent()
+			event.Version = version
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			var decoded Event
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+
+			want := *event
+			if version == SchemaV1 {
+				// Not part of the schema
+				want.Before = nil
+				want.ChangedFields = nil
+			}
+			if !reflect.DeepEqual(decoded, want) {
+				t.Errorf("decoded event = %+v, want %+v", decoded, want)
+			}
+		})
+	}
+}
+
+func TestEvent_MarshalJSON(t *testing.T) {
+	event := testUpdatedEvent()
+
+	event.Version = SchemaV1
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	for _, key := range []string{"User", "type", "id", "timestamp", "version"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("version 1.0 event has no %q key: %s", key, data)
+		}
+	}
+	if _, ok := fields["before"]; ok {
+		t.Errorf("version 1.0 event has a before key: %s", data)
+	}
+
+	event.Version = SchemaV1_1
+	if data, err = json.Marshal(event); err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	fields = nil
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	for _, key := range []string{"User", "before", "changed_fields"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("version 1.1 event has no %q key: %s", key, data)
+		}
+	}
+
+	event.Version = SchemaV2
+	if data, err = json.Marshal(event); err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	fields = nil
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	for _, key := range []string{"user", "before", "changed_fields"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("version 2.0 event has no %q key: %s", key, data)
+		}
+	}
+	if _, ok := fields["User"]; ok {
+		t.Errorf("version 2.0 event has a User key: %s", data)
+	}
+	if _, ok := fields["user"].(map[string]any)["password"]; ok {
+		t.Errorf("event carries the password hash: %s", data)
+	}
+
+	event.Version = "9.0"
+	if _, err := json.Marshal(event); err == nil {
+		t.Error("json.Marshal() error = nil, want an error for an unknown schema version")
+	}
+}
+
+// Consumers built against schema version 1.0 must keep decoding the events
+// published by default. Keys are checked case-sensitively, as consumers not
+// written in Go match them.
+func TestCompatibility_OldConsumersDecodeNewEvents(t *testing.T) {
+	event := testUpdatedEvent()
+
+	for _, encoding := range []string{EncodingJSON, EncodingCloudEvents} {
+		t.Run(encoding, func(t *testing.T) {
+			encoder, err := NewEncoder(&config.KafkaConfig{EventEncoding: encoding, EventSource: "test"})
+			if err != nil {
+				t.Fatalf("NewEncoder() error = %v", err)
+			}
+			msg, err := encoder.Encode(event)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			var raw map[string]json.RawMessage
+			if err := json.Unmarshal(msg.Value, &raw); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			for _, key := range []string{"type", "id", "User", "timestamp", "version"} {
+				if _, ok := raw[key]; !ok {
+					t.Errorf("event has no %q key of version 1.0: %s", key, msg.Value)
+				}
+			}
+
+			var old v1Consumer
+			if err := json.Unmarshal(msg.Value, &old); err != nil {
+				t.Fatalf("version 1.0 consumer failed to decode the event: %v", err)
+			}
+			if major, _, _ := strings.Cut(old.Version, "."); major != "1" {
+				t.Errorf("event version = %s, want a 1.x version", old.Version)
+			}
+			if old.Type != string(event.Type) || old.ID != event.ID || !old.Timestamp.Equal(event.Timestamp) {
+				t.Errorf("version 1.0 consumer decoded %+v, want the envelope of %+v", old, event)
+			}
+			if old.User == nil || !reflect.DeepEqual(*old.User, *event.User) {
+				t.Errorf("version 1.0 consumer decoded user %+v, want %+v", old.User, event.User)
+			}
+		})
+	}
+
+	// Protobuf consumers match fields by number, so those of the first
+	// version of the message must keep their number and wire type
+	t.Run(EncodingProtobuf, func(t *testing.T) {
+		encoder, err := NewEncoder(&config.KafkaConfig{EventEncoding: EncodingProtobuf})
+		if err != nil {
+			t.Fatalf("NewEncoder() error = %v", err)
+		}
+		msg, err := encoder.Encode(event)
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		fields := make(map[protowire.Number][]byte)
+		for b := msg.Value; len(b) > 0; {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatalf("malformed protobuf event: %v", protowire.ParseError(n))
+			}
+			b = b[n:]
+			if typ != protowire.BytesType {
+				n = protowire.ConsumeFieldValue(num, typ, b)
+				if n < 0 {
+					t.Fatalf("malformed protobuf event: %v", protowire.ParseError(n))
+				}
+				b = b[n:]
+				continue
+			}
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				t.Fatalf("malformed protobuf event: %v", protowire.ParseError(n))
+			}
+			fields[num] = value
+			b = b[n:]
+		}
+
+		if string(fields[1]) != event.ID || string(fields[2]) != string(event.Type) {
+			t.Errorf("fields 1 and 2 = %q, %q, want the event ID and type", fields[1], fields[2])
+		}
+		var state eventspb.UserState
+		if err := proto.Unmarshal(fields[5], &state); err != nil {
+			t.Fatalf("field 5 is not a user: %v", err)
+		}
+		if state.Id != event.User.ID.String() || state.Nickname != event.User.Nickname {
+			t.Errorf("field 5 = %+v, want the user %+v", &state, event.User)
+		}
+	})
+}
+
+// Events written by older releases, such as those still in the outbox after
+// an upgrade, must still decode
+func TestCompatibility_NewConsumersDecodeOldEvents(t *testing.T) {
+	payload := `{
+		"type": "nickname_changed",
+		"id": "0b9d3b4c-6a43-4a0e-8c39-6a1f1f3d7c11",
+		"User": {
+			"id": "7b1a5a4e-5f0e-4d6b-9c53-3c1f2b8a9d10",
+			"first_name": "John",
+			"last_name": "Doe",
+			"nickname": "johnsmith",
+			"email": "john@example.com",
+			"country": "US",
+			"role": "player",
+			"created_at": "2024-05-01T12:00:00Z",
+			"updated_at": "2024-05-01T13:00:00Z",
+			"version": 2
+		},
+		"timestamp": "2024-05-01T13:00:00Z",
+		"version": "1.0",
+		"previous_nickname": "johndoe"
+	}`
+
+	var event Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if event.Type != EventTypeNicknameChanged || event.Version != SchemaV1 || event.PreviousNickname != "johndoe" {
+		t.Errorf("decoded event = %+v, want the version 1.0 nickname_changed event", event)
+	}
+	if event.User == nil || event.User.Nickname != "johnsmith" || event.User.Version != 2 {
+		t.Errorf("decoded user = %+v, want johnsmith at version 2", event.User)
+	}
+}
+
+func TestCompatibility_NewerMinorVersion(t *testing.T) {
+	// A later 2.x release may add fields, which 2.0 decoding ignores
+	payload := `{
+		"type": "created",
+		"id": "0b9d3b4c-6a43-4a0e-8c39-6a1f1f3d7c11",
+		"user": {"id": "7b1a5a4e-5f0e-4d6b-9c53-3c1f2b8a9d10", "nickname": "johndoe"},
+		"timestamp": "2024-05-01T13:00:00Z",
+		"version": "2.7",
+		"added_later": {"anything": true}
+	}`
+
+	var event Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if event.Version != "2.7" || event.User == nil || event.User.Nickname != "johndoe" {
+		t.Errorf("decoded event = %+v, want the version 2.7 created event of johndoe", event)
+	}
+
+	// A new major version may break the schema, so it is not guessed at
+	if err := json.Unmarshal([]byte(`{"type": "created", "version": "3.0"}`), &event); err == nil {
+		t.Error("json.Unmarshal() error = nil, want an error for an unknown major version")
+	}
+}
@@ -0,0 +1,288 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+)
+
+// Headers of command messages. CommandTypeHeader is set by the sender; the
+// others by the Consumer on the messages it forwards to the retry and
+// dead-letter topics.
+const (
+	CommandTypeHeader = "command-type"
+	AttemptsHeader    = "attempts" // Number of failed attempts at the command
+	RetryAtHeader     = "retry-at" // Earliest time of the next attempt, in RFC 3339
+	ErrorHeader       = "error"    // Error of the last attempt
+)
+
+// Reader is the part of a kafka.Reader in a consumer group the Consumer uses
+type Reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Writer is the part of a kafka.Writer the Consumer uses to forward failed
+// commands, setting the topic of each message
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Handler handles a command. Errors are retried unless marked Permanent.
+type Handler func(ctx context.Context, msg kafka.Message) error
+
+// permanentError marks an error retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying cannot fix, such as a malformed
+// command, so that the command is dead-lettered right away
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Registry maps command types to their handlers
+type Registry struct {
+	handlers map[string]Handler
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]Handler)}
+}
+
+// Register makes handler handle the commands of commandType
+func (r *Registry) Register(commandType string, handler Handler) {
+	r.handlers[commandType] = handler
+}
+
+// Consumer handles the commands of a topic one at a time with the handlers of
+// a registry. A command is committed only once it was handled, or forwarded
+// to the retry topic or, after too many attempts, to the dead-letter topic,
+// so every command is handled at least once; handlers must be idempotent.
+//
+// The same Consumer type reads the retry topic, waiting for the retry-at
+// time of each command before handling it again.
+type Consumer struct {
+	reader   Reader
+	writer   Writer
+	registry *Registry
+	cfg      *config.CommandsConfig
+	logger   *slog.Logger
+	now      func() time.Time
+}
+
+// NewConsumer creates a consumer of the commands reader fetches, forwarding
+// failed ones with writer
+func NewConsumer(reader Reader, writer Writer, registry *Registry, cfg *config.CommandsConfig, logger *slog.Logger) *Consumer {
+	return &Consumer{
+		reader:   reader,
+		writer:   writer,
+		registry: registry,
+		cfg:      cfg,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Run handles commands until ctx is cancelled. The command in hand when it
+// is cancelled is still handled and committed, so stopping drains the
+// consumer instead of abandoning work halfway; a command still waiting for
+// its retry time is left uncommitted for the next run.
+func (c *Consumer) Run(ctx context.Context) error {
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to fetch command: %w", err)
+		}
+
+		if !c.waitForRetry(ctx, msg) {
+			return nil
+		}
+		if !c.process(ctx, msg) {
+			return nil
+		}
+	}
+}
+
+// waitForRetry waits until the retry-at time of msg, if any, and reports
+// whether it was reached before ctx was cancelled
+func (c *Consumer) waitForRetry(ctx context.Context, msg kafka.Message) bool {
+	retryAt, err := time.Parse(time.RFC3339Nano, header(msg, RetryAtHeader))
+	if err != nil {
+		return true
+	}
+	wait := retryAt.Sub(c.now())
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// process handles msg and commits it, and reports whether the consumer may
+// go on. It may not when a failed command could not be forwarded before ctx
+// was cancelled, as committing a later command would commit it too.
+func (c *Consumer) process(ctx context.Context, msg kafka.Message) bool {
+	// Handling is not cut short by a cancelled ctx, only by its own timeout
+	handleCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.HandlerTimeout)
+	err := c.handle(handleCtx, msg)
+	cancel()
+
+	if err != nil && !c.forward(ctx, msg, err) {
+		return false
+	}
+	if err := c.reader.CommitMessages(context.WithoutCancel(ctx), msg); err != nil {
+		// The command will be handled again after a restart or rebalance
+		c.logger.Error("failed to commit command", "topic", msg.Topic, "offset", msg.Offset, "error", err)
+	}
+	return true
+}
+
+func (c *Consumer) handle(ctx context.Context, msg kafka.Message) error {
+	commandType := header(msg, CommandTypeHeader)
+	handler, ok := c.registry.handlers[commandType]
+	if !ok {
+		return Permanent(fmt.Errorf("unknown command type %q", commandType))
+	}
+	return handler(ctx, msg)
+}
+
+// forward sends msg, which failed with cause, to the retry topic, or to the
+// dead-letter topic if cause is permanent or the attempts are used up. It
+// keeps trying until the forward succeeds or ctx is cancelled, and reports
+// whether it succeeded.
+func (c *Consumer) forward(ctx context.Context, msg kafka.Message, cause error) bool {
+	attempts := 1
+	if n, err := strconv.Atoi(header(msg, AttemptsHeader)); err == nil {
+		attempts = n + 1
+	}
+
+	out := kafka.Message{Key: msg.Key, Value: msg.Value}
+	for _, h := range msg.Headers {
+		if h.Key != AttemptsHeader && h.Key != RetryAtHeader && h.Key != ErrorHeader {
+			out.Headers = append(out.Headers, h)
+		}
+	}
+	out.Headers = append(out.Headers,
+		kafka.Header{Key: AttemptsHeader, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: ErrorHeader, Value: []byte(cause.Error())},
+	)
+
+	logArgs := []any{
+		"command_type", header(msg, CommandTypeHeader),
+		"attempts", attempts,
+		"error", cause,
+	}
+	if IsPermanent(cause) || attempts >= c.cfg.MaxAttempts {
+		out.Topic = c.cfg.DeadLetterTopic
+		c.logger.Error("command failed, dead-lettering it", logArgs...)
+	} else {
+		delay := c.retryDelay(attempts)
+		out.Topic = c.cfg.RetryTopic
+		out.Headers = append(out.Headers, kafka.Header{Key: RetryAtHeader, Value: []byte(c.now().Add(delay).UTC().Format(time.RFC3339Nano))})
+		c.logger.Warn("command failed, retrying later", append(logArgs, "retry_in", delay)...)
+	}
+
+	for delay := c.cfg.RetryBaseDelay; ; delay = min(delay*2, c.cfg.RetryMaxDelay) {
+		err := c.writer.WriteMessages(ctx, out)
+		if err == nil {
+			return true
+		}
+		c.logger.Error("failed to forward command", "topic", out.Topic, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryDelay doubles the base delay for every failed attempt, up to the maximum
+func (c *Consumer) retryDelay(attempts int) time.Duration {
+	delay := c.cfg.RetryBaseDelay
+	for i := 1; i < attempts && delay < c.cfg.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.cfg.RetryMaxDelay {
+		delay = c.cfg.RetryMaxDelay
+	}
+	return delay
+}
+
+func header(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// NewCommandReader creates a reader of topic in the consumer group of the
+// commands configuration
+func NewCommandReader(cfg *config.Config, topic string) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers: strings.Split(cfg.Kafka.Brokers, ","),
+		GroupID: cfg.Commands.GroupID,
+		Topic:   topic,
+	})
+}
+
+// NewCommandWriter creates the writer forwarding failed commands. Messages
+// name their topic, and keep their key and so their partition.
+func NewCommandWriter(cfg *config.Config) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(cfg.Kafka.Brokers, ",")...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		WriteTimeout: cfg.Kafka.WriteTimeout,
+		BatchTimeout: cfg.Kafka.BatchTimeout,
+	}
+}
+
+// CreateCommandTopics creates the commands, retry and dead-letter topics if
+// they do not exist yet
+func CreateCommandTopics(cfg *config.Config, log *slog.Logger) error {
+	conn, err := kafka.Dial("tcp", cfg.Kafka.Brokers)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, topic := range []string{cfg.Commands.Topic, cfg.Commands.RetryTopic, cfg.Commands.DeadLetterTopic} {
+		if err := createTopicIfNotExists(conn, topic, cfg, log); err != nil {
+			return fmt.Errorf("failed to create topic %s: %w", topic, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+)
+
+// fakeReader hands out its messages, then blocks until the context is done
+type fakeReader struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed []kafka.Message
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.messages) > 0 {
+		msg := r.messages[0]
+		r.messages = r.messages[1:]
+		r.mu.Unlock()
+		return msg, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Committed() []kafka.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]kafka.Message(nil), r.committed...)
+}
+
+// fakeWriter records the messages written, failing the first failures writes
+type fakeWriter struct {
+	mu       sync.Mutex
+	failures int
+	written  []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("broker unavailable")
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Written() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka.Message(nil), w.written...)
+}
+
+func testCommandsConfig() *config.CommandsConfig {
+	return &config.CommandsConfig{
+		Topic:           "user_commands",
+		RetryTopic:      "user_commands_retry",
+		DeadLetterTopic: "user_commands_dlq",
+		MaxAttempts:     3,
+		RetryBaseDelay:  time.Millisecond,
+		RetryMaxDelay:   4 * time.Millisecond,
+		HandlerTimeout:  time.Second,
+	}
+}
+
+func command(commandType string, headers ...kafka.Header) kafka.Message {
+	return kafka.Message{
+		Topic:   "user_commands",
+		Key:     []byte("key"),
+		Value:   []byte(`{}`),
+		Headers: append([]kafka.Header{{Key: CommandTypeHeader, Value: []byte(commandType)}}, headers...),
+	}
+}
+
+// runUntil runs consumer until done reports true, then stops it
+func runUntil(t *testing.T, consumer *Consumer, done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- consumer.Run(ctx) }()
+
+	assert.Eventually(t, done, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-errc)
+}
+
+func newTestConsumer(reader Reader, writer Writer, registry *Registry) *Consumer {
+	return NewConsumer(reader, writer, registry, testCommandsConfig(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestConsumer_HandlesAndCommits(t *testing.T) {
+	var handled []string
+	registry := NewRegistry()
+	registry.Register("user.erase", func(_ context.Context, msg kafka.Message) error {
+		handled = append(handled, string(msg.Key))
+		return nil
+	})
+	reader := &fakeReader{messages: []kafka.Message{command("user.erase"), command("user.erase")}}
+	writer := &fakeWriter{}
+
+	runUntil(t, newTestConsumer(reader, writer, registry), func() bool { return len(reader.Committed()) == 2 })
+
+	assert.Equal(t, []string{"key", "key"}, handled)
+	assert.Empty(t, writer.Written())
+}
+
+func TestConsumer_RetriesFailedCommands(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("user.erase", func(context.Context, kafka.Message) error {
+		return errors.New("database unavailable")
+	})
+	reader := &fakeReader{messages: []kafka.Message{command("user.erase", kafka.Header{Key: "trace", Value: []byte("abc")})}}
+	writer := &fakeWriter{failures: 2}
+	consumer := newTestConsumer(reader, writer, registry)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	consumer.now = func() time.Time { return now }
+
+	runUntil(t, consumer, func() bool { return len(reader.Committed()) == 1 })
+
+	written := writer.Written()
+	require.Len(t, written, 1, "the forward is retried until it succeeds")
+	assert.Equal(t, "user_commands_retry", written[0].Topic)
+	assert.Equal(t, []byte("key"), written[0].Key)
+	assert.Equal(t, "user.erase", header(written[0], CommandTypeHeader))
+	assert.Equal(t, "abc", header(written[0], "trace"))
+	assert.Equal(t, "1", header(written[0], AttemptsHeader))
+	assert.Equal(t, "database unavailable", header(written[0], ErrorHeader))
+	assert.Equal(t, "2024-05-01T12:00:00.001Z", header(written[0], RetryAtHeader))
+}
+
+func TestConsumer_DeadLetters(t *testing.T) {
+	tests := []struct {
+		name         string
+		msg          kafka.Message
+		err          error
+		wantAttempts string
+	}{
+		{
+			name:         "permanent error",
+			msg:          command("user.erase"),
+			err:          Permanent(errors.New("malformed command")),
+			wantAttempts: "1",
+		},
+		{
+			name:         "attempts used up",
+			msg:          command("user.erase", kafka.Header{Key: AttemptsHeader, Value: []byte("2")}),
+			err:          errors.New("database unavailable"),
+			wantAttempts: "3",
+		},
+		{
+			name:         "unknown command type",
+			msg:          command("user.ban"),
+			wantAttempts: "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			registry.Register("user.erase", func(context.Context, kafka.Message) error { return tt.err })
+			reader := &fakeReader{messages: []kafka.Message{tt.msg}}
+			writer := &fakeWriter{}
+
+			runUntil(t, newTestConsumer(reader, writer, registry), func() bool { return len(reader.Committed()) == 1 })
+
+			written := writer.Written()
+			require.Len(t, written, 1)
+			assert.Equal(t, "user_commands_dlq", written[0].Topic)
+			assert.Equal(t, tt.wantAttempts, header(written[0], AttemptsHeader))
+			assert.Empty(t, header(written[0], RetryAtHeader))
+			assert.NotEmpty(t, header(written[0], ErrorHeader))
+		})
+	}
+}
+
+func TestConsumer_WaitsForRetryTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	retryAt := kafka.Header{Key: RetryAtHeader, Value: []byte(now.Add(50 * time.Millisecond).Format(time.RFC3339Nano))}
+
+	t.Run("handles the command once it is due", func(t *testing.T) {
+		var handledAt time.Time
+		registry := NewRegistry()
+		registry.Register("user.erase", func(context.Context, kafka.Message) error {
+			handledAt = time.Now()
+			return nil
+		})
+		reader := &fakeReader{messages: []kafka.Message{command("user.erase", retryAt)}}
+		consumer := newTestConsumer(reader, &fakeWriter{}, registry)
+		consumer.now = func() time.Time { return now }
+
+		start := time.Now()
+		runUntil(t, consumer, func() bool { return len(reader.Committed()) == 1 })
+		assert.GreaterOrEqual(t, handledAt.Sub(start), 50*time.Millisecond)
+	})
+
+	t.Run("leaves the command uncommitted when stopped", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.Register("user.erase", func(context.Context, kafka.Message) error {
+			t.Error("the command must not be handled before it is due")
+			return nil
+		})
+		reader := &fakeReader{messages: []kafka.Message{command("user.erase", retryAt)}}
+		consumer := newTestConsumer(reader, &fakeWriter{}, registry)
+		consumer.now = func() time.Time { return now.Add(-time.Hour) }
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		require.NoError(t, consumer.Run(ctx))
+		assert.Empty(t, reader.Committed())
+	})
+}
+
+func TestConsumer_DrainsOnStop(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	registry := NewRegistry()
+	registry.Register("user.erase", func(ctx context.Context, _ kafka.Message) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	})
+	reader := &fakeReader{messages: []kafka.Message{command("user.erase")}}
+	writer := &fakeWriter{}
+	consumer := newTestConsumer(reader, writer, registry)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- consumer.Run(ctx) }()
+
+	<-started
+	cancel()
+	close(release)
+	require.NoError(t, <-errc)
+
+	assert.Len(t, reader.Committed(), 1, "the command in hand is finished and committed")
+	assert.Empty(t, writer.Written(), "the handler's context is not cancelled by stopping")
+}
+
+func TestRetryDelay(t *testing.T) {
+	consumer := newTestConsumer(nil, nil, NewRegistry())
+	assert.Equal(t, time.Millisecond, consumer.retryDelay(1))
+	assert.Equal(t, 2*time.Millisecond, consumer.retryDelay(2))
+	assert.Equal(t, 4*time.Millisecond, consumer.retryDelay(3))
+	assert.Equal(t, 4*time.Millisecond, consumer.retryDelay(10))
+}
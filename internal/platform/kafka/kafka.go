@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -17,21 +18,53 @@ func NewProducer(cfg *config.Config, log *slog.Logger) (*kafka.Writer, error) {
 	}
 	defer conn.Close()
 
-	err = createTopicIfNotExists(conn, cfg, log)
+	err = createTopicIfNotExists(conn, cfg.Kafka.EventTopic, cfg, log)
 	if err != nil {
 		return nil, err
 	}
 
-	writer := &kafka.Writer{
+	return newWriter(cfg), nil
+}
+
+// newWriter configures a synchronous writer so delivery errors reach the
+// outbox relay, hashing message keys so a user's events share a partition.
+func newWriter(cfg *config.Config) *kafka.Writer {
+	return &kafka.Writer{
 		Addr:         kafka.TCP(cfg.Kafka.Brokers),
 		Topic:        cfg.Kafka.EventTopic,
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     &kafka.Hash{},
 		RequiredAcks: kafka.RequireOne,
-		Async:        true,
+		Async:        false,
+		BatchTimeout: cfg.Kafka.BatchTimeout,
 		WriteTimeout: cfg.Kafka.WriteTimeout,
 	}
+}
+
+// NewResetWriter creates the writer of password reset tokens to the mailer.
+// Its topic is created to keep tokens no longer than they are valid.
+func NewResetWriter(cfg *config.Config, log *slog.Logger) (*kafka.Writer, error) {
+	conn, err := kafka.Dial("tcp", cfg.Kafka.Brokers)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	retention := kafka.ConfigEntry{
+		ConfigName:  "retention.ms",
+		ConfigValue: strconv.FormatInt(cfg.Auth.PasswordResetTTL.Milliseconds(), 10),
+	}
+	if err := createTopicIfNotExists(conn, cfg.Kafka.ResetTopic, cfg, log, retention); err != nil {
+		return nil, err
+	}
+
+	return newResetWriter(cfg), nil
+}
 
-	return writer, nil
+func newResetWriter(cfg *config.Config) *kafka.Writer {
+	writer := newWriter(cfg)
+	writer.Topic = cfg.Kafka.ResetTopic
+	writer.RequiredAcks = kafka.RequireAll
+	return writer
 }
 
 func Close(writer *kafka.Writer) error {
@@ -41,13 +74,13 @@ func Close(writer *kafka.Writer) error {
 	return nil
 }
 
-func createTopicIfNotExists(conn *kafka.Conn, cfg *config.Config, log *slog.Logger) error {
+func createTopicIfNotExists(conn *kafka.Conn, topic string, cfg *config.Config, log *slog.Logger, entries ...kafka.ConfigEntry) error {
 	var partitions []kafka.Partition
 	var err error
 
 	for i := range 20 {
 		log.Info("Trying to read Kafka partitions", "attempt", i+1)
-		partitions, err = conn.ReadPartitions(cfg.Kafka.EventTopic)
+		partitions, err = conn.ReadPartitions(topic)
 		if err != nil {
 			time.Sleep(5 * time.Second)
 			continue
@@ -60,14 +93,15 @@ func createTopicIfNotExists(conn *kafka.Conn, cfg *config.Config, log *slog.Logg
 
 	if len(partitions) == 0 {
 		err = conn.CreateTopics(kafka.TopicConfig{
-			Topic:             cfg.Kafka.EventTopic,
+			Topic:             topic,
 			NumPartitions:     cfg.Kafka.NumPartitions,
 			ReplicationFactor: cfg.Kafka.ReplicationFactor,
+			ConfigEntries:     entries,
 		})
 		if err != nil {
 			return err
 		}
-		log.Info("Created Kafka topic", "topic", cfg.Kafka.EventTopic)
+		log.Info("Created Kafka topic", "topic", topic)
 	}
 	return nil
 }
@@ -16,40 +16,37 @@ func TestNewProducer(t *testing.T) {
 	t.Run("Success with existing topic", func(t *testing.T) {
 		cfg := &config.Config{
 			Kafka: config.KafkaConfig{
-				Brokers:    "localhost:9092",
-				EventTopic: "test-topic",
+				Brokers:      "localhost:9092",
+				EventTopic:   "test-topic",
+				WriteTimeout: 10 * time.Second,
+				BatchTimeout: 10 * time.Millisecond,
 			},
 		}
 
-		expectedWriter := &kafka.Writer{
-			Addr:         kafka.TCP(cfg.Kafka.Brokers),
-			Topic:        cfg.Kafka.EventTopic,
-			Balancer:     &kafka.LeastBytes{},
-			RequiredAcks: kafka.RequireOne,
-			Async:        true,
-			WriteTimeout: 10 * time.Second,
-		}
-
 		// We can only test the configuration of the writer here
-		writer, err := createTestWriter(cfg)
-		assert.NoError(t, err)
-		assert.Equal(t, expectedWriter.Addr, writer.Addr)
-		assert.Equal(t, expectedWriter.Topic, writer.Topic)
-		assert.Equal(t, expectedWriter.WriteTimeout, writer.WriteTimeout)
-		assert.True(t, writer.Async)
+		writer := newWriter(cfg)
+		assert.Equal(t, kafka.TCP(cfg.Kafka.Brokers), writer.Addr)
+		assert.Equal(t, cfg.Kafka.EventTopic, writer.Topic)
+		assert.Equal(t, 10*time.Second, writer.WriteTimeout)
+		assert.Equal(t, 10*time.Millisecond, writer.BatchTimeout)
+		assert.IsType(t, &kafka.Hash{}, writer.Balancer)
+		assert.False(t, writer.Async, "writes must be synchronous so the outbox relay sees failures")
 	})
 }
 
-func createTestWriter(cfg *config.Config) (*kafka.Writer, error) {
-	writer := &kafka.Writer{
-		Addr:         kafka.TCP(cfg.Kafka.Brokers),
-		Topic:        cfg.Kafka.EventTopic,
-		Balancer:     &kafka.LeastBytes{},
-		RequiredAcks: kafka.RequireOne,
-		Async:        true,
-		WriteTimeout: 10 * time.Second,
+func TestNewResetWriter(t *testing.T) {
+	cfg := &config.Config{
+		Kafka: config.KafkaConfig{
+			Brokers:    "localhost:9092",
+			EventTopic: "test-topic",
+			ResetTopic: "test-resets",
+		},
 	}
-	return writer, nil
+
+	writer := newResetWriter(cfg)
+	assert.Equal(t, "test-resets", writer.Topic, "tokens must not go to the event topic")
+	assert.Equal(t, kafka.RequireAll, writer.RequiredAcks)
+	assert.False(t, writer.Async, "writes must be synchronous so a failed delivery is reported")
 }
 
 func TestClose(t *testing.T) {
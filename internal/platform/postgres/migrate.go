@@ -0,0 +1,271 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrationLockKey identifies the advisory lock serializing migrations across replicas
+const migrationLockKey = 0x6d696772617465 // "migrate"
+
+// NoVersion is the schema version of a database no migration was applied to
+const NoVersion = -1
+
+// ErrDirty is returned when a previous migration failed halfway; the schema
+// must be repaired by hand and the version set with Force before migrating again
+var ErrDirty = errors.New("database schema is dirty")
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is one step of the schema, read from a pair of up and down files
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes the schema version of the database against the
+// migrations known to the binary
+type MigrationStatus struct {
+	Version int  `json:"version"` // NoVersion before the first migration
+	Dirty   bool `json:"dirty"`   // The migration to Version failed halfway
+	Latest  int  `json:"latest"`  // Version of the last known migration
+	Pending int  `json:"pending"` // Known migrations not applied yet
+}
+
+// Behind reports whether migrations remain to be applied
+func (s *MigrationStatus) Behind() bool {
+	return s.Pending > 0
+}
+
+// Migrator applies schema migrations, recording the current version in the
+// schema_migrations table the migrate CLI uses, so both can be mixed
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration // Ordered by version
+}
+
+// NewMigrator reads the migrations in the root of fsys
+func NewMigrator(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := readMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func readMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Status returns the schema version of the database and how far behind it is
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	var status *MigrationStatus
+	err := m.withConn(ctx, false, func(conn *sqlx.Conn) error {
+		var err error
+		status, err = m.status(ctx, conn)
+		return err
+	})
+	return status, err
+}
+
+// Up applies every pending migration and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.withConn(ctx, true, func(conn *sqlx.Conn) error {
+		status, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if status.Dirty {
+			return fmt.Errorf("%w at version %d", ErrDirty, status.Version)
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version <= status.Version {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration.Version, migration.Version, migration.Up); err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts up to steps migrations, most recent first, and returns how
+// many were reverted
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.withConn(ctx, true, func(conn *sqlx.Conn) error {
+		status, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if status.Dirty {
+			return fmt.Errorf("%w at version %d", ErrDirty, status.Version)
+		}
+		if status.Version > status.Latest {
+			return fmt.Errorf("schema version %d is newer than the latest known migration %d", status.Version, status.Latest)
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if migration.Version > status.Version {
+				continue
+			}
+			previous := NoVersion
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			if err := m.apply(ctx, conn, migration.Version, previous, migration.Down); err != nil {
+				return fmt.Errorf("error reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Force records version as the clean schema version without running any
+// migration, once a failed migration has been repaired by hand
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	if version < NoVersion {
+		return fmt.Errorf("invalid schema version %d", version)
+	}
+	return m.withConn(ctx, true, func(conn *sqlx.Conn) error {
+		return setVersion(ctx, conn, version, false)
+	})
+}
+
+// apply runs the migration script of version and records target as the new
+// version. The version is marked dirty while the script runs, so a script
+// failing halfway leaves a trace instead of a silently broken schema.
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, version, target int, script string) error {
+	if err := setVersion(ctx, conn, target, true); err != nil {
+		return err
+	}
+	if script != "" {
+		if _, err := conn.ExecContext(ctx, script); err != nil {
+			return fmt.Errorf("%w, schema left dirty at version %d", err, target)
+		}
+	}
+	return setVersion(ctx, conn, target, false)
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sqlx.Conn) (*MigrationStatus, error) {
+	status := &MigrationStatus{Version: NoVersion, Latest: NoVersion}
+	err := conn.QueryRowxContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&status.Version, &status.Dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error reading schema version: %w", err)
+	}
+
+	for _, migration := range m.migrations {
+		status.Latest = migration.Version
+		if migration.Version > status.Version {
+			status.Pending++
+		}
+	}
+	return status, nil
+}
+
+// withConn runs fn on a dedicated connection with the schema_migrations
+// table in place and, when lock is set, holding the migration lock, so
+// replicas starting together apply each migration once
+func (m *Migrator) withConn(ctx context.Context, lock bool, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if lock {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return fmt.Errorf("error acquiring migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}
+
+	const createTable = "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)"
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+	return fn(conn)
+}
+
+// setVersion replaces the recorded schema version. Like the migrate CLI, it
+// records no row for a clean NoVersion.
+func setVersion(ctx context.Context, conn *sqlx.Conn, version int, dirty bool) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning schema version update: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return fmt.Errorf("error clearing schema version: %w", err)
+	}
+	if version != NoVersion || dirty {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)", version, dirty); err != nil {
+			return fmt.Errorf("error setting schema version: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing schema version: %w", err)
+	}
+	return nil
+}
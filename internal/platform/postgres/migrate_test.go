@@ -0,0 +1,211 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/migrations"
+)
+
+var testMigrations = fstest.MapFS{
+	"000001_create_things.up.sql":   {Data: []byte("CREATE TABLE things (id INT)")},
+	"000001_create_things.down.sql": {Data: []byte("DROP TABLE things")},
+	"000002_add_name.up.sql":        {Data: []byte("ALTER TABLE things ADD COLUMN name TEXT")},
+	"000002_add_name.down.sql":      {Data: []byte("ALTER TABLE things DROP COLUMN name")},
+	"readme.md":                     {Data: []byte("not a migration")},
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { mockDB.Close() })
+
+	migrator, err := NewMigrator(sqlx.NewDb(mockDB, "sqlmock"), testMigrations)
+	require.NoError(t, err)
+	return migrator, mock
+}
+
+func expectConn(mock sqlmock.Sqlmock, lock bool) {
+	if lock {
+		mock.ExpectExec("SELECT pg_advisory_lock").WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectVersion(mock sqlmock.Sqlmock, version int, dirty bool) {
+	rows := sqlmock.NewRows([]string{"version", "dirty"})
+	if version != NoVersion {
+		rows.AddRow(version, dirty)
+	}
+	mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").WillReturnRows(rows)
+}
+
+func expectSetVersion(mock sqlmock.Sqlmock, version int, dirty bool) {
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM schema_migrations").WillReturnResult(sqlmock.NewResult(0, 1))
+	if version != NoVersion || dirty {
+		mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(version, dirty).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestReadMigrations(t *testing.T) {
+	t.Run("pairs and orders files", func(t *testing.T) {
+		migrations, err := readMigrations(testMigrations)
+		require.NoError(t, err)
+		require.Len(t, migrations, 2)
+		assert.Equal(t, Migration{Version: 1, Name: "create_things", Up: "CREATE TABLE things (id INT)", Down: "DROP TABLE things"}, migrations[0])
+		assert.Equal(t, 2, migrations[1].Version)
+	})
+
+	t.Run("missing up file", func(t *testing.T) {
+		_, err := readMigrations(fstest.MapFS{"000001_create_things.down.sql": {Data: []byte("DROP TABLE things")}})
+		assert.ErrorContains(t, err, "has no up file")
+	})
+
+	t.Run("version used twice", func(t *testing.T) {
+		_, err := readMigrations(fstest.MapFS{
+			"000001_create_things.up.sql": {Data: []byte("CREATE TABLE things (id INT)")},
+			"000001_create_stuff.up.sql":  {Data: []byte("CREATE TABLE stuff (id INT)")},
+		})
+		assert.ErrorContains(t, err, "is used by both")
+	})
+
+	t.Run("embedded migrations", func(t *testing.T) {
+		migrations, err := readMigrations(migrations.FS)
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+		for i, m := range migrations {
+			assert.Equal(t, i+1, m.Version, "versions have no gaps")
+			assert.NotEmpty(t, m.Down, "migration %d can be reverted", m.Version)
+		}
+	})
+}
+
+func TestMigrator_Status(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fresh database", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectConn(mock, false)
+		expectVersion(mock, NoVersion, false)
+
+		status, err := migrator.Status(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &MigrationStatus{Version: NoVersion, Latest: 2, Pending: 2}, status)
+		assert.True(t, status.Behind())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectConn(mock, false)
+		expectVersion(mock, 2, false)
+
+		status, err := migrator.Status(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &MigrationStatus{Version: 2, Latest: 2}, status)
+		assert.False(t, status.Behind())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrator_Up(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("applies pending migrations", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectConn(mock, true)
+		expectVersion(mock, 1, false)
+		expectSetVersion(mock, 2, true)
+		mock.ExpectExec("ALTER TABLE things ADD COLUMN name TEXT").WillReturnResult(sqlmock.NewResult(0, 0))
+		expectSetVersion(mock, 2, false)
+		expectUnlock(mock)
+
+		applied, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("failed migration leaves the schema dirty", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectConn(mock, true)
+		expectVersion(mock, 1, false)
+		expectSetVersion(mock, 2, true)
+		mock.ExpectExec("ALTER TABLE things ADD COLUMN name TEXT").WillReturnError(assert.AnError)
+		expectUnlock(mock)
+
+		applied, err := migrator.Up(ctx)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "2_add_name")
+		assert.Equal(t, 0, applied)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("refuses a dirty schema", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectConn(mock, true)
+		expectVersion(mock, 2, true)
+		expectUnlock(mock)
+
+		_, err := migrator.Up(ctx)
+		assert.ErrorIs(t, err, ErrDirty)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrator_Down(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reverts down to no version", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectConn(mock, true)
+		expectVersion(mock, 2, false)
+		expectSetVersion(mock, 1, true)
+		mock.ExpectExec("ALTER TABLE things DROP COLUMN name").WillReturnResult(sqlmock.NewResult(0, 0))
+		expectSetVersion(mock, 1, false)
+		expectSetVersion(mock, NoVersion, true)
+		mock.ExpectExec("DROP TABLE things").WillReturnResult(sqlmock.NewResult(0, 0))
+		expectSetVersion(mock, NoVersion, false)
+		expectUnlock(mock)
+
+		reverted, err := migrator.Down(ctx, 5)
+		require.NoError(t, err)
+		assert.Equal(t, 2, reverted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("refuses an unknown version", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectConn(mock, true)
+		expectVersion(mock, 3, false)
+		expectUnlock(mock)
+
+		_, err := migrator.Down(ctx, 1)
+		assert.ErrorContains(t, err, "newer than the latest known migration")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrator_Force(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	expectConn(mock, true)
+	expectSetVersion(mock, 1, false)
+	expectUnlock(mock)
+
+	assert.NoError(t, migrator.Force(context.Background(), 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Error(t, migrator.Force(context.Background(), -2))
+}
@@ -0,0 +1,66 @@
+package ratelimiter
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Client identifies the caller of a request for rate limiting: by the
+// subject of a valid bearer token in authorization, or else by IP address.
+// remoteAddr is the address of the peer, and forwardedFor the values of
+// X-Forwarded-For, which are only believed as far as they were added by
+// trusted proxies.
+func (rl *RateLimiter) Client(authorization, remoteAddr string, forwardedFor []string) string {
+	if rl.tokens != nil {
+		scheme, raw, found := strings.Cut(authorization, " ")
+		if found && strings.EqualFold(scheme, "Bearer") && raw != "" {
+			if claims, err := rl.tokens.Verify(raw); err == nil && claims.Subject != "" {
+				return "user:" + claims.Subject
+			}
+		}
+	}
+	return "ip:" + rl.clientIP(remoteAddr, forwardedFor)
+}
+
+// clientIP walks X-Forwarded-For from the peer backwards and returns the
+// first address that is not a trusted proxy
+func (rl *RateLimiter) clientIP(remoteAddr string, forwardedFor []string) string {
+	addr, ok := parseAddr(remoteAddr)
+	if !ok {
+		return remoteAddr
+	}
+
+	var hops []string
+	for _, value := range forwardedFor {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && rl.trusted(addr); i-- {
+		hop, ok := parseAddr(strings.TrimSpace(hops[i]))
+		if !ok {
+			break // Whatever precedes a malformed hop cannot be trusted either
+		}
+		addr = hop
+	}
+	return addr.String()
+}
+
+func (rl *RateLimiter) trusted(addr netip.Addr) bool {
+	for _, prefix := range rl.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr parses an IP address with or without a port
+func parseAddr(s string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,43 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+)
+
+// sweepInterval is how often the memory store forgets clients whose quota is full
+const sweepInterval = time.Minute
+
+// memoryStore keeps quotas in process, limiting each replica on its own
+type memoryStore struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{tats: make(map[string]time.Time), now: time.Now}
+}
+
+func (m *memoryStore) allow(_ context.Context, key string, quota config.RateQuota) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		for k, tat := range m.tats {
+			if tat.Before(now) {
+				delete(m.tats, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	tat, result := gcra(now, m.tats[key], quota)
+	m.tats[key] = tat
+	return result, nil
+}
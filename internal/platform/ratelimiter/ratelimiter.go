@@ -1,28 +1,138 @@
 package ratelimiter
 
 import (
+	"context"
+	"math"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
 	"github.com/bentalebwael/faceit-users-service/internal/config"
-	"golang.org/x/time/rate"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
 )
 
-// RateLimiter wraps the standard library rate limiter with our configuration
+// Result is the outcome of a rate limited request and the state of the
+// client's quota after it
+type Result struct {
+	Allowed    bool
+	Limit      int           // Requests the client may make at once
+	Remaining  int           // Requests the client may still make at once
+	Reset      time.Duration // Time until the quota is full again
+	RetryAfter time.Duration // Time until a rejected request may be retried
+}
+
+// store keeps the state of the quotas under their keys
+type store interface {
+	allow(ctx context.Context, key string, quota config.RateQuota) (Result, error)
+}
+
+// RateLimiter limits the rate of requests of each client to each route. The
+// quotas are the same on every replica, and with the Redis backend so are the
+// request counts, so the limits hold for the service as a whole.
 type RateLimiter struct {
-	limiter *rate.Limiter
+	store          store
+	quota          config.RateQuota
+	routes         map[string]config.RateQuota
+	trustedProxies []netip.Prefix
+	tokens         *token.Manager
+}
+
+// Option configures a RateLimiter
+type Option func(*RateLimiter)
+
+// WithRedis keeps the request counts in client when the Redis backend is
+// configured
+func WithRedis(client *redis.Client) Option {
+	return func(rl *RateLimiter) {
+		rl.store = newRedisStore(client)
+	}
+}
+
+// WithTokens identifies clients presenting a valid access token by its
+// subject rather than by their IP address
+func WithTokens(tokens *token.Manager) Option {
+	return func(rl *RateLimiter) {
+		rl.tokens = tokens
+	}
 }
 
 // NewLimiter creates a new rate limiter with the specified configuration
-func NewLimiter(cfg *config.Config) *RateLimiter {
-	limit := rate.Limit(cfg.Rate.RequestsPerSecond)
-	burst := cfg.Rate.Burst
+func NewLimiter(cfg *config.Config, opts ...Option) *RateLimiter {
+	rl := &RateLimiter{
+		quota:          config.RateQuota{RequestsPerSecond: float64(cfg.Rate.RequestsPerSecond), Burst: cfg.Rate.Burst},
+		routes:         cfg.Rate.Routes,
+		trustedProxies: cfg.Rate.TrustedProxies,
+	}
+	for _, opt := range opts {
+		opt(rl)
+	}
+	if rl.store == nil || cfg.Rate.Backend != "redis" {
+		rl.store = newMemoryStore()
+	}
+	return rl
+}
+
+// Allow counts a request of client to route, which is a REST route such as
+// "POST /api/v1/users" or a gRPC method, against the quota of the route. If
+// the quota cannot be checked the request is allowed and the error returned.
+func (rl *RateLimiter) Allow(ctx context.Context, route, client string) (Result, error) {
+	quota, ok := rl.routes[route]
+	if !ok {
+		quota = rl.quota
+	}
+
+	result, err := rl.store.allow(ctx, route+"|"+client, quota)
+	if err != nil {
+		return Result{Allowed: true, Limit: quota.Burst, Remaining: quota.Burst}, err
+	}
+	return result, nil
+}
 
-	limiter := rate.NewLimiter(limit, burst)
+// gcra applies the generic cell rate algorithm to a request at now. tat is
+// the theoretical arrival time of the next request when the quota is in use;
+// the new one is returned along with the result.
+func gcra(now, tat time.Time, quota config.RateQuota) (time.Time, Result) {
+	interval := time.Duration(float64(time.Second) / quota.RequestsPerSecond)
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTAT := tat.Add(interval)
+	allowAt := newTAT.Add(-interval * time.Duration(quota.Burst))
+	if now.Before(allowAt) {
+		return tat, Result{
+			Limit:      quota.Burst,
+			Reset:      tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}
+	}
 
-	return &RateLimiter{
-		limiter: limiter,
+	return newTAT, Result{
+		Allowed:   true,
+		Limit:     quota.Burst,
+		Remaining: int(math.Floor(float64(now.Sub(allowAt)) / float64(interval))),
+		Reset:     newTAT.Sub(now),
+	}
+}
+
+// Fields returns the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// fields describing the result, and Retry-After if the request was rejected,
+// for use as HTTP headers or gRPC trailers. Durations are in whole seconds,
+// rounded up.
+func (r Result) Fields() map[string]string {
+	fields := map[string]string{
+		"RateLimit-Limit":     strconv.Itoa(r.Limit),
+		"RateLimit-Remaining": strconv.Itoa(r.Remaining),
+		"RateLimit-Reset":     strconv.Itoa(seconds(r.Reset)),
+	}
+	if !r.Allowed {
+		fields["Retry-After"] = strconv.Itoa(seconds(r.RetryAfter))
 	}
+	return fields
 }
 
-// Allow returns true if a request should be allowed, false if it should be rejected
-func (rl *RateLimiter) Allow() bool {
-	return rl.limiter.Allow()
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
@@ -1,10 +1,17 @@
 package ratelimiter
 
 import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/go-redis/redismock/v9"
+
 	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/platform/token"
 )
 
 func TestNewLimiter(t *testing.T) {
@@ -45,8 +52,8 @@ func TestNewLimiter(t *testing.T) {
 				return
 			}
 
-			if limiter.limiter == nil {
-				t.Error("NewLimiter() internal limiter is nil")
+			if _, ok := limiter.store.(*memoryStore); !ok {
+				t.Errorf("NewLimiter() store = %T, want the memory store without Redis", limiter.store)
 			}
 		})
 	}
@@ -115,7 +122,7 @@ func TestRateLimiter_Allow(t *testing.T) {
 			rejected := 0
 
 			for i := 0; i < tt.requests; i++ {
-				if limiter.Allow() {
+				if allow(limiter, "GET /api/v1/users", "ip:192.0.2.1") {
 					allowed++
 				} else {
 					rejected++
@@ -146,17 +153,17 @@ func TestRateLimiter_RateRecovery(t *testing.T) {
 
 	limiter := NewLimiter(cfg)
 
-	if !limiter.Allow() {
+	if !allow(limiter, "GET /api/v1/users", "ip:192.0.2.1") {
 		t.Error("First request was not allowed")
 	}
 
-	if limiter.Allow() {
+	if allow(limiter, "GET /api/v1/users", "ip:192.0.2.1") {
 		t.Error("Second immediate request was allowed when it should have been rejected")
 	}
 
 	time.Sleep(time.Second / 2)
 
-	if !limiter.Allow() {
+	if !allow(limiter, "GET /api/v1/users", "ip:192.0.2.1") {
 		t.Error("Request after waiting was not allowed")
 	}
 }
@@ -177,7 +184,7 @@ func TestRateLimiter_Concurrent(t *testing.T) {
 	for i := 0; i < numGoroutines; i++ {
 		go func() {
 			for j := 0; j < requestsPerGoroutine; j++ {
-				limiter.Allow()
+				allow(limiter, "GET /api/v1/users", "ip:192.0.2.1")
 				time.Sleep(time.Millisecond)
 			}
 			done <- true
@@ -188,3 +195,160 @@ func TestRateLimiter_Concurrent(t *testing.T) {
 		<-done
 	}
 }
+
+// allow reports whether a request of client to route is allowed
+func allow(limiter *RateLimiter, route, client string) bool {
+	result, _ := limiter.Allow(context.Background(), route, client)
+	return result.Allowed
+}
+
+func TestRateLimiter_RoutesAndClients(t *testing.T) {
+	cfg := &config.Config{
+		Rate: config.RateConfig{
+			RequestsPerSecond: 1,
+			Burst:             3,
+			Routes: map[string]config.RateQuota{
+				"POST /api/v1/auth/login": {RequestsPerSecond: 0.5, Burst: 1},
+			},
+		},
+	}
+	limiter := NewLimiter(cfg)
+
+	if !allow(limiter, "POST /api/v1/auth/login", "ip:192.0.2.1") {
+		t.Error("First login was not allowed")
+	}
+	if allow(limiter, "POST /api/v1/auth/login", "ip:192.0.2.1") {
+		t.Error("Second login was allowed over the route quota")
+	}
+	if !allow(limiter, "POST /api/v1/auth/login", "ip:192.0.2.2") {
+		t.Error("Login of another client was not allowed")
+	}
+	for i := 0; i < 3; i++ {
+		if !allow(limiter, "GET /api/v1/users", "ip:192.0.2.1") {
+			t.Errorf("Request %d to another route was not allowed", i+1)
+		}
+	}
+}
+
+func TestRateLimiter_Result(t *testing.T) {
+	cfg := &config.Config{Rate: config.RateConfig{RequestsPerSecond: 2, Burst: 3}}
+	limiter := NewLimiter(cfg)
+	store := limiter.store.(*memoryStore)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	want := []Result{
+		{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond},
+		{Allowed: true, Limit: 3, Remaining: 1, Reset: time.Second},
+		{Allowed: true, Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond},
+		{Allowed: false, Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond, RetryAfter: 500 * time.Millisecond},
+	}
+	for i, w := range want {
+		got, err := limiter.Allow(context.Background(), "GET /api/v1/users", "ip:192.0.2.1")
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		if got != w {
+			t.Errorf("request %d: Allow() = %+v, want %+v", i+1, got, w)
+		}
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !allow(limiter, "GET /api/v1/users", "ip:192.0.2.1") {
+		t.Error("Request after Retry-After was not allowed")
+	}
+
+	fields := want[3].Fields()
+	wantFields := map[string]string{
+		"RateLimit-Limit":     "3",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "2",
+		"Retry-After":         "1",
+	}
+	if !reflect.DeepEqual(fields, wantFields) {
+		t.Errorf("Fields() = %v, want %v", fields, wantFields)
+	}
+}
+
+func TestRateLimiter_Redis(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	defer db.Close()
+
+	cfg := &config.Config{Rate: config.RateConfig{RequestsPerSecond: 5, Burst: 10, Backend: "redis"}}
+	limiter := NewLimiter(cfg, WithRedis(db))
+	key := "ratelimit:GET /api/v1/users|ip:192.0.2.1"
+
+	mock.ExpectEvalSha(gcraScript.Hash(), []string{key}, int64(200000), 10).
+		SetVal([]interface{}{int64(0), int64(0), int64(150000), int64(2000000)})
+	got, err := limiter.Allow(context.Background(), "GET /api/v1/users", "ip:192.0.2.1")
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	want := Result{Limit: 10, RetryAfter: 150 * time.Millisecond, Reset: 2 * time.Second}
+	if got != want {
+		t.Errorf("Allow() = %+v, want %+v", got, want)
+	}
+
+	mock.ExpectEvalSha(gcraScript.Hash(), []string{key}, int64(200000), 10).SetErr(errors.New("connection refused"))
+	got, err = limiter.Allow(context.Background(), "GET /api/v1/users", "ip:192.0.2.1")
+	if err == nil {
+		t.Error("Allow() error = nil, want the Redis error")
+	}
+	if !got.Allowed {
+		t.Error("Allow() rejected the request when Redis failed, want it allowed")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRateLimiter_Client(t *testing.T) {
+	cfg := &config.Config{
+		Rate: config.RateConfig{
+			RequestsPerSecond: 1,
+			Burst:             1,
+			TrustedProxies:    []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		},
+		Auth: config.AuthConfig{
+			JWTAlgorithm: "HS256",
+			JWTSecret:    "test-secret",
+			JWTKeyID:     "test",
+			JWTIssuer:    "user-service",
+			JWTTTL:       time.Hour,
+		},
+	}
+	tokens, err := token.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	accessToken, _, err := tokens.Issue("user-1", nil)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	limiter := NewLimiter(cfg, WithTokens(tokens))
+
+	tests := []struct {
+		name          string
+		authorization string
+		remoteAddr    string
+		forwardedFor  []string
+		want          string
+	}{
+		{name: "token subject", authorization: "Bearer " + accessToken, remoteAddr: "192.0.2.1:1234", want: "user:user-1"},
+		{name: "invalid token", authorization: "Bearer nope", remoteAddr: "192.0.2.1:1234", want: "ip:192.0.2.1"},
+		{name: "untrusted peer", remoteAddr: "192.0.2.1:1234", forwardedFor: []string{"198.51.100.7"}, want: "ip:192.0.2.1"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:1234", forwardedFor: []string{"198.51.100.7"}, want: "ip:198.51.100.7"},
+		{name: "chain of proxies", remoteAddr: "10.0.0.2:1234", forwardedFor: []string{"203.0.113.9, 198.51.100.7", "10.0.0.3"}, want: "ip:198.51.100.7"},
+		{name: "malformed hop", remoteAddr: "10.0.0.2:1234", forwardedFor: []string{"198.51.100.7, garbage"}, want: "ip:10.0.0.2"},
+		{name: "ipv6 peer", remoteAddr: "[2001:db8::1]:1234", want: "ip:2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limiter.Client(tt.authorization, tt.remoteAddr, tt.forwardedFor); got != tt.want {
+				t.Errorf("Client() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
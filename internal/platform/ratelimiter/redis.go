@@ -0,0 +1,67 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+)
+
+// redisKeyPrefix namespaces the quota keys
+const redisKeyPrefix = "ratelimit:"
+
+// gcraScript is gcra run atomically in Redis on its clock, so that replicas
+// with skewed clocks agree. Times are in microseconds. It returns whether the
+// request is allowed, the remaining requests, the retry delay and the time
+// until the quota is full.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+  tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - interval * burst
+if now < allow_at then
+  return {0, 0, allow_at - now, tat - now}
+end
+
+redis.call('SET', KEYS[1], new_tat, 'PX', math.ceil((new_tat - now) / 1000))
+return {1, math.floor((now - allow_at) / interval), 0, new_tat - now}
+`)
+
+// redisStore keeps quotas in Redis, shared by every replica
+type redisStore struct {
+	client *redis.Client
+}
+
+func newRedisStore(client *redis.Client) *redisStore {
+	return &redisStore{client: client}
+}
+
+func (r *redisStore) allow(ctx context.Context, key string, quota config.RateQuota) (Result, error) {
+	interval := time.Duration(float64(time.Second) / quota.RequestsPerSecond).Microseconds()
+	values, err := gcraScript.Run(ctx, r.client, []string{redisKeyPrefix + key}, interval, quota.Burst).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("error checking rate limit: %w", err)
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("error checking rate limit: unexpected script result %v", values)
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      quota.Burst,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		Reset:      time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
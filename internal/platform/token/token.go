@@ -0,0 +1,184 @@
+package token
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+)
+
+// ErrInvalidToken is returned when a token is malformed, expired or not signed by us
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the JWT claims issued by this service
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+// HasRole reports whether the claims grant the given role
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// JWK is a single JSON Web Key as defined by RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS is a JSON Web Key Set document
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Manager signs and verifies access tokens
+type Manager struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	keyID     string
+	issuer    string
+	ttl       time.Duration
+	jwks      JWKS
+}
+
+// NewManager creates a token manager from the auth configuration.
+// HS256 uses the shared JWT_SECRET, RS256 loads an RSA private key either
+// inline from JWT_PRIVATE_KEY or from the file at JWT_PRIVATE_KEY_FILE.
+func NewManager(cfg *config.Config) (*Manager, error) {
+	m := &Manager{
+		keyID:  cfg.Auth.JWTKeyID,
+		issuer: cfg.Auth.JWTIssuer,
+		ttl:    cfg.Auth.JWTTTL,
+		jwks:   JWKS{Keys: []JWK{}},
+	}
+
+	switch strings.ToUpper(cfg.Auth.JWTAlgorithm) {
+	case "HS256":
+		if cfg.Auth.JWTSecret == "" {
+			return nil, errors.New("JWT secret is required for HS256")
+		}
+		m.method = jwt.SigningMethodHS256
+		m.signKey = []byte(cfg.Auth.JWTSecret)
+		m.verifyKey = []byte(cfg.Auth.JWTSecret)
+	case "RS256":
+		key, err := loadRSAPrivateKey(cfg.Auth.JWTPrivateKey, cfg.Auth.JWTPrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		m.method = jwt.SigningMethodRS256
+		m.signKey = key
+		m.verifyKey = &key.PublicKey
+		// Only asymmetric keys are published; a shared secret must never be exposed.
+		m.jwks.Keys = append(m.jwks.Keys, rsaJWK(&key.PublicKey, m.keyID))
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %s", cfg.Auth.JWTAlgorithm)
+	}
+
+	return m, nil
+}
+
+// Issue signs a new access token for the given subject
+func (m *Manager) Issue(subject string, roles []string) (string, time.Time, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(m.ttl)
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Roles: roles,
+	}
+
+	t := jwt.NewWithClaims(m.method, claims)
+	t.Header["kid"] = m.keyID
+
+	signed, err := t.SignedString(m.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// Verify parses a token and checks its signature, algorithm, issuer and expiry
+func (m *Manager) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims,
+		func(t *jwt.Token) (interface{}, error) { return m.verifyKey, nil },
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys that can be used to verify issued tokens
+func (m *Manager) JWKS() JWKS {
+	return m.jwks
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the verified claims
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the verified claims stored in ctx, if any
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+func loadRSAPrivateKey(inline, path string) (*rsa.PrivateKey, error) {
+	pemData := []byte(inline)
+	if inline == "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT private key file: %w", err)
+		}
+		pemData = data
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT private key: %w", err)
+	}
+	return key, nil
+}
+
+func rsaJWK(key *rsa.PublicKey, keyID string) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		Kid: keyID,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
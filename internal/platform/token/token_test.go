@@ -0,0 +1,177 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+)
+
+func hsConfig(secret string) *config.Config {
+	return &config.Config{
+		Auth: config.AuthConfig{
+			JWTAlgorithm: "HS256",
+			JWTSecret:    secret,
+			JWTKeyID:     "test",
+			JWTIssuer:    "user-service",
+			JWTTTL:       time.Hour,
+		},
+	}
+}
+
+func rsaPEM(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+}
+
+func TestNewManager(t *testing.T) {
+	keyPEM := rsaPEM(t)
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	require.NoError(t, os.WriteFile(keyFile, []byte(keyPEM), 0o600))
+
+	tests := []struct {
+		name     string
+		auth     config.AuthConfig
+		wantKeys int
+		wantErr  bool
+	}{
+		{
+			name:     "hs256",
+			auth:     config.AuthConfig{JWTAlgorithm: "HS256", JWTSecret: "secret"},
+			wantKeys: 0,
+		},
+		{
+			name:    "hs256 without secret",
+			auth:    config.AuthConfig{JWTAlgorithm: "HS256"},
+			wantErr: true,
+		},
+		{
+			name:     "rs256 inline key",
+			auth:     config.AuthConfig{JWTAlgorithm: "RS256", JWTPrivateKey: keyPEM},
+			wantKeys: 1,
+		},
+		{
+			name:     "rs256 key file",
+			auth:     config.AuthConfig{JWTAlgorithm: "RS256", JWTPrivateKeyFile: keyFile},
+			wantKeys: 1,
+		},
+		{
+			name:    "rs256 missing file",
+			auth:    config.AuthConfig{JWTAlgorithm: "RS256", JWTPrivateKeyFile: filepath.Join(t.TempDir(), "missing.pem")},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported algorithm",
+			auth:    config.AuthConfig{JWTAlgorithm: "none"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewManager(&config.Config{Auth: tt.auth})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, m.JWKS().Keys, tt.wantKeys)
+		})
+	}
+}
+
+func TestManager_IssueAndVerify(t *testing.T) {
+	rsCfg := hsConfig("")
+	rsCfg.Auth.JWTAlgorithm = "RS256"
+	rsCfg.Auth.JWTPrivateKey = rsaPEM(t)
+
+	for name, cfg := range map[string]*config.Config{"HS256": hsConfig("secret"), "RS256": rsCfg} {
+		t.Run(name, func(t *testing.T) {
+			m, err := NewManager(cfg)
+			require.NoError(t, err)
+
+			signed, expiresAt, err := m.Issue("user-1", []string{"admin"})
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+			claims, err := m.Verify(signed)
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", claims.Subject)
+			assert.True(t, claims.HasRole("admin"))
+			assert.False(t, claims.HasRole("moderator"))
+		})
+	}
+}
+
+func TestManager_Verify_Rejects(t *testing.T) {
+	m, err := NewManager(hsConfig("secret"))
+	require.NoError(t, err)
+
+	other, err := NewManager(hsConfig("other-secret"))
+	require.NoError(t, err)
+	foreign, _, err := other.Issue("user-1", nil)
+	require.NoError(t, err)
+
+	expiredCfg := hsConfig("secret")
+	expiredCfg.Auth.JWTTTL = -time.Minute
+	expiredManager, err := NewManager(expiredCfg)
+	require.NoError(t, err)
+	expired, _, err := expiredManager.Issue("user-1", nil)
+	require.NoError(t, err)
+
+	otherIssuerCfg := hsConfig("secret")
+	otherIssuerCfg.Auth.JWTIssuer = "someone-else"
+	otherIssuer, err := NewManager(otherIssuerCfg)
+	require.NoError(t, err)
+	wrongIssuer, _, err := otherIssuer.Issue("user-1", nil)
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"malformed":     "not-a-jwt",
+		"wrong key":     foreign,
+		"expired":       expired,
+		"wrong issuer":  wrongIssuer,
+		"empty subject": mustIssue(t, m, ""),
+	}
+
+	for name, tok := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := m.Verify(tok)
+			assert.True(t, errors.Is(err, ErrInvalidToken), "error = %v", err)
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	claims := &Claims{}
+	claims.Subject = "user-1"
+	got, ok := FromContext(NewContext(context.Background(), claims))
+	assert.True(t, ok)
+	assert.Equal(t, claims, got)
+}
+
+func mustIssue(t *testing.T, m *Manager, subject string) string {
+	t.Helper()
+	signed, _, err := m.Issue(subject, nil)
+	require.NoError(t, err)
+	return signed
+}
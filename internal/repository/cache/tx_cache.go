@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// txCache is the repository a unit of work of the CacheDecorator hands to its
+// function. Reads go straight to the transaction, so they see its own writes
+// and count towards its isolation, and writes record the users whose cache
+// entries must be evicted after commit.
+type txCache struct {
+	repo  user.Repository
+	cache *CacheDecorator
+	stale []user.User
+}
+
+func (t *txCache) Create(ctx context.Context, u *user.User) error {
+	if err := t.repo.Create(ctx, u); err != nil {
+		return err
+	}
+	t.evict(u)
+	return nil
+}
+
+func (t *txCache) CreateBatch(ctx context.Context, users []*user.User) error {
+	if err := t.repo.CreateBatch(ctx, users); err != nil {
+		return err
+	}
+	for _, u := range users {
+		t.evict(u)
+	}
+	return nil
+}
+
+func (t *txCache) Taken(ctx context.Context, emails, nicknames []string) ([]string, []string, error) {
+	return t.repo.Taken(ctx, emails, nicknames)
+}
+
+func (t *txCache) GetByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	return t.repo.GetByID(ctx, id)
+}
+
+func (t *txCache) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]user.User, error) {
+	return t.repo.GetByIDs(ctx, ids)
+}
+
+func (t *txCache) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	return t.repo.GetByEmail(ctx, email)
+}
+
+func (t *txCache) GetByNickname(ctx context.Context, nickname string) (*user.User, error) {
+	return t.repo.GetByNickname(ctx, nickname)
+}
+
+func (t *txCache) Update(ctx context.Context, u *user.User) error {
+	oldUser, err := t.repo.GetByID(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := t.repo.Update(ctx, u); err != nil {
+		return err
+	}
+
+	// Entries under the old email and nickname must go as well as the new ones
+	t.evict(oldUser)
+	t.evict(u)
+	return nil
+}
+
+func (t *txCache) SetCountry(ctx context.Context, ids []uuid.UUID, country string) ([]user.User, error) {
+	users, err := t.repo.SetCountry(ctx, ids, country)
+	if err != nil {
+		return nil, err
+	}
+
+	// The country is in no cache key, so the entries of the users as saved
+	// are all there is to evict
+	for i := range users {
+		t.evict(&users[i])
+	}
+	return users, nil
+}
+
+func (t *txCache) Delete(ctx context.Context, id uuid.UUID) error {
+	u, err := t.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := t.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	t.evict(u)
+	return nil
+}
+
+func (t *txCache) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) error {
+	if err := t.repo.Restore(ctx, id, deletedAfter); err != nil {
+		return err
+	}
+
+	restoredUser, err := t.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	t.evict(restoredUser)
+	return nil
+}
+
+func (t *txCache) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]user.User, error) {
+	users, err := t.repo.Purge(ctx, deletedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		t.evict(&users[i])
+	}
+	return users, nil
+}
+
+func (t *txCache) Erase(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	u, err := t.repo.Erase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	t.evict(u)
+	return u, nil
+}
+
+func (t *txCache) List(ctx context.Context, params user.ListParams) ([]user.User, int64, error) {
+	return t.repo.List(ctx, params)
+}
+
+func (t *txCache) Search(ctx context.Context, query string, limit int) ([]user.SearchResult, error) {
+	return t.repo.Search(ctx, query, limit)
+}
+
+// WithTx joins the unit of work t belongs to
+func (t *txCache) WithTx(ctx context.Context, fn func(ctx context.Context, repo user.Repository) error) error {
+	return t.repo.WithTx(ctx, func(ctx context.Context, _ user.Repository) error {
+		return fn(ctx, t)
+	})
+}
+
+// evict keeps a copy of u, whose fields the caller may change later on
+func (t *txCache) evict(u *user.User) {
+	t.stale = append(t.stale, *u)
+}
@@ -22,17 +22,34 @@ const (
 
 // CacheDecorator wraps a user.Repository with caching functionality
 type CacheDecorator struct {
-	repo  user.Repository
-	redis *redis.Client
-	ttl   time.Duration
+	repo        user.Repository
+	redis       *redis.Client
+	ttl         time.Duration
+	bypassReads bool
 }
 
-func NewCacheDecorator(repo user.Repository, redis *redis.Client, cfg *config.RedisConfig) *CacheDecorator {
-	return &CacheDecorator{
+// Option configures a CacheDecorator
+type Option func(*CacheDecorator)
+
+// WithoutCachedReads makes reads go straight to the repository, neither
+// served from nor stored in the cache, while writes still evict the entries
+// of the users they change so that other readers do not see stale users
+func WithoutCachedReads() Option {
+	return func(c *CacheDecorator) {
+		c.bypassReads = true
+	}
+}
+
+func NewCacheDecorator(repo user.Repository, redis *redis.Client, cfg *config.RedisConfig, opts ...Option) *CacheDecorator {
+	c := &CacheDecorator{
 		repo:  repo,
 		redis: redis,
 		ttl:   cfg.CacheTTL,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *CacheDecorator) Create(ctx context.Context, u *user.User) error {
@@ -47,7 +64,21 @@ func (c *CacheDecorator) Create(ctx context.Context, u *user.User) error {
 	return nil
 }
 
+// CreateBatch leaves the new users to be cached by their first read rather
+// than writing a whole batch to Redis at once
+func (c *CacheDecorator) CreateBatch(ctx context.Context, users []*user.User) error {
+	return c.repo.CreateBatch(ctx, users)
+}
+
+// Taken must also see soft deleted users, which are never cached
+func (c *CacheDecorator) Taken(ctx context.Context, emails, nicknames []string) ([]string, []string, error) {
+	return c.repo.Taken(ctx, emails, nicknames)
+}
+
 func (c *CacheDecorator) GetByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	if c.bypassReads {
+		return c.repo.GetByID(ctx, id)
+	}
 	if u, err := c.getUserFromCache(ctx, userKey(id)); err == nil {
 		return u, nil
 	}
@@ -64,7 +95,55 @@ func (c *CacheDecorator) GetByID(ctx context.Context, id uuid.UUID) (*user.User,
 	return u, nil
 }
 
+// GetByIDs reads all the users from Redis in one round trip, fetches the
+// misses from the repository and caches them
+func (c *CacheDecorator) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]user.User, error) {
+	if c.bypassReads {
+		return c.repo.GetByIDs(ctx, ids)
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = userKey(id)
+	}
+
+	users := make([]user.User, 0, len(ids))
+	misses := ids
+	// A failing cache is bypassed like on single reads
+	if values, err := c.redis.MGet(ctx, keys...).Result(); err == nil {
+		misses = make([]uuid.UUID, 0, len(ids))
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				misses = append(misses, ids[i])
+				continue
+			}
+			u, err := unmarshalUser([]byte(data))
+			if err != nil {
+				misses = append(misses, ids[i])
+				continue
+			}
+			users = append(users, *u)
+		}
+	}
+	if len(misses) == 0 {
+		return users, nil
+	}
+
+	fetched, err := c.repo.GetByIDs(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.cacheUsers(ctx, fetched); err != nil {
+		return nil, fmt.Errorf("error caching users: %w", err)
+	}
+
+	return append(users, fetched...), nil
+}
+
 func (c *CacheDecorator) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	if c.bypassReads {
+		return c.repo.GetByEmail(ctx, email)
+	}
 	if u, err := c.getUserFromCache(ctx, emailKey(email)); err == nil {
 		return u, nil
 	}
@@ -82,6 +161,9 @@ func (c *CacheDecorator) GetByEmail(ctx context.Context, email string) (*user.Us
 }
 
 func (c *CacheDecorator) GetByNickname(ctx context.Context, nickname string) (*user.User, error) {
+	if c.bypassReads {
+		return c.repo.GetByNickname(ctx, nickname)
+	}
 	if u, err := c.getUserFromCache(ctx, nickKey(nickname)); err == nil {
 		return u, nil
 	}
@@ -123,6 +205,21 @@ func (c *CacheDecorator) Update(ctx context.Context, u *user.User) error {
 	return nil
 }
 
+func (c *CacheDecorator) SetCountry(ctx context.Context, ids []uuid.UUID, country string) ([]user.User, error) {
+	users, err := c.repo.SetCountry(ctx, ids, country)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		if err := c.invalidateUserCache(ctx, &users[i]); err != nil {
+			return users, fmt.Errorf("error invalidating cache: %w", err)
+		}
+	}
+
+	return users, nil
+}
+
 func (c *CacheDecorator) Delete(ctx context.Context, id uuid.UUID) error {
 	u, err := c.repo.GetByID(ctx, id)
 	if err != nil {
@@ -140,14 +237,87 @@ func (c *CacheDecorator) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+func (c *CacheDecorator) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) error {
+	if err := c.repo.Restore(ctx, id, deletedAfter); err != nil {
+		return err
+	}
+
+	restoredUser, err := c.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := c.cacheUser(ctx, restoredUser); err != nil {
+		return fmt.Errorf("error caching restored user: %w", err)
+	}
+
+	return nil
+}
+
+func (c *CacheDecorator) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]user.User, error) {
+	users, err := c.repo.Purge(ctx, deletedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleted users are already evicted, this only guards against entries
+	// written by a racing read before the soft delete committed.
+	for i := range users {
+		if err := c.invalidateUserCache(ctx, &users[i]); err != nil {
+			return users, fmt.Errorf("error invalidating cache: %w", err)
+		}
+	}
+
+	return users, nil
+}
+
+func (c *CacheDecorator) Erase(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	u, err := c.repo.Erase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.invalidateUserCache(ctx, u); err != nil {
+		return u, fmt.Errorf("error invalidating cache: %w", err)
+	}
+
+	return u, nil
+}
+
 func (c *CacheDecorator) List(ctx context.Context, params user.ListParams) ([]user.User, int64, error) {
 	// Currently bypasses cache for list operations.
 	// Caching list results requires more complex invalidation strategies.
 	return c.repo.List(ctx, params)
 }
 
+func (c *CacheDecorator) Search(ctx context.Context, query string, limit int) ([]user.SearchResult, error) {
+	// Search results are ranked over all users and bypass the cache like lists
+	return c.repo.Search(ctx, query, limit)
+}
+
+// WithTx runs fn as a unit of work of the wrapped repository. Inside it, reads
+// bypass the cache and writes only note which users to evict: the cache is
+// updated once the unit of work commits, so it never holds changes that were
+// rolled back.
+func (c *CacheDecorator) WithTx(ctx context.Context, fn func(ctx context.Context, repo user.Repository) error) error {
+	var tx *txCache
+	err := c.repo.WithTx(ctx, func(ctx context.Context, repo user.Repository) error {
+		tx = &txCache{repo: repo, cache: c} // A retried attempt starts over with nothing to evict
+		return fn(ctx, tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range tx.stale {
+		if err := c.invalidateUserCache(ctx, &tx.stale[i]); err != nil {
+			return fmt.Errorf("error invalidating cache: %w", err)
+		}
+	}
+	return nil
+}
+
 func (c *CacheDecorator) cacheUser(ctx context.Context, u *user.User) error {
-	data, err := json.Marshal(u)
+	data, err := marshalUser(u)
 	if err != nil {
 		return fmt.Errorf("error marshaling user: %w", err)
 	}
@@ -164,18 +334,38 @@ func (c *CacheDecorator) cacheUser(ctx context.Context, u *user.User) error {
 	return nil
 }
 
+// cacheUsers caches users in a single pipeline
+func (c *CacheDecorator) cacheUsers(ctx context.Context, users []user.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	pipe := c.redis.Pipeline()
+	for i := range users {
+		u := &users[i]
+		data, err := marshalUser(u)
+		if err != nil {
+			return fmt.Errorf("error marshaling user: %w", err)
+		}
+		pipe.Set(ctx, userKey(u.ID), data, c.ttl)
+		pipe.Set(ctx, emailKey(u.Email), data, c.ttl)
+		pipe.Set(ctx, nickKey(u.Nickname), data, c.ttl)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error executing cache pipeline: %w", err)
+	}
+
+	return nil
+}
+
 func (c *CacheDecorator) getUserFromCache(ctx context.Context, key string) (*user.User, error) {
 	data, err := c.redis.Get(ctx, key).Bytes()
 	if err != nil {
 		return nil, err
 	}
 
-	var u user.User
-	if err := json.Unmarshal(data, &u); err != nil {
-		return nil, fmt.Errorf("error unmarshaling user: %w", err)
-	}
-
-	return &u, nil
+	return unmarshalUser(data)
 }
 
 func (c *CacheDecorator) invalidateUserCache(ctx context.Context, u *user.User) error {
@@ -191,6 +381,21 @@ func (c *CacheDecorator) invalidateUserCache(ctx context.Context, u *user.User)
 	return nil
 }
 
+// marshalUser encodes u for Redis. The password hash is hidden from JSON, so
+// it never reaches the cache and users read from it have none; credentials are
+// checked against users read from Postgres in a unit of work.
+func marshalUser(u *user.User) ([]byte, error) {
+	return json.Marshal(u)
+}
+
+func unmarshalUser(data []byte) (*user.User, error) {
+	u := &user.User{}
+	if err := json.Unmarshal(data, u); err != nil {
+		return nil, fmt.Errorf("error unmarshaling user: %w", err)
+	}
+	return u, nil
+}
+
 func userKey(id uuid.UUID) string {
 	return fmt.Sprintf("%s%s", userKeyPrefix, id.String())
 }
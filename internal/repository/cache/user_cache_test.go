@@ -2,7 +2,6 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"testing"
 	"time"
@@ -27,6 +26,23 @@ func (m *MockUserRepository) Create(ctx context.Context, u *user.User) error {
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) CreateBatch(ctx context.Context, users []*user.User) error {
+	args := m.Called(ctx, users)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Taken(ctx context.Context, emails, nicknames []string) ([]string, []string, error) {
+	args := m.Called(ctx, emails, nicknames)
+	var takenEmails, takenNicknames []string
+	if ret := args.Get(0); ret != nil {
+		takenEmails = ret.([]string)
+	}
+	if ret := args.Get(1); ret != nil {
+		takenNicknames = ret.([]string)
+	}
+	return takenEmails, takenNicknames, args.Error(2)
+}
+
 func (m *MockUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
 	args := m.Called(ctx, id)
 	ret := args.Get(0)
@@ -36,6 +52,15 @@ func (m *MockUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*user.U
 	return ret.(*user.User), args.Error(1)
 }
 
+func (m *MockUserRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]user.User, error) {
+	args := m.Called(ctx, ids)
+	var users []user.User
+	if ret := args.Get(0); ret != nil {
+		users = ret.([]user.User)
+	}
+	return users, args.Error(1)
+}
+
 func (m *MockUserRepository) GetByEmail(ctx context.Context, email string) (*user.User, error) {
 	args := m.Called(ctx, email)
 	ret := args.Get(0)
@@ -64,6 +89,38 @@ func (m *MockUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) error {
+	args := m.Called(ctx, id, deletedAfter)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]user.User, error) {
+	args := m.Called(ctx, deletedBefore, limit)
+	var users []user.User
+	if ret := args.Get(0); ret != nil {
+		users = ret.([]user.User)
+	}
+	return users, args.Error(1)
+}
+
+func (m *MockUserRepository) SetCountry(ctx context.Context, ids []uuid.UUID, country string) ([]user.User, error) {
+	args := m.Called(ctx, ids, country)
+	var users []user.User
+	if ret := args.Get(0); ret != nil {
+		users = ret.([]user.User)
+	}
+	return users, args.Error(1)
+}
+
+func (m *MockUserRepository) Erase(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	args := m.Called(ctx, id)
+	var u *user.User
+	if ret := args.Get(0); ret != nil {
+		u = ret.(*user.User)
+	}
+	return u, args.Error(1)
+}
+
 func (m *MockUserRepository) List(ctx context.Context, params user.ListParams) ([]user.User, int64, error) {
 	args := m.Called(ctx, params)
 	retUsers := args.Get(0)
@@ -79,6 +136,24 @@ func (m *MockUserRepository) List(ctx context.Context, params user.ListParams) (
 	return users, count, args.Error(2)
 }
 
+func (m *MockUserRepository) Search(ctx context.Context, query string, limit int) ([]user.SearchResult, error) {
+	args := m.Called(ctx, query, limit)
+	var results []user.SearchResult
+	if ret := args.Get(0); ret != nil {
+		results = ret.([]user.SearchResult)
+	}
+	return results, args.Error(1)
+}
+
+// WithTx runs fn against the mock itself and then returns the configured
+// error, which stands for the outcome of the commit
+func (m *MockUserRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repo user.Repository) error) error {
+	if err := fn(ctx, m); err != nil {
+		return err
+	}
+	return m.Called(ctx).Error(0)
+}
+
 func setupCacheTest(t *testing.T) (*CacheDecorator, *MockUserRepository, redismock.ClientMock) {
 	mockRepo := new(MockUserRepository)
 	db, mockRedis := redismock.NewClientMock()
@@ -106,7 +181,7 @@ func TestCacheDecorator_Create(t *testing.T) {
 		UpdatedAt: time.Now().UTC(),
 	}
 
-	userData, err := json.Marshal(testUser)
+	userData, err := marshalUser(testUser)
 	require.NoError(t, err)
 
 	t.Run("success", func(t *testing.T) {
@@ -153,7 +228,7 @@ func TestCacheDecorator_GetByID(t *testing.T) {
 	userID := uuid.New()
 
 	testUser := &user.User{ID: userID, Email: "get@id.com", Nickname: "getid"}
-	userData, err := json.Marshal(testUser)
+	userData, err := marshalUser(testUser)
 	require.NoError(t, err)
 
 	t.Run("cache hit", func(t *testing.T) {
@@ -240,6 +315,75 @@ func TestCacheDecorator_GetByID(t *testing.T) {
 	})
 }
 
+func TestCacheDecorator_GetByIDs(t *testing.T) {
+	cache, mockRepo, mockRedis := setupCacheTest(t)
+	ctx := context.Background()
+
+	cached := &user.User{ID: uuid.New(), Email: "cached@ids.com", Nickname: "cachedids"}
+	missed := user.User{ID: uuid.New(), Email: "missed@ids.com", Nickname: "missedids"}
+	unknownID := uuid.New()
+	ids := []uuid.UUID{cached.ID, missed.ID, unknownID}
+
+	cachedData, err := marshalUser(cached)
+	require.NoError(t, err)
+	missedData, err := marshalUser(&missed)
+	require.NoError(t, err)
+
+	t.Run("fetches and caches the misses", func(t *testing.T) {
+		mockRedis.ExpectMGet(userKey(cached.ID), userKey(missed.ID), userKey(unknownID)).SetVal([]interface{}{string(cachedData), nil, nil})
+		mockRepo.On("GetByIDs", ctx, []uuid.UUID{missed.ID, unknownID}).Return([]user.User{missed}, nil).Once()
+		mockRedis.ExpectSet(userKey(missed.ID), missedData, cache.ttl).SetVal("OK")
+		mockRedis.ExpectSet(emailKey(missed.Email), missedData, cache.ttl).SetVal("OK")
+		mockRedis.ExpectSet(nickKey(missed.Nickname), missedData, cache.ttl).SetVal("OK")
+
+		users, err := cache.GetByIDs(ctx, ids)
+		assert.NoError(t, err)
+		assert.Equal(t, []user.User{*cached, missed}, users)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("all cached", func(t *testing.T) {
+		mockRedis.ExpectMGet(userKey(cached.ID)).SetVal([]interface{}{string(cachedData)})
+
+		users, err := cache.GetByIDs(ctx, []uuid.UUID{cached.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, []user.User{*cached}, users)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("cache error falls back to the repository", func(t *testing.T) {
+		mockRedis.ExpectMGet(userKey(cached.ID), userKey(missed.ID), userKey(unknownID)).SetErr(errors.New("redis down"))
+		mockRepo.On("GetByIDs", ctx, ids).Return([]user.User{}, nil).Once()
+
+		users, err := cache.GetByIDs(ctx, ids)
+		assert.NoError(t, err)
+		assert.Empty(t, users)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+}
+
+func TestCacheDecorator_GetByEmail_LeavesOutPasswordHash(t *testing.T) {
+	cache, mockRepo, mockRedis := setupCacheTest(t)
+	ctx := context.Background()
+
+	testUser := &user.User{ID: uuid.New(), Email: "auth@cache.com", Nickname: "authcache", Password: "bcrypt-hash"}
+	userData, err := marshalUser(testUser)
+	require.NoError(t, err)
+	assert.NotContains(t, string(userData), testUser.Password)
+
+	mockRedis.ExpectGet(emailKey(testUser.Email)).SetVal(string(userData))
+
+	result, err := cache.GetByEmail(ctx, testUser.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, testUser.ID, result.ID)
+	assert.Empty(t, result.Password)
+	mockRepo.AssertNotCalled(t, "GetByEmail")
+	assert.NoError(t, mockRedis.ExpectationsWereMet())
+}
+
 // Similar tests should be written for GetByEmail and GetByNickname
 // They follow the same pattern as GetByID, just using different cache keys.
 
@@ -251,7 +395,7 @@ func TestCacheDecorator_Update(t *testing.T) {
 	oldUser := &user.User{ID: userID, Email: "old@update.com", Nickname: "oldupdate"}
 	updatedUser := &user.User{ID: userID, Email: "new@update.com", Nickname: "newupdate"}
 
-	updatedUserData, err := json.Marshal(updatedUser)
+	updatedUserData, err := marshalUser(updatedUser)
 	require.NoError(t, err)
 
 	t.Run("success", func(t *testing.T) {
@@ -393,6 +537,266 @@ func TestCacheDecorator_Delete(t *testing.T) {
 	})
 }
 
+func TestCacheDecorator_Restore(t *testing.T) {
+	cache, mockRepo, mockRedis := setupCacheTest(t)
+	ctx := context.Background()
+	userID := uuid.New()
+	deletedAfter := time.Now().UTC().Add(-time.Hour)
+
+	restoredUser := &user.User{ID: userID, Email: "restore@me.com", Nickname: "restoreme"}
+	restoredUserData, err := marshalUser(restoredUser)
+	require.NoError(t, err)
+
+	t.Run("success re-caches user", func(t *testing.T) {
+		mockRepo.On("Restore", ctx, userID, deletedAfter).Return(nil).Once()
+		mockRepo.On("GetByID", ctx, userID).Return(restoredUser, nil).Once()
+
+		mockRedis.ExpectSet(userKey(restoredUser.ID), restoredUserData, cache.ttl).SetVal("OK")
+		mockRedis.ExpectSet(emailKey(restoredUser.Email), restoredUserData, cache.ttl).SetVal("OK")
+		mockRedis.ExpectSet(nickKey(restoredUser.Nickname), restoredUserData, cache.ttl).SetVal("OK")
+
+		err := cache.Restore(ctx, userID, deletedAfter)
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("Restore error", func(t *testing.T) {
+		mockRepo.On("Restore", ctx, userID, deletedAfter).Return(user.ErrNotFound).Once()
+
+		err := cache.Restore(ctx, userID, deletedAfter)
+		assert.Equal(t, user.ErrNotFound, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+}
+
+func TestCacheDecorator_Purge(t *testing.T) {
+	cache, mockRepo, mockRedis := setupCacheTest(t)
+	ctx := context.Background()
+	deletedBefore := time.Now().UTC().Add(-720 * time.Hour)
+
+	purgedUsers := []user.User{{ID: uuid.New(), Email: "purge@me.com", Nickname: "purgeme"}}
+
+	t.Run("success evicts purged users", func(t *testing.T) {
+		mockRepo.On("Purge", ctx, deletedBefore, 100).Return(purgedUsers, nil).Once()
+
+		mockRedis.ExpectDel(userKey(purgedUsers[0].ID)).SetVal(0)
+		mockRedis.ExpectDel(emailKey(purgedUsers[0].Email)).SetVal(0)
+		mockRedis.ExpectDel(nickKey(purgedUsers[0].Nickname)).SetVal(0)
+
+		users, err := cache.Purge(ctx, deletedBefore, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, purgedUsers, users)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("Purge error", func(t *testing.T) {
+		purgeErr := errors.New("purge repo error")
+		mockRepo.On("Purge", ctx, deletedBefore, 100).Return(nil, purgeErr).Once()
+
+		_, err := cache.Purge(ctx, deletedBefore, 100)
+		assert.Equal(t, purgeErr, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+}
+
+func TestCacheDecorator_SetCountry(t *testing.T) {
+	cache, mockRepo, mockRedis := setupCacheTest(t)
+	ctx := context.Background()
+	ids := []uuid.UUID{uuid.New()}
+
+	movedUsers := []user.User{{ID: ids[0], Email: "move@me.com", Nickname: "moveme", Country: "RS"}}
+
+	t.Run("success evicts moved users", func(t *testing.T) {
+		mockRepo.On("SetCountry", ctx, ids, "RS").Return(movedUsers, nil).Once()
+
+		mockRedis.ExpectDel(userKey(movedUsers[0].ID)).SetVal(1)
+		mockRedis.ExpectDel(emailKey(movedUsers[0].Email)).SetVal(1)
+		mockRedis.ExpectDel(nickKey(movedUsers[0].Nickname)).SetVal(1)
+
+		users, err := cache.SetCountry(ctx, ids, "RS")
+		assert.NoError(t, err)
+		assert.Equal(t, movedUsers, users)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("SetCountry error", func(t *testing.T) {
+		setErr := errors.New("set country repo error")
+		mockRepo.On("SetCountry", ctx, ids, "RS").Return(nil, setErr).Once()
+
+		_, err := cache.SetCountry(ctx, ids, "RS")
+		assert.Equal(t, setErr, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+}
+
+func TestCacheDecorator_Erase(t *testing.T) {
+	cache, mockRepo, mockRedis := setupCacheTest(t)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	erasedUser := &user.User{ID: userID, Email: "erase@me.com", Nickname: "eraseme"}
+
+	t.Run("success evicts the erased user", func(t *testing.T) {
+		mockRepo.On("Erase", ctx, userID).Return(erasedUser, nil).Once()
+
+		mockRedis.ExpectDel(userKey(erasedUser.ID)).SetVal(1)
+		mockRedis.ExpectDel(emailKey(erasedUser.Email)).SetVal(1)
+		mockRedis.ExpectDel(nickKey(erasedUser.Nickname)).SetVal(1)
+
+		u, err := cache.Erase(ctx, userID)
+		assert.NoError(t, err)
+		assert.Equal(t, erasedUser, u)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("Erase error", func(t *testing.T) {
+		mockRepo.On("Erase", ctx, userID).Return(nil, user.ErrNotFound).Once()
+
+		_, err := cache.Erase(ctx, userID)
+		assert.Equal(t, user.ErrNotFound, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+}
+
+func TestCacheDecorator_WithoutCachedReads(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	db, mockRedis := redismock.NewClientMock()
+	cache := NewCacheDecorator(mockRepo, db, &config.RedisConfig{Addr: "localhost:6379"}, WithoutCachedReads())
+	ctx := context.Background()
+
+	testUser := &user.User{ID: uuid.New(), Email: "direct@read.com", Nickname: "direct"}
+
+	t.Run("reads bypass the cache", func(t *testing.T) {
+		mockRepo.On("GetByID", ctx, testUser.ID).Return(testUser, nil).Once()
+		mockRepo.On("GetByEmail", ctx, testUser.Email).Return(testUser, nil).Once()
+		mockRepo.On("GetByNickname", ctx, testUser.Nickname).Return(testUser, nil).Once()
+
+		u, err := cache.GetByID(ctx, testUser.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, testUser, u)
+		_, err = cache.GetByEmail(ctx, testUser.Email)
+		assert.NoError(t, err)
+		_, err = cache.GetByNickname(ctx, testUser.Nickname)
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("writes still evict", func(t *testing.T) {
+		mockRepo.On("GetByID", ctx, testUser.ID).Return(testUser, nil).Once()
+		mockRepo.On("Delete", ctx, testUser.ID).Return(nil).Once()
+		mockRepo.On("WithTx", ctx).Return(nil).Once()
+
+		mockRedis.ExpectDel(userKey(testUser.ID)).SetVal(1)
+		mockRedis.ExpectDel(emailKey(testUser.Email)).SetVal(1)
+		mockRedis.ExpectDel(nickKey(testUser.Nickname)).SetVal(1)
+
+		err := cache.WithTx(ctx, func(ctx context.Context, repo user.Repository) error {
+			return repo.Delete(ctx, testUser.ID)
+		})
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+}
+
+func TestCacheDecorator_WithTx(t *testing.T) {
+	cache, mockRepo, mockRedis := setupCacheTest(t)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	oldUser := &user.User{ID: userID, Email: "old@tx.com", Nickname: "oldtx"}
+	updatedUser := &user.User{ID: userID, Email: "new@tx.com", Nickname: "newtx"}
+
+	t.Run("evicts written users after commit", func(t *testing.T) {
+		mockRepo.On("GetByID", ctx, userID).Return(oldUser, nil).Once()
+		mockRepo.On("Update", ctx, updatedUser).Return(nil).Once()
+		mockRepo.On("WithTx", ctx).Return(nil).Once()
+
+		err := cache.WithTx(ctx, func(ctx context.Context, repo user.Repository) error {
+			if err := repo.Update(ctx, updatedUser); err != nil {
+				return err
+			}
+			// Nothing reaches Redis before the commit
+			assert.NoError(t, mockRedis.ExpectationsWereMet())
+
+			mockRedis.ExpectDel(userKey(userID)).SetVal(1)
+			mockRedis.ExpectDel(emailKey(oldUser.Email)).SetVal(1)
+			mockRedis.ExpectDel(nickKey(oldUser.Nickname)).SetVal(1)
+			mockRedis.ExpectDel(userKey(userID)).SetVal(0)
+			mockRedis.ExpectDel(emailKey(updatedUser.Email)).SetVal(0)
+			mockRedis.ExpectDel(nickKey(updatedUser.Nickname)).SetVal(0)
+			return nil
+		})
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("failed commit leaves the cache alone", func(t *testing.T) {
+		commitErr := errors.New("commit failed")
+		mockRepo.On("Delete", ctx, userID).Return(nil).Once()
+		mockRepo.On("GetByID", ctx, userID).Return(oldUser, nil).Once()
+		mockRepo.On("WithTx", ctx).Return(commitErr).Once()
+
+		err := cache.WithTx(ctx, func(ctx context.Context, repo user.Repository) error {
+			return repo.Delete(ctx, userID)
+		})
+		assert.Equal(t, commitErr, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("evicts each user of a batch after commit", func(t *testing.T) {
+		batch := []*user.User{
+			{ID: uuid.New(), Email: "first@tx.com", Nickname: "firsttx"},
+			{ID: uuid.New(), Email: "second@tx.com", Nickname: "secondtx"},
+		}
+		mockRepo.On("CreateBatch", ctx, batch).Return(nil).Once()
+		mockRepo.On("WithTx", ctx).Return(nil).Once()
+
+		for _, u := range batch {
+			mockRedis.ExpectDel(userKey(u.ID)).SetVal(0)
+			mockRedis.ExpectDel(emailKey(u.Email)).SetVal(0)
+			mockRedis.ExpectDel(nickKey(u.Nickname)).SetVal(0)
+		}
+
+		err := cache.WithTx(ctx, func(ctx context.Context, repo user.Repository) error {
+			return repo.CreateBatch(ctx, batch)
+		})
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+
+	t.Run("nested units of work share the evictions", func(t *testing.T) {
+		createdUser := &user.User{ID: uuid.New(), Email: "nested@tx.com", Nickname: "nestedtx"}
+		mockRepo.On("Create", ctx, createdUser).Return(nil).Once()
+		mockRepo.On("WithTx", ctx).Return(nil).Twice()
+
+		mockRedis.ExpectDel(userKey(createdUser.ID)).SetVal(0)
+		mockRedis.ExpectDel(emailKey(createdUser.Email)).SetVal(0)
+		mockRedis.ExpectDel(nickKey(createdUser.Nickname)).SetVal(0)
+
+		err := cache.WithTx(ctx, func(ctx context.Context, repo user.Repository) error {
+			return repo.WithTx(ctx, func(ctx context.Context, repo user.Repository) error {
+				return repo.Create(ctx, createdUser)
+			})
+		})
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet())
+	})
+}
+
 func TestCacheDecorator_List(t *testing.T) {
 	cache, mockRepo, mockRedis := setupCacheTest(t)
 	ctx := context.Background()
@@ -424,3 +828,30 @@ func TestCacheDecorator_List(t *testing.T) {
 		assert.NoError(t, mockRedis.ExpectationsWereMet()) // No expectations set
 	})
 }
+
+func TestCacheDecorator_Search(t *testing.T) {
+	cache, mockRepo, mockRedis := setupCacheTest(t)
+	ctx := context.Background()
+
+	expectedResults := []user.SearchResult{{User: user.User{ID: uuid.New()}, Score: 0.9}}
+
+	t.Run("search bypasses cache", func(t *testing.T) {
+		mockRepo.On("Search", ctx, "john", 10).Return(expectedResults, nil).Once()
+
+		results, err := cache.Search(ctx, "john", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedResults, results)
+		mockRepo.AssertExpectations(t)
+		assert.NoError(t, mockRedis.ExpectationsWereMet()) // No expectations set
+	})
+
+	t.Run("search repo error", func(t *testing.T) {
+		repoErr := errors.New("search repo error")
+		mockRepo.On("Search", ctx, "john", 10).Return(nil, repoErr).Once()
+
+		results, err := cache.Search(ctx, "john", 10)
+		assert.Equal(t, repoErr, err)
+		assert.Nil(t, results)
+		mockRepo.AssertExpectations(t)
+	})
+}
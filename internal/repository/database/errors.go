@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+// SQLSTATE codes translated to domain errors
+const (
+	codeUniqueViolation      = "23505"
+	codeForeignKeyViolation  = "23503"
+	codeCheckViolation       = "23514"
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+	codeQueryCanceled        = "57014" // Also raised by statement_timeout
+)
+
+// constraintErrors maps constraint names to the domain errors their violations
+// stand for
+var constraintErrors = map[string]error{
+	"users_email_key":    user.ErrEmailTaken,
+	"users_nickname_key": user.ErrNicknameTaken,
+	"users_role_check":   user.NewValidationError("role", "must be one of player, moderator, admin"),
+}
+
+// codeErrors maps SQLSTATE codes to the domain errors they stand for when the
+// violated constraint is not in constraintErrors
+var codeErrors = map[string]error{
+	codeUniqueViolation:      user.ErrAlreadyExists,
+	codeForeignKeyViolation:  user.ErrNotFound, // The referenced row does not exist
+	codeCheckViolation:       user.ErrValidation,
+	codeSerializationFailure: user.ErrSerialization,
+	codeDeadlockDetected:     user.ErrSerialization,
+	codeQueryCanceled:        user.ErrTimeout,
+}
+
+// translateError maps a driver error to the domain error it stands for, using
+// the SQLSTATE code and constraint name Postgres reports rather than the
+// message text. Violations of a known constraint return its domain error as
+// is; other known codes wrap both the domain error and err under action, and
+// any other error is wrapped under action alone.
+func translateError(err error, action string) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+
+	if domainErr, ok := constraintErrors[pgErr.ConstraintName]; ok {
+		return domainErr
+	}
+	if domainErr, ok := codeErrors[pgErr.Code]; ok {
+		return fmt.Errorf("%s: %w: %w", action, domainErr, err)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// retryable reports whether a transaction that failed with err may succeed
+// when run again from the start: it lost a serialization check or deadlock
+// to a concurrent one, or its connection broke
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == codeSerializationFailure || pgErr.Code == codeDeadlockDetected
+	}
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error // Domain error the result must match, nil for none
+		same bool  // The result is want itself rather than wrapping it
+	}{
+		{
+			name: "email taken",
+			err:  &pgconn.PgError{Code: codeUniqueViolation, ConstraintName: "users_email_key", Message: "duplicate key value"},
+			want: user.ErrEmailTaken,
+			same: true,
+		},
+		{
+			name: "nickname taken",
+			err:  &pgconn.PgError{Code: codeUniqueViolation, ConstraintName: "users_nickname_key"},
+			want: user.ErrNicknameTaken,
+			same: true,
+		},
+		{
+			name: "wrapped violation",
+			err:  fmt.Errorf("exec: %w", &pgconn.PgError{Code: codeUniqueViolation, ConstraintName: "users_nickname_key"}),
+			want: user.ErrNicknameTaken,
+			same: true,
+		},
+		{
+			name: "other unique constraint",
+			err:  &pgconn.PgError{Code: codeUniqueViolation, ConstraintName: "outbox_pkey", Message: "mentions email"},
+			want: user.ErrAlreadyExists,
+		},
+		{
+			name: "role check",
+			err:  &pgconn.PgError{Code: codeCheckViolation, ConstraintName: "users_role_check"},
+			want: constraintErrors["users_role_check"],
+			same: true,
+		},
+		{
+			name: "other check",
+			err:  &pgconn.PgError{Code: codeCheckViolation, ConstraintName: "users_country_check"},
+			want: user.ErrValidation,
+		},
+		{
+			name: "missing referenced row",
+			err:  &pgconn.PgError{Code: codeForeignKeyViolation, ConstraintName: "password_reset_tokens_user_id_fkey"},
+			want: user.ErrNotFound,
+		},
+		{
+			name: "serialization failure",
+			err:  &pgconn.PgError{Code: codeSerializationFailure},
+			want: user.ErrSerialization,
+		},
+		{
+			name: "statement timeout",
+			err:  &pgconn.PgError{Code: codeQueryCanceled},
+			want: user.ErrTimeout,
+		},
+		{
+			name: "message text is ignored",
+			err:  errors.New("duplicate key value violates unique constraint users_email_key"),
+		},
+		{
+			name: "unknown code",
+			err:  &pgconn.PgError{Code: "42P01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateError(tt.err, "error doing things")
+
+			if tt.same {
+				assert.Equal(t, tt.want, got)
+				return
+			}
+			assert.ErrorIs(t, got, tt.err, "driver error is kept")
+			assert.Contains(t, got.Error(), "error doing things")
+			if tt.want != nil {
+				assert.ErrorIs(t, got, tt.want)
+			}
+			for _, domainErr := range []error{user.ErrEmailTaken, user.ErrNicknameTaken, user.ErrSerialization, user.ErrTimeout} {
+				if domainErr != tt.want {
+					assert.NotErrorIs(t, got, domainErr)
+				}
+			}
+		})
+	}
+}
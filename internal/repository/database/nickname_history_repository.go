@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+type NicknameHistoryRepository struct {
+	db *sqlx.DB
+}
+
+func NewNicknameHistoryRepository(db *sqlx.DB) *NicknameHistoryRepository {
+	return &NicknameHistoryRepository{db: db}
+}
+
+func (r *NicknameHistoryRepository) Record(ctx context.Context, userID uuid.UUID, nickname string, changedAt time.Time) error {
+	query := `
+		INSERT INTO nickname_history (user_id, nickname, changed_at)
+		VALUES ($1, $2, $3)`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID, nickname, changedAt); err != nil {
+		return translateError(err, "error recording nickname history")
+	}
+	return nil
+}
+
+func (r *NicknameHistoryRepository) LastChange(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	query := `
+		SELECT changed_at FROM nickname_history
+		WHERE user_id = $1
+		ORDER BY changed_at DESC
+		LIMIT 1`
+
+	var changedAt time.Time
+	if err := conn(ctx, r.db).GetContext(ctx, &changedAt, query, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, user.ErrNotFound
+		}
+		return time.Time{}, translateError(err, "error getting last nickname change")
+	}
+	return changedAt, nil
+}
+
+func (r *NicknameHistoryRepository) Resolve(ctx context.Context, nickname string, since time.Time) (uuid.UUID, error) {
+	query := `
+		SELECT user_id FROM nickname_history
+		WHERE nickname = $1 AND changed_at > $2
+		ORDER BY changed_at DESC
+		LIMIT 1`
+
+	var userID uuid.UUID
+	if err := conn(ctx, r.db).GetContext(ctx, &userID, query, nickname, since); err != nil {
+		if err == sql.ErrNoRows {
+			return uuid.Nil, user.ErrNotFound
+		}
+		return uuid.Nil, translateError(err, "error resolving nickname")
+	}
+	return userID, nil
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func TestNicknameHistoryRepository_Record(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewNicknameHistoryRepository(db)
+	ctx := context.Background()
+	userID := uuid.New()
+	changedAt := time.Now().UTC()
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO nickname_history").WithArgs(userID, "johndoe", changedAt).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := repo.Record(ctx, userID, "johndoe", changedAt)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO nickname_history").WithArgs(userID, "johndoe", changedAt).
+			WillReturnError(errors.New("database error"))
+
+		err := repo.Record(ctx, userID, "johndoe", changedAt)
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestNicknameHistoryRepository_LastChange(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewNicknameHistoryRepository(db)
+	ctx := context.Background()
+	userID := uuid.New()
+	changedAt := time.Now().UTC()
+
+	t.Run("success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"changed_at"}).AddRow(changedAt)
+		mock.ExpectQuery("SELECT changed_at FROM nickname_history").WithArgs(userID).WillReturnRows(rows)
+
+		got, err := repo.LastChange(ctx, userID)
+		assert.NoError(t, err)
+		assert.True(t, changedAt.Equal(got))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("never changed", func(t *testing.T) {
+		mock.ExpectQuery("SELECT changed_at FROM nickname_history").WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"changed_at"}))
+
+		_, err := repo.LastChange(ctx, userID)
+		assert.Equal(t, user.ErrNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestNicknameHistoryRepository_Resolve(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewNicknameHistoryRepository(db)
+	ctx := context.Background()
+	userID := uuid.New()
+	since := time.Now().UTC().Add(-24 * time.Hour)
+
+	t.Run("success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"user_id"}).AddRow(userID)
+		mock.ExpectQuery("SELECT user_id FROM nickname_history").WithArgs("johndoe", since).WillReturnRows(rows)
+
+		got, err := repo.Resolve(ctx, "johndoe", since)
+		assert.NoError(t, err)
+		assert.Equal(t, userID, got)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown nickname", func(t *testing.T) {
+		mock.ExpectQuery("SELECT user_id FROM nickname_history").WithArgs("nobody", since).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+		_, err := repo.Resolve(ctx, "nobody", since)
+		assert.Equal(t, user.ErrNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectQuery("SELECT user_id FROM nickname_history").WithArgs("johndoe", since).
+			WillReturnError(errors.New("database error"))
+
+		_, err := repo.Resolve(ctx, "johndoe", since)
+		assert.Error(t, err)
+		assert.NotEqual(t, user.ErrNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/bentalebwael/faceit-users-service/internal/events"
+)
+
+// outboxLockKey identifies the advisory lock held by the outbox relay claiming messages
+const outboxLockKey = 0x6f7574626f78 // "outbox"
+
+// OutboxRepository stores outbox messages, implementing events.OutboxStore
+type OutboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+func (r *OutboxRepository) Enqueue(ctx context.Context, msg *events.OutboxMessage) error {
+	query := `
+		INSERT INTO outbox (aggregate_id, event_type, payload, available_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	err := conn(ctx, r.db).GetContext(ctx, &msg.ID, query,
+		msg.AggregateID, msg.EventType, string(msg.Payload), msg.AvailableAt, msg.CreatedAt)
+	if err != nil {
+		return translateError(err, "error enqueueing outbox message")
+	}
+	return nil
+}
+
+// TryLock takes a transaction scoped advisory lock, so it must be called
+// inside a transaction and is released when that transaction ends
+func (r *OutboxRepository) TryLock(ctx context.Context) (bool, error) {
+	var locked bool
+	if err := conn(ctx, r.db).GetContext(ctx, &locked, "SELECT pg_try_advisory_xact_lock($1)", outboxLockKey); err != nil {
+		return false, translateError(err, "error locking outbox")
+	}
+	return locked, nil
+}
+
+func (r *OutboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]events.OutboxMessage, error) {
+	query := `
+		SELECT id, aggregate_id, event_type, payload, attempts, available_at, created_at
+		FROM outbox
+		WHERE aggregate_id NOT IN (SELECT aggregate_id FROM outbox WHERE available_at > $1)
+		ORDER BY id
+		LIMIT $2`
+
+	var msgs []events.OutboxMessage
+	if err := conn(ctx, r.db).SelectContext(ctx, &msgs, query, now, limit); err != nil {
+		return nil, translateError(err, "error fetching pending outbox messages")
+	}
+	return msgs, nil
+}
+
+func (r *OutboxRepository) Lease(ctx context.Context, ids []int64, until time.Time) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE outbox SET available_at = $1 WHERE id = ANY($2::bigint[])", until, ids); err != nil {
+		return translateError(err, "error leasing outbox messages")
+	}
+	return nil
+}
+
+func (r *OutboxRepository) Delete(ctx context.Context, id int64) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM outbox WHERE id = $1", id); err != nil {
+		return translateError(err, "error deleting outbox message")
+	}
+	return nil
+}
+
+func (r *OutboxRepository) Reschedule(ctx context.Context, id int64, attempts int, availableAt time.Time, lastErr string) error {
+	query := `
+		UPDATE outbox SET attempts = $1, available_at = $2, last_error = $3
+		WHERE id = $4`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, attempts, availableAt, lastErr, id); err != nil {
+		return translateError(err, "error rescheduling outbox message")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bentalebwael/faceit-users-service/internal/events"
+)
+
+func TestOutboxRepository_Enqueue(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewOutboxRepository(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	msg := &events.OutboxMessage{
+		AggregateID: uuid.New(),
+		EventType:   events.EventTypeCreated,
+		Payload:     []byte(`{"type":"created"}`),
+		AvailableAt: now,
+		CreatedAt:   now,
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectQuery("INSERT INTO outbox").
+			WithArgs(msg.AggregateID, msg.EventType, string(msg.Payload), now, now).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+
+		err := repo.Enqueue(ctx, msg)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), msg.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectQuery("INSERT INTO outbox").WillReturnError(errors.New("database error"))
+
+		err := repo.Enqueue(ctx, msg)
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestOutboxRepository_TryLock(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewOutboxRepository(db)
+	ctx := context.Background()
+
+	for _, held := range []bool{true, false} {
+		mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).WithArgs(outboxLockKey).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_xact_lock"}).AddRow(held))
+
+		locked, err := repo.TryLock(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, held, locked)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_Pending(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewOutboxRepository(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	aggregateID := uuid.New()
+
+	rows := sqlmock.NewRows([]string{"id", "aggregate_id", "event_type", "payload", "attempts", "available_at", "created_at"}).
+		AddRow(1, aggregateID, "created", []byte(`{}`), 0, now, now).
+		AddRow(2, aggregateID, "updated", []byte(`{}`), 2, now, now)
+	mock.ExpectQuery(`FROM outbox\s+WHERE aggregate_id NOT IN \(SELECT aggregate_id FROM outbox WHERE available_at > \$1\)\s+ORDER BY id\s+LIMIT \$2`).
+		WithArgs(now, 10).WillReturnRows(rows)
+
+	msgs, err := repo.Pending(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, int64(1), msgs[0].ID)
+	assert.Equal(t, events.EventTypeUpdated, msgs[1].EventType)
+	assert.Equal(t, 2, msgs[1].Attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_Delete(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewOutboxRepository(db)
+
+	mock.ExpectExec(`DELETE FROM outbox WHERE id = \$1`).WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.Delete(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_Lease(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+	require.NoError(t, err)
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	defer db.Close()
+
+	repo := NewOutboxRepository(db)
+	until := time.Now().UTC().Add(time.Minute)
+
+	mock.ExpectExec(`UPDATE outbox SET available_at = \$1 WHERE id = ANY\(\$2::bigint\[\]\)`).
+		WithArgs(until, []int64{7, 8}).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err = repo.Lease(context.Background(), []int64{7, 8}, until)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_Reschedule(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewOutboxRepository(db)
+	availableAt := time.Now().UTC().Add(time.Minute)
+
+	mock.ExpectExec("UPDATE outbox SET attempts").WithArgs(3, availableAt, "broker unavailable", int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.Reschedule(context.Background(), 7, 3, availableAt, "broker unavailable")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+type PasswordResetRepository struct {
+	db *sqlx.DB
+}
+
+func NewPasswordResetRepository(db *sqlx.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+func (r *PasswordResetRepository) Create(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO password_reset_tokens (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, tokenHash, userID, expiresAt); err != nil {
+		return translateError(err, "error creating password reset token")
+	}
+	return nil
+}
+
+// Consume atomically marks the token as used so it can only be redeemed once
+func (r *PasswordResetRepository) Consume(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	query := `
+		UPDATE password_reset_tokens SET used_at = $1
+		WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id`
+
+	var userID uuid.UUID
+	err := conn(ctx, r.db).GetContext(ctx, &userID, query, time.Now().UTC(), tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return uuid.Nil, user.ErrNotFound
+		}
+		return uuid.Nil, translateError(err, "error consuming password reset token")
+	}
+	return userID, nil
+}
+
+func (r *PasswordResetRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM password_reset_tokens WHERE user_id = $1", userID); err != nil {
+		return translateError(err, "error deleting password reset tokens")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func TestPasswordResetRepository_Create(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPasswordResetRepository(db)
+	ctx := context.Background()
+	userID := uuid.New()
+	expiresAt := time.Now().UTC().Add(time.Hour)
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO password_reset_tokens").WithArgs("hash", userID, expiresAt).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := repo.Create(ctx, userID, "hash", expiresAt)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO password_reset_tokens").WithArgs("hash", userID, expiresAt).
+			WillReturnError(errors.New("database error"))
+
+		err := repo.Create(ctx, userID, "hash", expiresAt)
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPasswordResetRepository_Consume(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPasswordResetRepository(db)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	t.Run("success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"user_id"}).AddRow(userID)
+		mock.ExpectQuery("UPDATE password_reset_tokens SET used_at").WithArgs(sqlmock.AnyArg(), "hash").WillReturnRows(rows)
+
+		got, err := repo.Consume(ctx, "hash")
+		assert.NoError(t, err)
+		assert.Equal(t, userID, got)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("used or expired", func(t *testing.T) {
+		mock.ExpectQuery("UPDATE password_reset_tokens SET used_at").WithArgs(sqlmock.AnyArg(), "hash").WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.Consume(ctx, "hash")
+		assert.Equal(t, user.ErrNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPasswordResetRepository_DeleteByUserID(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewPasswordResetRepository(db)
+	userID := uuid.New()
+
+	mock.ExpectExec("DELETE FROM password_reset_tokens WHERE user_id = \\$1").WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err := repo.DeleteByUserID(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+)
+
+// queryer is implemented by both *sqlx.DB and *sqlx.Tx
+type queryer interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+type txKey struct{}
+
+// conn returns the transaction carried by ctx, or db when there is none, so
+// repositories transparently join a transaction started by the Transactor
+func conn(ctx context.Context, db *sqlx.DB) queryer {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// isolationLevels maps the DATABASE_TX_ISOLATION values to isolation levels
+var isolationLevels = map[string]sql.IsolationLevel{
+	"":                sql.LevelDefault,
+	"read_committed":  sql.LevelReadCommitted,
+	"repeatable_read": sql.LevelRepeatableRead,
+	"serializable":    sql.LevelSerializable,
+}
+
+// Transactor runs functions inside a database transaction, implementing user.Transactor
+type Transactor struct {
+	db  *sqlx.DB
+	cfg *config.DBConfig
+}
+
+func NewTransactor(db *sqlx.DB, cfg *config.DBConfig) *Transactor {
+	return &Transactor{db: db, cfg: cfg}
+}
+
+// WithinTx runs fn in a transaction that is committed if fn succeeds and
+// rolled back otherwise. Calls nested in an existing transaction join it.
+// A transaction failing with a serialization failure, a deadlock or a broken
+// connection is run again from the start, up to the configured number of
+// retries, so fn must not have side effects outside the transaction.
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return fn(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := t.run(ctx, fn)
+		if err == nil || !retry || attempt > t.cfg.TxMaxRetries {
+			return err
+		}
+
+		timer := time.NewTimer(t.retryDelay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// run makes a single attempt at the transaction and reports whether it may
+// be retried if it failed
+func (t *Transactor) run(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	tx, err := t.db.BeginTxx(ctx, &sql.TxOptions{Isolation: isolationLevels[t.cfg.TxIsolation]})
+	if err != nil {
+		return retryable(err), translateError(err, "error beginning transaction")
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return retryable(err), fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return retryable(err), err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// A commit lost with its connection may still have been applied, so
+		// only a commit Postgres answered with a rejection is retried
+		var pgErr *pgconn.PgError
+		return errors.As(err, &pgErr) && retryable(err), translateError(err, "error committing transaction")
+	}
+	return false, nil
+}
+
+// retryDelay doubles the base delay for every failed attempt, up to the
+// maximum, and picks a random delay in its upper half so transactions that
+// conflicted with each other do not collide again
+func (t *Transactor) retryDelay(attempt int) time.Duration {
+	delay := t.cfg.TxRetryBaseDelay
+	for i := 1; i < attempt && delay < t.cfg.TxRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.cfg.TxRetryMaxDelay {
+		delay = t.cfg.TxRetryMaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
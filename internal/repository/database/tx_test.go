@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bentalebwael/faceit-users-service/internal/config"
+	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
+)
+
+func TestTransactor_WithinTx(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("commits when fn succeeds", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM password_reset_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		resets := NewPasswordResetRepository(db)
+		err := NewTransactor(db, &config.DBConfig{}).WithinTx(ctx, func(ctx context.Context) error {
+			return resets.DeleteByUserID(ctx, uuid.New())
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rolls back when fn fails", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		fnErr := errors.New("publish failed")
+		err := NewTransactor(db, &config.DBConfig{}).WithinTx(ctx, func(ctx context.Context) error {
+			return fnErr
+		})
+		assert.ErrorIs(t, err, fnErr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("nested calls join the outer transaction", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		transactor := NewTransactor(db, &config.DBConfig{})
+		err := transactor.WithinTx(ctx, func(ctx context.Context) error {
+			return transactor.WithinTx(ctx, func(ctx context.Context) error {
+				return nil
+			})
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("retries a serialization failure", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM password_reset_tokens").WillReturnError(&pgconn.PgError{Code: codeSerializationFailure})
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM password_reset_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		resets := NewPasswordResetRepository(db)
+		attempts := 0
+		err := NewTransactor(db, &config.DBConfig{TxMaxRetries: 1}).WithinTx(ctx, func(ctx context.Context) error {
+			attempts++
+			return resets.DeleteByUserID(ctx, uuid.New())
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("retries a rejected commit", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(&pgconn.PgError{Code: codeSerializationFailure})
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		err := NewTransactor(db, &config.DBConfig{TxMaxRetries: 1}).WithinTx(ctx, func(ctx context.Context) error {
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		defer db.Close()
+
+		for i := 0; i < 3; i++ {
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+		}
+
+		cfg := &config.DBConfig{TxMaxRetries: 2, TxRetryBaseDelay: time.Millisecond, TxRetryMaxDelay: time.Millisecond}
+		attempts := 0
+		err := NewTransactor(db, cfg).WithinTx(ctx, func(ctx context.Context) error {
+			attempts++
+			return translateError(&pgconn.PgError{Code: codeDeadlockDetected}, "error updating user")
+		})
+		assert.ErrorIs(t, err, user.ErrSerialization)
+		assert.Equal(t, 3, attempts)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("does not retry other failures", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		attempts := 0
+		err := NewTransactor(db, &config.DBConfig{TxMaxRetries: 3}).WithinTx(ctx, func(ctx context.Context) error {
+			attempts++
+			return user.ErrEmailTaken
+		})
+		assert.ErrorIs(t, err, user.ErrEmailTaken)
+		assert.Equal(t, 1, attempts)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("does not retry a commit lost with its connection", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(io.ErrUnexpectedEOF)
+
+		err := NewTransactor(db, &config.DBConfig{TxMaxRetries: 3}).WithinTx(ctx, func(ctx context.Context) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTransactor_RetryDelay(t *testing.T) {
+	transactor := NewTransactor(nil, &config.DBConfig{TxRetryBaseDelay: 10 * time.Millisecond, TxRetryMaxDelay: 50 * time.Millisecond})
+
+	for attempt, max := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond, 5: 50 * time.Millisecond} {
+		delay := transactor.retryDelay(attempt)
+		assert.GreaterOrEqual(t, delay, max/2, "attempt %d", attempt)
+		assert.LessOrEqual(t, delay, max, "attempt %d", attempt)
+	}
+}
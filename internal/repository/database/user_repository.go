@@ -15,103 +15,238 @@ import (
 
 type UserRepository struct {
 	db *sqlx.DB
+	tx *Transactor
 }
 
-func NewUserRepository(db *sqlx.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *sqlx.DB, tx *Transactor) *UserRepository {
+	return &UserRepository{db: db, tx: tx}
 }
 
+// WithTx runs fn as a unit of work in a transaction of the Transactor, which
+// retries it on transient failures
+func (r *UserRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repo user.Repository) error) error {
+	return r.tx.WithinTx(ctx, func(ctx context.Context) error {
+		return fn(ctx, r)
+	})
+}
+
+// userColumns are the columns Create and CreateBatch insert, in order
+const userColumns = `id, first_name, last_name, nickname, password_hash,
+	email, country, role, created_at, updated_at, version`
+
+// userColumnCount is the number of userColumns
+const userColumnCount = 11
+
+// batchInsertRows bounds the rows of one multi-row insert, keeping its
+// parameters well below the 65535 Postgres accepts per statement
+const batchInsertRows = 1000
+
 func (r *UserRepository) Create(ctx context.Context, u *user.User) error {
-	query := `
-		INSERT INTO users (
-			id, first_name, last_name, nickname, password_hash,
-			email, country, created_at, updated_at
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9
-		)`
-
-	_, err := r.db.ExecContext(ctx, query,
+	query := "INSERT INTO users (" + userColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)"
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
 		u.ID, u.FirstName, u.LastName, u.Nickname, u.Password,
-		u.Email, u.Country, u.CreatedAt, u.UpdatedAt,
+		u.Email, u.Country, u.Role, u.CreatedAt, u.UpdatedAt, u.Version,
 	)
 	if err != nil {
-		if strings.Contains(err.Error(), "unique constraint") {
-			if strings.Contains(err.Error(), "email") {
-				return user.ErrEmailTaken
-			}
-			if strings.Contains(err.Error(), "nickname") {
-				return user.ErrNicknameTaken
+		return translateError(err, "error creating user")
+	}
+
+	return nil
+}
+
+// CreateBatch inserts users with one multi-row insert per batchInsertRows
+// users. Callers run it in a unit of work to make the batch atomic.
+func (r *UserRepository) CreateBatch(ctx context.Context, users []*user.User) error {
+	for start := 0; start < len(users); start += batchInsertRows {
+		chunk := users[start:min(start+batchInsertRows, len(users))]
+
+		rows := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*userColumnCount)
+		for i, u := range chunk {
+			placeholders := make([]string, userColumnCount)
+			for j := range placeholders {
+				placeholders[j] = fmt.Sprintf("$%d", len(args)+j+1)
 			}
+			rows[i] = "(" + strings.Join(placeholders, ", ") + ")"
+			args = append(args,
+				u.ID, u.FirstName, u.LastName, u.Nickname, u.Password,
+				u.Email, u.Country, u.Role, u.CreatedAt, u.UpdatedAt, u.Version,
+			)
 		}
-		return fmt.Errorf("error creating user: %w", err)
-	}
 
+		query := "INSERT INTO users (" + userColumns + ") VALUES " + strings.Join(rows, ", ")
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+			return translateError(err, "error creating users")
+		}
+	}
 	return nil
 }
 
+// Taken looks at every user, soft deleted ones included, because the unique
+// constraints on email and nickname do too
+func (r *UserRepository) Taken(ctx context.Context, emails, nicknames []string) ([]string, []string, error) {
+	query := `
+		SELECT email, nickname FROM users
+		WHERE email = ANY($1) OR nickname = ANY($2)`
+
+	var rows []struct {
+		Email    string `db:"email"`
+		Nickname string `db:"nickname"`
+	}
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, query, emails, nicknames); err != nil {
+		return nil, nil, translateError(err, "error checking taken emails and nicknames")
+	}
+
+	wantEmails, wantNicknames := make(map[string]bool, len(emails)), make(map[string]bool, len(nicknames))
+	for _, email := range emails {
+		wantEmails[email] = true
+	}
+	for _, nickname := range nicknames {
+		wantNicknames[nickname] = true
+	}
+
+	var takenEmails, takenNicknames []string
+	for _, row := range rows {
+		if wantEmails[row.Email] {
+			takenEmails = append(takenEmails, row.Email)
+		}
+		if wantNicknames[row.Nickname] {
+			takenNicknames = append(takenNicknames, row.Nickname)
+		}
+	}
+	return takenEmails, takenNicknames, nil
+}
+
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
 	var u user.User
-	err := r.db.GetContext(ctx, &u, "SELECT * FROM users WHERE id = $1", id)
+	err := conn(ctx, r.db).GetContext(ctx, &u, "SELECT * FROM users WHERE id = $1 AND deleted_at IS NULL", id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, user.ErrNotFound
 		}
-		return nil, fmt.Errorf("error getting user: %w", err)
+		return nil, translateError(err, "error getting user")
 	}
 	return &u, nil
 }
 
+func (r *UserRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]user.User, error) {
+	params := make([]string, len(ids))
+	for i, id := range ids {
+		params[i] = id.String()
+	}
+
+	users := make([]user.User, 0, len(ids))
+	err := conn(ctx, r.db).SelectContext(ctx, &users, "SELECT * FROM users WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL", params)
+	if err != nil {
+		return nil, translateError(err, "error getting users")
+	}
+	return users, nil
+}
+
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*user.User, error) {
 	var u user.User
-	err := r.db.GetContext(ctx, &u, "SELECT * FROM users WHERE email = $1", email)
+	err := conn(ctx, r.db).GetContext(ctx, &u, "SELECT * FROM users WHERE email = $1 AND deleted_at IS NULL", email)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, user.ErrNotFound
 		}
-		return nil, fmt.Errorf("error getting user by email: %w", err)
+		return nil, translateError(err, "error getting user by email")
 	}
 	return &u, nil
 }
 
 func (r *UserRepository) GetByNickname(ctx context.Context, nickname string) (*user.User, error) {
 	var u user.User
-	err := r.db.GetContext(ctx, &u, "SELECT * FROM users WHERE nickname = $1", nickname)
+	err := conn(ctx, r.db).GetContext(ctx, &u, "SELECT * FROM users WHERE nickname = $1 AND deleted_at IS NULL", nickname)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, user.ErrNotFound
 		}
-		return nil, fmt.Errorf("error getting user by nickname: %w", err)
+		return nil, translateError(err, "error getting user by nickname")
 	}
 	return &u, nil
 }
 
+// Update is a compare-and-swap on u.Version: the row is only written while
+// its version still equals u.Version. u then takes the new version and
+// updated_at of the row.
 func (r *UserRepository) Update(ctx context.Context, u *user.User) error {
 	query := `
 		UPDATE users SET 
 			first_name = $1, last_name = $2, nickname = $3,
 			password_hash = $4, email = $5, country = $6,
-			updated_at = $7
-		WHERE id = $8`
+			role = $7, banned_at = $8, ban_reason = $9,
+			updated_at = $10, version = version + 1
+		WHERE id = $11 AND version = $12 AND deleted_at IS NULL
+		RETURNING version, updated_at`
 
-	result, err := r.db.ExecContext(ctx, query,
+	var saved struct {
+		Version   int64     `db:"version"`
+		UpdatedAt time.Time `db:"updated_at"`
+	}
+	err := conn(ctx, r.db).GetContext(ctx, &saved, query,
 		u.FirstName, u.LastName, u.Nickname, u.Password,
-		u.Email, u.Country, time.Now().UTC(), u.ID,
+		u.Email, u.Country, u.Role, u.BannedAt, u.BanReason,
+		time.Now().UTC(), u.ID, u.Version,
 	)
 	if err != nil {
-		if strings.Contains(err.Error(), "unique constraint") {
-			if strings.Contains(err.Error(), "email") {
-				return user.ErrEmailTaken
-			}
-			if strings.Contains(err.Error(), "nickname") {
-				return user.ErrNicknameTaken
-			}
+		if err == sql.ErrNoRows {
+			return r.updateMissError(ctx, u.ID)
 		}
-		return fmt.Errorf("error updating user: %w", err)
+		return translateError(err, "error updating user")
+	}
+
+	u.Version = saved.Version
+	u.UpdatedAt = saved.UpdatedAt
+	return nil
+}
+
+// updateMissError tells why an update matched no row: the user is gone, or
+// it was changed since it was read
+func (r *UserRepository) updateMissError(ctx context.Context, id uuid.UUID) error {
+	var exists bool
+	err := conn(ctx, r.db).GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)", id)
+	if err != nil {
+		return translateError(err, "error checking user existence")
+	}
+	if !exists {
+		return user.ErrNotFound
+	}
+	return user.ErrConflict
+}
+
+func (r *UserRepository) SetCountry(ctx context.Context, ids []uuid.UUID, country string) ([]user.User, error) {
+	params := make([]string, len(ids))
+	for i, id := range ids {
+		params[i] = id.String()
+	}
+
+	query := `
+		UPDATE users SET country = $1, updated_at = $2, version = version + 1
+		WHERE id = ANY($3::uuid[]) AND deleted_at IS NULL
+		RETURNING *`
+
+	users := make([]user.User, 0, len(ids))
+	if err := conn(ctx, r.db).SelectContext(ctx, &users, query, country, time.Now().UTC(), params); err != nil {
+		return nil, translateError(err, "error setting user country")
+	}
+	return users, nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE users SET deleted_at = $1, updated_at = $1, version = version + 1
+		WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now().UTC(), id)
+	if err != nil {
+		return translateError(err, "error deleting user")
 	}
 
 	rows, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error getting rows affected: %w", err)
+		return translateError(err, "error getting rows affected")
 	}
 	if rows == 0 {
 		return user.ErrNotFound
@@ -120,15 +255,19 @@ func (r *UserRepository) Update(ctx context.Context, u *user.User) error {
 	return nil
 }
 
-func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	result, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+func (r *UserRepository) Restore(ctx context.Context, id uuid.UUID, deletedAfter time.Time) error {
+	query := `
+		UPDATE users SET deleted_at = NULL, updated_at = $1, version = version + 1
+		WHERE id = $2 AND deleted_at IS NOT NULL AND deleted_at > $3`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now().UTC(), id, deletedAfter)
 	if err != nil {
-		return fmt.Errorf("error deleting user: %w", err)
+		return translateError(err, "error restoring user")
 	}
 
 	rows, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error getting rows affected: %w", err)
+		return translateError(err, "error getting rows affected")
 	}
 	if rows == 0 {
 		return user.ErrNotFound
@@ -137,44 +276,198 @@ func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+func (r *UserRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]user.User, error) {
+	query := `
+		DELETE FROM users WHERE id IN (
+			SELECT id FROM users
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			ORDER BY deleted_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`
+
+	users := make([]user.User, 0)
+	if err := conn(ctx, r.db).SelectContext(ctx, &users, query, deletedBefore, limit); err != nil {
+		return nil, translateError(err, "error purging users")
+	}
+
+	return users, nil
+}
+
+func (r *UserRepository) Erase(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	// Nickname history and reset tokens go with the user by ON DELETE CASCADE
+	query := `DELETE FROM users WHERE id = $1 RETURNING *`
+
+	var u user.User
+	if err := conn(ctx, r.db).GetContext(ctx, &u, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrNotFound
+		}
+		return nil, translateError(err, "error erasing user")
+	}
+
+	return &u, nil
+}
+
 func (r *UserRepository) List(ctx context.Context, params user.ListParams) ([]user.User, int64, error) {
-	var conditions []string
-	var filterArgs []interface{}
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
 	argCount := 1
 
 	for _, filter := range params.Filters {
-		conditions = append(conditions, fmt.Sprintf("%s ILIKE $%d", filter.Field, argCount))
-		filterArgs = append(filterArgs, fmt.Sprintf("%%%v%%", filter.Value))
-		argCount++
-	}
-	whereClause := ""
-	if len(conditions) > 0 {
-		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+		condition, filterArgs, err := filterCondition(filter, argCount)
+		if err != nil {
+			return nil, 0, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, filterArgs...)
+		argCount += len(filterArgs)
 	}
 
-	countQuery := "SELECT COUNT(*) FROM users" + whereClause
 	var totalCount int64
-	err := r.db.GetContext(ctx, &totalCount, countQuery, filterArgs...)
-	if err != nil {
-		return nil, 0, fmt.Errorf("error counting users: %w", err)
+	if params.IncludeTotal {
+		countQuery := "SELECT COUNT(*) FROM users WHERE " + strings.Join(conditions, " AND ")
+		err := conn(ctx, r.db).GetContext(ctx, &totalCount, countQuery, args...)
+		if err != nil {
+			return nil, 0, translateError(err, "error counting users")
+		}
 	}
 
-	selectQuery := "SELECT * FROM users" + whereClause
-	selectQuery += fmt.Sprintf(" ORDER BY %s", params.OrderBy)
+	direction := "ASC"
 	if params.OrderDesc {
-		selectQuery += " DESC"
-	} else {
-		selectQuery += " ASC"
+		direction = "DESC"
 	}
 
-	selectQuery += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCount, argCount+1)
-	args := append(filterArgs, params.Limit, params.Offset)
+	// Keyset pagination: continue strictly after the (order column, id) of the
+	// cursor, with id breaking ties between equal values
+	if params.After != nil {
+		value, err := columnArg(params.OrderBy, params.After.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+		operator := ">"
+		if params.OrderDesc {
+			operator = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d, $%d)", params.OrderBy, operator, argCount, argCount+1))
+		args = append(args, value, params.After.ID)
+		argCount += 2
+	}
+
+	selectQuery := "SELECT * FROM users WHERE " + strings.Join(conditions, " AND ")
+	selectQuery += fmt.Sprintf(" ORDER BY %s %s, id %s", params.OrderBy, direction, direction)
+	selectQuery += fmt.Sprintf(" LIMIT $%d", argCount)
+	args = append(args, params.Limit)
+	if params.After == nil {
+		selectQuery += fmt.Sprintf(" OFFSET $%d", argCount+1)
+		args = append(args, params.Offset)
+	}
 
 	users := make([]user.User, 0)
-	err = r.db.SelectContext(ctx, &users, selectQuery, args...)
+	err := conn(ctx, r.db).SelectContext(ctx, &users, selectQuery, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error listing users: %w", err)
+		return nil, 0, translateError(err, "error listing users")
 	}
 
 	return users, totalCount, nil
 }
+
+// searchDocument is the full-text document of a user; it must match the
+// expression of users_search_tsv_idx for the index to be used
+const searchDocument = `(
+	setweight(to_tsvector('simple', nickname), 'A') ||
+	setweight(to_tsvector('simple', first_name || ' ' || last_name), 'B') ||
+	setweight(to_tsvector('simple', split_part(email, '@', 1)), 'C')
+)`
+
+// Search matches query against the trigram indexes of the nickname, names and
+// email local part, and against the full-text document for whole words. The
+// score favours nickname similarity over names and names over email.
+func (r *UserRepository) Search(ctx context.Context, query string, limit int) ([]user.SearchResult, error) {
+	searchQuery := `
+		SELECT users.*,
+			GREATEST(
+				word_similarity($1, nickname),
+				word_similarity($1, first_name) * 0.8,
+				word_similarity($1, last_name) * 0.8,
+				word_similarity($1, split_part(email, '@', 1)) * 0.6
+			) + ts_rank(` + searchDocument + `, plainto_tsquery('simple', $1)) AS score
+		FROM users
+		WHERE deleted_at IS NULL AND (
+			$1 <% nickname OR $1 <% first_name OR $1 <% last_name
+			OR $1 <% split_part(email, '@', 1)
+			OR ` + searchDocument + ` @@ plainto_tsquery('simple', $1)
+		)
+		ORDER BY score DESC, id
+		LIMIT $2`
+
+	var rows []struct {
+		user.User
+		Score float64 `db:"score"`
+	}
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, searchQuery, query, limit); err != nil {
+		return nil, translateError(err, "error searching users")
+	}
+
+	results := make([]user.SearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = user.SearchResult{User: row.User, Score: row.Score}
+	}
+	return results, nil
+}
+
+// comparisonOperators maps filter operators to their SQL counterparts
+var comparisonOperators = map[user.FilterOperator]string{
+	user.OpEq:  "=",
+	user.OpNeq: "<>",
+	user.OpGt:  ">",
+	user.OpLt:  "<",
+}
+
+// filterCondition renders filter as a SQL condition whose placeholders start
+// at $argCount, returning the arguments to bind to them. Field names have been
+// validated by the service against the filterable columns.
+func filterCondition(filter user.Filter, argCount int) (string, []interface{}, error) {
+	switch filter.Operator {
+	case user.OpEq, user.OpNeq, user.OpGt, user.OpLt:
+		value, err := columnArg(filter.Field, filter.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s %s $%d", filter.Field, comparisonOperators[filter.Operator], argCount), []interface{}{value}, nil
+	case user.OpPrefix:
+		return fmt.Sprintf("%s ILIKE $%d", filter.Field, argCount), []interface{}{escapeLike(filter.Value) + "%"}, nil
+	case user.OpContains, "":
+		return fmt.Sprintf("%s ILIKE $%d", filter.Field, argCount), []interface{}{"%" + escapeLike(filter.Value) + "%"}, nil
+	case user.OpIn:
+		placeholders := make([]string, len(filter.Values))
+		args := make([]interface{}, len(filter.Values))
+		for i, value := range filter.Values {
+			placeholders[i] = fmt.Sprintf("$%d", argCount+i)
+			args[i] = value
+		}
+		return fmt.Sprintf("%s IN (%s)", filter.Field, strings.Join(placeholders, ", ")), args, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported filter operator: %s", filter.Operator)
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in value so it matches literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// columnArg converts a filter or cursor value to the type of its column
+func columnArg(column, value string) (interface{}, error) {
+	switch column {
+	case "created_at", "updated_at":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s value: %w", column, err)
+		}
+		return t, nil
+	default:
+		return value, nil
+	}
+}
@@ -3,16 +3,20 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/bentalebwael/faceit-users-service/internal/config"
 	"github.com/bentalebwael/faceit-users-service/internal/domain/user"
 )
 
@@ -28,7 +32,7 @@ func TestUserRepository_Create(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewUserRepository(db)
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
 	ctx := context.Background()
 
 	testUser := &user.User{
@@ -39,6 +43,7 @@ func TestUserRepository_Create(t *testing.T) {
 		Password:  "hashed_password",
 		Email:     "john@example.com",
 		Country:   "US",
+		Role:      user.RolePlayer,
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 	}
@@ -46,7 +51,7 @@ func TestUserRepository_Create(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		mock.ExpectExec("INSERT INTO users").WithArgs(
 			testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password,
-			testUser.Email, testUser.Country, testUser.CreatedAt, testUser.UpdatedAt,
+			testUser.Email, testUser.Country, testUser.Role, testUser.CreatedAt, testUser.UpdatedAt, testUser.Version,
 		).WillReturnResult(sqlmock.NewResult(1, 1))
 
 		err := repo.Create(ctx, testUser)
@@ -57,8 +62,8 @@ func TestUserRepository_Create(t *testing.T) {
 	t.Run("email taken", func(t *testing.T) {
 		mock.ExpectExec("INSERT INTO users").WithArgs(
 			testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password,
-			testUser.Email, testUser.Country, testUser.CreatedAt, testUser.UpdatedAt,
-		).WillReturnError(errors.New("unique constraint email"))
+			testUser.Email, testUser.Country, testUser.Role, testUser.CreatedAt, testUser.UpdatedAt, testUser.Version,
+		).WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"})
 
 		err := repo.Create(ctx, testUser)
 		assert.Equal(t, user.ErrEmailTaken, err)
@@ -68,8 +73,8 @@ func TestUserRepository_Create(t *testing.T) {
 	t.Run("nickname taken", func(t *testing.T) {
 		mock.ExpectExec("INSERT INTO users").WithArgs(
 			testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password,
-			testUser.Email, testUser.Country, testUser.CreatedAt, testUser.UpdatedAt,
-		).WillReturnError(errors.New("unique constraint nickname"))
+			testUser.Email, testUser.Country, testUser.Role, testUser.CreatedAt, testUser.UpdatedAt, testUser.Version,
+		).WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_nickname_key"})
 
 		err := repo.Create(ctx, testUser)
 		assert.Equal(t, user.ErrNicknameTaken, err)
@@ -79,7 +84,7 @@ func TestUserRepository_Create(t *testing.T) {
 	t.Run("other error", func(t *testing.T) {
 		mock.ExpectExec("INSERT INTO users").WithArgs(
 			testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password,
-			testUser.Email, testUser.Country, testUser.CreatedAt, testUser.UpdatedAt,
+			testUser.Email, testUser.Country, testUser.Role, testUser.CreatedAt, testUser.UpdatedAt, testUser.Version,
 		).WillReturnError(errors.New("database error"))
 
 		err := repo.Create(ctx, testUser)
@@ -90,11 +95,78 @@ func TestUserRepository_Create(t *testing.T) {
 	})
 }
 
+func TestUserRepository_CreateBatch(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	users := make([]*user.User, batchInsertRows+1)
+	for i := range users {
+		users[i] = &user.User{ID: uuid.New(), Nickname: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.com", i), Role: user.RolePlayer, CreatedAt: now, UpdatedAt: now, Version: 1}
+	}
+
+	t.Run("one insert per chunk", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO users \(id, .*\) VALUES \(\$1, .*, \$11\), \(\$12, `).WillReturnResult(sqlmock.NewResult(0, batchInsertRows))
+		last := users[batchInsertRows]
+		mock.ExpectExec(`INSERT INTO users \(id, .*\) VALUES \(\$1, [^(]*\$11\)$`).WithArgs(
+			last.ID, last.FirstName, last.LastName, last.Nickname, last.Password,
+			last.Email, last.Country, last.Role, last.CreatedAt, last.UpdatedAt, last.Version,
+		).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.CreateBatch(ctx, users))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unique violation", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO users").WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_nickname_key"})
+
+		err := repo.CreateBatch(ctx, users[:1])
+		assert.ErrorIs(t, err, user.ErrNicknameTaken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// passthroughConverter hands every argument to the driver unchanged, as pgx
+// does, so slices can be bound to ANY($n)
+type passthroughConverter struct{}
+
+func (passthroughConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	return v, nil
+}
+
+func TestUserRepository_Taken(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+	require.NoError(t, err)
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	defer db.Close()
+
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
+	emails := []string{"john@example.com", "jane@example.com"}
+	nicknames := []string{"johndoe", "janedoe"}
+
+	// A row matching on one column only reports that column
+	rows := sqlmock.NewRows([]string{"email", "nickname"}).
+		AddRow("john@example.com", "johnny").
+		AddRow("someone@example.com", "janedoe")
+	mock.ExpectQuery(`SELECT email, nickname FROM users\s+WHERE email = ANY\(\$1\) OR nickname = ANY\(\$2\)`).
+		WithArgs(emails, nicknames).
+		WillReturnRows(rows)
+
+	takenEmails, takenNicknames, err := repo.Taken(context.Background(), emails, nicknames)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"john@example.com"}, takenEmails)
+	assert.Equal(t, []string{"janedoe"}, takenNicknames)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestUserRepository_GetByID(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewUserRepository(db)
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
 	ctx := context.Background()
 	userID := uuid.New()
 
@@ -106,13 +178,14 @@ func TestUserRepository_GetByID(t *testing.T) {
 		Password:  "hashed_password",
 		Email:     "john@example.com",
 		Country:   "US",
+		Role:      user.RolePlayer,
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 	}
 
 	t.Run("success", func(t *testing.T) {
-		rows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "created_at", "updated_at"}).
-			AddRow(testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password, testUser.Email, testUser.Country, testUser.CreatedAt, testUser.UpdatedAt)
+		rows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "role", "created_at", "updated_at"}).
+			AddRow(testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password, testUser.Email, testUser.Country, testUser.Role, testUser.CreatedAt, testUser.UpdatedAt)
 
 		mock.ExpectQuery("SELECT \\* FROM users WHERE id = \\$1").WithArgs(userID).WillReturnRows(rows)
 
@@ -124,6 +197,7 @@ func TestUserRepository_GetByID(t *testing.T) {
 		assert.Equal(t, testUser.Nickname, result.Nickname)
 		assert.Equal(t, testUser.Email, result.Email)
 		assert.Equal(t, testUser.Country, result.Country)
+		assert.Equal(t, testUser.Role, result.Role)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
@@ -148,11 +222,33 @@ func TestUserRepository_GetByID(t *testing.T) {
 	})
 }
 
+func TestUserRepository_GetByIDs(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+	require.NoError(t, err)
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	defer db.Close()
+
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
+	found, missing := uuid.New(), uuid.New()
+
+	rows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "role", "created_at", "updated_at"}).
+		AddRow(found, "John", "Doe", "johndoe", "hash", "john@example.com", "US", "player", time.Now(), time.Now())
+	mock.ExpectQuery(`SELECT \* FROM users WHERE id = ANY\(\$1::uuid\[\]\) AND deleted_at IS NULL`).
+		WithArgs([]string{found.String(), missing.String()}).
+		WillReturnRows(rows)
+
+	users, err := repo.GetByIDs(context.Background(), []uuid.UUID{found, missing})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, found, users[0].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestUserRepository_GetByEmail(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewUserRepository(db)
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
 	ctx := context.Background()
 	email := "john@example.com"
 
@@ -164,13 +260,14 @@ func TestUserRepository_GetByEmail(t *testing.T) {
 		Password:  "hashed_password",
 		Email:     email,
 		Country:   "US",
+		Role:      user.RolePlayer,
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 	}
 
 	t.Run("success", func(t *testing.T) {
-		rows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "created_at", "updated_at"}).
-			AddRow(testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password, testUser.Email, testUser.Country, testUser.CreatedAt, testUser.UpdatedAt)
+		rows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "role", "created_at", "updated_at"}).
+			AddRow(testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password, testUser.Email, testUser.Country, testUser.Role, testUser.CreatedAt, testUser.UpdatedAt)
 
 		mock.ExpectQuery("SELECT \\* FROM users WHERE email = \\$1").WithArgs(email).WillReturnRows(rows)
 
@@ -196,7 +293,7 @@ func TestUserRepository_GetByNickname(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewUserRepository(db)
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
 	ctx := context.Background()
 	nickname := "johndoe"
 
@@ -208,13 +305,14 @@ func TestUserRepository_GetByNickname(t *testing.T) {
 		Password:  "hashed_password",
 		Email:     "john@example.com",
 		Country:   "US",
+		Role:      user.RolePlayer,
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 	}
 
 	t.Run("success", func(t *testing.T) {
-		rows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "created_at", "updated_at"}).
-			AddRow(testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password, testUser.Email, testUser.Country, testUser.CreatedAt, testUser.UpdatedAt)
+		rows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "role", "created_at", "updated_at"}).
+			AddRow(testUser.ID, testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password, testUser.Email, testUser.Country, testUser.Role, testUser.CreatedAt, testUser.UpdatedAt)
 
 		mock.ExpectQuery("SELECT \\* FROM users WHERE nickname = \\$1").WithArgs(nickname).WillReturnRows(rows)
 
@@ -240,37 +338,48 @@ func TestUserRepository_Update(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewUserRepository(db)
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
 	ctx := context.Background()
 
-	testUser := &user.User{
-		ID:        uuid.New(),
-		FirstName: "John",
-		LastName:  "Doe",
-		Nickname:  "johndoe",
-		Password:  "hashed_password",
-		Email:     "john@example.com",
-		Country:   "US",
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
+	newTestUser := func() *user.User {
+		return &user.User{
+			ID:        uuid.New(),
+			FirstName: "John",
+			LastName:  "Doe",
+			Nickname:  "johndoe",
+			Password:  "hashed_password",
+			Email:     "john@example.com",
+			Country:   "US",
+			Role:      user.RolePlayer,
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+			Version:   3,
+		}
+	}
+	expectUpdate := func(u *user.User) *sqlmock.ExpectedQuery {
+		return mock.ExpectQuery("UPDATE users SET").WithArgs(
+			u.FirstName, u.LastName, u.Nickname, u.Password,
+			u.Email, u.Country, u.Role, u.BannedAt, u.BanReason,
+			sqlmock.AnyArg(), u.ID, int64(3),
+		)
 	}
 
 	t.Run("success", func(t *testing.T) {
-		mock.ExpectExec("UPDATE users SET").WithArgs(
-			testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password,
-			testUser.Email, testUser.Country, sqlmock.AnyArg(), testUser.ID,
-		).WillReturnResult(sqlmock.NewResult(0, 1))
+		testUser := newTestUser()
+		updatedAt := testUser.UpdatedAt.Add(time.Minute)
+		expectUpdate(testUser).WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(4, updatedAt))
 
 		err := repo.Update(ctx, testUser)
 		assert.NoError(t, err)
+		assert.Equal(t, int64(4), testUser.Version)
+		assert.Equal(t, updatedAt, testUser.UpdatedAt)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("not found", func(t *testing.T) {
-		mock.ExpectExec("UPDATE users SET").WithArgs(
-			testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password,
-			testUser.Email, testUser.Country, sqlmock.AnyArg(), testUser.ID,
-		).WillReturnResult(sqlmock.NewResult(0, 0))
+		testUser := newTestUser()
+		expectUpdate(testUser).WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}))
+		mock.ExpectQuery("SELECT EXISTS").WithArgs(testUser.ID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
 		err := repo.Update(ctx, testUser)
 		assert.Error(t, err)
@@ -278,11 +387,20 @@ func TestUserRepository_Update(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("version moved on", func(t *testing.T) {
+		testUser := newTestUser()
+		expectUpdate(testUser).WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}))
+		mock.ExpectQuery("SELECT EXISTS").WithArgs(testUser.ID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		err := repo.Update(ctx, testUser)
+		assert.Equal(t, user.ErrConflict, err)
+		assert.Equal(t, int64(3), testUser.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("email taken", func(t *testing.T) {
-		mock.ExpectExec("UPDATE users SET").WithArgs(
-			testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password,
-			testUser.Email, testUser.Country, sqlmock.AnyArg(), testUser.ID,
-		).WillReturnError(errors.New("unique constraint email"))
+		testUser := newTestUser()
+		expectUpdate(testUser).WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"})
 
 		err := repo.Update(ctx, testUser)
 		assert.Equal(t, user.ErrEmailTaken, err)
@@ -290,10 +408,8 @@ func TestUserRepository_Update(t *testing.T) {
 	})
 
 	t.Run("nickname taken", func(t *testing.T) {
-		mock.ExpectExec("UPDATE users SET").WithArgs(
-			testUser.FirstName, testUser.LastName, testUser.Nickname, testUser.Password,
-			testUser.Email, testUser.Country, sqlmock.AnyArg(), testUser.ID,
-		).WillReturnError(errors.New("unique constraint nickname"))
+		testUser := newTestUser()
+		expectUpdate(testUser).WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_nickname_key"})
 
 		err := repo.Update(ctx, testUser)
 		assert.Equal(t, user.ErrNicknameTaken, err)
@@ -301,16 +417,40 @@ func TestUserRepository_Update(t *testing.T) {
 	})
 }
 
+func TestUserRepository_SetCountry(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+	require.NoError(t, err)
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	defer db.Close()
+
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
+	moved, deleted := uuid.New(), uuid.New()
+
+	rows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "role", "version", "created_at", "updated_at"}).
+		AddRow(moved, "John", "Doe", "johndoe", "hash", "john@example.com", "RS", "player", 2, time.Now(), time.Now())
+	mock.ExpectQuery(`UPDATE users SET country = \$1, updated_at = \$2, version = version \+ 1 WHERE id = ANY\(\$3::uuid\[\]\) AND deleted_at IS NULL RETURNING \*`).
+		WithArgs("RS", sqlmock.AnyArg(), []string{moved.String(), deleted.String()}).
+		WillReturnRows(rows)
+
+	users, err := repo.SetCountry(context.Background(), []uuid.UUID{moved, deleted}, "RS")
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, moved, users[0].ID)
+	assert.Equal(t, "RS", users[0].Country)
+	assert.Equal(t, int64(2), users[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestUserRepository_Delete(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewUserRepository(db)
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
 	ctx := context.Background()
 	userID := uuid.New()
 
 	t.Run("success", func(t *testing.T) {
-		mock.ExpectExec("DELETE FROM users WHERE id = \\$1").WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
 
 		err := repo.Delete(ctx, userID)
 		assert.NoError(t, err)
@@ -318,7 +458,7 @@ func TestUserRepository_Delete(t *testing.T) {
 	})
 
 	t.Run("not found", func(t *testing.T) {
-		mock.ExpectExec("DELETE FROM users WHERE id = \\$1").WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 0))
 
 		err := repo.Delete(ctx, userID)
 		assert.Error(t, err)
@@ -327,7 +467,7 @@ func TestUserRepository_Delete(t *testing.T) {
 	})
 
 	t.Run("database error", func(t *testing.T) {
-		mock.ExpectExec("DELETE FROM users WHERE id = \\$1").WithArgs(userID).WillReturnError(errors.New("database error"))
+		mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), userID).WillReturnError(errors.New("database error"))
 
 		err := repo.Delete(ctx, userID)
 		assert.Error(t, err)
@@ -336,11 +476,195 @@ func TestUserRepository_Delete(t *testing.T) {
 	})
 }
 
+func TestUserRepository_WithTx(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{TxMaxRetries: 1}))
+	ctx := context.Background()
+	userID := uuid.New()
+
+	t.Run("runs repository calls in a transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.WithTx(ctx, func(ctx context.Context, txRepo user.Repository) error {
+			return txRepo.Delete(ctx, userID)
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("retries a serialization failure", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), userID).WillReturnError(&pgconn.PgError{Code: "40001"})
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), userID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.WithTx(ctx, func(ctx context.Context, txRepo user.Repository) error {
+			return txRepo.Delete(ctx, userID)
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserRepository_Restore(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
+	ctx := context.Background()
+	userID := uuid.New()
+	deletedAfter := time.Now().UTC().Add(-24 * time.Hour)
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectExec("UPDATE users SET deleted_at = NULL").WithArgs(sqlmock.AnyArg(), userID, deletedAfter).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.Restore(ctx, userID, deletedAfter)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("not deleted or grace period expired", func(t *testing.T) {
+		mock.ExpectExec("UPDATE users SET deleted_at = NULL").WithArgs(sqlmock.AnyArg(), userID, deletedAfter).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.Restore(ctx, userID, deletedAfter)
+		assert.Equal(t, user.ErrNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectExec("UPDATE users SET deleted_at = NULL").WithArgs(sqlmock.AnyArg(), userID, deletedAfter).WillReturnError(errors.New("database error"))
+
+		err := repo.Restore(ctx, userID, deletedAfter)
+		assert.Error(t, err)
+		assert.NotEqual(t, user.ErrNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserRepository_Purge(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
+	ctx := context.Background()
+	deletedBefore := time.Now().UTC().Add(-30 * 24 * time.Hour)
+	deletedAt := deletedBefore.Add(-time.Hour)
+
+	t.Run("success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "email", "nickname", "deleted_at"}).
+			AddRow(uuid.New(), "gone@example.com", "gone", deletedAt)
+		mock.ExpectQuery("DELETE FROM users WHERE id IN").WithArgs(deletedBefore, 100).WillReturnRows(rows)
+
+		users, err := repo.Purge(ctx, deletedBefore, 100)
+		assert.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.Equal(t, "gone@example.com", users[0].Email)
+		require.NotNil(t, users[0].DeletedAt)
+		assert.True(t, deletedAt.Equal(*users[0].DeletedAt))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectQuery("DELETE FROM users WHERE id IN").WithArgs(deletedBefore, 100).WillReturnError(errors.New("database error"))
+
+		_, err := repo.Purge(ctx, deletedBefore, 100)
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserRepository_Erase(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
+	ctx := context.Background()
+	userID := uuid.New()
+
+	t.Run("success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "email", "nickname"}).AddRow(userID, "gone@example.com", "gone")
+		mock.ExpectQuery("DELETE FROM users WHERE id = \\$1").WithArgs(userID).WillReturnRows(rows)
+
+		u, err := repo.Erase(ctx, userID)
+		assert.NoError(t, err)
+		require.NotNil(t, u)
+		assert.Equal(t, "gone@example.com", u.Email)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectQuery("DELETE FROM users WHERE id = \\$1").WithArgs(userID).WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.Erase(ctx, userID)
+		assert.Equal(t, user.ErrNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectQuery("DELETE FROM users WHERE id = \\$1").WithArgs(userID).WillReturnError(errors.New("database error"))
+
+		_, err := repo.Erase(ctx, userID)
+		assert.Error(t, err)
+		assert.NotEqual(t, user.ErrNotFound, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserRepository_Search(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "email", "nickname", "score"}).
+			AddRow(uuid.New(), "john@example.com", "john", 1.5).
+			AddRow(uuid.New(), "johnny@example.com", "johnny", 0.67)
+		mock.ExpectQuery(`SELECT users\.\*, .+ AS score FROM users WHERE deleted_at IS NULL AND .+ ORDER BY score DESC, id LIMIT \$2`).
+			WithArgs("john", 10).
+			WillReturnRows(rows)
+
+		results, err := repo.Search(ctx, "john", 10)
+		assert.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, "john", results[0].User.Nickname)
+		assert.Equal(t, 1.5, results[0].Score)
+		assert.Equal(t, "johnny@example.com", results[1].User.Email)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		mock.ExpectQuery("SELECT users").WithArgs("nobody", 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "score"}))
+
+		results, err := repo.Search(ctx, "nobody", 10)
+		assert.NoError(t, err)
+		assert.Empty(t, results)
+		assert.NotNil(t, results)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectQuery("SELECT users").WithArgs("john", 10).WillReturnError(errors.New("database error"))
+
+		_, err := repo.Search(ctx, "john", 10)
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
 func TestUserRepository_List(t *testing.T) {
 	db, mock := newMockDB(t)
 	defer db.Close()
 
-	repo := NewUserRepository(db)
+	repo := NewUserRepository(db, NewTransactor(db, &config.DBConfig{}))
 	ctx := context.Background()
 
 	testUsers := []user.User{
@@ -370,21 +694,22 @@ func TestUserRepository_List(t *testing.T) {
 
 	t.Run("list all users", func(t *testing.T) {
 		params := user.ListParams{
-			Limit:     10,
-			Offset:    0,
-			OrderBy:   "created_at",
-			OrderDesc: true,
+			Limit:        10,
+			Offset:       0,
+			OrderBy:      "created_at",
+			OrderDesc:    true,
+			IncludeTotal: true,
 		}
 
 		countRows := sqlmock.NewRows([]string{"count"}).AddRow(2)
 		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users`).WillReturnRows(countRows)
 
-		userRows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "created_at", "updated_at"})
+		userRows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "role", "created_at", "updated_at"})
 		for _, u := range testUsers {
-			userRows.AddRow(u.ID, u.FirstName, u.LastName, u.Nickname, u.Password, u.Email, u.Country, u.CreatedAt, u.UpdatedAt)
+			userRows.AddRow(u.ID, u.FirstName, u.LastName, u.Nickname, u.Password, u.Email, u.Country, u.Role, u.CreatedAt, u.UpdatedAt)
 		}
 
-		mock.ExpectQuery("SELECT \\* FROM users ORDER BY created_at DESC LIMIT \\$1 OFFSET \\$2").WithArgs(params.Limit, params.Offset).WillReturnRows(userRows)
+		mock.ExpectQuery("SELECT \\* FROM users WHERE deleted_at IS NULL ORDER BY created_at DESC, id DESC LIMIT \\$1 OFFSET \\$2").WithArgs(params.Limit, params.Offset).WillReturnRows(userRows)
 
 		users, count, err := repo.List(ctx, params)
 		assert.NoError(t, err)
@@ -395,25 +720,26 @@ func TestUserRepository_List(t *testing.T) {
 
 	t.Run("list with filters", func(t *testing.T) {
 		params := user.ListParams{
-			Limit:     10,
-			Offset:    0,
-			OrderBy:   "created_at",
-			OrderDesc: true,
+			Limit:        10,
+			Offset:       0,
+			OrderBy:      "created_at",
+			OrderDesc:    true,
+			IncludeTotal: true,
 			Filters: []user.Filter{
 				{Field: "country", Value: "US"},
 			},
 		}
 
 		countRows := sqlmock.NewRows([]string{"count"}).AddRow(1)
-		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE country ILIKE \$1`).WithArgs("%US%").WillReturnRows(countRows)
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE deleted_at IS NULL AND country ILIKE \$1`).WithArgs("%US%").WillReturnRows(countRows)
 
-		userRows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "created_at", "updated_at"})
+		userRows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "role", "created_at", "updated_at"})
 		userRows.AddRow(
 			testUsers[0].ID, testUsers[0].FirstName, testUsers[0].LastName, testUsers[0].Nickname,
-			testUsers[0].Password, testUsers[0].Email, testUsers[0].Country, testUsers[0].CreatedAt, testUsers[0].UpdatedAt,
+			testUsers[0].Password, testUsers[0].Email, testUsers[0].Country, testUsers[0].Role, testUsers[0].CreatedAt, testUsers[0].UpdatedAt,
 		)
 
-		mock.ExpectQuery("SELECT \\* FROM users WHERE country ILIKE \\$1 ORDER BY created_at DESC LIMIT \\$2 OFFSET \\$3").WithArgs("%US%", params.Limit, params.Offset).WillReturnRows(userRows)
+		mock.ExpectQuery("SELECT \\* FROM users WHERE deleted_at IS NULL AND country ILIKE \\$1 ORDER BY created_at DESC, id DESC LIMIT \\$2 OFFSET \\$3").WithArgs("%US%", params.Limit, params.Offset).WillReturnRows(userRows)
 
 		users, count, err := repo.List(ctx, params)
 		assert.NoError(t, err)
@@ -425,21 +751,22 @@ func TestUserRepository_List(t *testing.T) {
 
 	t.Run("empty result", func(t *testing.T) {
 		params := user.ListParams{
-			Limit:     10,
-			Offset:    0,
-			OrderBy:   "created_at",
-			OrderDesc: true,
+			Limit:        10,
+			Offset:       0,
+			OrderBy:      "created_at",
+			OrderDesc:    true,
+			IncludeTotal: true,
 			Filters: []user.Filter{
 				{Field: "country", Value: "FR"},
 			},
 		}
 
 		countRows := sqlmock.NewRows([]string{"count"}).AddRow(0)
-		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE country ILIKE \$1`).WithArgs("%FR%").WillReturnRows(countRows)
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE deleted_at IS NULL AND country ILIKE \$1`).WithArgs("%FR%").WillReturnRows(countRows)
 
-		userRows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "created_at", "updated_at"})
+		userRows := sqlmock.NewRows([]string{"id", "first_name", "last_name", "nickname", "password_hash", "email", "country", "role", "created_at", "updated_at"})
 
-		mock.ExpectQuery("SELECT \\* FROM users WHERE country ILIKE \\$1 ORDER BY created_at DESC LIMIT \\$2 OFFSET \\$3").WithArgs("%FR%", params.Limit, params.Offset).WillReturnRows(userRows)
+		mock.ExpectQuery("SELECT \\* FROM users WHERE deleted_at IS NULL AND country ILIKE \\$1 ORDER BY created_at DESC, id DESC LIMIT \\$2 OFFSET \\$3").WithArgs("%FR%", params.Limit, params.Offset).WillReturnRows(userRows)
 
 		users, count, err := repo.List(ctx, params)
 		assert.NoError(t, err)
@@ -450,10 +777,11 @@ func TestUserRepository_List(t *testing.T) {
 
 	t.Run("database error", func(t *testing.T) {
 		params := user.ListParams{
-			Limit:     10,
-			Offset:    0,
-			OrderBy:   "created_at",
-			OrderDesc: true,
+			Limit:        10,
+			Offset:       0,
+			OrderBy:      "created_at",
+			OrderDesc:    true,
+			IncludeTotal: true,
 		}
 
 		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users`).WillReturnError(errors.New("database error"))
@@ -464,4 +792,140 @@ func TestUserRepository_List(t *testing.T) {
 		assert.Len(t, users, 0)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
+
+	t.Run("without total count", func(t *testing.T) {
+		params := user.ListParams{
+			Limit:     10,
+			Offset:    20,
+			OrderBy:   "nickname",
+			OrderDesc: false,
+		}
+
+		userRows := sqlmock.NewRows([]string{"id", "nickname"}).AddRow(testUsers[0].ID, testUsers[0].Nickname)
+		mock.ExpectQuery("SELECT \\* FROM users WHERE deleted_at IS NULL ORDER BY nickname ASC, id ASC LIMIT \\$1 OFFSET \\$2").WithArgs(10, 20).WillReturnRows(userRows)
+
+		users, count, err := repo.List(ctx, params)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), count)
+		assert.Len(t, users, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("keyset after cursor", func(t *testing.T) {
+		after := &user.Cursor{
+			OrderBy: "created_at",
+			Desc:    true,
+			Value:   testUsers[0].CreatedAt.Format(time.RFC3339Nano),
+			ID:      testUsers[0].ID,
+		}
+		params := user.ListParams{
+			Limit:     10,
+			OrderBy:   "created_at",
+			OrderDesc: true,
+			After:     after,
+			Filters: []user.Filter{
+				{Field: "country", Value: "UK"},
+			},
+		}
+
+		userRows := sqlmock.NewRows([]string{"id", "nickname", "country"}).AddRow(testUsers[1].ID, testUsers[1].Nickname, testUsers[1].Country)
+		mock.ExpectQuery("SELECT \\* FROM users WHERE deleted_at IS NULL AND country ILIKE \\$1 AND \\(created_at, id\\) < \\(\\$2, \\$3\\) ORDER BY created_at DESC, id DESC LIMIT \\$4$").
+			WithArgs("%UK%", testUsers[0].CreatedAt, testUsers[0].ID, 10).WillReturnRows(userRows)
+
+		users, _, err := repo.List(ctx, params)
+		assert.NoError(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, testUsers[1].ID, users[0].ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("malformed cursor value", func(t *testing.T) {
+		params := user.ListParams{
+			Limit:   10,
+			OrderBy: "created_at",
+			After:   &user.Cursor{OrderBy: "created_at", Value: "yesterday", ID: uuid.New()},
+		}
+
+		_, _, err := repo.List(ctx, params)
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestFilterCondition(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		filter   user.Filter
+		want     string
+		wantArgs []interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "eq",
+			filter:   user.Filter{Field: "country", Operator: user.OpEq, Value: "DE"},
+			want:     "country = $3",
+			wantArgs: []interface{}{"DE"},
+		},
+		{
+			name:     "neq",
+			filter:   user.Filter{Field: "country", Operator: user.OpNeq, Value: "DE"},
+			want:     "country <> $3",
+			wantArgs: []interface{}{"DE"},
+		},
+		{
+			name:     "prefix escapes wildcards",
+			filter:   user.Filter{Field: "nickname", Operator: user.OpPrefix, Value: "jo_n%"},
+			want:     "nickname ILIKE $3",
+			wantArgs: []interface{}{`jo\_n\%%`},
+		},
+		{
+			name:     "contains",
+			filter:   user.Filter{Field: "email", Operator: user.OpContains, Value: "example"},
+			want:     "email ILIKE $3",
+			wantArgs: []interface{}{"%example%"},
+		},
+		{
+			name:     "in",
+			filter:   user.Filter{Field: "country", Operator: user.OpIn, Values: []string{"DE", "FR"}},
+			want:     "country IN ($3, $4)",
+			wantArgs: []interface{}{"DE", "FR"},
+		},
+		{
+			name:     "gt on timestamp",
+			filter:   user.Filter{Field: "created_at", Operator: user.OpGt, Value: "2024-01-01T00:00:00Z"},
+			want:     "created_at > $3",
+			wantArgs: []interface{}{since},
+		},
+		{
+			name:     "lt on timestamp",
+			filter:   user.Filter{Field: "updated_at", Operator: user.OpLt, Value: "2024-01-01T00:00:00Z"},
+			want:     "updated_at < $3",
+			wantArgs: []interface{}{since},
+		},
+		{
+			name:    "malformed timestamp",
+			filter:  user.Filter{Field: "created_at", Operator: user.OpGt, Value: "yesterday"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown operator",
+			filter:  user.Filter{Field: "country", Operator: "like", Value: "DE"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args, err := filterCondition(tt.filter, 3)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
 }
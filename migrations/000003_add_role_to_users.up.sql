@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'player'
+    CONSTRAINT users_role_check CHECK (role IN ('player', 'moderator', 'admin'));
+
+CREATE INDEX users_role_idx ON users (role);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS users_search_tsv_idx;
+DROP INDEX IF EXISTS users_email_local_trgm_idx;
+DROP INDEX IF EXISTS users_last_name_trgm_idx;
+DROP INDEX IF EXISTS users_first_name_trgm_idx;
+DROP INDEX IF EXISTS users_nickname_trgm_idx;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX users_nickname_trgm_idx ON users USING GIN (nickname gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX users_first_name_trgm_idx ON users USING GIN (first_name gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX users_last_name_trgm_idx ON users USING GIN (last_name gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX users_email_local_trgm_idx ON users USING GIN (split_part(email, '@', 1) gin_trgm_ops) WHERE deleted_at IS NULL;
+
+CREATE INDEX users_search_tsv_idx ON users USING GIN ((
+    setweight(to_tsvector('simple', nickname), 'A') ||
+    setweight(to_tsvector('simple', first_name || ' ' || last_name), 'B') ||
+    setweight(to_tsvector('simple', split_part(email, '@', 1)), 'C')
+)) WHERE deleted_at IS NULL;
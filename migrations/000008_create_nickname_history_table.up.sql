@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS nickname_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    nickname VARCHAR(50) NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX nickname_history_nickname_idx ON nickname_history (nickname, changed_at DESC);
+CREATE INDEX nickname_history_user_id_idx ON nickname_history (user_id, changed_at DESC);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN banned_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN ban_reason TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL schema migrations so the server binary
+// can apply them without the migrate CLI
+package migrations
+
+import "embed"
+
+// FS holds the NNNNNN_name.up.sql and NNNNNN_name.down.sql migration files
+//
+//go:embed *.sql
+var FS embed.FS